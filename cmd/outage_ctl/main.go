@@ -0,0 +1,145 @@
+// Command outage_ctl lets operators enter outages they learned about by
+// phone or from building managers:
+//
+//	outage_ctl report -location რუსთავი -start 2023-10-18T10:00:00+04:00 -address "მესხიშვილის ქ."
+//	outage_ctl update -id 3f2a... -location რუსთავი -start ... -end ... -address ...
+//	outage_ctl close -id 3f2a...
+//
+// The monitor address and the operator token come from OUTAGE_MONITOR_URL
+// and OUTAGE_MONITOR_TOKEN.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type addresses []string
+
+func (a *addresses) String() string {
+	return strings.Join(*a, "; ")
+}
+
+func (a *addresses) Set(addr string) error {
+	*a = append(*a, addr)
+	return nil
+}
+
+type manualOutage struct {
+	LocationGe        string    `json:"locationGe"`
+	AddressesGe       []string  `json:"addressesGe"`
+	Start             time.Time `json:"start"`
+	End               time.Time `json:"end"`
+	AffectedCustomers int       `json:"affectedCustomers"`
+}
+
+var errUsage = errors.New("usage: outage_ctl report|update|close [flags]")
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("outage_ctl: %w", err)
+	}
+	if len(args) == 0 {
+		return handleErr(errUsage)
+	}
+	monitorURL := os.Getenv("OUTAGE_MONITOR_URL")
+	if monitorURL == "" {
+		monitorURL = "http://localhost:8080"
+	}
+	endpoint, err := url.JoinPath(monitorURL, "/water/outages")
+	if err != nil {
+		return handleErr(err)
+	}
+	var (
+		fs                = flag.NewFlagSet(args[0], flag.ContinueOnError)
+		id                = fs.String("id", "", "id of the outage to update or close")
+		location          = fs.String("location", "", "service center or town, in Georgian")
+		start             = fs.String("start", "", "start, RFC 3339")
+		end               = fs.String("end", "", "end, RFC 3339; leave empty when unknown")
+		affectedCustomers = fs.Int("customers", 0, "affected customers")
+		addrs             addresses
+	)
+	fs.Var(&addrs, "address", "affected address, in Georgian; repeat for several")
+	if err := fs.Parse(args[1:]); err != nil {
+		return handleErr(err)
+	}
+	var (
+		method string
+		body   io.Reader
+	)
+	switch args[0] {
+	case "report", "update":
+		method = http.MethodPost
+		if args[0] == "update" {
+			method = http.MethodPut
+		}
+		o := manualOutage{
+			LocationGe:        *location,
+			AddressesGe:       addrs,
+			AffectedCustomers: *affectedCustomers,
+		}
+		if o.Start, err = time.Parse(time.RFC3339, *start); err != nil {
+			return handleErr(fmt.Errorf("start: %w", err))
+		}
+		if *end != "" {
+			if o.End, err = time.Parse(time.RFC3339, *end); err != nil {
+				return handleErr(fmt.Errorf("end: %w", err))
+			}
+		}
+		rawBody, err := json.Marshal(o)
+		if err != nil {
+			return handleErr(err)
+		}
+		body = bytes.NewReader(rawBody)
+	case "close":
+		method = http.MethodDelete
+	default:
+		return handleErr(errUsage)
+	}
+	if method != http.MethodPost {
+		if *id == "" {
+			return handleErr(errors.New("-id is required"))
+		}
+		endpoint += "?" + url.Values{"id": {*id}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return handleErr(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("OUTAGE_MONITOR_TOKEN"))
+	req.Header.Set("Content-Type", "application/json")
+	c := http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer resp.Body.Close()
+	rawResp, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return handleErr(err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return handleErr(fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(rawResp)))
+	}
+	_, err = out.Write(rawResp)
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/migrate"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+)
+
+// commands run instead of the server when named by the first argument:
+//
+//	outage_monitor restore [prefix]
+//	outage_monitor migrate -from dynamo -to sqlite:file:outages.db [-checkpoint path] [-dry-run]
+var commands = map[string]func(ctx context.Context, cfg config, args []string, sl *slog.Logger) error{
+	"restore": restore,
+	"migrate": migrateBackends,
+}
+
+// registeredProviderIds lists the providers the server would refresh, whose
+// tables the commands read and write.
+func registeredProviderIds(ctx context.Context, cfg config, sl *slog.Logger) ([]string, error) {
+	waterGovGeParser, err := parser.NewWaterGovGe(sl)
+	if err != nil {
+		return nil, err
+	}
+	registrations, err := injectProviders(ctx, cfg, waterGovGeParser, sl)
+	if err != nil {
+		return nil, err
+	}
+	providerIds := make([]string, len(registrations))
+	for i, reg := range registrations {
+		providerIds[i] = reg.Provider.Id()
+	}
+	return providerIds, nil
+}
+
+// restore loads the archive partitions under the prefix given as the only
+// argument, or the whole archive without one, back into the configured
+// repo. The repo is opened without retention so the restored outages do
+// not expire again.
+func restore(ctx context.Context, cfg config, args []string, sl *slog.Logger) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("restore: %w", err)
+	}
+	prefix := "outages/"
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+	providerIds, err := registeredProviderIds(ctx, cfg, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	cfg.RetentionDays = 0
+	store, err := injectRepo(ctx, cfg, providerIds, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	archiver, err := injectArchiver(ctx, cfg, store, providerIds, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	restored, err := archiver.Restore(ctx, store, prefix)
+	if err != nil {
+		return handleErr(err)
+	}
+	if memory, ok := store.(repo.Memory); ok {
+		if err := memory.Snapshot(); err != nil {
+			return handleErr(err)
+		}
+	}
+	sl.Info("restored archive", slog.String("prefix", prefix), slog.Int("outages", restored))
+	return nil
+}
+
+// migrateBackends copies the data of one backend into another. Backends
+// are named dynamo, memory:<snapshot path>, sqlite:<dsn>, postgres:<url>
+// or jsonl:<path>; dynamo takes its settings from the environment. The
+// report comparing both sides is printed as JSON.
+func migrateBackends(ctx context.Context, cfg config, args []string, sl *slog.Logger) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	var (
+		fs             = flag.NewFlagSet("migrate", flag.ContinueOnError)
+		from           = fs.String("from", "", "backend to copy from")
+		to             = fs.String("to", "", "backend to copy to")
+		checkpointPath = fs.String("checkpoint", "migrate.checkpoint.json", "file the progress is kept in to resume an interrupted run")
+		dryRun         = fs.Bool("dry-run", false, "only compare the backends")
+	)
+	if err := fs.Parse(args); err != nil {
+		return handleErr(err)
+	}
+	if *from == "" || *to == "" {
+		return handleErr(fmt.Errorf("-from and -to are required"))
+	}
+	providerIds, err := registeredProviderIds(ctx, cfg, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	source, _, err := openBackend(ctx, cfg, *from, providerIds, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	target, flush, err := openBackend(ctx, cfg, *to, providerIds, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	report, runErr := migrate.NewMigrator(source, target, providerIds, *checkpointPath, sl).Run(ctx, *dryRun)
+	if !*dryRun {
+		if err := flush(); err != nil {
+			return handleErr(err)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return handleErr(err)
+	}
+	return runErr
+}
+
+// openBackend opens a backend for migrating without retention, so copied
+// outages do not expire, and returns what writes it out when it is kept in
+// memory.
+func openBackend(ctx context.Context, cfg config, spec string, providerIds []string, sl *slog.Logger) (migrate.Target, func() error, error) {
+	noFlush := func() error {
+		return nil
+	}
+	kind, dsn, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "dynamo":
+		cfg.StorageBackend, cfg.RetentionDays = "dynamo", 0
+		store, err := injectRepo(ctx, cfg, providerIds, sl)
+		return store, noFlush, err
+	case "memory":
+		memory, err := repo.NewMemory(dsn, time.Now, sl)
+		return memory, memory.Snapshot, err
+	case repo.DriverSQLite, repo.DriverPostgres:
+		store, err := repo.NewSQL(ctx, kind, dsn, time.Now, sl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := store.Migrate(ctx); err != nil {
+			return nil, nil, err
+		}
+		return store, noFlush, nil
+	case "jsonl":
+		jsonl, err := migrate.NewJSONL(dsn)
+		return jsonl, jsonl.Flush, err
+	}
+	return nil, nil, fmt.Errorf("unknown backend %q", spec)
+}
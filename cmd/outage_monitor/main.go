@@ -8,12 +8,21 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/cristalhq/aconfig"
+	"github.com/doesnotcommit/outage_monitor/internal/archive"
+	"github.com/doesnotcommit/outage_monitor/internal/cron"
 	"github.com/doesnotcommit/outage_monitor/internal/handlers"
+	"github.com/doesnotcommit/outage_monitor/internal/migrate"
+	"github.com/doesnotcommit/outage_monitor/internal/notify"
 	"github.com/doesnotcommit/outage_monitor/internal/outage"
 	"github.com/doesnotcommit/outage_monitor/internal/parser"
+	"github.com/doesnotcommit/outage_monitor/internal/parser/declarative"
+	"github.com/doesnotcommit/outage_monitor/internal/parser/electricity"
+	"github.com/doesnotcommit/outage_monitor/internal/parser/gas"
 	"github.com/doesnotcommit/outage_monitor/internal/plugin"
 	"github.com/doesnotcommit/outage_monitor/internal/repo"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,10 +30,62 @@ import (
 )
 
 type config struct {
-	LogLevel              int `default:"-4"`
-	DynamoAccessKey       string
-	DynamoSecretAccessKey string
-	DynamoRegion          string
+	LogLevel                   int `default:"-4"`
+	DynamoAccessKey            string
+	DynamoSecretAccessKey      string
+	DynamoRegion               string
+	DynamoEndpoint             string
+	DynamoTablePrefix          string
+	DynamoEnsureTables         bool `default:"true"`
+	ChangeFeed                 bool
+	ReplicaId                  string
+	StorageBackend             string `default:"dynamo"`
+	DatabaseURL                string
+	SnapshotPath               string
+	SnapshotInterval           time.Duration `default:"5m"`
+	WaterRefreshInterval       time.Duration `default:"1h"`
+	TelasiBaseURI              string        `default:"https://www.telasi.ge"`
+	EnergoProBaseURI           string        `default:"https://www.energo-pro.ge"`
+	ElectricityRefreshInterval time.Duration `default:"30m"`
+	TbilisiEnergyBaseURI       string        `default:"https://www.tbilisienergy.ge"`
+	GasRefreshInterval         time.Duration `default:"6h"`
+	ProviderDefinitionsDir     string
+	ExternalProviders          []string
+	ExternalProviderTimeout    time.Duration `default:"30s"`
+	ExternalRefreshInterval    time.Duration `default:"1h"`
+	RefreshCrons               string
+	RefreshTimezone            string        `default:"Asia/Tbilisi"`
+	ActiveRefreshInterval      time.Duration `default:"10m"`
+	NearEndWindow              time.Duration `default:"30m"`
+	RefreshJitter              time.Duration `default:"1m"`
+	RefreshMaxBackoff          time.Duration `default:"6h"`
+	RefreshTriggerPoll         time.Duration `default:"10s"`
+	Operators                  []string
+	Reporters                  []string
+	ReportsPerReporter         int           `default:"10"`
+	ReportWindow               time.Duration `default:"1h"`
+	RetentionDays              int
+	ArchiveInterval            time.Duration `default:"24h"`
+	ArchiveDir                 string
+	ArchiveS3Endpoint          string
+	ArchiveS3Region            string
+	ArchiveS3Bucket            string
+	ArchiveS3AccessKey         string
+	ArchiveS3SecretAccessKey   string
+	NotifyWebhookURLs          []string
+	NotifyTimeout              time.Duration `default:"10s"`
+	DispatchInterval           time.Duration `default:"30s"`
+	LeaderElection             bool
+	LeaderLeaseTTL             time.Duration `default:"15s"`
+}
+
+// repository is what the service needs from storage plus what the archive
+// exports from and the leader lease.
+type repository interface {
+	outage.Repo
+	archive.Source
+	migrate.Source
+	outage.Leases
 }
 
 func main() {
@@ -40,6 +101,15 @@ func main() {
 		Level:     slog.Level(cfg.LogLevel),
 	}))
 	ctx := context.Background()
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			if err := command(ctx, cfg, os.Args[2:], sl); err != nil {
+				sl.Error(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	if err := run(ctx, cfg, sl); err != nil {
 		sl.Error(err.Error())
 		os.Exit(1)
@@ -52,40 +122,357 @@ func run(ctx context.Context, cfg config, sl *slog.Logger) error {
 	}
 	ctx, cancelCtx := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancelCtx()
-	handleWater, err := injectWater(ctx, cfg, sl)
+	handlers, registry, err := inject(ctx, cfg, sl)
 	if err != nil {
 		return handleErr(err)
 	}
-	handlers := map[string]http.HandlerFunc{
-		"/water": handleWater,
-	}
+	defer registry.Close()
 	handleHTTP(ctx, handlers, sl)
 	return nil
 }
 
-func injectWater(ctx context.Context, cfg config, sl *slog.Logger) (http.HandlerFunc, error) {
-	handleErr := func(err error) (http.HandlerFunc, error) {
-		return nil, fmt.Errorf("inject water: %w", err)
+// inject wires the service and its HTTP handlers. The registry is handed
+// back so that its providers can be closed on shutdown.
+func inject(ctx context.Context, cfg config, sl *slog.Logger) (map[string]http.HandlerFunc, outage.Registry, error) {
+	handleErr := func(err error) (map[string]http.HandlerFunc, outage.Registry, error) {
+		return nil, outage.Registry{}, fmt.Errorf("inject: %w", err)
 	}
-	ctx, cancelCtx := signal.NotifyContext(ctx, os.Interrupt)
-	defer cancelCtx()
 	waterGovGeParser, err := parser.NewWaterGovGe(sl)
 	if err != nil {
 		return handleErr(err)
 	}
-	waterGovGePlugin := plugin.NewWaterGovGe(waterGovGeParser)
-	dynamo, err := repo.NewDynamoWaterGovGe(ctx, cfg.DynamoAccessKey, cfg.DynamoSecretAccessKey, cfg.DynamoRegion, time.Now, sl)
+	registrations, err := injectProviders(ctx, cfg, waterGovGeParser, sl)
 	if err != nil {
 		return handleErr(err)
 	}
-	s := outage.NewService(ctx, waterGovGePlugin, dynamo, time.Hour, sl)
-	go s.StartRefreshingData(ctx)
-	h := handlers.NewHTTP(s, sl)
-	handlers := map[string]http.HandlerFunc{
-		"/water": h.HandleWater,
+	if registrations, err = withSchedules(cfg, registrations); err != nil {
+		return handleErr(err)
 	}
-	handleHTTP(ctx, handlers, sl)
-	return h.HandleWater, nil
+	registry, err := outage.NewRegistry(registrations...)
+	if err != nil {
+		return handleErr(err)
+	}
+	providerIds := make([]string, len(registrations))
+	for i, reg := range registrations {
+		providerIds[i] = reg.Provider.Id()
+	}
+	store, err := injectRepo(ctx, cfg, providerIds, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	// works run on the leader only when LeaderElection is on; everything
+	// else, the HTTP API included, runs on every replica.
+	var works []func(ctx context.Context)
+	if cfg.RetentionDays > 0 {
+		archiver, err := injectArchiver(ctx, cfg, store, providerIds, sl)
+		if err != nil {
+			return handleErr(err)
+		}
+		works = append(works, func(ctx context.Context) {
+			if err := archiver.StartExporting(ctx, cfg.ArchiveInterval); err != nil {
+				sl.Error(err.Error())
+			}
+		})
+	}
+	s := outage.NewService(registry, store, outage.NewReportLimiter(cfg.ReportsPerReporter, cfg.ReportWindow), time.Now, sl).
+		WithTriggerPoll(cfg.RefreshTriggerPoll)
+	if len(cfg.NotifyWebhookURLs) > 0 {
+		dispatcher, err := injectDispatcher(cfg, store, sl)
+		if err != nil {
+			return handleErr(err)
+		}
+		s = s.WithOutbox()
+		works = append(works, func(ctx context.Context) {
+			dispatcher.StartDispatching(ctx, cfg.DispatchInterval)
+		})
+	}
+	if cfg.ChangeFeed {
+		feed, err := injectChangeFeed(ctx, cfg, store, providerIds)
+		if err != nil {
+			return handleErr(err)
+		}
+		s = s.WithChangeFeed()
+		go feed.Run(ctx, s.HandleChange)
+	}
+	works = append(works, s.StartRefreshingData)
+	if err := startWorks(ctx, cfg, store, works, sl); err != nil {
+		return handleErr(err)
+	}
+	operators, err := handlers.NewOperators(cfg.Operators...)
+	if err != nil {
+		return handleErr(err)
+	}
+	reporters, err := handlers.NewOperators(cfg.Reporters...)
+	if err != nil {
+		return handleErr(err)
+	}
+	h := handlers.NewHTTP(s, waterGovGeParser, operators, reporters, sl)
+	return map[string]http.HandlerFunc{
+		"/water":                 h.HandleWater,
+		"/water/centers":         h.HandleWaterCenters,
+		"/water/outages":         h.HandleWaterOutages,
+		"/water/outages/reports": h.HandleWaterReports,
+		"/water/outages/":        h.HandleWaterOutageHistory,
+		"/water/outages/search":  h.HandleWaterOutagesSearch,
+		"/water/outages/diff":    h.HandleWaterOutagesDiff,
+		"/debug/parse":           h.HandleDebugParse,
+		"/refresh":               h.HandleRefresh,
+		"/status":                h.HandleStatus,
+		"/status/runs":           h.HandleStatusRuns,
+	}, registry, nil
+}
+
+// withSchedules gives every provider the same adaptive schedule and, when
+// RefreshCrons names it, a cron schedule in place of its interval.
+// RefreshCrons holds "provider=expression" pairs separated by semicolons,
+// since the expressions have commas of their own, e.g.
+// "water.gov.ge=*/20 7-22 * * *;gas=0 8,20 * * *".
+func withSchedules(cfg config, registrations []outage.Registration) ([]outage.Registration, error) {
+	handleErr := func(err error) ([]outage.Registration, error) {
+		return nil, fmt.Errorf("with schedules: %w", err)
+	}
+	loc, err := time.LoadLocation(cfg.RefreshTimezone)
+	if err != nil {
+		return handleErr(err)
+	}
+	crons := make(map[string]cron.Schedule)
+	for _, pair := range strings.Split(cfg.RefreshCrons, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		providerId, expr, found := strings.Cut(pair, "=")
+		if !found {
+			return handleErr(fmt.Errorf("refresh cron %q must look like provider=expression", pair))
+		}
+		schedule, err := cron.Parse(expr, loc)
+		if err != nil {
+			return handleErr(err)
+		}
+		crons[strings.TrimSpace(providerId)] = schedule
+	}
+	for i, reg := range registrations {
+		schedule := crons[reg.Provider.Id()]
+		delete(crons, reg.Provider.Id())
+		registrations[i].Schedule = outage.Schedule{
+			Cron:           schedule,
+			ActiveInterval: cfg.ActiveRefreshInterval,
+			NearEnd:        cfg.NearEndWindow,
+			Jitter:         cfg.RefreshJitter,
+			MaxBackoff:     cfg.RefreshMaxBackoff,
+		}
+	}
+	for providerId := range crons {
+		return handleErr(fmt.Errorf("refresh cron for unknown provider %s", providerId))
+	}
+	return registrations, nil
+}
+
+// injectRepo picks the storage backend: dynamo, memory snapshotted to
+// SnapshotPath, or postgres and sqlite with DatabaseURL as the data source
+// name. SQL schemas are migrated on start, and so are Dynamo tables unless
+// DynamoEnsureTables is off. RetentionDays only expires Dynamo items; the
+// other backends keep everything. Memory cannot back LeaderElection, as its
+// leases are not shared between replicas.
+func injectRepo(ctx context.Context, cfg config, providerIds []string, sl *slog.Logger) (repository, error) {
+	handleErr := func(err error) (repository, error) {
+		return nil, fmt.Errorf("inject repo: %w", err)
+	}
+	if cfg.StorageBackend == "dynamo" {
+		dynamo, err := repo.NewDynamo(ctx, cfg.DynamoAccessKey, cfg.DynamoSecretAccessKey, cfg.DynamoRegion, cfg.DynamoEndpoint, cfg.DynamoTablePrefix, time.Now, sl)
+		if err != nil {
+			return handleErr(err)
+		}
+		dynamo = dynamo.WithRetention(retention(cfg))
+		if cfg.ChangeFeed {
+			dynamo = dynamo.WithStreams()
+		}
+		if cfg.DynamoEnsureTables {
+			if err := dynamo.EnsureTables(ctx, providerIds...); err != nil {
+				return handleErr(err)
+			}
+		}
+		return dynamo, nil
+	}
+	if cfg.StorageBackend == "memory" {
+		// Every replica would hold its own lease and lead.
+		if cfg.LeaderElection {
+			return handleErr(errors.New("leader election needs a backend replicas share, not memory"))
+		}
+		memory, err := repo.NewMemory(cfg.SnapshotPath, time.Now, sl)
+		if err != nil {
+			return handleErr(err)
+		}
+		go memory.StartSnapshotting(ctx, cfg.SnapshotInterval)
+		return memory, nil
+	}
+	store, err := repo.NewSQL(ctx, cfg.StorageBackend, cfg.DatabaseURL, time.Now, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	if err := store.Migrate(ctx); err != nil {
+		return handleErr(err)
+	}
+	return store, nil
+}
+
+// injectChangeFeed reads the streams of the Dynamo tables, leasing shards
+// as ReplicaId, the host name by default.
+func injectChangeFeed(ctx context.Context, cfg config, store repository, providerIds []string) (repo.DynamoChangeFeed, error) {
+	handleErr := func(err error) (repo.DynamoChangeFeed, error) {
+		return repo.DynamoChangeFeed{}, fmt.Errorf("inject change feed: %w", err)
+	}
+	dynamo, ok := store.(repo.Dynamo)
+	if !ok {
+		return handleErr(fmt.Errorf("change feed needs the dynamo backend, not %s", cfg.StorageBackend))
+	}
+	owner, err := replicaId(cfg)
+	if err != nil {
+		return handleErr(err)
+	}
+	feed, err := repo.NewDynamoChangeFeed(ctx, cfg.DynamoAccessKey, cfg.DynamoSecretAccessKey, cfg.DynamoRegion, cfg.DynamoEndpoint, dynamo, providerIds, owner)
+	if err != nil {
+		return handleErr(err)
+	}
+	return feed, nil
+}
+
+// startWorks runs the works under a leader lease with LeaderElection on,
+// and right away otherwise.
+func startWorks(ctx context.Context, cfg config, store repository, works []func(ctx context.Context), sl *slog.Logger) error {
+	if !cfg.LeaderElection {
+		for _, work := range works {
+			go work(ctx)
+		}
+		return nil
+	}
+	owner, err := replicaId(cfg)
+	if err != nil {
+		return fmt.Errorf("start works: %w", err)
+	}
+	leader, err := outage.NewLeader(store, "leader", owner, cfg.LeaderLeaseTTL, time.Now, sl)
+	if err != nil {
+		return fmt.Errorf("start works: %w", err)
+	}
+	go leader.Lead(ctx, works...)
+	return nil
+}
+
+// injectDispatcher delivers the outbox to the NotifyWebhookURLs, claiming
+// batches as ReplicaId, the host name by default.
+func injectDispatcher(cfg config, store repository, sl *slog.Logger) (outage.Dispatcher, error) {
+	owner, err := replicaId(cfg)
+	if err != nil {
+		return outage.Dispatcher{}, fmt.Errorf("inject dispatcher: %w", err)
+	}
+	webhook := notify.NewWebhook(&http.Client{Timeout: cfg.NotifyTimeout}, cfg.NotifyWebhookURLs...)
+	return outage.NewDispatcher(store, webhook, owner, time.Now, sl), nil
+}
+
+// replicaId names this replica in leases and outbox claims.
+func replicaId(cfg config) (string, error) {
+	if cfg.ReplicaId != "" {
+		return cfg.ReplicaId, nil
+	}
+	return os.Hostname()
+}
+
+func retention(cfg config) time.Duration {
+	return time.Duration(cfg.RetentionDays) * 24 * time.Hour
+}
+
+// injectArchiver archives to the S3 bucket when ArchiveS3Bucket is set and
+// to ArchiveDir otherwise.
+func injectArchiver(ctx context.Context, cfg config, source archive.Source, providerIds []string, sl *slog.Logger) (archive.Archiver, error) {
+	handleErr := func(err error) (archive.Archiver, error) {
+		return archive.Archiver{}, fmt.Errorf("inject archiver: %w", err)
+	}
+	var (
+		store archive.Store
+		err   error
+	)
+	if cfg.ArchiveS3Bucket != "" {
+		store, err = archive.NewS3(ctx, cfg.ArchiveS3Endpoint, cfg.ArchiveS3Region, cfg.ArchiveS3Bucket, cfg.ArchiveS3AccessKey, cfg.ArchiveS3SecretAccessKey)
+	} else {
+		store, err = archive.NewLocal(cfg.ArchiveDir)
+	}
+	if err != nil {
+		return handleErr(err)
+	}
+	return archive.NewArchiver(source, store, providerIds, retention(cfg), time.Now, sl), nil
+}
+
+func injectProviders(ctx context.Context, cfg config, waterGovGeParser parser.WaterGovGe, sl *slog.Logger) ([]outage.Registration, error) {
+	handleErr := func(err error) ([]outage.Registration, error) {
+		return nil, fmt.Errorf("inject providers: %w", err)
+	}
+	waterGovGeNewsParser, err := parser.NewWaterGovGeNews(sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	telasiParser, err := electricity.NewTelasi(cfg.TelasiBaseURI, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	energoProParser, err := electricity.NewEnergoPro(cfg.EnergoProBaseURI, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	tbilisiEnergyParser, err := gas.NewTbilisiEnergy(cfg.TbilisiEnergyBaseURI, sl)
+	if err != nil {
+		return handleErr(err)
+	}
+	// The parsers fetch through one transport that revalidates the pages
+	// they fetched before and counts pages for the refresh journal.
+	transport := parser.NewRefreshTransport(http.DefaultTransport)
+	registrations := []outage.Registration{
+		{
+			Provider: plugin.NewWaterGovGe(waterGovGeParser.WithTransport(transport), waterGovGeNewsParser.WithTransport(transport), sl),
+			Interval: cfg.WaterRefreshInterval,
+		},
+		{
+			Provider: plugin.NewElectricity(plugin.TelasiId, telasiParser.WithTransport(transport), time.Now),
+			Interval: cfg.ElectricityRefreshInterval,
+		},
+		{
+			Provider: plugin.NewElectricity(plugin.EnergoProId, energoProParser.WithTransport(transport), time.Now),
+			Interval: cfg.ElectricityRefreshInterval,
+		},
+		{
+			Provider: plugin.NewGas(plugin.TbilisiEnergyId, tbilisiEnergyParser.WithTransport(transport), time.Now),
+			Interval: cfg.GasRefreshInterval,
+		},
+	}
+	if cfg.ProviderDefinitionsDir != "" {
+		defs, err := declarative.LoadDefinitions(cfg.ProviderDefinitionsDir)
+		if err != nil {
+			return handleErr(err)
+		}
+		for _, def := range defs {
+			scraper, err := declarative.NewScraper(def, sl)
+			if err != nil {
+				return handleErr(err)
+			}
+			registrations = append(registrations, outage.Registration{
+				Provider: plugin.NewDeclarative(scraper.WithTransport(transport), time.Now),
+				Interval: def.Interval,
+			})
+		}
+	}
+	for _, target := range cfg.ExternalProviders {
+		external, err := plugin.NewExternal(ctx, target, cfg.ExternalProviderTimeout, time.Now, sl)
+		if err != nil {
+			return handleErr(err)
+		}
+		interval := external.Interval()
+		if interval <= 0 {
+			interval = cfg.ExternalRefreshInterval
+		}
+		registrations = append(registrations, outage.Registration{
+			Provider: external,
+			Interval: interval,
+		})
+	}
+	return registrations, nil
 }
 
 func handleHTTP(ctx context.Context, handlers map[string]http.HandlerFunc, sl *slog.Logger) {
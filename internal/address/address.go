@@ -0,0 +1,91 @@
+package address
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var translitTable = map[rune]string{
+	'ა': "a", 'ბ': "b", 'გ': "g",
+	'დ': "d", 'ე': "e", 'ვ': "v",
+	'ზ': "z", 'თ': "t", 'ი': "i",
+	'კ': "k'", 'ლ': "l", 'მ': "m",
+	'ნ': "n", 'ო': "o", 'პ': "p'",
+	'ჟ': "zh", 'რ': "r", 'ს': "s",
+	'ტ': "t'", 'უ': "u", 'ფ': "p",
+	'ქ': "k", 'ღ': "gh", 'ყ': "q",
+	'შ': "sh", 'ჩ': "ch", 'ც': "ts",
+	'ძ': "dz", 'წ': "ts'", 'ჭ': "ch'",
+	'ხ': "kh", 'ჯ': "j", 'ჰ': "h",
+}
+
+func Translit(ge string) string {
+	result := make([]rune, 0, len(ge))
+	for _, r := range ge {
+		tr, ok := translitTable[r]
+		if !ok {
+			tr = " "
+		}
+		result = append(result, []rune(tr)...)
+	}
+	return string(result)
+}
+
+var normalizeReplacer = strings.NewReplacer("№", "N ", " ", " ")
+
+// Normalize unescapes entities, collapses whitespace and trims list
+// separators so the same street reads the same across providers.
+func Normalize(addr string) string {
+	addr = normalizeReplacer.Replace(html.UnescapeString(addr))
+	addr = strings.Join(strings.Fields(addr), " ")
+	return strings.Trim(addr, " ,;")
+}
+
+// Split breaks a separator-delimited street list into normalized addresses.
+func Split(addrs string, separators string) []string {
+	var result []string
+	for _, addr := range strings.FieldsFunc(addrs, func(r rune) bool {
+		return strings.ContainsRune(separators, r)
+	}) {
+		if addr = Normalize(addr); addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// tokenStopwords are street-type words that match nearly every address.
+var tokenStopwords = map[string]bool{
+	"ქ": true, "ქუჩა": true, "გამზ": true, "გამზირი": true, "ჩიხი": true,
+	"შეს": true, "შესახვევი": true, "ხეივანი": true, "n": true,
+}
+
+// Tokens splits an address into the words worth indexing: punctuation is
+// dropped along with one-letter words and street types, and "N5" reads as
+// "5".
+func Tokens(addr string) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(Normalize(addr), func(r rune) bool {
+		return r == ' ' || r == '.' || r == ',' || r == ';' || r == '-'
+	}) {
+		word = strings.ToLower(word)
+		if number, found := strings.CutPrefix(word, "n"); found && number != "" && unicode.IsDigit([]rune(number)[0]) {
+			word = number
+		}
+		if utf8.RuneCountInString(word) < 2 && !unicode.IsDigit([]rune(word)[0]) || tokenStopwords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// TrimServiceCenter turns "ოზურგეთის სერვის ცენტრი" into "ოზურგეთის".
+func TrimServiceCenter(title string) string {
+	short, _ := strings.CutSuffix(strings.TrimSpace(title), " სერვის ცენტრი")
+	return short
+}
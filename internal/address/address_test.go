@@ -0,0 +1,27 @@
+package address
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tokens(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		addr string
+		want []string
+	}{
+		{"stopwords", "ვაჟა-ფშაველას გამზ. ჩიხი", []string{"ვაჟა", "ფშაველას"}},
+		{"number prefix", "პეკინის გამზ. N5", []string{"პეკინის", "5"}},
+		{"number sign", "პეკინის №41", []string{"პეკინის", "41"}},
+		{"detached number sign", "ნუცუბიძის ქ. N 3", []string{"ნუცუბიძის", "3"}},
+		{"one letter words", "ა კორპუსი ბ 7", []string{"კორპუსი", "7"}},
+		{"repeated words", "თამარ მეფის თამარ", []string{"თამარ", "მეფის"}},
+		{"nothing worth indexing", "ქ. N", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Tokens(tc.addr))
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+const partitionSuffix = ".jsonl.gz"
+
+// Source reads the outages of a provider that started in [from, to).
+type Source interface {
+	GetOutagesStartedBetween(ctx context.Context, providerId string, from, to time.Time) ([]outage.Outage, error)
+}
+
+type Saver interface {
+	SaveOutages(ctx context.Context, outages ...outage.Outage) error
+}
+
+// Archiver copies outages into gzipped JSON lines partitioned by provider
+// and month of start, e.g. outages/provider=water.gov.ge/month=2023-10.jsonl.gz.
+// Every export merges the outages still in the source into the partitions
+// of the months the retention reaches back to, so an outage is archived as
+// long as an export runs between its save and its expiry.
+type Archiver struct {
+	source      Source
+	store       Store
+	providerIds []string
+	retention   time.Duration
+	now         func() time.Time
+	sl          *slog.Logger
+}
+
+func NewArchiver(source Source, store Store, providerIds []string, retention time.Duration, now func() time.Time, sl *slog.Logger) Archiver {
+	return Archiver{source, store, providerIds, retention, now, sl}
+}
+
+// record is the archived form of an outage. Its fields are spelled out so
+// the archive does not change when Outage does.
+type record struct {
+	Id                string            `json:"id,omitempty"`
+	ProviderId        string            `json:"providerId"`
+	Key               string            `json:"key,omitempty"`
+	Kind              outage.Kind       `json:"kind"`
+	Start             time.Time         `json:"start"`
+	End               time.Time         `json:"end"`
+	AffectedCustomers int               `json:"affectedCustomers"`
+	LocationId        string            `json:"locationId"`
+	TitleGe           string            `json:"titleGe"`
+	TitleLat          string            `json:"titleLat"`
+	Lat               string            `json:"lat"`
+	Lng               string            `json:"lng"`
+	AddressesGe       []string          `json:"addressesGe"`
+	Status            outage.Status     `json:"status"`
+	AnnouncementURI   string            `json:"announcementUri,omitempty"`
+	Source            outage.Source     `json:"source"`
+	Reporter          string            `json:"reporter,omitempty"`
+	Extra             map[string]string `json:"extra,omitempty"`
+}
+
+func newRecord(o outage.Outage) record {
+	return record{
+		Id:                o.Id,
+		ProviderId:        o.ProviderId,
+		Key:               o.Key,
+		Kind:              o.Kind,
+		Start:             o.Start,
+		End:               o.End,
+		AffectedCustomers: o.AffectedCustomers,
+		LocationId:        o.Location.Id,
+		TitleGe:           o.Location.TitleGe,
+		TitleLat:          o.Location.TitleLat,
+		Lat:               o.Location.Lat,
+		Lng:               o.Location.Lng,
+		AddressesGe:       o.AddressesGe,
+		Status:            o.Status,
+		AnnouncementURI:   o.AnnouncementURI,
+		Source:            o.Source,
+		Reporter:          o.Reporter,
+		Extra:             o.Extra,
+	}
+}
+
+func (r record) outage() outage.Outage {
+	return outage.Outage{
+		Id:                r.Id,
+		ProviderId:        r.ProviderId,
+		Key:               r.Key,
+		Kind:              r.Kind,
+		Start:             r.Start,
+		End:               r.End,
+		AffectedCustomers: r.AffectedCustomers,
+		Location: outage.Location{
+			Id:       r.LocationId,
+			TitleGe:  r.TitleGe,
+			TitleLat: r.TitleLat,
+			Lat:      r.Lat,
+			Lng:      r.Lng,
+		},
+		AddressesGe:     r.AddressesGe,
+		Status:          r.Status,
+		AnnouncementURI: r.AnnouncementURI,
+		Source:          r.Source,
+		Reporter:        r.Reporter,
+		Extra:           r.Extra,
+	}
+}
+
+func partitionKey(providerId string, month time.Time) string {
+	return "outages/provider=" + providerId + "/month=" + month.Format("2006-01") + partitionSuffix
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Export merges the outages of every month from now back past the retention
+// into their partitions. Each provider's outages are read from the source
+// at once and split by month, since a scan costs the same however many
+// months it spans.
+func (a Archiver) Export(ctx context.Context) error {
+	now := a.now()
+	// An outage expires retention after it ends, and it may have started
+	// well before it ended; one month of slack covers it.
+	from, to := monthOf(now.Add(-a.retention)).AddDate(0, -1, 0), monthOf(now).AddDate(0, 1, 0)
+	var errs []error
+	for _, providerId := range a.providerIds {
+		outages, err := a.source.GetOutagesStartedBetween(ctx, providerId, from, to)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", providerId, err))
+			continue
+		}
+		months := make(map[time.Time][]outage.Outage)
+		for _, o := range outages {
+			month := monthOf(o.Start)
+			months[month] = append(months[month], o)
+		}
+		for month := from; month.Before(to); month = month.AddDate(0, 1, 0) {
+			if err := a.exportPartition(ctx, providerId, month, months[month]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("export archive: %w", err)
+	}
+	return nil
+}
+
+func (a Archiver) exportPartition(ctx context.Context, providerId string, month time.Time, outages []outage.Outage) error {
+	key := partitionKey(providerId, month)
+	handleErr := func(err error) error {
+		return fmt.Errorf("export %s: %w", key, err)
+	}
+	if len(outages) == 0 {
+		return nil
+	}
+	archived, err := a.readPartition(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return handleErr(err)
+	}
+	merged := make(map[string]outage.Outage, len(archived)+len(outages))
+	for _, o := range append(archived, outages...) {
+		merged[o.Ref()] = o
+	}
+	data, err := encodePartition(merged)
+	if err != nil {
+		return handleErr(err)
+	}
+	if err := a.store.Put(ctx, key, data); err != nil {
+		return handleErr(err)
+	}
+	a.sl.Info("exported archive partition", slog.String("key", key), slog.Int("outages", len(merged)))
+	return nil
+}
+
+func encodePartition(outages map[string]outage.Outage) ([]byte, error) {
+	refs := make([]string, 0, len(outages))
+	for ref := range outages {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, ref := range refs {
+		if err := enc.Encode(newRecord(outages[ref])); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a Archiver) readPartition(ctx context.Context, key string) ([]outage.Outage, error) {
+	data, err := a.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var outages []outage.Outage
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var r record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		outages = append(outages, r.outage())
+	}
+	return outages, sc.Err()
+}
+
+// StartExporting exports every interval until ctx is done. The interval has
+// to be shorter than the retention or outages expire unarchived.
+func (a Archiver) StartExporting(ctx context.Context, interval time.Duration) error {
+	if interval >= a.retention {
+		return fmt.Errorf("start exporting: %w", errRetentionTooLow)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Export(ctx); err != nil {
+			a.sl.Error("export archive", slog.Any("err", err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Restore saves the outages of every partition under prefix back into
+// saver and returns how many it saved. The saver should not set a TTL, or
+// old outages expire again right away.
+func (a Archiver) Restore(ctx context.Context, saver Saver, prefix string) (int, error) {
+	handleErr := func(err error) (int, error) {
+		return 0, fmt.Errorf("restore archive: %w", err)
+	}
+	keys, err := a.store.List(ctx, prefix)
+	if err != nil {
+		return handleErr(err)
+	}
+	var restored int
+	for _, key := range keys {
+		if !strings.HasSuffix(key, partitionSuffix) {
+			continue
+		}
+		outages, err := a.readPartition(ctx, key)
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: %w", key, err))
+		}
+		if err := saver.SaveOutages(ctx, outages...); err != nil {
+			return handleErr(fmt.Errorf("%s: %w", key, err))
+		}
+		restored += len(outages)
+		a.sl.Info("restored archive partition", slog.String("key", key), slog.Int("outages", len(outages)))
+	}
+	return restored, nil
+}
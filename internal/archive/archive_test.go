@@ -0,0 +1,191 @@
+package archive_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/archive"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2023, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func fixedNow() time.Time {
+	return testNow
+}
+
+func testOutage(start time.Time, titleLat string) outage.Outage {
+	return outage.Outage{
+		ProviderId:  "water.gov.ge",
+		Kind:        outage.KindWater,
+		Start:       start,
+		End:         start.Add(6 * time.Hour),
+		Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: titleLat},
+		AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ."},
+		Status:      outage.StatusActive,
+		Source:      outage.SourceOfficial,
+		Extra:       map[string]string{"note": "planned"},
+	}
+}
+
+func Test_ExportRestore(t *testing.T) {
+	ctx := context.Background()
+	source, err := repo.NewMemory("", fixedNow, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	september := testOutage(time.Date(2023, 9, 20, 8, 0, 0, 0, time.UTC), "ozurgetis")
+	october := testOutage(time.Date(2023, 10, 2, 8, 0, 0, 0, time.UTC), "ozurgetis")
+	if err := source.SaveOutages(ctx, september, october); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	store, err := archive.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := archive.NewArchiver(source, store, []string{"water.gov.ge"}, 30*24*time.Hour, fixedNow, slog.Default())
+	if err := a.Export(ctx); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := store.List(ctx, "outages/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"outages/provider=water.gov.ge/month=2023-09.jsonl.gz",
+		"outages/provider=water.gov.ge/month=2023-10.jsonl.gz",
+	}, keys)
+
+	// A later export merges into the partition instead of replacing it, so
+	// outages that expired from the source in between stay archived.
+	later := testOutage(time.Date(2023, 10, 10, 8, 0, 0, 0, time.UTC), "chokhatauri")
+	fresh, err := repo.NewMemory("", fixedNow, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.SaveOutages(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.NewArchiver(fresh, store, []string{"water.gov.ge"}, 30*24*time.Hour, fixedNow, slog.Default()).Export(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := repo.NewMemory("", fixedNow, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := a.Restore(ctx, restored, "outages/provider=water.gov.ge/month=2023-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, n)
+	got, err := restored.GetOutagesStartedBetween(ctx, "water.gov.ge", time.Time{}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Outage{october, later}, got)
+}
+
+func Test_LocalRejectsEscapingKeys(t *testing.T) {
+	store, err := archive.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(context.Background(), "../outside.jsonl.gz", []byte("x"))
+	assert.Error(t, err)
+	_, err = store.Get(context.Background(), "outages/missing.jsonl.gz")
+	assert.ErrorIs(t, err, archive.ErrNotFound)
+}
+
+func Test_StartExportingNeedsShortInterval(t *testing.T) {
+	store, err := archive.NewLocal(filepath.Join(t.TempDir(), "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := archive.NewArchiver(nil, store, nil, time.Hour, fixedNow, slog.Default())
+	assert.Error(t, a.StartExporting(context.Background(), 2*time.Hour))
+}
+
+// S3 runs when OUTAGE_MONITOR_TEST_S3_URL points at MinIO with a bucket
+// named outage-archive, e.g. docker run -p 9000:9000 minio/minio server
+// /data and http://localhost:9000 with the minioadmin credentials.
+const testS3URLEnv = "OUTAGE_MONITOR_TEST_S3_URL"
+
+func Test_S3(t *testing.T) {
+	endpoint := os.Getenv(testS3URLEnv)
+	if endpoint == "" {
+		t.Skip(testS3URLEnv + " is not set")
+	}
+	ctx := context.Background()
+	store, err := archive.NewS3(ctx, endpoint, "", "outage-archive", "minioadmin", "minioadmin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := "test/" + time.Now().Format("20060102150405.000000000") + "/"
+	if err := store.Put(ctx, prefix+"a.jsonl.gz", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Get(ctx, prefix+"a.jsonl.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("a"), data)
+	_, err = store.Get(ctx, prefix+"b.jsonl.gz")
+	assert.ErrorIs(t, err, archive.ErrNotFound)
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{prefix + "a.jsonl.gz"}, keys)
+}
+
+type countingSource struct {
+	archive.Source
+	reads int
+}
+
+func (s *countingSource) GetOutagesStartedBetween(ctx context.Context, providerId string, from, to time.Time) ([]outage.Outage, error) {
+	s.reads++
+	return s.Source.GetOutagesStartedBetween(ctx, providerId, from, to)
+}
+
+func Test_ExportReadsSourceOnce(t *testing.T) {
+	ctx := context.Background()
+	memory, err := repo.NewMemory("", fixedNow, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.SaveOutages(ctx,
+		testOutage(time.Date(2023, 8, 20, 8, 0, 0, 0, time.UTC), "ozurgetis"),
+		testOutage(time.Date(2023, 9, 20, 8, 0, 0, 0, time.UTC), "ozurgetis"),
+		testOutage(time.Date(2023, 10, 2, 8, 0, 0, 0, time.UTC), "ozurgetis"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	source := &countingSource{Source: memory}
+	store, err := archive.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := archive.NewArchiver(source, store, []string{"water.gov.ge"}, 60*24*time.Hour, fixedNow, slog.Default())
+	if err := a.Export(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, source.reads)
+	keys, err := store.List(ctx, "outages/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"outages/provider=water.gov.ge/month=2023-08.jsonl.gz",
+		"outages/provider=water.gov.ge/month=2023-09.jsonl.gz",
+		"outages/provider=water.gov.ge/month=2023-10.jsonl.gz",
+	}, keys)
+}
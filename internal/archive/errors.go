@@ -0,0 +1,13 @@
+package archive
+
+type errorArchive string
+
+func (e errorArchive) Error() string {
+	return string(e)
+}
+
+const (
+	ErrNotFound        errorArchive = "archive object not found"
+	errBadKey          errorArchive = "archive key escapes the archive"
+	errRetentionTooLow errorArchive = "retention must be longer than the export interval"
+)
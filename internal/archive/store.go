@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Store keeps archive objects under slash-separated keys.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get fails with ErrNotFound for a missing key.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys under prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Local keeps archive objects as files under a directory.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Local{}, fmt.Errorf("new local archive: %w", err)
+	}
+	return Local{dir}, nil
+}
+
+func (l Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean != "/"+key {
+		return "", fmt.Errorf("%w: %q", errBadKey, key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes through a temporary file so readers never see half an object.
+func (l Local) Put(ctx context.Context, key string, data []byte) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	p, err := l.path(key)
+	if err != nil {
+		return handleErr(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return handleErr(err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*")
+	if err != nil {
+		return handleErr(err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return handleErr(errors.Join(err, tmp.Close(), os.Remove(tmp.Name())))
+	}
+	if err := tmp.Close(); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	return nil
+}
+
+func (l Local) Get(ctx context.Context, key string) ([]byte, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("get %s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (l Local) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) && !isTemp(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", prefix, err)
+	}
+	return keys, nil
+}
+
+// isTemp tells the leftovers of an interrupted Put: "x.jsonl.gz.123".
+func isTemp(key string) bool {
+	return !strings.HasSuffix(key, partitionSuffix)
+}
+
+// S3 keeps archive objects in a bucket of S3 or of anything that speaks its
+// API, such as MinIO.
+type S3 struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3 talks to AWS unless endpoint is set, and then uses path-style
+// addressing as MinIO expects. Without an access key the default credential
+// chain is used.
+func NewS3(ctx context.Context, endpoint, region, bucket, accessKey, secretAccessKey string) (S3, error) {
+	if region == "" && endpoint != "" {
+		region = "us-east-1"
+	}
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if accessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{
+				AccessKeyID:     accessKey,
+				SecretAccessKey: secretAccessKey,
+			}, nil
+		})))
+	}
+	conf, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return S3{}, fmt.Errorf("new s3 archive: %w", err)
+	}
+	client := s3.NewFromConfig(conf, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return S3{client, bucket}, nil
+}
+
+func (s S3) Put(ctx context.Context, key string, data []byte) error {
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}); err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s S3) Get(ctx context.Context, key string) ([]byte, error) {
+	goo, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("get %s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer goo.Body.Close()
+	data, err := io.ReadAll(goo.Body)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,52 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Next(t *testing.T) {
+	tbilisi := time.FixedZone("Asia/Tbilisi", 4*60*60)
+	// A Wednesday, 12:00 in Tbilisi.
+	from := time.Date(2023, 10, 18, 8, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2023, 10, 18, 12, 1, 0, 0, tbilisi)},
+		{"*/15 * * * *", time.Date(2023, 10, 18, 12, 15, 0, 0, tbilisi)},
+		{"0 6-23/2 * * *", time.Date(2023, 10, 18, 14, 0, 0, 0, tbilisi)},
+		{"30 3 * * *", time.Date(2023, 10, 19, 3, 30, 0, 0, tbilisi)},
+		{"0 9 * * mon-fri", time.Date(2023, 10, 19, 9, 0, 0, 0, tbilisi)},
+		{"0 9 * * sun", time.Date(2023, 10, 22, 9, 0, 0, 0, tbilisi)},
+		{"0 9 * * 7", time.Date(2023, 10, 22, 9, 0, 0, 0, tbilisi)},
+		{"0 0 1 * *", time.Date(2023, 11, 1, 0, 0, 0, 0, tbilisi)},
+		{"0 0 1,15 * 6", time.Date(2023, 10, 21, 0, 0, 0, 0, tbilisi)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, tbilisi)},
+		{"@hourly", time.Date(2023, 10, 18, 13, 0, 0, 0, tbilisi)},
+		{"5/20 12 * * *", time.Date(2023, 10, 18, 12, 5, 0, 0, tbilisi)},
+	} {
+		s, err := Parse(tc.expr, tbilisi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, tc.want.Equal(s.Next(from)), "%s: got %s", tc.expr, s.Next(from))
+	}
+}
+
+func Test_NextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, s.Next(time.Date(2023, 10, 18, 0, 0, 0, 0, time.UTC)).IsZero())
+}
+
+func Test_ParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := Parse(expr, time.UTC)
+		assert.Error(t, err, expr)
+	}
+}
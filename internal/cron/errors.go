@@ -0,0 +1,12 @@
+package cron
+
+type errorCron string
+
+func (e errorCron) Error() string {
+	return string(e)
+}
+
+const (
+	errFieldCount errorCron = "cron expression must have 5 fields"
+	errBadField   errorCron = "bad cron field"
+)
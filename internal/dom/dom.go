@@ -0,0 +1,194 @@
+package dom
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Node is a lenient HTML tree node that remembers where in the source
+// document it started, so extractors can point at the offending markup.
+type Node struct {
+	Tag      string
+	Attrs    map[string]string
+	Text     string
+	Offset   int
+	Parent   *Node
+	Children []*Node
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true,
+	"embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "source": true, "track": true,
+	"wbr": true,
+}
+
+// Parse builds a tree from a full page or a fragment. Unlike html.Parse it
+// does not synthesize html/head/body and tolerates stray end tags.
+func Parse(doc []byte) (*Node, error) {
+	handleErr := func(err error) (*Node, error) {
+		return nil, fmt.Errorf("parse dom: %w", err)
+	}
+	root := &Node{}
+	open := root
+	offset := 0
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		tokenOffset := offset
+		offset += len(z.Raw())
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				return handleErr(err)
+			}
+			return root, nil
+		case html.TextToken:
+			open.append(&Node{Text: string(z.Text()), Offset: tokenOffset})
+		case html.StartTagToken, html.SelfClosingTagToken:
+			n := newElement(z, tokenOffset)
+			open.append(n)
+			if tt == html.StartTagToken && !voidElements[n.Tag] {
+				open = n
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			for n := open; n != root; n = n.Parent {
+				if n.Tag == string(name) {
+					open = n.Parent
+					break
+				}
+			}
+		}
+	}
+}
+
+func newElement(z *html.Tokenizer, offset int) *Node {
+	name, hasAttr := z.TagName()
+	n := Node{
+		Tag:    string(name),
+		Attrs:  make(map[string]string),
+		Offset: offset,
+	}
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		n.Attrs[string(key)] = string(val)
+	}
+	return &n
+}
+
+func (n *Node) append(child *Node) {
+	child.Parent = n
+	n.Children = append(n.Children, child)
+}
+
+func (n *Node) IsElement() bool {
+	return n.Tag != ""
+}
+
+func (n *Node) Attr(key string) string {
+	return n.Attrs[key]
+}
+
+func (n *Node) HasClass(class string) bool {
+	for _, c := range strings.Fields(n.Attrs["class"]) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Elements returns the element children of n, skipping text.
+func (n *Node) Elements() []*Node {
+	var elements []*Node
+	for _, c := range n.Children {
+		if c.IsElement() {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// TextContent returns the text of n and its descendants with runs of
+// whitespace collapsed to a single space.
+func (n *Node) TextContent() string {
+	var sb strings.Builder
+	n.Walk(func(d *Node) bool {
+		if !d.IsElement() {
+			sb.WriteString(d.Text)
+			sb.WriteByte(' ')
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// Walk visits n and its descendants in document order. Returning false
+// from visit skips the descendants of the visited node.
+func (n *Node) Walk(visit func(*Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for _, c := range n.Children {
+		c.Walk(visit)
+	}
+}
+
+func (n *Node) Find(match func(*Node) bool) *Node {
+	var found *Node
+	n.Walk(func(d *Node) bool {
+		if found == nil && d.IsElement() && match(d) {
+			found = d
+		}
+		return found == nil
+	})
+	return found
+}
+
+func (n *Node) FindAll(match func(*Node) bool) []*Node {
+	var found []*Node
+	n.Walk(func(d *Node) bool {
+		if d.IsElement() && match(d) {
+			found = append(found, d)
+		}
+		return true
+	})
+	return found
+}
+
+func ByTag(tag string) func(*Node) bool {
+	return func(n *Node) bool {
+		return n.Tag == tag
+	}
+}
+
+func ByClass(class string) func(*Node) bool {
+	return func(n *Node) bool {
+		return n.HasClass(class)
+	}
+}
+
+// TextOffset returns the document offset of the first occurrence of s in
+// the text below n, or n.Offset when it cannot be located.
+func (n *Node) TextOffset(s string) int {
+	offset := n.Offset
+	n.Walk(func(d *Node) bool {
+		if offset != n.Offset {
+			return false
+		}
+		if !d.IsElement() {
+			if i := strings.Index(d.Text, s); i >= 0 {
+				offset = d.Offset + i
+			}
+		}
+		return true
+	})
+	return offset
+}
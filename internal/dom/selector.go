@@ -0,0 +1,188 @@
+package dom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector is a compiled subset of CSS: comma separated groups of compound
+// selectors (tag, #id, .class, [attr], [attr=value]) joined by descendant
+// (space) or child (>) combinators.
+type Selector struct {
+	groups [][]compound
+}
+
+type compound struct {
+	child   bool
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatch
+}
+
+type attrMatch struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+type errorSelector string
+
+func (e errorSelector) Error() string {
+	return string(e)
+}
+
+const errBadSelector errorSelector = "malformed selector"
+
+func Compile(sel string) (Selector, error) {
+	handleErr := func(err error) (Selector, error) {
+		return Selector{}, fmt.Errorf("compile selector %q: %w", sel, err)
+	}
+	var s Selector
+	for _, rawGroup := range strings.Split(sel, ",") {
+		rawGroup = strings.ReplaceAll(rawGroup, ">", " > ")
+		var (
+			group []compound
+			child bool
+		)
+		for _, token := range strings.Fields(rawGroup) {
+			if token == ">" {
+				if len(group) == 0 || child {
+					return handleErr(errBadSelector)
+				}
+				child = true
+				continue
+			}
+			c, err := compileCompound(token)
+			if err != nil {
+				return handleErr(err)
+			}
+			c.child = child
+			child = false
+			group = append(group, c)
+		}
+		if len(group) == 0 || child {
+			return handleErr(errBadSelector)
+		}
+		s.groups = append(s.groups, group)
+	}
+	return s, nil
+}
+
+func MustCompile(sel string) Selector {
+	s, err := Compile(sel)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func compileCompound(token string) (compound, error) {
+	var c compound
+	for token != "" {
+		switch token[0] {
+		case '#', '.':
+			end := strings.IndexAny(token[1:], "#.[")
+			if end < 0 {
+				end = len(token) - 1
+			}
+			name := token[1 : end+1]
+			if name == "" {
+				return compound{}, errBadSelector
+			}
+			if token[0] == '#' {
+				c.id = name
+			} else {
+				c.classes = append(c.classes, name)
+			}
+			token = token[end+1:]
+		case '[':
+			end := strings.IndexByte(token, ']')
+			if end < 0 {
+				return compound{}, errBadSelector
+			}
+			key, value, hasValue := strings.Cut(token[1:end], "=")
+			c.attrs = append(c.attrs, attrMatch{key, strings.Trim(value, `"'`), hasValue})
+			token = token[end+1:]
+		default:
+			end := strings.IndexAny(token, "#.[")
+			if end < 0 {
+				end = len(token)
+			}
+			c.tag = strings.ToLower(token[:end])
+			if c.tag == "*" {
+				c.tag = ""
+			}
+			token = token[end:]
+		}
+	}
+	return c, nil
+}
+
+func (c compound) matches(n *Node) bool {
+	if !n.IsElement() {
+		return false
+	}
+	if c.tag != "" && n.Tag != c.tag {
+		return false
+	}
+	if c.id != "" && n.Attr("id") != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !n.HasClass(class) {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		value, found := n.Attrs[a.key]
+		if !found || a.hasValue && value != a.value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesGroup reports whether n is selected by group, walking up the ancestors
+// for the combinators.
+func matchesGroup(group []compound, n *Node) bool {
+	last := len(group) - 1
+	if !group[last].matches(n) {
+		return false
+	}
+	if last == 0 {
+		return true
+	}
+	rest := group[:last]
+	if group[last].child {
+		return n.Parent != nil && matchesGroup(rest, n.Parent)
+	}
+	for a := n.Parent; a != nil; a = a.Parent {
+		if matchesGroup(rest, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Selector) Matches(n *Node) bool {
+	for _, group := range s.groups {
+		if matchesGroup(group, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the descendants of n matched by s in document order.
+func (n *Node) Select(s Selector) []*Node {
+	return n.FindAll(func(d *Node) bool {
+		return d != n && s.Matches(d)
+	})
+}
+
+func (n *Node) SelectFirst(s Selector) *Node {
+	return n.Find(func(d *Node) bool {
+		return d != n && s.Matches(d)
+	})
+}
@@ -0,0 +1,33 @@
+package dom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Select(t *testing.T) {
+	root, err := Parse([]byte(`
+<div class="list outages">
+  <div class="item" id="first"><a href="/1">one</a><span data-kind="planned">p</span></div>
+  <div class="item"><p><a href="/2">two</a></p><span data-kind="emergency">e</span></div>
+</div>
+<a href="/3">three</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(nodes []*Node) []string {
+		var texts []string
+		for _, n := range nodes {
+			texts = append(texts, n.TextContent())
+		}
+		return texts
+	}
+	assert.Equal(t, []string{"one", "two"}, text(root.Select(MustCompile(".outages .item a"))))
+	assert.Equal(t, []string{"one"}, text(root.Select(MustCompile("div.item > a"))))
+	assert.Equal(t, []string{"one"}, text(root.Select(MustCompile("#first a[href]"))))
+	assert.Equal(t, []string{"e"}, text(root.Select(MustCompile(`span[data-kind="emergency"]`))))
+	assert.Equal(t, []string{"one", "p", "three"}, text(root.Select(MustCompile("#first > *, a[href=/3]"))))
+	_, err = Compile("div >")
+	assert.ErrorIs(t, err, errBadSelector)
+}
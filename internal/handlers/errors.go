@@ -0,0 +1,11 @@
+package handlers
+
+type errorHandlers string
+
+func (e errorHandlers) Error() string {
+	return string(e)
+}
+
+const (
+	errBadOperator errorHandlers = `client must look like "name:token"`
+)
@@ -2,24 +2,705 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+	"github.com/samber/lo"
 )
 
 type OutageMonitor interface {
-	GetWaterOutages(ctx context.Context) error
+	GetCenters(ctx context.Context, kind outage.Kind) ([]outage.Center, error)
+	GetCenterHistory(ctx context.Context, providerId, locationId string) ([]outage.CenterStatus, error)
+	ReportOutage(ctx context.Context, o outage.Outage) (outage.Outage, error)
+	UpdateOutage(ctx context.Context, id string, o outage.Outage) (outage.Outage, error)
+	CloseOutage(ctx context.Context, id, reporter string) (outage.Outage, error)
+	GetOutages(ctx context.Context, kind outage.Kind, titleLat string) ([]outage.Outage, error)
+	GetOutagesByAddress(ctx context.Context, kind outage.Kind, addr string) ([]outage.Outage, error)
+	GetCrowd(ctx context.Context, ref string) (outage.Crowd, error)
+	ReportCrowd(ctx context.Context, r outage.CrowdReport) (outage.Crowd, error)
+	GetOutageHistory(ctx context.Context, ref string) ([]outage.Revision, error)
+	GetOutagesAsOf(ctx context.Context, kind outage.Kind, titleLat string, asOf time.Time) ([]outage.Outage, error)
+	DiffOutagesAsOf(ctx context.Context, kind outage.Kind, titleLat string, from, to time.Time) (outage.OutageDiff, error)
+	TriggerRefresh(ctx context.Context, providerId string) error
+	GetRefreshStatus(ctx context.Context) (outage.RefreshStatus, error)
+	GetRuns(ctx context.Context, providerId string, limit int) ([]outage.Run, error)
+}
+
+type ProblemParser interface {
+	ParseProblemHTML(ctx context.Context, rawProblemHTML []byte) (outage.Outage, error)
 }
 
 type HTTP struct {
-	omon OutageMonitor
-	sl   *slog.Logger
+	omon      OutageMonitor
+	parser    ProblemParser
+	operators Operators
+	reporters Operators
+	sl        *slog.Logger
 }
 
-func NewHTTP(omon OutageMonitor, sl *slog.Logger) HTTP {
-	return HTTP{omon, sl}
+// NewHTTP takes two sets of clients: operators enter outages by hand,
+// reporters (the site and the bots) relay crowd reports on behalf of users.
+func NewHTTP(omon OutageMonitor, parser ProblemParser, operators, reporters Operators, sl *slog.Logger) HTTP {
+	return HTTP{omon, parser, operators, reporters, sl}
 }
 
 func (h HTTP) HandleWater(res http.ResponseWriter, req *http.Request) {
 	h.sl.Info("handling a water request")
 	res.WriteHeader(http.StatusOK)
 }
+
+type centerResponse struct {
+	ProviderId string                 `json:"providerId"`
+	Id         string                 `json:"id"`
+	TitleGe    string                 `json:"titleGe"`
+	TitleLat   string                 `json:"titleLat"`
+	Lat        string                 `json:"lat"`
+	Lng        string                 `json:"lng"`
+	Problem    bool                   `json:"problem"`
+	FirstSeen  time.Time              `json:"firstSeen"`
+	LastSeen   time.Time              `json:"lastSeen"`
+	History    []centerStatusResponse `json:"history,omitempty"`
+}
+
+type centerStatusResponse struct {
+	Problem    bool      `json:"problem"`
+	ObservedAt time.Time `json:"observedAt"`
+}
+
+// HandleWaterCenters lists the service-center catalog with the current
+// problem flag. With ?id= it returns that center and its flag history.
+func (h HTTP) HandleWaterCenters(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	centers, err := h.omon.GetCenters(ctx, outage.KindWater)
+	if err != nil {
+		h.sl.Error("get centers", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := make([]centerResponse, len(centers))
+	for i, c := range centers {
+		resp[i] = centerResponse{
+			ProviderId: c.ProviderId,
+			Id:         c.Location.Id,
+			TitleGe:    c.Location.TitleGe,
+			TitleLat:   c.Location.TitleLat,
+			Lat:        c.Location.Lat,
+			Lng:        c.Location.Lng,
+			Problem:    c.Problem,
+			FirstSeen:  c.FirstSeen,
+			LastSeen:   c.LastSeen,
+		}
+	}
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		h.writeJSON(res, http.StatusOK, resp)
+		return
+	}
+	center, found := lo.Find(resp, func(c centerResponse) bool {
+		return c.Id == id
+	})
+	if !found {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	history, err := h.omon.GetCenterHistory(ctx, center.ProviderId, id)
+	if err != nil {
+		h.sl.Error("get center history", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	center.History = lo.Map(history, func(s outage.CenterStatus, _ int) centerStatusResponse {
+		return centerStatusResponse{s.Problem, s.ObservedAt}
+	})
+	h.writeJSON(res, http.StatusOK, center)
+}
+
+type debugParseResponse struct {
+	Outage     *outage.Outage     `json:"outage,omitempty"`
+	Diagnostic *parser.Diagnostic `json:"diagnostic,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// HandleDebugParse serves POST /debug/parse: operators post a problem page
+// and get back the outage parsed from it or the diagnostic.
+func (h HTTP) HandleDebugParse(res http.ResponseWriter, req *http.Request) {
+	const maxBodyBytes = 1 << 20
+	if _, ok := h.operators.authenticate(req); !ok {
+		res.Header().Set("WWW-Authenticate", "Bearer")
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", http.MethodPost)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rawHTML, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxBodyBytes))
+	if err != nil {
+		h.writeJSON(res, http.StatusRequestEntityTooLarge, debugParseResponse{Error: err.Error()})
+		return
+	}
+	o, err := h.parser.ParseProblemHTML(req.Context(), rawHTML)
+	if err != nil {
+		resp := debugParseResponse{Error: err.Error()}
+		var diag parser.Diagnostic
+		if errors.As(err, &diag) {
+			resp.Diagnostic = &diag
+		}
+		h.writeJSON(res, http.StatusUnprocessableEntity, resp)
+		return
+	}
+	h.writeJSON(res, http.StatusOK, debugParseResponse{Outage: &o})
+}
+
+func (h HTTP) writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(v); err != nil {
+		h.sl.Error("write json response", slog.Any("err", err))
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type manualOutageRequest struct {
+	LocationGe        string    `json:"locationGe"`
+	AddressesGe       []string  `json:"addressesGe"`
+	Start             time.Time `json:"start"`
+	End               time.Time `json:"end"`
+	AffectedCustomers int       `json:"affectedCustomers"`
+}
+
+type outageResponse struct {
+	Ref               string            `json:"ref"`
+	Id                string            `json:"id,omitempty"`
+	ProviderId        string            `json:"providerId"`
+	Kind              outage.Kind       `json:"kind"`
+	Start             time.Time         `json:"start"`
+	End               time.Time         `json:"end"`
+	AffectedCustomers int               `json:"affectedCustomers"`
+	LocationId        string            `json:"locationId"`
+	TitleGe           string            `json:"titleGe"`
+	TitleLat          string            `json:"titleLat"`
+	AddressesGe       []string          `json:"addressesGe"`
+	Status            outage.Status     `json:"status"`
+	Source            outage.Source     `json:"source"`
+	Reporter          string            `json:"reporter,omitempty"`
+	AnnouncementURI   string            `json:"announcementUri,omitempty"`
+	Extra             map[string]string `json:"extra,omitempty"`
+	Crowd             *crowdResponse    `json:"crowd,omitempty"`
+}
+
+// crowdResponse carries the crowd-reported restoration time next to the
+// official end so the two can be compared.
+type crowdResponse struct {
+	Restored     int        `json:"restored"`
+	StillOff     int        `json:"stillOff"`
+	Confidence   float64    `json:"confidence"`
+	RestoredAt   *time.Time `json:"restoredAt,omitempty"`
+	LastReportAt *time.Time `json:"lastReportAt,omitempty"`
+}
+
+func newCrowdResponse(c outage.Crowd) *crowdResponse {
+	resp := crowdResponse{
+		Restored:   c.Restored,
+		StillOff:   c.StillOff,
+		Confidence: c.Confidence,
+	}
+	if !c.RestoredAt.IsZero() {
+		resp.RestoredAt = &c.RestoredAt
+	}
+	if !c.LastReportAt.IsZero() {
+		resp.LastReportAt = &c.LastReportAt
+	}
+	return &resp
+}
+
+func newOutageResponse(o outage.Outage) outageResponse {
+	return outageResponse{
+		Ref:               o.Ref(),
+		Id:                o.Id,
+		ProviderId:        o.ProviderId,
+		Kind:              o.Kind,
+		Start:             o.Start,
+		End:               o.End,
+		AffectedCustomers: o.AffectedCustomers,
+		LocationId:        o.Location.Id,
+		TitleGe:           o.Location.TitleGe,
+		TitleLat:          o.Location.TitleLat,
+		AddressesGe:       o.AddressesGe,
+		Status:            o.Status,
+		Source:            o.Source,
+		Reporter:          o.Reporter,
+		AnnouncementURI:   o.AnnouncementURI,
+		Extra:             o.Extra,
+	}
+}
+
+// HandleWaterOutages lists the outages at ?location= (a transliterated
+// service center) with their crowd reports on GET. With ?asOf= (RFC 3339) it
+// lists them as they were observed at that instant instead, without crowd
+// reports. It also lets operators
+// enter outages by hand: POST creates one, PUT ?id= replaces it and
+// DELETE ?id= closes it. Those need an operator bearer token.
+func (h HTTP) HandleWaterOutages(res http.ResponseWriter, req *http.Request) {
+	const maxBodyBytes = 1 << 16
+	if req.Method == http.MethodGet {
+		h.listOutages(res, req, outage.KindWater)
+		return
+	}
+	reporter, ok := h.operators.authenticate(req)
+	if !ok {
+		res.Header().Set("WWW-Authenticate", "Bearer")
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	ctx := req.Context()
+	id := req.URL.Query().Get("id")
+	if req.Method == http.MethodDelete {
+		o, err := h.omon.CloseOutage(ctx, id, reporter)
+		h.writeOutage(res, http.StatusOK, o, err)
+		return
+	}
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		res.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body manualOutageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(res, req.Body, maxBodyBytes)).Decode(&body); err != nil {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+	o := outage.Outage{
+		Kind:              outage.KindWater,
+		Start:             body.Start,
+		End:               body.End,
+		AffectedCustomers: body.AffectedCustomers,
+		Location:          outage.Location{TitleGe: body.LocationGe},
+		AddressesGe:       body.AddressesGe,
+		Reporter:          reporter,
+	}
+	if req.Method == http.MethodPost {
+		o, err := h.omon.ReportOutage(ctx, o)
+		h.writeOutage(res, http.StatusCreated, o, err)
+		return
+	}
+	o, err := h.omon.UpdateOutage(ctx, id, o)
+	h.writeOutage(res, http.StatusOK, o, err)
+}
+
+func (h HTTP) writeOutage(res http.ResponseWriter, status int, o outage.Outage, err error) {
+	switch {
+	case errors.Is(err, outage.ErrNotFound):
+		res.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, outage.ErrInvalidOutage):
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{err.Error()})
+	case err != nil:
+		h.sl.Error("manual outage", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+	default:
+		h.writeJSON(res, status, newOutageResponse(o))
+	}
+}
+
+func (h HTTP) listOutages(res http.ResponseWriter, req *http.Request, kind outage.Kind) {
+	ctx := req.Context()
+	location := req.URL.Query().Get("location")
+	if location == "" {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{"location is required"})
+		return
+	}
+	if rawAsOf := req.URL.Query().Get("asOf"); rawAsOf != "" {
+		asOf, err := time.Parse(time.RFC3339, rawAsOf)
+		if err != nil {
+			h.writeJSON(res, http.StatusBadRequest, errorResponse{err.Error()})
+			return
+		}
+		outages, err := h.omon.GetOutagesAsOf(ctx, kind, location, asOf)
+		if err != nil {
+			h.sl.Error("get outages as of", slog.Any("err", err))
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		h.writeJSON(res, http.StatusOK, lo.Map(outages, func(o outage.Outage, _ int) outageResponse {
+			return newOutageResponse(o)
+		}))
+		return
+	}
+	outages, err := h.omon.GetOutages(ctx, kind, location)
+	if err != nil {
+		h.sl.Error("get outages", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := make([]outageResponse, len(outages))
+	for i, o := range outages {
+		crowd, err := h.omon.GetCrowd(ctx, o.Ref())
+		if err != nil {
+			h.sl.Error("get crowd", slog.Any("err", err))
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp[i] = newOutageResponse(o)
+		resp[i].Crowd = newCrowdResponse(crowd)
+	}
+	h.writeJSON(res, http.StatusOK, resp)
+}
+
+// HandleWaterOutagesSearch lists the outages, ended or not, with an address
+// holding every word of ?address=, oldest first. Storage without an address
+// index answers 501.
+func (h HTTP) HandleWaterOutagesSearch(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.Header().Set("Allow", http.MethodGet)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	addr := req.URL.Query().Get("address")
+	if addr == "" {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{"address is required"})
+		return
+	}
+	outages, err := h.omon.GetOutagesByAddress(req.Context(), outage.KindWater, addr)
+	switch {
+	case errors.Is(err, outage.ErrNoAddressIndex):
+		h.writeJSON(res, http.StatusNotImplemented, errorResponse{err.Error()})
+	case err != nil:
+		h.sl.Error("get outages by address", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+	default:
+		h.writeJSON(res, http.StatusOK, lo.Map(outages, func(o outage.Outage, _ int) outageResponse {
+			return newOutageResponse(o)
+		}))
+	}
+}
+
+type crowdReportRequest struct {
+	Ref      string              `json:"ref"`
+	Reporter string              `json:"reporter"`
+	Address  string              `json:"address"`
+	Status   outage.ReportStatus `json:"status"`
+}
+
+// HandleWaterReports takes a user's "restored" or "still_off" report on an
+// outage from a reporter client. The user is recorded as client:reporter,
+// so the same user id on two bots counts twice.
+func (h HTTP) HandleWaterReports(res http.ResponseWriter, req *http.Request) {
+	const maxBodyBytes = 1 << 12
+	client, ok := h.reporters.authenticate(req)
+	if !ok {
+		res.Header().Set("WWW-Authenticate", "Bearer")
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", http.MethodPost)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body crowdReportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(res, req.Body, maxBodyBytes)).Decode(&body); err != nil {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+	reporter := client
+	if body.Reporter != "" {
+		reporter += ":" + body.Reporter
+	}
+	crowd, err := h.omon.ReportCrowd(req.Context(), outage.CrowdReport{
+		OutageRef: body.Ref,
+		Reporter:  reporter,
+		Address:   body.Address,
+		Status:    body.Status,
+	})
+	switch {
+	case errors.Is(err, outage.ErrNotFound):
+		res.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, outage.ErrRateLimited):
+		h.writeJSON(res, http.StatusTooManyRequests, errorResponse{err.Error()})
+	case errors.Is(err, outage.ErrInvalidOutage):
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{err.Error()})
+	case err != nil:
+		h.sl.Error("crowd report", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+	default:
+		h.writeJSON(res, http.StatusCreated, newCrowdResponse(crowd))
+	}
+}
+
+// HandleRefresh serves POST /refresh?provider={id}: operators make a
+// provider refresh now instead of on its schedule. Any replica accepts: the
+// request is stored for the one that refreshes, the leader.
+func (h HTTP) HandleRefresh(res http.ResponseWriter, req *http.Request) {
+	if _, ok := h.operators.authenticate(req); !ok {
+		res.Header().Set("WWW-Authenticate", "Bearer")
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", http.MethodPost)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	err := h.omon.TriggerRefresh(req.Context(), req.URL.Query().Get("provider"))
+	switch {
+	case errors.Is(err, outage.ErrNoProvider):
+		h.writeJSON(res, http.StatusNotFound, errorResponse{err.Error()})
+	case err != nil:
+		h.sl.Error("trigger refresh", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+	default:
+		res.WriteHeader(http.StatusAccepted)
+	}
+}
+
+type statusResponse struct {
+	// DataAsOf is null until every provider has refreshed successfully.
+	DataAsOf  *time.Time               `json:"dataAsOf"`
+	Providers []providerStatusResponse `json:"providers"`
+}
+
+type providerStatusResponse struct {
+	ProviderId     string        `json:"providerId"`
+	AgeSeconds     *float64      `json:"ageSeconds"`
+	LastRun        *runResponse  `json:"lastRun"`
+	LastSuccess    *runResponse  `json:"lastSuccess"`
+	RecentFailures []runResponse `json:"recentFailures"`
+}
+
+type runResponse struct {
+	ProviderId      string    `json:"providerId"`
+	Reason          string    `json:"reason"`
+	StartedAt       time.Time `json:"startedAt"`
+	EndedAt         time.Time `json:"endedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Ok              bool      `json:"ok"`
+	Pages           int       `json:"pages"`
+	CacheHits       int       `json:"cacheHits"`
+	Parsed          int       `json:"parsed"`
+	Saved           int       `json:"saved"`
+	Errors          []string  `json:"errors"`
+}
+
+func newStatusResponse(status outage.RefreshStatus) statusResponse {
+	resp := statusResponse{Providers: make([]providerStatusResponse, len(status.Providers))}
+	if !status.DataAsOf.IsZero() {
+		resp.DataAsOf = &status.DataAsOf
+	}
+	for i, ps := range status.Providers {
+		p := providerStatusResponse{
+			ProviderId:     ps.ProviderId,
+			RecentFailures: lo.Map(ps.RecentFailures, func(r outage.Run, _ int) runResponse { return newRunResponse(r) }),
+		}
+		if ps.LastRun != nil {
+			lastRun := newRunResponse(*ps.LastRun)
+			p.LastRun = &lastRun
+		}
+		if ps.LastSuccess != nil {
+			lastSuccess := newRunResponse(*ps.LastSuccess)
+			age := ps.Age.Seconds()
+			p.LastSuccess, p.AgeSeconds = &lastSuccess, &age
+		}
+		resp.Providers[i] = p
+	}
+	return resp
+}
+
+func newRunResponse(r outage.Run) runResponse {
+	errs := r.Errors
+	if errs == nil {
+		errs = []string{}
+	}
+	return runResponse{
+		ProviderId:      r.ProviderId,
+		Reason:          string(r.Reason),
+		StartedAt:       r.StartedAt,
+		EndedAt:         r.EndedAt,
+		DurationSeconds: r.Duration().Seconds(),
+		Ok:              r.Ok(),
+		Pages:           r.Pages,
+		CacheHits:       r.CacheHits,
+		Parsed:          r.Parsed,
+		Saved:           r.Saved,
+		Errors:          errs,
+	}
+}
+
+// HandleStatus serves GET /status: per provider the last run, the last
+// successful one with the age of its data, and the recent failures.
+func (h HTTP) HandleStatus(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.Header().Set("Allow", http.MethodGet)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := h.omon.GetRefreshStatus(req.Context())
+	if err != nil {
+		h.sl.Error("get refresh status", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(res, http.StatusOK, newStatusResponse(status))
+}
+
+// HandleStatusRuns serves GET /status/runs?provider={id}&limit={n}, the
+// refresh journal newest first, of every provider without ?provider=.
+func (h HTTP) HandleStatusRuns(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.Header().Set("Allow", http.MethodGet)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	var limit int
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		var err error
+		if limit, err = strconv.Atoi(rawLimit); err != nil || limit <= 0 {
+			h.writeJSON(res, http.StatusBadRequest, errorResponse{"limit must be a positive integer"})
+			return
+		}
+	}
+	runs, err := h.omon.GetRuns(req.Context(), query.Get("provider"), limit)
+	switch {
+	case errors.Is(err, outage.ErrNoProvider):
+		h.writeJSON(res, http.StatusNotFound, errorResponse{err.Error()})
+	case err != nil:
+		h.sl.Error("get runs", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+	default:
+		h.writeJSON(res, http.StatusOK, lo.Map(runs, func(r outage.Run, _ int) runResponse { return newRunResponse(r) }))
+	}
+}
+
+type historyResponse struct {
+	Ref           string             `json:"ref"`
+	OriginalEnd   *time.Time         `json:"originalEnd,omitempty"`
+	EndExtensions int                `json:"endExtensions"`
+	Revisions     []revisionResponse `json:"revisions"`
+}
+
+type revisionResponse struct {
+	ObservedAt time.Time      `json:"observedAt"`
+	Changed    []string       `json:"changed"`
+	Outage     outageResponse `json:"outage"`
+}
+
+// HandleWaterOutageHistory serves /water/outages/{ref}/history: every
+// revision of an outage, with the end it was first announced with and how
+// many times that end was pushed back. A bare id stands for a manual outage.
+func (h HTTP) HandleWaterOutageHistory(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.Header().Set("Allow", http.MethodGet)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ref, found := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/water/outages/"), "/history")
+	if !found || ref == "" {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !strings.Contains(ref, "/") {
+		ref = outage.ManualProviderId + "/" + ref
+	}
+	revisions, err := h.omon.GetOutageHistory(req.Context(), ref)
+	switch {
+	case errors.Is(err, outage.ErrNotFound):
+		res.WriteHeader(http.StatusNotFound)
+		return
+	case err != nil:
+		h.sl.Error("get outage history", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := historyResponse{
+		Ref:           ref,
+		EndExtensions: outage.EndExtensions(revisions),
+		Revisions:     make([]revisionResponse, len(revisions)),
+	}
+	if end := revisions[0].Outage.End; !end.IsZero() {
+		resp.OriginalEnd = &end
+	}
+	for i, r := range revisions {
+		resp.Revisions[i] = revisionResponse{
+			ObservedAt: r.ObservedAt,
+			Changed:    lo.Ternary(r.Changed == nil, []string{}, r.Changed),
+			Outage:     newOutageResponse(r.Outage),
+		}
+	}
+	h.writeJSON(res, http.StatusOK, resp)
+}
+
+type diffResponse struct {
+	From    time.Time              `json:"from"`
+	To      time.Time              `json:"to"`
+	Added   []outageResponse       `json:"added"`
+	Removed []outageResponse       `json:"removed"`
+	Changed []outageChangeResponse `json:"changed"`
+}
+
+type outageChangeResponse struct {
+	Ref     string         `json:"ref"`
+	Changed []string       `json:"changed"`
+	Before  outageResponse `json:"before"`
+	After   outageResponse `json:"after"`
+}
+
+// HandleWaterOutagesDiff compares the outages at ?location= as observed at
+// ?from= and at ?to=, both RFC 3339.
+func (h HTTP) HandleWaterOutagesDiff(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.Header().Set("Allow", http.MethodGet)
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	location := query.Get("location")
+	if location == "" {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{"location is required"})
+		return
+	}
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{"from: " + err.Error()})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil {
+		h.writeJSON(res, http.StatusBadRequest, errorResponse{"to: " + err.Error()})
+		return
+	}
+	diff, err := h.omon.DiffOutagesAsOf(req.Context(), outage.KindWater, location, from, to)
+	if err != nil {
+		h.sl.Error("diff outages", slog.Any("err", err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	toResponse := func(o outage.Outage, _ int) outageResponse {
+		return newOutageResponse(o)
+	}
+	h.writeJSON(res, http.StatusOK, diffResponse{
+		From:    from,
+		To:      to,
+		Added:   lo.Map(diff.Added, toResponse),
+		Removed: lo.Map(diff.Removed, toResponse),
+		Changed: lo.Map(diff.Changed, func(c outage.OutageChange, _ int) outageChangeResponse {
+			return outageChangeResponse{
+				Ref:     c.After.Ref(),
+				Changed: c.Changed,
+				Before:  newOutageResponse(c.Before),
+				After:   newOutageResponse(c.After),
+			}
+		}),
+	})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2023, 10, 18, 12, 0, 0, 0, time.UTC)
+
+type fakeParser struct{}
+
+func (p fakeParser) ParseProblemHTML(ctx context.Context, rawProblemHTML []byte) (outage.Outage, error) {
+	return outage.Outage{}, nil
+}
+
+func newTestHTTP(t *testing.T) HTTP {
+	t.Helper()
+	now := func() time.Time {
+		return testNow
+	}
+	registry, err := outage.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := repo.NewMemory("", now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := outage.NewService(registry, store, outage.NewReportLimiter(1, time.Hour), now, slog.Default())
+	operators, err := NewOperators("nino:op-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporters, err := NewOperators("bot:bot-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHTTP(s, fakeParser{}, operators, reporters, slog.Default())
+}
+
+func serve(handler http.HandlerFunc, method, target, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res := httptest.NewRecorder()
+	handler(res, req)
+	return res
+}
+
+func Test_HandleWaterOutages(t *testing.T) {
+	h := newTestHTTP(t)
+	body := `{"locationGe":"რუსთავი","addressesGe":["მესხიშვილის ქ."],"start":"2023-10-18T10:00:00Z"}`
+	res := serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "", body)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "bot-token", body)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "op-token", `{"locationGe":"რუსთავი"}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "op-token", body)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	var created outageResponse
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rustavi", created.TitleLat)
+	assert.Equal(t, "nino", created.Reporter)
+	assert.Equal(t, outage.StatusActive, created.Status)
+
+	res = serve(h.HandleWaterOutages, http.MethodGet, "/water/outages?location=rustavi", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var listed []outageResponse
+	if err := json.NewDecoder(res.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	created.Crowd = &crowdResponse{Confidence: 0.5}
+	assert.Equal(t, []outageResponse{created}, listed)
+
+	res = serve(h.HandleWaterOutages, http.MethodDelete, "/water/outages?id=missing", "op-token", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	res = serve(h.HandleWaterOutages, http.MethodDelete, "/water/outages?id="+created.Id, "op-token", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = serve(h.HandleWaterOutages, http.MethodGet, "/water/outages?location=rustavi", "", "")
+	assert.JSONEq(t, "[]", res.Body.String())
+}
+
+func Test_HandleWaterOutagesSearch(t *testing.T) {
+	h := newTestHTTP(t)
+	res := serve(h.HandleWaterOutagesSearch, http.MethodGet, "/water/outages/search", "", "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = serve(h.HandleWaterOutagesSearch, http.MethodGet, "/water/outages/search?address=მესხიშვილის", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, "[]", res.Body.String())
+}
+
+func Test_HandleWaterReports(t *testing.T) {
+	h := newTestHTTP(t)
+	res := serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "op-token", `{"locationGe":"რუსთავი","addressesGe":["მესხიშვილის ქ."],"start":"2023-10-18T10:00:00Z"}`)
+	var created outageResponse
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	res = serve(h.HandleWaterReports, http.MethodPost, "/water/outages/reports", "bot-token", `{"ref":"manual/missing","status":"still_off"}`)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	body := `{"ref":"` + created.Ref + `","reporter":"42","status":"still_off"}`
+	res = serve(h.HandleWaterReports, http.MethodPost, "/water/outages/reports", "op-token", body)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = serve(h.HandleWaterReports, http.MethodPost, "/water/outages/reports", "bot-token", `{"ref":"`+created.Ref+`","status":"maybe"}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = serve(h.HandleWaterReports, http.MethodPost, "/water/outages/reports", "bot-token", body)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.JSONEq(t, `{"restored":0,"stillOff":1,"confidence":0.6666666666666666,"lastReportAt":"2023-10-18T12:00:00Z"}`, res.Body.String())
+	res = serve(h.HandleWaterReports, http.MethodPost, "/water/outages/reports", "bot-token", body)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+}
+
+func Test_HandleWaterOutageHistory(t *testing.T) {
+	h := newTestHTTP(t)
+	body := `{"locationGe":"რუსთავი","addressesGe":["მესხიშვილის ქ."],"start":"2023-10-18T10:00:00Z","end":"2023-10-18T18:00:00Z"}`
+	res := serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "op-token", body)
+	var created outageResponse
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	body = strings.Replace(body, "18:00", "21:00", 1)
+	res = serve(h.HandleWaterOutages, http.MethodPut, "/water/outages?id="+created.Id, "op-token", body)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = serve(h.HandleWaterOutageHistory, http.MethodGet, "/water/outages/"+created.Id+"/history", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var history historyResponse
+	if err := json.NewDecoder(res.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, created.Ref, history.Ref)
+	assert.Equal(t, time.Date(2023, 10, 18, 18, 0, 0, 0, time.UTC), *history.OriginalEnd)
+	assert.Equal(t, 1, history.EndExtensions)
+	assert.Len(t, history.Revisions, 2)
+	assert.Equal(t, []string{"end"}, history.Revisions[1].Changed)
+
+	res = serve(h.HandleWaterOutageHistory, http.MethodGet, "/water/outages/water.gov.ge/rustavi/2023-10-18T10:00:00Z/history", "", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	res = serve(h.HandleWaterOutageHistory, http.MethodGet, "/water/outages/"+created.Id, "", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func Test_HandleWaterOutagesAsOf(t *testing.T) {
+	h := newTestHTTP(t)
+	body := `{"locationGe":"რუსთავი","addressesGe":["მესხიშვილის ქ."],"start":"2023-10-18T10:00:00Z","end":"2023-10-18T18:00:00Z"}`
+	res := serve(h.HandleWaterOutages, http.MethodPost, "/water/outages", "op-token", body)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = serve(h.HandleWaterOutages, http.MethodGet, "/water/outages?location=rustavi&asOf=2023-10-18T12:00:00Z", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var listed []outageResponse
+	if err := json.NewDecoder(res.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, listed, 1)
+	assert.Nil(t, listed[0].Crowd)
+	res = serve(h.HandleWaterOutages, http.MethodGet, "/water/outages?location=rustavi&asOf=yesterday", "", "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = serve(h.HandleWaterOutagesDiff, http.MethodGet, "/water/outages/diff?location=rustavi&from=2023-10-18T11:00:00Z&to=2023-10-18T12:00:00Z", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var diff diffResponse
+	if err := json.NewDecoder(res.Body).Decode(&diff); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, diff.Added, 1)
+	assert.Empty(t, diff.Removed)
+	assert.Empty(t, diff.Changed)
+	res = serve(h.HandleWaterOutagesDiff, http.MethodGet, "/water/outages/diff?location=rustavi&from=2023-10-18T11:00:00Z", "", "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func Test_HandleRefresh(t *testing.T) {
+	h := newTestHTTP(t)
+	res := serve(h.HandleRefresh, http.MethodPost, "/refresh?provider=water.gov.ge", "bot-token", "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = serve(h.HandleRefresh, http.MethodGet, "/refresh?provider=water.gov.ge", "op-token", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	res = serve(h.HandleRefresh, http.MethodPost, "/refresh?provider=water.gov.ge", "op-token", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func Test_HandleStatus(t *testing.T) {
+	h := newTestHTTP(t)
+	res := serve(h.HandleStatus, http.MethodGet, "/status", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var status statusResponse
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, status.DataAsOf)
+	assert.Empty(t, status.Providers)
+	res = serve(h.HandleStatus, http.MethodPost, "/status", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+
+	res = serve(h.HandleStatusRuns, http.MethodGet, "/status/runs", "", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = serve(h.HandleStatusRuns, http.MethodGet, "/status/runs?limit=none", "", "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = serve(h.HandleStatusRuns, http.MethodGet, "/status/runs?provider=water.gov.ge", "", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	res = serve(h.HandleStatusRuns, http.MethodDelete, "/status/runs", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	assert.Equal(t, http.MethodGet, res.Header().Get("Allow"))
+}
+
+func Test_HandleDebugParse(t *testing.T) {
+	h := newTestHTTP(t)
+	res := serve(h.HandleDebugParse, http.MethodPost, "/debug/parse", "", "<html></html>")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = serve(h.HandleDebugParse, http.MethodPost, "/debug/parse", "bot-token", "<html></html>")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = serve(h.HandleDebugParse, http.MethodPost, "/debug/parse", "op-token", "<html></html>")
+	assert.Equal(t, http.StatusOK, res.Code)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Operators are the people allowed to enter outages by hand, each with a
+// bearer token. The operator name is recorded as the reporter.
+type Operators struct {
+	names  []string
+	tokens [][]byte
+}
+
+// NewOperators parses "name:token" pairs.
+func NewOperators(pairs ...string) (Operators, error) {
+	var ops Operators
+	for _, pair := range pairs {
+		name, token, found := strings.Cut(pair, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !found || name == "" || token == "" {
+			return Operators{}, fmt.Errorf("new operators: %w", errBadOperator)
+		}
+		ops.names = append(ops.names, name)
+		ops.tokens = append(ops.tokens, []byte(token))
+	}
+	return ops, nil
+}
+
+func (o Operators) authenticate(req *http.Request) (string, bool) {
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return "", false
+	}
+	for i, t := range o.tokens {
+		if subtle.ConstantTimeCompare(t, []byte(token)) == 1 {
+			return o.names[i], true
+		}
+	}
+	return "", false
+}
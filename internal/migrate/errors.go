@@ -0,0 +1,9 @@
+package migrate
+
+type errorMigrate string
+
+func (e errorMigrate) Error() string {
+	return string(e)
+}
+
+const errMismatch errorMigrate = "target does not match source"
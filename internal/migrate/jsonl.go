@@ -0,0 +1,227 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+// JSONL is a migration backend kept in memory and written to a file of
+// JSON lines, one record per line, for moving data through a plain file or
+// inspecting it. It is loaded from the file when it exists and written
+// back by Flush.
+type JSONL struct {
+	path  string
+	state *jsonlState
+}
+
+type jsonlState struct {
+	mu        sync.RWMutex
+	outages   map[string]outage.Outage
+	manual    map[string]outage.Outage
+	revisions map[string][]outage.Revision
+	crowd     map[string][]outage.CrowdReport
+}
+
+// jsonlRecord is one line: Type tells which of the other fields is set.
+type jsonlRecord struct {
+	Type     string              `json:"type"`
+	Outage   *outage.Outage      `json:"outage,omitempty"`
+	Revision *outage.Revision    `json:"revision,omitempty"`
+	Crowd    *outage.CrowdReport `json:"crowdReport,omitempty"`
+}
+
+const (
+	jsonlOutage   = "outage"
+	jsonlManual   = "manual"
+	jsonlRevision = "revision"
+	jsonlCrowd    = "crowdReport"
+)
+
+func NewJSONL(path string) (JSONL, error) {
+	j := JSONL{path, &jsonlState{
+		outages:   make(map[string]outage.Outage),
+		manual:    make(map[string]outage.Outage),
+		revisions: make(map[string][]outage.Revision),
+		crowd:     make(map[string][]outage.CrowdReport),
+	}}
+	if err := j.load(); err != nil {
+		return JSONL{}, fmt.Errorf("new jsonl: %w", err)
+	}
+	return j, nil
+}
+
+func (j JSONL) load() error {
+	f, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := j.state
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var r jsonlRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return fmt.Errorf("%s:%d: %w", j.path, line, err)
+		}
+		switch {
+		case r.Type == jsonlOutage && r.Outage != nil:
+			s.outages[r.Outage.Ref()] = *r.Outage
+		case r.Type == jsonlManual && r.Outage != nil:
+			s.manual[r.Outage.Id] = *r.Outage
+		case r.Type == jsonlRevision && r.Revision != nil:
+			s.revisions[r.Revision.OutageRef] = append(s.revisions[r.Revision.OutageRef], *r.Revision)
+		case r.Type == jsonlCrowd && r.Crowd != nil:
+			s.crowd[r.Crowd.OutageRef] = append(s.crowd[r.Crowd.OutageRef], *r.Crowd)
+		default:
+			return fmt.Errorf("%s:%d: unknown record type %q", j.path, line, r.Type)
+		}
+	}
+	return sc.Err()
+}
+
+// Flush writes every record, sorted, through a temporary file.
+func (j JSONL) Flush() error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("flush jsonl: %w", err)
+	}
+	s := j.state
+	s.mu.RLock()
+	var records []jsonlRecord
+	for _, ref := range sortedKeys(s.outages) {
+		o := s.outages[ref]
+		records = append(records, jsonlRecord{Type: jsonlOutage, Outage: &o})
+	}
+	for _, id := range sortedKeys(s.manual) {
+		o := s.manual[id]
+		records = append(records, jsonlRecord{Type: jsonlManual, Outage: &o})
+	}
+	for _, ref := range sortedKeys(s.revisions) {
+		for _, r := range s.revisions[ref] {
+			r := r
+			records = append(records, jsonlRecord{Type: jsonlRevision, Revision: &r})
+		}
+	}
+	for _, ref := range sortedKeys(s.crowd) {
+		for _, r := range s.crowd[ref] {
+			r := r
+			records = append(records, jsonlRecord{Type: jsonlCrowd, Crowd: &r})
+		}
+	}
+	s.mu.RUnlock()
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return handleErr(err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return handleErr(errors.Join(err, tmp.Close(), os.Remove(tmp.Name())))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return handleErr(errors.Join(err, tmp.Close(), os.Remove(tmp.Name())))
+	}
+	if err := tmp.Close(); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	sort.Strings(keys)
+	return keys
+}
+
+func (j JSONL) SaveOutages(ctx context.Context, outages ...outage.Outage) error {
+	s := j.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range outages {
+		s.outages[o.Ref()] = o
+	}
+	return nil
+}
+
+func (j JSONL) GetOutagesPage(ctx context.Context, providerId, cursor string, limit int) ([]outage.Outage, string, error) {
+	s := j.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var outages []outage.Outage
+	for _, ref := range sortedKeys(s.outages) {
+		if o := s.outages[ref]; o.ProviderId == providerId && ref > cursor {
+			outages = append(outages, o)
+		}
+	}
+	if len(outages) <= limit {
+		return outages, "", nil
+	}
+	return outages[:limit], outages[limit-1].Ref(), nil
+}
+
+func (j JSONL) SaveManualOutage(ctx context.Context, o outage.Outage) error {
+	s := j.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manual[o.Id] = o
+	return nil
+}
+
+func (j JSONL) GetManualOutages(ctx context.Context) ([]outage.Outage, error) {
+	s := j.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	outages := lo.Values(s.manual)
+	sort.Slice(outages, func(i, k int) bool {
+		return outages[i].Id < outages[k].Id
+	})
+	return outages, nil
+}
+
+func (j JSONL) SaveRevision(ctx context.Context, r outage.Revision) error {
+	s := j.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revisions[r.OutageRef] = append(s.revisions[r.OutageRef], r)
+	return nil
+}
+
+func (j JSONL) GetRevisions(ctx context.Context, outageRef string) ([]outage.Revision, error) {
+	s := j.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]outage.Revision(nil), s.revisions[outageRef]...), nil
+}
+
+func (j JSONL) SaveCrowdReport(ctx context.Context, r outage.CrowdReport) error {
+	s := j.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crowd[r.OutageRef] = append(s.crowd[r.OutageRef], r)
+	return nil
+}
+
+func (j JSONL) GetCrowdReports(ctx context.Context, outageRef string) ([]outage.CrowdReport, error) {
+	s := j.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]outage.CrowdReport(nil), s.crowd[outageRef]...), nil
+}
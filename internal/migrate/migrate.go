@@ -0,0 +1,466 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+// Source is what the migration reads from every backend.
+type Source interface {
+	// GetOutagesPage returns up to limit outages of a provider after cursor
+	// and the cursor of the next page, empty after the last one.
+	GetOutagesPage(ctx context.Context, providerId, cursor string, limit int) ([]outage.Outage, string, error)
+	GetManualOutages(ctx context.Context) ([]outage.Outage, error)
+	GetRevisions(ctx context.Context, outageRef string) ([]outage.Revision, error)
+	GetCrowdReports(ctx context.Context, outageRef string) ([]outage.CrowdReport, error)
+}
+
+// Target is a backend the migration writes to. It is read back to verify
+// the copy and to skip what is already there, so reruns write nothing
+// twice.
+type Target interface {
+	Source
+	SaveOutages(ctx context.Context, outages ...outage.Outage) error
+	SaveManualOutage(ctx context.Context, o outage.Outage) error
+	SaveRevision(ctx context.Context, r outage.Revision) error
+	SaveCrowdReport(ctx context.Context, r outage.CrowdReport) error
+}
+
+// pageSize is how many outages are read at once, and copied with their
+// revisions and crowd reports between two checkpoints.
+const pageSize = 100
+
+// Migrator copies the outages of the given providers, manual outages, and
+// the revisions and crowd reports of all of them from source to target.
+// Centers are left out: they hold the current state of each service center
+// and the next refresh rebuilds them.
+type Migrator struct {
+	source         Source
+	target         Target
+	providerIds    []string
+	checkpointPath string
+	sl             *slog.Logger
+}
+
+func NewMigrator(source Source, target Target, providerIds []string, checkpointPath string, sl *slog.Logger) Migrator {
+	return Migrator{source, target, providerIds, checkpointPath, sl}
+}
+
+// Tally counts the records of one kind and hashes the fields every backend
+// keeps, so backends that store times or optional fields differently still
+// agree.
+type Tally struct {
+	Count    int    `json:"count"`
+	Checksum string `json:"checksum"`
+}
+
+// Report compares source and target by kind: outages, revisions and
+// crowdReports. Copied counts what this run wrote.
+type Report struct {
+	Copied map[string]int   `json:"copied"`
+	Source map[string]Tally `json:"source"`
+	Target map[string]Tally `json:"target"`
+}
+
+// Mismatches names the kinds whose target tally differs from the source.
+func (r Report) Mismatches() []string {
+	var kinds []string
+	for kind, tally := range r.Source {
+		if r.Target[kind] != tally {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// checkpoint records the finished steps of a run and, for the step in
+// progress, the cursor of the page after the last one copied.
+type checkpoint struct {
+	Done   map[string]bool   `json:"done"`
+	Cursor map[string]string `json:"cursor"`
+}
+
+// Run copies everything the target lacks, checkpointing as it goes, and
+// then verifies the target against the source. A dry run only compares
+// them. The checkpoint is removed once the target verifies.
+func (m Migrator) Run(ctx context.Context, dryRun bool) (Report, error) {
+	handleErr := func(err error) (Report, error) {
+		return Report{}, fmt.Errorf("migrate: %w", err)
+	}
+	copied := map[string]int{"outages": 0, "revisions": 0, "crowdReports": 0}
+	if !dryRun {
+		cp, err := m.loadCheckpoint()
+		if err != nil {
+			return handleErr(err)
+		}
+		for _, providerId := range m.allProviderIds() {
+			if err := m.copyProvider(ctx, providerId, &cp, copied); err != nil {
+				return handleErr(err)
+			}
+		}
+	}
+	report, err := m.Verify(ctx)
+	if err != nil {
+		return handleErr(err)
+	}
+	report.Copied = copied
+	if dryRun {
+		return report, nil
+	}
+	if mismatches := report.Mismatches(); len(mismatches) > 0 {
+		return report, fmt.Errorf("migrate: %s: %w", strings.Join(mismatches, ", "), errMismatch)
+	}
+	if m.checkpointPath != "" {
+		if err := os.Remove(m.checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return handleErr(err)
+		}
+	}
+	return report, nil
+}
+
+// copyProvider copies a provider's outages a page at a time, each page with
+// the revisions and crowd reports of its outages.
+func (m Migrator) copyProvider(ctx context.Context, providerId string, cp *checkpoint, copied map[string]int) error {
+	step := "outages/" + providerId
+	handleErr := func(err error) error {
+		return fmt.Errorf("copy %s: %w", providerId, err)
+	}
+	if cp.Done[step] {
+		return nil
+	}
+	existing, err := m.lines(ctx, m.target, providerId)
+	if err != nil {
+		return handleErr(err)
+	}
+	var n int
+	if err := m.eachPage(ctx, m.source, providerId, cp.Cursor[step], func(outages []outage.Outage, next string) error {
+		saved, err := m.copyOutages(ctx, providerId, outages, existing)
+		if err != nil {
+			return err
+		}
+		n += saved
+		copied["outages"] += saved
+		for _, o := range outages {
+			revisions, reports, err := m.copyHistory(ctx, o.Ref())
+			if err != nil {
+				return err
+			}
+			copied["revisions"] += revisions
+			copied["crowdReports"] += reports
+		}
+		cp.Cursor[step] = next
+		return m.saveCheckpoint(*cp)
+	}); err != nil {
+		return handleErr(err)
+	}
+	cp.Done[step] = true
+	delete(cp.Cursor, step)
+	if err := m.saveCheckpoint(*cp); err != nil {
+		return handleErr(err)
+	}
+	m.sl.Info("copied outages", slog.String("providerId", providerId), slog.Int("outages", n))
+	return nil
+}
+
+// copyOutages saves the outages the target lacks or holds differently;
+// existing maps the refs of the target's outages to their lines.
+func (m Migrator) copyOutages(ctx context.Context, providerId string, outages []outage.Outage, existing map[string]string) (int, error) {
+	var missing []outage.Outage
+	for _, o := range outages {
+		if existing[o.Ref()] != outageLine(o) {
+			missing = append(missing, o)
+		}
+	}
+	if providerId != outage.ManualProviderId {
+		if len(missing) == 0 {
+			return 0, nil
+		}
+		return len(missing), m.target.SaveOutages(ctx, missing...)
+	}
+	for _, o := range missing {
+		if err := m.target.SaveManualOutage(ctx, o); err != nil {
+			return 0, err
+		}
+	}
+	return len(missing), nil
+}
+
+// copyHistory saves the revisions and crowd reports of an outage that the
+// target does not have yet.
+func (m Migrator) copyHistory(ctx context.Context, ref string) (int, int, error) {
+	revisions, err := m.source.GetRevisions(ctx, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	existingRevisions, err := m.target.GetRevisions(ctx, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	haveRevisions := make(map[string]bool, len(existingRevisions))
+	for _, r := range existingRevisions {
+		haveRevisions[revisionLine(r)] = true
+	}
+	var nRevisions int
+	for _, r := range revisions {
+		if haveRevisions[revisionLine(r)] {
+			continue
+		}
+		if err := m.target.SaveRevision(ctx, r); err != nil {
+			return 0, 0, err
+		}
+		nRevisions++
+	}
+	reports, err := m.source.GetCrowdReports(ctx, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	existingReports, err := m.target.GetCrowdReports(ctx, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	haveReports := make(map[string]bool, len(existingReports))
+	for _, r := range existingReports {
+		haveReports[crowdLine(r)] = true
+	}
+	var nReports int
+	for _, r := range reports {
+		if haveReports[crowdLine(r)] {
+			continue
+		}
+		if err := m.target.SaveCrowdReport(ctx, r); err != nil {
+			return 0, 0, err
+		}
+		nReports++
+	}
+	return nRevisions, nReports, nil
+}
+
+// Verify tallies the source and the same records in the target, reading
+// the source a page at a time and keeping only the lines of the target's
+// outages.
+func (m Migrator) Verify(ctx context.Context) (Report, error) {
+	handleErr := func(err error) (Report, error) {
+		return Report{}, fmt.Errorf("verify: %w", err)
+	}
+	kinds := []string{"outages", "revisions", "crowdReports"}
+	tallies := map[string]map[string]*tallier{"source": {}, "target": {}}
+	for _, side := range tallies {
+		for _, kind := range kinds {
+			side[kind] = newTallier()
+		}
+	}
+	for _, providerId := range m.allProviderIds() {
+		targetLines, err := m.lines(ctx, m.target, providerId)
+		if err != nil {
+			return handleErr(err)
+		}
+		if err := m.eachPage(ctx, m.source, providerId, "", func(outages []outage.Outage, _ string) error {
+			for _, o := range outages {
+				ref := o.Ref()
+				tallies["source"]["outages"].add(outageLine(o))
+				if line, found := targetLines[ref]; found {
+					tallies["target"]["outages"].add(line)
+				}
+				for side, store := range map[string]Source{"source": m.source, "target": m.target} {
+					revisions, err := store.GetRevisions(ctx, ref)
+					if err != nil {
+						return err
+					}
+					for _, r := range revisions {
+						tallies[side]["revisions"].add(revisionLine(r))
+					}
+					reports, err := store.GetCrowdReports(ctx, ref)
+					if err != nil {
+						return err
+					}
+					for _, r := range reports {
+						tallies[side]["crowdReports"].add(crowdLine(r))
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			return handleErr(err)
+		}
+	}
+	report := Report{Source: map[string]Tally{}, Target: map[string]Tally{}}
+	for _, kind := range kinds {
+		report.Source[kind] = tallies["source"][kind].tally()
+		report.Target[kind] = tallies["target"][kind].tally()
+	}
+	return report, nil
+}
+
+// allProviderIds adds the manual provider, whose outages are stored apart.
+func (m Migrator) allProviderIds() []string {
+	return append(append([]string(nil), m.providerIds...), outage.ManualProviderId)
+}
+
+// eachPage calls page with every page of a provider's outages in store
+// after cursor and the cursor of the page that follows. Manual outages are
+// few and read as one page.
+func (m Migrator) eachPage(ctx context.Context, store Source, providerId, cursor string, page func(outages []outage.Outage, next string) error) error {
+	if providerId == outage.ManualProviderId {
+		outages, err := store.GetManualOutages(ctx)
+		if err != nil {
+			return err
+		}
+		return page(outages, "")
+	}
+	for {
+		outages, next, err := store.GetOutagesPage(ctx, providerId, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		if err := page(outages, next); err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// lines maps the refs of a provider's outages in store to their lines.
+func (m Migrator) lines(ctx context.Context, store Source, providerId string) (map[string]string, error) {
+	lines := make(map[string]string)
+	err := m.eachPage(ctx, store, providerId, "", func(outages []outage.Outage, _ string) error {
+		for _, o := range outages {
+			lines[o.Ref()] = outageLine(o)
+		}
+		return nil
+	})
+	return lines, err
+}
+
+// tallier sums the hashes of lines, so the checksum does not depend on the
+// order the lines are read in and needs none of them kept.
+type tallier struct {
+	count int
+	sum   *big.Int
+}
+
+func newTallier() *tallier {
+	return &tallier{sum: new(big.Int)}
+}
+
+func (t *tallier) add(line string) {
+	h := sha256.Sum256([]byte(line))
+	t.sum.Add(t.sum, new(big.Int).SetBytes(h[:]))
+	t.count++
+}
+
+func (t *tallier) tally() Tally {
+	sum := new(big.Int).Mod(t.sum, new(big.Int).Lsh(big.NewInt(1), 256))
+	return Tally{t.count, hex.EncodeToString(sum.FillBytes(make([]byte, sha256.Size)))}
+}
+
+// outageLine holds the fields of an outage that every backend keeps.
+func outageLine(o outage.Outage) string {
+	return strings.Join([]string{
+		o.Ref(),
+		string(o.Kind),
+		strconv.FormatInt(o.Start.Unix(), 10),
+		strconv.FormatInt(o.End.Unix(), 10),
+		strconv.Itoa(o.AffectedCustomers),
+		string(o.Status),
+		strings.Join(sortedAddresses(o.AddressesGe), ";"),
+	}, "|")
+}
+
+// sortedAddresses drops repeated addresses and sorts the rest, since not
+// every backend keeps the order they were listed in.
+func sortedAddresses(addresses []string) []string {
+	addresses = lo.Uniq(addresses)
+	sort.Strings(addresses)
+	return addresses
+}
+
+func revisionLine(r outage.Revision) string {
+	return strings.Join([]string{
+		r.OutageRef,
+		strconv.FormatInt(r.ObservedAt.UnixNano(), 10),
+		strings.Join(r.Changed, ","),
+		outageLine(r.Outage),
+	}, "|")
+}
+
+func crowdLine(r outage.CrowdReport) string {
+	return strings.Join([]string{
+		r.OutageRef,
+		strconv.FormatInt(r.ReportedAt.UnixNano(), 10),
+		r.Reporter,
+		r.Address,
+		string(r.Status),
+	}, "|")
+}
+
+func (m Migrator) loadCheckpoint() (checkpoint, error) {
+	cp := checkpoint{Done: map[string]bool{}, Cursor: map[string]string{}}
+	if m.checkpointPath == "" {
+		return cp, nil
+	}
+	raw, err := os.ReadFile(m.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return checkpoint{}, fmt.Errorf("load checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(raw, &cp); err != nil {
+		return checkpoint{}, fmt.Errorf("load checkpoint %s: %w", m.checkpointPath, err)
+	}
+	if cp.Done == nil {
+		cp.Done = map[string]bool{}
+	}
+	if cp.Cursor == nil {
+		cp.Cursor = map[string]string{}
+	}
+	m.sl.Info("resuming migration", slog.String("checkpoint", m.checkpointPath), slog.Int("stepsDone", len(cp.Done)))
+	return cp, nil
+}
+
+// saveCheckpoint writes through a temporary file so a crash mid-write
+// leaves the previous checkpoint intact.
+func (m Migrator) saveCheckpoint(cp checkpoint) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	if m.checkpointPath == "" {
+		return nil
+	}
+	raw, err := json.Marshal(cp)
+	if err != nil {
+		return handleErr(err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.checkpointPath), filepath.Base(m.checkpointPath)+".*")
+	if err != nil {
+		return handleErr(err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		return handleErr(errors.Join(err, tmp.Close(), os.Remove(tmp.Name())))
+	}
+	if err := tmp.Close(); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	if err := os.Rename(tmp.Name(), m.checkpointPath); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package migrate_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/migrate"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2023, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func fixedNow() time.Time {
+	return testNow
+}
+
+func newTestSource(t *testing.T) repo.Memory {
+	t.Helper()
+	ctx := context.Background()
+	m, err := repo.NewMemory("", fixedNow, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scraped := outage.Outage{
+		ProviderId:  "water.gov.ge",
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-2 * time.Hour),
+		End:         testNow.Add(4 * time.Hour),
+		Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+		AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ."},
+		Status:      outage.StatusActive,
+		Source:      outage.SourceOfficial,
+	}
+	extended := scraped
+	extended.End = testNow.Add(6 * time.Hour)
+	manual := outage.Outage{
+		Id:          "3f2a",
+		ProviderId:  outage.ManualProviderId,
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-time.Hour),
+		Location:    outage.Location{TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      outage.StatusActive,
+		Source:      outage.SourceManual,
+		Reporter:    "nino",
+	}
+	if err := m.SaveOutages(ctx, extended); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SaveManualOutage(ctx, manual); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []outage.Revision{
+		{OutageRef: scraped.Ref(), ObservedAt: testNow.Add(-2 * time.Hour), Outage: scraped},
+		{OutageRef: scraped.Ref(), ObservedAt: testNow.Add(-time.Hour), Changed: []string{"end"}, Outage: extended},
+		{OutageRef: manual.Ref(), ObservedAt: testNow.Add(-time.Hour), Outage: manual},
+	} {
+		if err := m.SaveRevision(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SaveCrowdReport(ctx, outage.CrowdReport{
+		OutageRef:  scraped.Ref(),
+		Reporter:   "bot",
+		Address:    "ე.თაყაიშვილის ქ. 5",
+		Status:     outage.ReportStillOff,
+		ReportedAt: testNow.Add(-30 * time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func newTestSQLite(t *testing.T) repo.SQL {
+	t.Helper()
+	s, err := repo.NewSQL(context.Background(), repo.DriverSQLite, "file:"+filepath.Join(t.TempDir(), "outages.db"), fixedNow, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func Test_MigrateToSQLite(t *testing.T) {
+	ctx := context.Background()
+	source := newTestSource(t)
+	target := newTestSQLite(t)
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+	m := migrate.NewMigrator(source, target, []string{"water.gov.ge"}, checkpointPath, slog.Default())
+
+	dry, err := m.Run(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"crowdReports", "outages", "revisions"}, dry.Mismatches())
+	assert.Equal(t, 0, dry.Target["outages"].Count)
+
+	report, err := m.Run(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, report.Mismatches())
+	assert.Equal(t, map[string]int{"outages": 2, "revisions": 3, "crowdReports": 1}, report.Copied)
+	assert.Equal(t, migrate.Tally{Count: 3, Checksum: report.Source["revisions"].Checksum}, report.Target["revisions"])
+	_, err = os.Stat(checkpointPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// A second run finds everything in place and writes nothing.
+	again, err := m.Run(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]int{"outages": 0, "revisions": 0, "crowdReports": 0}, again.Copied)
+}
+
+func Test_MigrateResumes(t *testing.T) {
+	ctx := context.Background()
+	source := newTestSource(t)
+	path := filepath.Join(t.TempDir(), "dump.jsonl")
+	target, err := migrate.NewJSONL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+	raw, err := json.Marshal(map[string]any{"done": map[string]bool{
+		"outages/water.gov.ge": true,
+		"history/water.gov.ge": true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(checkpointPath, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := migrate.NewMigrator(source, target, []string{"water.gov.ge"}, checkpointPath, slog.Default())
+
+	// Steps the checkpoint marks done are skipped, so the scraped outage
+	// is missing and the run fails verification, keeping the checkpoint.
+	report, err := m.Run(ctx, false)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]int{"outages": 1, "revisions": 1, "crowdReports": 0}, report.Copied)
+	_, err = os.Stat(checkpointPath)
+	assert.NoError(t, err)
+
+	if err := os.Remove(checkpointPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := migrate.NewJSONL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = migrate.NewMigrator(source, reloaded, []string{"water.gov.ge"}, "", slog.Default()).Run(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, report.Mismatches())
+}
+
+func Test_MigratePages(t *testing.T) {
+	ctx := context.Background()
+	source := newTestSource(t)
+	var outages []outage.Outage
+	for i := 0; i < 250; i++ {
+		outages = append(outages, outage.Outage{
+			ProviderId:  "gwp.ge",
+			Kind:        outage.KindWater,
+			Start:       testNow.Add(-time.Duration(i) * time.Hour),
+			End:         testNow.Add(-time.Duration(i)*time.Hour + 3*time.Hour),
+			Location:    outage.Location{Id: "9", TitleGe: "საბურთალო", TitleLat: "saburtalo"},
+			AddressesGe: []string{"ვაჟა-ფშაველას გამზ.", "ნუცუბიძის ქ."},
+			Status:      outage.StatusActive,
+			Source:      outage.SourceOfficial,
+		})
+	}
+	if err := source.SaveOutages(ctx, outages...); err != nil {
+		t.Fatal(err)
+	}
+	target, err := migrate.NewJSONL(filepath.Join(t.TempDir(), "dump.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The target lists the addresses of one outage in another order, which
+	// is the same outage.
+	reordered := outages[0]
+	reordered.AddressesGe = []string{"ნუცუბიძის ქ.", "ვაჟა-ფშაველას გამზ."}
+	if err := target.SaveOutages(ctx, reordered); err != nil {
+		t.Fatal(err)
+	}
+	report, err := migrate.NewMigrator(source, target, []string{"gwp.ge"}, "", slog.Default()).Run(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 249+1, report.Copied["outages"], "every page but the outage the target has, and the manual one")
+	assert.Equal(t, 251, report.Target["outages"].Count)
+	assert.Empty(t, report.Mismatches())
+}
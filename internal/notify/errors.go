@@ -0,0 +1,11 @@
+package notify
+
+type errorNotify string
+
+func (e errorNotify) Error() string {
+	return string(e)
+}
+
+const (
+	errBadStatus errorNotify = "webhook answered with a non-2xx status"
+)
@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// Webhook POSTs every notification as JSON to each of its URLs. The
+// notification id goes in the Idempotency-Key header, so receivers can drop
+// the redeliveries an at-least-once outbox makes.
+type Webhook struct {
+	c    *http.Client
+	urls []string
+}
+
+func NewWebhook(c *http.Client, urls ...string) Webhook {
+	return Webhook{c, urls}
+}
+
+type notificationPayload struct {
+	Id        string        `json:"id"`
+	OutageRef string        `json:"outageRef"`
+	Changed   []string      `json:"changed,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Outage    outagePayload `json:"outage"`
+}
+
+type outagePayload struct {
+	ProviderId        string            `json:"providerId"`
+	Kind              outage.Kind       `json:"kind"`
+	Start             time.Time         `json:"start"`
+	End               time.Time         `json:"end"`
+	AffectedCustomers int               `json:"affectedCustomers"`
+	LocationId        string            `json:"locationId"`
+	TitleGe           string            `json:"titleGe"`
+	TitleLat          string            `json:"titleLat"`
+	AddressesGe       []string          `json:"addressesGe"`
+	Status            outage.Status     `json:"status"`
+	Source            outage.Source     `json:"source"`
+	AnnouncementURI   string            `json:"announcementUri,omitempty"`
+	Extra             map[string]string `json:"extra,omitempty"`
+}
+
+func newNotificationPayload(n outage.Notification) notificationPayload {
+	o := n.Outage
+	return notificationPayload{
+		Id:        n.Id,
+		OutageRef: n.OutageRef,
+		Changed:   n.Changed,
+		CreatedAt: n.CreatedAt,
+		Outage: outagePayload{
+			ProviderId:        o.ProviderId,
+			Kind:              o.Kind,
+			Start:             o.Start,
+			End:               o.End,
+			AffectedCustomers: o.AffectedCustomers,
+			LocationId:        o.Location.Id,
+			TitleGe:           o.Location.TitleGe,
+			TitleLat:          o.Location.TitleLat,
+			AddressesGe:       o.AddressesGe,
+			Status:            o.Status,
+			Source:            o.Source,
+			AnnouncementURI:   o.AnnouncementURI,
+			Extra:             o.Extra,
+		},
+	}
+}
+
+// Notify fails unless every URL answers with a 2xx status. A retry posts to
+// all of them again.
+func (w Webhook) Notify(ctx context.Context, n outage.Notification) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("notify webhook %s: %w", n.Id, err)
+	}
+	body, err := json.Marshal(newNotificationPayload(n))
+	if err != nil {
+		return handleErr(err)
+	}
+	for _, url := range w.urls {
+		if err := w.post(ctx, url, n.Id, body); err != nil {
+			return handleErr(err)
+		}
+	}
+	return nil
+}
+
+func (w Webhook) post(ctx context.Context, url, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", id)
+	resp, err := w.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s answered %d", errBadStatus, url, resp.StatusCode)
+	}
+	return nil
+}
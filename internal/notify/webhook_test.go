@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Webhook(t *testing.T) {
+	var (
+		keys     []string
+		payloads []notificationPayload
+		fail     = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		var p notificationPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		payloads = append(payloads, p)
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	n, err := outage.NewNotification(outage.Revision{}, outage.Revision{
+		OutageRef: "water.gov.ge/ozurgetis/1709287200",
+		Changed:   []string{"end"},
+		Outage: outage.Outage{
+			ProviderId: "water.gov.ge",
+			Kind:       outage.KindWater,
+			Start:      now,
+			End:        now.Add(4 * time.Hour),
+			Location:   outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+			Status:     outage.StatusActive,
+			Source:     outage.SourceOfficial,
+		},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWebhook(srv.Client(), srv.URL)
+
+	err = w.Notify(context.Background(), n)
+	assert.True(t, errors.Is(err, errBadStatus), err)
+	fail = false
+	if err := w.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{n.Id, n.Id}, keys)
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, n.OutageRef, payloads[1].OutageRef)
+	assert.Equal(t, []string{"end"}, payloads[1].Changed)
+	assert.Equal(t, "ozurgetis", payloads[1].Outage.TitleLat)
+	assert.True(t, now.Add(4*time.Hour).Equal(payloads[1].Outage.End))
+}
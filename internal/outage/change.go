@@ -0,0 +1,76 @@
+package outage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Change is one write to an outage as a change feed saw it. Old is zero for
+// a new outage and New is zero for a deleted one.
+type Change struct {
+	Old        Outage
+	New        Outage
+	ObservedAt time.Time
+}
+
+// WithChangeFeed stops the service from comparing every saved outage with
+// its latest revision: writes reach HandleChange from the storage change
+// feed instead, whichever replica or API made them.
+func (s Service) WithChangeFeed() Service {
+	s.changeFeed = true
+	return s
+}
+
+// HandleChange records a revision of the outage a change wrote. Deletions,
+// such as TTL expiry, record nothing, and neither do writes that changed
+// none of the fields a revision tracks. With an outbox a scraped outage's
+// revision is followed by its notification. A redelivered change saves the
+// same revision again, which the feed's storage has to treat as an
+// overwrite, and queues the same notification, which the outbox ignores.
+func (s Service) HandleChange(ctx context.Context, c Change) error {
+	if c.New.Start.IsZero() {
+		return nil
+	}
+	r := Revision{OutageRef: c.New.Ref(), ObservedAt: c.ObservedAt, Outage: c.New}
+	if !c.Old.Start.IsZero() {
+		if r.Changed = ChangedFields(c.Old, c.New); len(r.Changed) == 0 {
+			return nil
+		}
+	}
+	if err := s.repo.SaveRevision(ctx, r); err != nil {
+		return fmt.Errorf("handle change %s: %w", r.OutageRef, err)
+	}
+	if c.New.Id != "" || !s.outbox {
+		return nil
+	}
+	previous, err := s.revisionBefore(ctx, r)
+	if err != nil {
+		return fmt.Errorf("handle change %s: %w", r.OutageRef, err)
+	}
+	notifications, err := s.notifications([]transition{{previous, r}})
+	if err != nil {
+		return fmt.Errorf("handle change %s: %w", r.OutageRef, err)
+	}
+	if err := s.repo.SaveNotifications(ctx, notifications...); err != nil {
+		return fmt.Errorf("handle change %s: %w", r.OutageRef, err)
+	}
+	return nil
+}
+
+// revisionBefore returns the latest revision of r's outage observed before
+// r, or the zero Revision when there is none. A redelivered change finds the
+// same one, even though its own revision was saved already.
+func (s Service) revisionBefore(ctx context.Context, r Revision) (Revision, error) {
+	revisions, err := s.repo.GetRevisions(ctx, r.OutageRef)
+	if err != nil {
+		return Revision{}, err
+	}
+	var previous Revision
+	for _, earlier := range revisions {
+		if earlier.ObservedAt.Before(r.ObservedAt) {
+			previous = earlier
+		}
+	}
+	return previous, nil
+}
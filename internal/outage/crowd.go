@@ -0,0 +1,224 @@
+package outage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+)
+
+type ReportStatus string
+
+const (
+	ReportRestored ReportStatus = "restored"
+	ReportStillOff ReportStatus = "still_off"
+)
+
+// CrowdReport is one user telling whether the supply at an address of an
+// outage is back.
+type CrowdReport struct {
+	OutageRef  string
+	Reporter   string
+	Address    string
+	Status     ReportStatus
+	ReportedAt time.Time
+}
+
+// Crowd aggregates the reports on one outage. Only the latest report of
+// each reporter counts. Confidence is the smoothed share of reporters who
+// say the supply is still off, so it starts at 0.5 with no reports.
+// RestoredAt is the median time reporters saw the supply return, set once
+// most of them say it did.
+type Crowd struct {
+	Restored     int
+	StillOff     int
+	Confidence   float64
+	RestoredAt   time.Time
+	LastReportAt time.Time
+}
+
+// Ref identifies an outage across providers: manual outages by their id,
+// scraped ones by provider, location, start and Key when there is one.
+func (o Outage) Ref() string {
+	if o.Id != "" {
+		return ManualProviderId + "/" + o.Id
+	}
+	ref := o.ProviderId + "/" + o.Location.TitleLat + "/" + o.Start.UTC().Format(time.RFC3339)
+	if o.Key != "" {
+		ref += "/" + o.Key
+	}
+	return ref
+}
+
+// ParseRef reads back what a Ref identifies: the Id of a manual outage, or
+// the provider, location, start and Key of a scraped one.
+func ParseRef(ref string) (Outage, error) {
+	malformed := fmt.Errorf("%w: malformed outage ref %q", ErrInvalidOutage, ref)
+	providerId, rest, _ := strings.Cut(ref, "/")
+	if providerId == "" || rest == "" {
+		return Outage{}, malformed
+	}
+	if providerId == ManualProviderId {
+		return Outage{Id: rest, ProviderId: ManualProviderId}, nil
+	}
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return Outage{}, malformed
+	}
+	start, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return Outage{}, malformed
+	}
+	o := Outage{ProviderId: providerId, Location: Location{TitleLat: parts[0]}, Start: start}
+	if len(parts) == 3 {
+		o.Key = parts[2]
+	}
+	return o, nil
+}
+
+// AddressKey is a Key for providers that list several rows for one district
+// with the same start and no id of their own: a hash of the row's distinct
+// addresses in sorted order, so it does not depend on how they are listed.
+func AddressKey(addresses []string) string {
+	sorted := slices.Clone(addresses)
+	slices.Sort(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(slices.Compact(sorted), "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func AggregateCrowd(reports []CrowdReport) Crowd {
+	latest := make(map[string]CrowdReport)
+	for _, r := range reports {
+		if l, found := latest[r.Reporter]; !found || r.ReportedAt.After(l.ReportedAt) {
+			latest[r.Reporter] = r
+		}
+	}
+	var (
+		crowd    Crowd
+		restored []time.Time
+	)
+	for _, r := range latest {
+		switch r.Status {
+		case ReportRestored:
+			crowd.Restored++
+			restored = append(restored, r.ReportedAt)
+		case ReportStillOff:
+			crowd.StillOff++
+		}
+		if r.ReportedAt.After(crowd.LastReportAt) {
+			crowd.LastReportAt = r.ReportedAt
+		}
+	}
+	crowd.Confidence = float64(crowd.StillOff+1) / float64(crowd.Restored+crowd.StillOff+2)
+	if crowd.Restored > crowd.StillOff {
+		sort.Slice(restored, func(i, j int) bool {
+			return restored[i].Before(restored[j])
+		})
+		crowd.RestoredAt = restored[(len(restored)-1)/2]
+	}
+	return crowd
+}
+
+// ReportLimiter caps how many reports one reporter may send per window.
+// Reporters with nothing sent in the last window are swept out once a
+// window, so the map does not grow with every reporter ever seen.
+type ReportLimiter struct {
+	mu        sync.Mutex
+	max       int
+	window    time.Duration
+	sent      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewReportLimiter(max int, window time.Duration) *ReportLimiter {
+	return &ReportLimiter{
+		max:    max,
+		window: window,
+		sent:   make(map[string][]time.Time),
+	}
+}
+
+func (l *ReportLimiter) allow(reporter string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= l.window {
+		for r := range l.sent {
+			l.prune(r, now)
+		}
+		l.lastSweep = now
+	}
+	recent := l.prune(reporter, now)
+	if len(recent) >= l.max {
+		return false
+	}
+	l.sent[reporter] = append(recent, now)
+	return true
+}
+
+// prune drops the reporter's reports older than the window, and the
+// reporter with them when none are left.
+func (l *ReportLimiter) prune(reporter string, now time.Time) []time.Time {
+	var recent []time.Time
+	for _, t := range l.sent[reporter] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(l.sent, reporter)
+		return nil
+	}
+	l.sent[reporter] = recent
+	return recent
+}
+
+func (s Service) ReportCrowd(ctx context.Context, r CrowdReport) (Crowd, error) {
+	handleErr := func(err error) (Crowd, error) {
+		return Crowd{}, fmt.Errorf("report crowd: %w", err)
+	}
+	r.Address = address.Normalize(r.Address)
+	switch {
+	case r.Reporter == "":
+		return handleErr(fmt.Errorf("%w: no reporter", ErrInvalidOutage))
+	case r.Status != ReportRestored && r.Status != ReportStillOff:
+		return handleErr(fmt.Errorf("%w: unknown report status %q", ErrInvalidOutage, r.Status))
+	}
+	if _, err := s.outageByRef(ctx, r.OutageRef); err != nil {
+		return handleErr(err)
+	}
+	r.ReportedAt = s.now()
+	if !s.reportLimiter.allow(r.Reporter, r.ReportedAt) {
+		return handleErr(ErrRateLimited)
+	}
+	if err := s.repo.SaveCrowdReport(ctx, r); err != nil {
+		return handleErr(err)
+	}
+	return s.GetCrowd(ctx, r.OutageRef)
+}
+
+// outageByRef looks up the outage a ref points at, ended or not.
+func (s Service) outageByRef(ctx context.Context, ref string) (Outage, error) {
+	key, err := ParseRef(ref)
+	if err != nil {
+		return Outage{}, err
+	}
+	if key.Id != "" {
+		return s.repo.GetManualOutage(ctx, key.Id)
+	}
+	return s.repo.GetOutage(ctx, key.ProviderId, key.Location.TitleLat, key.Start, key.Key)
+}
+
+func (s Service) GetCrowd(ctx context.Context, ref string) (Crowd, error) {
+	reports, err := s.repo.GetCrowdReports(ctx, ref)
+	if err != nil {
+		return Crowd{}, fmt.Errorf("get crowd: %w", err)
+	}
+	return AggregateCrowd(reports), nil
+}
@@ -0,0 +1,46 @@
+package outage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AggregateCrowd(t *testing.T) {
+	at := time.Date(2023, 10, 18, 18, 0, 0, 0, time.UTC)
+	assert.Equal(t, Crowd{Confidence: 0.5}, AggregateCrowd(nil))
+	reports := []CrowdReport{
+		{Reporter: "bot:1", Status: ReportStillOff, ReportedAt: at},
+		{Reporter: "bot:1", Status: ReportRestored, ReportedAt: at.Add(2 * time.Hour)},
+		{Reporter: "bot:2", Status: ReportRestored, ReportedAt: at.Add(time.Hour)},
+		{Reporter: "bot:3", Status: ReportRestored, ReportedAt: at.Add(3 * time.Hour)},
+		{Reporter: "bot:4", Status: ReportStillOff, ReportedAt: at.Add(30 * time.Minute)},
+	}
+	assert.Equal(t, Crowd{
+		Restored:     3,
+		StillOff:     1,
+		Confidence:   2.0 / 6.0,
+		RestoredAt:   at.Add(2 * time.Hour),
+		LastReportAt: at.Add(3 * time.Hour),
+	}, AggregateCrowd(reports))
+}
+
+func Test_AddressKey(t *testing.T) {
+	key := AddressKey([]string{"ვეკუას ქ.", "ბოჭორიშვილის ქ."})
+	assert.Equal(t, key, AddressKey([]string{"ბოჭორიშვილის ქ.", "ვეკუას ქ.", "ვეკუას ქ."}))
+	assert.NotEqual(t, key, AddressKey([]string{"ვეკუას ქ."}))
+}
+
+func Test_ReportLimiter(t *testing.T) {
+	at := time.Date(2023, 10, 18, 18, 0, 0, 0, time.UTC)
+	l := NewReportLimiter(2, time.Hour)
+	assert.True(t, l.allow("bot:1", at))
+	assert.True(t, l.allow("bot:1", at.Add(time.Minute)))
+	assert.False(t, l.allow("bot:1", at.Add(2*time.Minute)))
+	assert.True(t, l.allow("bot:2", at.Add(2*time.Minute)))
+	assert.True(t, l.allow("bot:1", at.Add(time.Hour)))
+	assert.True(t, l.allow("bot:3", at.Add(3*time.Hour)))
+	assert.Len(t, l.sent, 1)
+	assert.Contains(t, l.sent, "bot:3")
+}
@@ -0,0 +1,20 @@
+package outage
+
+type errorOutage string
+
+func (e errorOutage) Error() string {
+	return string(e)
+}
+
+const (
+	errDuplicateProvider errorOutage = "duplicate provider"
+	errBadInterval       errorOutage = "refresh interval must be positive"
+	errBadTTL            errorOutage = "lease ttl must be positive"
+	errBadSchedule       errorOutage = "schedule durations must not be negative"
+	ErrNotFound          errorOutage = "outage not found"
+	ErrInvalidOutage     errorOutage = "invalid outage"
+	ErrRateLimited       errorOutage = "too many reports"
+	ErrNoNotification    errorOutage = "notification not found"
+	ErrNoProvider        errorOutage = "provider not found"
+	ErrNoAddressIndex    errorOutage = "storage has no address index"
+)
@@ -0,0 +1,199 @@
+package outage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+type RunReason string
+
+const (
+	ReasonStartup  RunReason = "startup"
+	ReasonSchedule RunReason = "schedule"
+	ReasonTrigger  RunReason = "trigger"
+)
+
+// Run is the journal entry of one refresh of a provider.
+type Run struct {
+	ProviderId string
+	Reason     RunReason
+	StartedAt  time.Time
+	EndedAt    time.Time
+	Pages      int
+	CacheHits  int
+	Parsed     int
+	Saved      int
+	Errors     []string
+}
+
+func (r Run) Duration() time.Duration {
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+func (r Run) Ok() bool {
+	return len(r.Errors) == 0
+}
+
+// runStats counts what a refresh fetched. The transport of the providers
+// reaches the stats of the run it serves through the context, with
+// CountPage and CountCacheHit.
+type runStats struct {
+	pages     atomic.Int64
+	cacheHits atomic.Int64
+}
+
+type runStatsKey struct{}
+
+func withRunStats(ctx context.Context, stats *runStats) context.Context {
+	return context.WithValue(ctx, runStatsKey{}, stats)
+}
+
+// statsOf returns the stats of the refresh running in ctx, or nil outside
+// of one.
+func statsOf(ctx context.Context) *runStats {
+	stats, _ := ctx.Value(runStatsKey{}).(*runStats)
+	return stats
+}
+
+// CountPage counts a page fetched for the refresh running in ctx.
+func CountPage(ctx context.Context) {
+	if s := statsOf(ctx); s != nil {
+		s.pages.Add(1)
+	}
+}
+
+// CountCacheHit counts a page the refresh running in ctx was served from a
+// cache instead of fetching it.
+func CountCacheHit(ctx context.Context) {
+	if s := statsOf(ctx); s != nil {
+		s.cacheHits.Add(1)
+	}
+}
+
+// refreshRun refreshes a provider and journals the run. A journal that
+// cannot be written is logged with the refresh error, not in its place.
+func (s Service) refreshRun(ctx context.Context, provider Provider, reason RunReason) ([]Outage, error) {
+	run := Run{ProviderId: provider.Id(), Reason: reason, StartedAt: s.now()}
+	var stats runStats
+	outages, err := s.refreshProvider(withRunStats(ctx, &stats), provider, &run)
+	run.EndedAt = s.now()
+	run.Pages, run.CacheHits = int(stats.pages.Load()), int(stats.cacheHits.Load())
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+	}
+	if saveErr := s.repo.SaveRun(ctx, run); saveErr != nil {
+		err = errors.Join(err, fmt.Errorf("journal run: %w", saveErr))
+	}
+	return outages, err
+}
+
+const (
+	defaultRunsLimit = 50
+	maxRunsLimit     = 500
+	// statusWindow is how many of a provider's latest runs the status
+	// looks through for its last success and recent failures.
+	statusWindow   = 100
+	recentFailures = 10
+)
+
+// GetRuns returns the latest runs of a provider, or of every provider when
+// providerId is empty, newest first.
+func (s Service) GetRuns(ctx context.Context, providerId string, limit int) ([]Run, error) {
+	handleErr := func(err error) ([]Run, error) {
+		return nil, fmt.Errorf("get runs: %w", err)
+	}
+	if limit <= 0 {
+		limit = defaultRunsLimit
+	}
+	limit = min(limit, maxRunsLimit)
+	providerIds := []string{providerId}
+	if providerId == "" {
+		providerIds = s.providerIds()
+	} else if !s.registry.has(providerId) {
+		return handleErr(ErrNoProvider)
+	}
+	var runs []Run
+	for _, id := range providerIds {
+		providerRuns, err := s.repo.GetRuns(ctx, id, limit)
+		if err != nil {
+			return handleErr(err)
+		}
+		runs = append(runs, providerRuns...)
+	}
+	slices.SortStableFunc(runs, func(a, b Run) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	return runs[:min(limit, len(runs))], nil
+}
+
+func (s Service) providerIds() []string {
+	registrations := s.registry.Registrations()
+	ids := make([]string, len(registrations))
+	for i, reg := range registrations {
+		ids[i] = reg.Provider.Id()
+	}
+	return ids
+}
+
+// ProviderStatus sums up the latest runs of a provider. Age is how old its
+// data is, from the end of its last successful run, and zero without one.
+// RecentFailures are the latest failed runs, newest first.
+type ProviderStatus struct {
+	ProviderId     string
+	LastRun        *Run
+	LastSuccess    *Run
+	Age            time.Duration
+	RecentFailures []Run
+}
+
+// RefreshStatus sums up every provider. DataAsOf is the end of the oldest last
+// success, so every provider's data is at least that fresh; it is zero
+// while a provider has not succeeded yet.
+type RefreshStatus struct {
+	Providers []ProviderStatus
+	DataAsOf  time.Time
+}
+
+func (s Service) GetRefreshStatus(ctx context.Context) (RefreshStatus, error) {
+	now := s.now()
+	var status RefreshStatus
+	complete := true
+	for _, id := range s.providerIds() {
+		runs, err := s.repo.GetRuns(ctx, id, statusWindow)
+		if err != nil {
+			return RefreshStatus{}, fmt.Errorf("get refresh status: %w", err)
+		}
+		ps := ProviderStatus{ProviderId: id}
+		for i, r := range runs {
+			if i == 0 {
+				ps.LastRun = &runs[i]
+			}
+			if r.Ok() {
+				if ps.LastSuccess == nil {
+					ps.LastSuccess = &runs[i]
+				}
+				continue
+			}
+			if len(ps.RecentFailures) < recentFailures {
+				ps.RecentFailures = append(ps.RecentFailures, r)
+			}
+		}
+		if ps.LastSuccess == nil {
+			complete = false
+		} else {
+			ps.Age = now.Sub(ps.LastSuccess.EndedAt)
+			if status.DataAsOf.IsZero() || ps.LastSuccess.EndedAt.Before(status.DataAsOf) {
+				status.DataAsOf = ps.LastSuccess.EndedAt
+			}
+		}
+		status.Providers = append(status.Providers, ps)
+	}
+	if !complete {
+		status.DataAsOf = time.Time{}
+	}
+	return status, nil
+}
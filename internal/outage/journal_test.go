@@ -0,0 +1,104 @@
+package outage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPagesServer serves a map page the client can revalidate by its ETag and
+// a problem page it has to fetch every time.
+func newPagesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/map", func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		res.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(res, "<html>map</html>")
+	})
+	mux.HandleFunc("/problem", func(res http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(res, "<html>problem</html>")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_Journal(t *testing.T) {
+	clock := newFakeClock(testNow)
+	srv := newPagesServer(t)
+	provider := &outage.FakeProvider{
+		Client: &http.Client{Transport: parser.NewRefreshTransport(http.DefaultTransport)},
+		Pages:  []string{srv.URL + "/map", srv.URL + "/problem"},
+	}
+	provider.Set([]outage.Outage{{
+		Start:    testNow.Add(time.Hour),
+		End:      testNow.Add(4 * time.Hour),
+		Location: outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+	}}, nil)
+	s, _, stop := startScheduledService(t, clock, 0, outage.Registration{
+		Provider: provider,
+		Interval: time.Hour,
+	})
+	defer stop()
+
+	timer := clock.wait(t)
+	provider.Set(nil, errors.New("upstream is down"))
+	clock.fire(timer)
+	clock.wait(t)
+	if err := s.TriggerRefresh(context.Background(), "water.gov.ge"); err != nil {
+		t.Fatal(err)
+	}
+	clock.wait(t)
+
+	ctx := context.Background()
+	runs, err := s.GetRuns(ctx, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, runs, 3)
+	assert.Equal(t, []outage.RunReason{outage.ReasonTrigger, outage.ReasonSchedule, outage.ReasonStartup},
+		[]outage.RunReason{runs[0].Reason, runs[1].Reason, runs[2].Reason})
+	first := runs[2]
+	assert.True(t, first.Ok())
+	assert.Equal(t, testNow, first.StartedAt)
+	assert.Equal(t, 2, first.Pages)
+	assert.Zero(t, first.CacheHits)
+	assert.Equal(t, 1, runs[1].Pages, "the problem page is fetched again")
+	assert.Equal(t, 1, runs[1].CacheHits, "the map did not change")
+	assert.Equal(t, 1, first.Parsed)
+	assert.Equal(t, 1, first.Saved)
+	assert.False(t, runs[0].Ok())
+	assert.Contains(t, runs[0].Errors[0], "upstream is down")
+
+	runs, err = s.GetRuns(ctx, "water.gov.ge", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, runs, 1)
+	_, err = s.GetRuns(ctx, "missing", 1)
+	assert.ErrorIs(t, err, outage.ErrNoProvider)
+
+	status, err := s.GetRefreshStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testNow, status.DataAsOf)
+	assert.Len(t, status.Providers, 1)
+	ps := status.Providers[0]
+	assert.Equal(t, outage.ReasonTrigger, ps.LastRun.Reason)
+	assert.Equal(t, first, *ps.LastSuccess)
+	assert.Equal(t, time.Hour, ps.Age)
+	assert.Len(t, ps.RecentFailures, 2)
+}
@@ -0,0 +1,114 @@
+package outage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Leases are named, expiring locks held by one owner at a time, shared by
+// every replica through storage.
+type Leases interface {
+	// AcquireLease takes the lease for owner until the given time, or
+	// renews it when owner holds it already. It reports false while
+	// another owner holds it unexpired at now.
+	AcquireLease(ctx context.Context, name, owner string, now, until time.Time) (bool, error)
+	// ReleaseLease gives the lease up if owner holds it.
+	ReleaseLease(ctx context.Context, name, owner string) error
+}
+
+// Leader runs work on one replica at a time. Replicas campaign for a lease
+// every ttl/3; the one holding it runs the work and renews the lease on the
+// same schedule. A leader that fails to renew stops the work right away,
+// before its lease can run out, so two leaders never overlap as long as
+// clocks agree to within ttl/3. A leader that dies is replaced within
+// ttl plus ttl/3, and one that shuts down releases the lease, which is
+// picked up at the next campaign.
+type Leader struct {
+	leases Leases
+	name   string
+	owner  string
+	ttl    time.Duration
+	now    func() time.Time
+	sl     *slog.Logger
+}
+
+func NewLeader(leases Leases, name, owner string, ttl time.Duration, now func() time.Time, sl *slog.Logger) (Leader, error) {
+	if ttl <= 0 {
+		return Leader{}, fmt.Errorf("new leader %s: %w", name, errBadTTL)
+	}
+	return Leader{leases, name, owner, ttl, now, sl}, nil
+}
+
+// Lead campaigns until ctx is done and runs every one of works in its own
+// goroutine while leading. The works get a context that is cancelled when
+// leadership is lost and should return promptly then: Lead waits for them
+// before it campaigns again or returns.
+func (l Leader) Lead(ctx context.Context, works ...func(ctx context.Context)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	var (
+		leading bool
+		cancel  context.CancelFunc
+		wg      sync.WaitGroup
+	)
+	stepDown := func() {
+		cancel()
+		wg.Wait()
+		leading = false
+	}
+	for {
+		acquired, err := l.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			l.sl.Error("acquire leader lease", slog.String("lease", l.name), slog.Any("err", err))
+		}
+		switch {
+		case acquired && !leading:
+			l.sl.Info("became leader", slog.String("lease", l.name), slog.String("owner", l.owner))
+			cancel = start(ctx, &wg, works)
+			leading = true
+		case !acquired && leading:
+			l.sl.Warn("lost leadership", slog.String("lease", l.name), slog.String("owner", l.owner))
+			stepDown()
+		}
+		select {
+		case <-ctx.Done():
+			if leading {
+				stepDown()
+				// ctx is done, so the release gets a context of its own.
+				releaseCtx, cancelRelease := context.WithTimeout(context.Background(), l.ttl/3)
+				if err := l.leases.ReleaseLease(releaseCtx, l.name, l.owner); err != nil {
+					l.sl.Error("release leader lease", slog.String("lease", l.name), slog.Any("err", err))
+				}
+				cancelRelease()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// start runs the works until the returned cancel is called.
+func start(ctx context.Context, wg *sync.WaitGroup, works []func(ctx context.Context)) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	for _, work := range works {
+		work := work
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx)
+		}()
+	}
+	return cancel
+}
+
+// acquire gives up after ttl/3, so a slow renewal makes a leader step down
+// before its lease can run out under it.
+func (l Leader) acquire(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.ttl/3)
+	defer cancel()
+	now := l.now()
+	return l.leases.AcquireLease(ctx, l.name, l.owner, now, now.Add(l.ttl))
+}
@@ -0,0 +1,78 @@
+package outage_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Leader(t *testing.T) {
+	const ttl = 60 * time.Millisecond
+	store, err := repo.NewMemory("", time.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		leading [2]atomic.Bool
+		ctxs    [2]context.Context
+		cancels [2]context.CancelFunc
+		wg      sync.WaitGroup
+	)
+	for i, owner := range []string{"a", "b"} {
+		i := i
+		leader, err := outage.NewLeader(store, "leader", owner, ttl, time.Now, slog.Default())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctxs[i], cancels[i] = context.WithCancel(context.Background())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leader.Lead(ctxs[i], func(ctx context.Context) {
+				leading[i].Store(true)
+				<-ctx.Done()
+				leading[i].Store(false)
+			})
+		}()
+	}
+	defer func() {
+		cancels[0]()
+		cancels[1]()
+		wg.Wait()
+	}()
+	both := func() bool {
+		return leading[0].Load() && leading[1].Load()
+	}
+	assert.Eventually(t, func() bool {
+		return leading[0].Load() || leading[1].Load()
+	}, time.Second, ttl/6)
+	first := 0
+	if leading[1].Load() {
+		first = 1
+	}
+	// Leadership stays put while the leader renews.
+	time.Sleep(2 * ttl)
+	assert.True(t, leading[first].Load())
+	assert.False(t, both())
+
+	cancels[first]()
+	assert.Eventually(t, func() bool {
+		return leading[1-first].Load() && !leading[first].Load()
+	}, ttl+ttl/3+time.Second, ttl/6, "the other replica takes over")
+}
+
+func Test_NewLeaderBadTTL(t *testing.T) {
+	store, err := repo.NewMemory("", time.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = outage.NewLeader(store, "leader", "a", 0, time.Now, slog.Default())
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package outage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const announcementLinkWindow = 12 * time.Hour
+
+// LinkAnnouncements copies the announcement URI of a planned-works article
+// onto the live outage it later became. An announcement matches when it is
+// for the same service center and its window is within
+// announcementLinkWindow of the live one.
+func LinkAnnouncements(outages []Outage) []Outage {
+	var announced []Outage
+	for _, o := range outages {
+		if o.Status == StatusAnnounced && o.AnnouncementURI != "" {
+			announced = append(announced, o)
+		}
+	}
+	linked := make([]Outage, len(outages))
+	for i, o := range outages {
+		linked[i] = o
+		if o.Status == StatusAnnounced || o.AnnouncementURI != "" {
+			continue
+		}
+		for _, a := range announced {
+			if a.Location.TitleGe != o.Location.TitleGe {
+				continue
+			}
+			if absDuration(a.Start.Sub(o.Start)) > announcementLinkWindow && !overlaps(a, o) {
+				continue
+			}
+			linked[i].AnnouncementURI = a.AnnouncementURI
+			break
+		}
+	}
+	return linked
+}
+
+func overlaps(a, b Outage) bool {
+	return a.Start.Before(b.End) && b.Start.Before(a.End)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// SupersedeAnnouncements marks announcements that already went live as
+// superseded, since the live outage carries their URI. They are kept rather
+// than dropped, so saving them replaces the announcement stored before.
+func SupersedeAnnouncements(outages []Outage) []Outage {
+	live := make(map[string]bool)
+	for _, o := range outages {
+		if o.Status != StatusAnnounced && o.AnnouncementURI != "" {
+			live[o.AnnouncementURI] = true
+		}
+	}
+	result := make([]Outage, len(outages))
+	for i, o := range outages {
+		if o.Status == StatusAnnounced && live[o.AnnouncementURI] {
+			o.Status = StatusSuperseded
+		}
+		result[i] = o
+	}
+	return result
+}
+
+// supersedeAnnouncements links the refreshed outages to the announcements
+// fetched with them and to the ones stored by earlier refreshes, whose
+// articles may be gone from the news by the time the outage goes live.
+// Stored announcements that get linked are returned with the outages,
+// superseded, and one superseded before stays so when its article is
+// fetched again.
+func (s Service) supersedeAnnouncements(ctx context.Context, providerId string, outages []Outage) ([]Outage, error) {
+	refreshed := make(map[string]bool, len(outages))
+	titleLats := make(map[string]bool)
+	for _, o := range outages {
+		refreshed[o.Ref()] = true
+		if o.Status != StatusAnnounced || o.AnnouncementURI != "" {
+			titleLats[o.Location.TitleLat] = true
+		}
+	}
+	superseded := make(map[string]bool)
+	var stored []Outage
+	for titleLat := range titleLats {
+		located, err := s.repo.GetOutages(ctx, providerId, titleLat)
+		if err != nil {
+			return outages, fmt.Errorf("supersede announcements: %w", err)
+		}
+		for _, o := range located {
+			switch {
+			case o.Status == StatusSuperseded:
+				superseded[o.Ref()] = true
+			case o.Status == StatusAnnounced && o.AnnouncementURI != "" && !refreshed[o.Ref()]:
+				stored = append(stored, o)
+			}
+		}
+	}
+	all := append(append([]Outage(nil), outages...), stored...)
+	linked := SupersedeAnnouncements(LinkAnnouncements(all))
+	result := linked[:len(outages)]
+	for i, o := range result {
+		if o.Status == StatusAnnounced && superseded[o.Ref()] {
+			result[i].Status = StatusSuperseded
+		}
+	}
+	for _, o := range linked[len(outages):] {
+		if o.Status == StatusSuperseded {
+			result = append(result, o)
+		}
+	}
+	return result, nil
+}
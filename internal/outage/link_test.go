@@ -0,0 +1,37 @@
+package outage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LinkAnnouncements(t *testing.T) {
+	start := time.Date(2023, 9, 15, 10, 0, 0, 0, time.UTC)
+	announced := Outage{
+		Start:           start,
+		End:             start.Add(8 * time.Hour),
+		Location:        Location{TitleGe: "ოზურგეთის"},
+		Status:          StatusAnnounced,
+		AnnouncementURI: "http://water.gov.ge/page/full/2741",
+	}
+	live := Outage{
+		Start:    start.Add(40 * time.Minute),
+		End:      start.Add(10 * time.Hour),
+		Location: Location{Id: "7", TitleGe: "ოზურგეთის"},
+		Status:   StatusActive,
+	}
+	elsewhere := Outage{
+		Start:    start,
+		End:      start.Add(time.Hour),
+		Location: Location{Id: "8", TitleGe: "ქუთაისის"},
+		Status:   StatusActive,
+	}
+	linked := LinkAnnouncements([]Outage{announced, live, elsewhere})
+	assert.Equal(t, announced.AnnouncementURI, linked[1].AnnouncementURI)
+	assert.Empty(t, linked[2].AnnouncementURI)
+	superseded := linked[0]
+	superseded.Status = StatusSuperseded
+	assert.Equal(t, []Outage{superseded, linked[1], linked[2]}, SupersedeAnnouncements(linked))
+}
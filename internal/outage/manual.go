@@ -0,0 +1,210 @@
+package outage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+)
+
+// ManualProviderId is the provider id of outages entered by operators.
+const ManualProviderId = "manual"
+
+func (o Outage) open() bool {
+	return o.Status == StatusActive || o.Status == StatusAnnounced
+}
+
+// ReportOutage stores an outage an operator learned about before any
+// provider published it. End may be left zero when nobody knows it yet.
+func (s Service) ReportOutage(ctx context.Context, o Outage) (Outage, error) {
+	handleErr := func(err error) (Outage, error) {
+		return Outage{}, fmt.Errorf("report outage: %w", err)
+	}
+	id, err := newManualId()
+	if err != nil {
+		return handleErr(err)
+	}
+	o, err = s.prepareManual(id, o)
+	if err != nil {
+		return handleErr(err)
+	}
+	if err := s.repo.SaveManualOutage(ctx, o); err != nil {
+		return handleErr(err)
+	}
+	if err := s.recordRevisions(ctx, o); err != nil {
+		return handleErr(err)
+	}
+	return o, nil
+}
+
+// UpdateOutage replaces an open manual outage. Closed and superseded
+// outages are final.
+func (s Service) UpdateOutage(ctx context.Context, id string, o Outage) (Outage, error) {
+	handleErr := func(err error) (Outage, error) {
+		return Outage{}, fmt.Errorf("update outage %s: %w", id, err)
+	}
+	stored, err := s.repo.GetManualOutage(ctx, id)
+	if err != nil {
+		return handleErr(err)
+	}
+	if !stored.open() {
+		return handleErr(fmt.Errorf("%w: outage is %s", ErrInvalidOutage, stored.Status))
+	}
+	o, err = s.prepareManual(id, o)
+	if err != nil {
+		return handleErr(err)
+	}
+	if err := s.repo.SaveManualOutage(ctx, o); err != nil {
+		return handleErr(err)
+	}
+	if err := s.recordRevisions(ctx, o); err != nil {
+		return handleErr(err)
+	}
+	return o, nil
+}
+
+// CloseOutage ends an open manual outage now.
+func (s Service) CloseOutage(ctx context.Context, id, reporter string) (Outage, error) {
+	handleErr := func(err error) (Outage, error) {
+		return Outage{}, fmt.Errorf("close outage %s: %w", id, err)
+	}
+	o, err := s.repo.GetManualOutage(ctx, id)
+	if err != nil {
+		return handleErr(err)
+	}
+	if !o.open() {
+		return handleErr(fmt.Errorf("%w: outage is %s", ErrInvalidOutage, o.Status))
+	}
+	now := s.now()
+	if o.End.IsZero() || o.End.After(now) {
+		o.End = now
+	}
+	o.Status = StatusClosed
+	o.Reporter = reporter
+	if err := s.repo.SaveManualOutage(ctx, o); err != nil {
+		return handleErr(err)
+	}
+	if err := s.recordRevisions(ctx, o); err != nil {
+		return handleErr(err)
+	}
+	return o, nil
+}
+
+func (s Service) prepareManual(id string, o Outage) (Outage, error) {
+	var addresses []string
+	for _, addr := range o.AddressesGe {
+		if addr = address.Normalize(addr); addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+	o.AddressesGe = addresses
+	o.Location.TitleGe = address.Normalize(o.Location.TitleGe)
+	switch {
+	case o.Reporter == "":
+		return Outage{}, fmt.Errorf("%w: no reporter", ErrInvalidOutage)
+	case o.Kind != KindWater && o.Kind != KindElectricity && o.Kind != KindGas:
+		return Outage{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidOutage, o.Kind)
+	case o.Location.TitleGe == "":
+		return Outage{}, fmt.Errorf("%w: no location", ErrInvalidOutage)
+	case len(o.AddressesGe) == 0:
+		return Outage{}, fmt.Errorf("%w: no addresses", ErrInvalidOutage)
+	case o.Start.IsZero():
+		return Outage{}, fmt.Errorf("%w: no start", ErrInvalidOutage)
+	case !o.End.IsZero() && !o.End.After(o.Start):
+		return Outage{}, fmt.Errorf("%w: end is not after start", ErrInvalidOutage)
+	}
+	o.Id = id
+	o.ProviderId = ManualProviderId
+	o.Source = SourceManual
+	o.Location.TitleLat = address.Translit(o.Location.TitleGe)
+	if o.Location.Id == "" {
+		o.Location.Id = o.Location.TitleLat
+	}
+	o.Status = StatusActive
+	if o.Start.After(s.now()) {
+		o.Status = StatusAnnounced
+	}
+	return o, nil
+}
+
+func newManualId() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("new manual id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SupersedeManual matches open manual reports against freshly scraped
+// outages of the same kind. A report is taken over by the first scraped
+// outage that shares an address and overlaps it in time: the report becomes
+// superseded and the scraped outage points back at it.
+func SupersedeManual(official, manual []Outage) ([]Outage, []Outage) {
+	linked := make([]Outage, len(official))
+	copy(linked, official)
+	var superseded []Outage
+	for _, m := range manual {
+		if !m.open() {
+			continue
+		}
+		for i, o := range linked {
+			if o.Status == StatusSuperseded || o.Kind != m.Kind || !manualOverlaps(m, o) || !sharesAddress(m, o) {
+				continue
+			}
+			extra := make(map[string]string, len(o.Extra)+1)
+			for k, v := range o.Extra {
+				extra[k] = v
+			}
+			extra[ExtraManualReport] = m.Id
+			linked[i].Extra = extra
+			m.Status = StatusSuperseded
+			m.Extra = map[string]string{ExtraSupersededBy: o.ProviderId}
+			superseded = append(superseded, m)
+			break
+		}
+	}
+	return linked, superseded
+}
+
+// manualOverlaps treats a zero end on either side as open-ended.
+func manualOverlaps(m, o Outage) bool {
+	return (o.End.IsZero() || m.Start.Before(o.End)) && (m.End.IsZero() || o.Start.Before(m.End))
+}
+
+func sharesAddress(a, b Outage) bool {
+	addrs := make(map[string]bool, len(a.AddressesGe))
+	for _, addr := range a.AddressesGe {
+		addrs[addr] = true
+	}
+	for _, addr := range b.AddressesGe {
+		if addrs[address.Normalize(addr)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Service) supersedeManual(ctx context.Context, official []Outage) ([]Outage, error) {
+	manual, err := s.repo.GetManualOutages(ctx)
+	if err != nil {
+		return official, fmt.Errorf("supersede manual outages: %w", err)
+	}
+	linked, superseded := SupersedeManual(official, manual)
+	var errs []error
+	for _, m := range superseded {
+		if err := s.repo.SaveManualOutage(ctx, m); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.recordRevisions(ctx, m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return linked, fmt.Errorf("supersede manual outages: %w", err)
+	}
+	return linked, nil
+}
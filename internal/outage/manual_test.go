@@ -0,0 +1,71 @@
+package outage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SupersedeManual(t *testing.T) {
+	start := time.Date(2023, 10, 18, 10, 0, 0, 0, time.UTC)
+	reported := Outage{
+		Id:          "3f2a",
+		ProviderId:  ManualProviderId,
+		Kind:        KindWater,
+		Start:       start,
+		Location:    Location{TitleGe: "რუსთავი"},
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      StatusActive,
+		Source:      SourceManual,
+		Reporter:    "nino",
+	}
+	closed := reported
+	closed.Id = "77b1"
+	closed.Status = StatusClosed
+	elsewhere := reported
+	elsewhere.Id = "90c4"
+	elsewhere.AddressesGe = []string{"კოსტავას გამზ."}
+	official := Outage{
+		ProviderId:  "water.gov.ge",
+		Kind:        KindWater,
+		Start:       start.Add(time.Hour),
+		End:         start.Add(6 * time.Hour),
+		AddressesGe: []string{"შარტავას ქ.", "მესხიშვილის  ქ."},
+		Status:      StatusActive,
+		Source:      SourceOfficial,
+	}
+	gas := official
+	gas.ProviderId = "tbilisienergy.ge"
+	gas.Kind = KindGas
+	linked, superseded := SupersedeManual([]Outage{gas, official}, []Outage{reported, closed, elsewhere})
+	wantSuperseded := reported
+	wantSuperseded.Status = StatusSuperseded
+	wantSuperseded.Extra = map[string]string{ExtraSupersededBy: "water.gov.ge"}
+	assert.Equal(t, []Outage{wantSuperseded}, superseded)
+	assert.Nil(t, linked[0].Extra)
+	assert.Equal(t, map[string]string{ExtraManualReport: "3f2a"}, linked[1].Extra)
+}
+
+func Test_SupersedeManualOpenEnded(t *testing.T) {
+	start := time.Date(2023, 10, 18, 10, 0, 0, 0, time.UTC)
+	reported := Outage{
+		Id:          "3f2a",
+		ProviderId:  ManualProviderId,
+		Kind:        KindWater,
+		Start:       start,
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      StatusActive,
+		Source:      SourceManual,
+	}
+	official := Outage{
+		ProviderId:  "water.gov.ge",
+		Kind:        KindWater,
+		Start:       start.Add(time.Hour),
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      StatusActive,
+		Source:      SourceOfficial,
+	}
+	_, superseded := SupersedeManual([]Outage{official}, []Outage{reported})
+	assert.Len(t, superseded, 1)
+}
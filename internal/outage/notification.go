@@ -0,0 +1,177 @@
+package outage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// Notification tells subscribers that an outage appeared or changed. It is
+// queued in the outbox in the same write as the outage and delivered at
+// least once; Id stays the same across redeliveries and requeues of the
+// same change, so receivers can use it as an idempotency key.
+type Notification struct {
+	Id            string
+	OutageRef     string
+	Changed       []string
+	Outage        Outage
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+// Notifier delivers a notification. It may be called again with the same
+// notification after a crash or a failed attempt.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NewNotification builds the notification of a revision that follows
+// previous, the zero Revision for a new outage. Its id hashes the outage
+// ref, when the previous revision was observed, the changed fields and the
+// outage, so the same change seen twice, as after a crash between saving an
+// outage and its revision, is queued once, while an outage that changes back
+// and forth is notified of every change.
+func NewNotification(previous, r Revision, now time.Time) (Notification, error) {
+	var since string
+	if !previous.ObservedAt.IsZero() {
+		since = previous.ObservedAt.UTC().Format(time.RFC3339Nano)
+	}
+	raw, err := json.Marshal(struct {
+		Ref     string
+		Since   string
+		Changed []string
+		Outage  Outage
+	}{r.OutageRef, since, r.Changed, r.Outage})
+	if err != nil {
+		return Notification{}, fmt.Errorf("new notification %s: %w", r.OutageRef, err)
+	}
+	sum := sha256.Sum256(raw)
+	return Notification{
+		Id:            hex.EncodeToString(sum[:16]),
+		OutageRef:     r.OutageRef,
+		Changed:       r.Changed,
+		Outage:        r.Outage,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// WithOutbox makes the service queue a notification for every new or
+// changed scraped outage, in the same write as the outage, for a
+// Dispatcher to deliver.
+func (s Service) WithOutbox() Service {
+	s.outbox = true
+	return s
+}
+
+func (s Service) notifications(transitions []transition) ([]Notification, error) {
+	if !s.outbox {
+		return nil, nil
+	}
+	notifications := make([]Notification, 0, len(transitions))
+	for _, t := range transitions {
+		n, err := NewNotification(t.previous, t.next, s.now())
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+const (
+	dispatchBatch       = 50
+	dispatchClaim       = time.Minute
+	dispatchBackoffBase = 10 * time.Second
+	dispatchBackoffMax  = time.Hour
+)
+
+// Dispatcher delivers the notifications in the outbox. Each batch is
+// claimed for a while first, so replicas dispatching side by side do not
+// pick the same notifications, and a replica that dies mid-batch leaves
+// them to be claimed again once the claim runs out. Failed deliveries are
+// retried with exponential backoff.
+type Dispatcher struct {
+	repo     Repo
+	notifier Notifier
+	owner    string
+	now      func() time.Time
+	sl       *slog.Logger
+}
+
+func NewDispatcher(repo Repo, notifier Notifier, owner string, now func() time.Time, sl *slog.Logger) Dispatcher {
+	return Dispatcher{repo, notifier, owner, now, sl}
+}
+
+// Dispatch delivers one batch of due notifications and returns how many
+// were delivered.
+func (d Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	handleErr := func(err error) (int, error) {
+		return 0, fmt.Errorf("dispatch: %w", err)
+	}
+	now := d.now()
+	claimed, err := d.repo.ClaimNotifications(ctx, d.owner, now, now.Add(dispatchClaim), dispatchBatch)
+	if err != nil {
+		return handleErr(err)
+	}
+	var (
+		delivered int
+		errs      []error
+	)
+	for _, n := range claimed {
+		if err := d.notifier.Notify(ctx, n); err != nil {
+			next := d.now().Add(dispatchBackoff(n.Attempts))
+			d.sl.Warn("notification failed", slog.String("id", n.Id), slog.Int("attempts", n.Attempts+1), slog.Time("next", next), slog.Any("err", err))
+			errs = append(errs, d.repo.RetryNotification(ctx, n.Id, next, err.Error()))
+			continue
+		}
+		if err := d.repo.CompleteNotification(ctx, n.Id, d.now()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delivered++
+	}
+	if err := errors.Join(errs...); err != nil {
+		return delivered, fmt.Errorf("dispatch: %w", err)
+	}
+	return delivered, nil
+}
+
+// dispatchBackoff grows the delay before the next attempt exponentially,
+// with jitter, up to dispatchBackoffMax.
+func dispatchBackoff(attempts int) time.Duration {
+	delay := dispatchBackoffMax
+	if attempts < 16 {
+		delay = min(dispatchBackoffBase<<attempts, dispatchBackoffMax)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// StartDispatching dispatches every interval until ctx is done, and right
+// away again while batches come back full.
+func (d Dispatcher) StartDispatching(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		delivered, err := d.Dispatch(ctx)
+		if err != nil {
+			d.sl.Error("dispatch notifications", slog.Any("err", err))
+		}
+		if delivered == dispatchBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
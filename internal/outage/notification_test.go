@@ -0,0 +1,156 @@
+package outage_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotifier struct {
+	failures  int
+	delivered []outage.Notification
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, notification outage.Notification) error {
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("receiver is down")
+	}
+	n.delivered = append(n.delivered, notification)
+	return nil
+}
+
+func refresh(t *testing.T, s outage.Service) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.StartRefreshingData(ctx)
+}
+
+func Test_ServiceOutbox(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Outage{
+		ProviderId: "water.gov.ge",
+		Kind:       outage.KindWater,
+		Start:      testNow.Add(-time.Hour),
+		End:        testNow.Add(6 * time.Hour),
+		Location:   outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		Status:     outage.StatusActive,
+	}
+	provider := &outage.FakeProvider{Outages: []outage.Outage{rustavi}}
+	s, store := newTestService(t, fixedNow, provider)
+	s = s.WithOutbox()
+
+	refresh(t, s)
+	refresh(t, s)
+	provider.Outages[0].End = rustavi.End.Add(2 * time.Hour)
+	refresh(t, s)
+
+	claimed, err := store.ClaimNotifications(ctx, "a", testNow, testNow.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, claimed, 2, "an unchanged outage is not notified twice") {
+		changed := claimed[0].Changed
+		if len(changed) == 0 {
+			changed = claimed[1].Changed
+		}
+		assert.Equal(t, []string{"end"}, changed)
+		assert.NotEqual(t, claimed[0].Id, claimed[1].Id)
+	}
+	again, err := store.ClaimNotifications(ctx, "b", testNow, testNow.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, again, "claimed notifications are left to their owner")
+}
+
+func Test_ServiceOutboxChangesBack(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Outage{
+		ProviderId: "water.gov.ge",
+		Kind:       outage.KindWater,
+		Start:      testNow.Add(-time.Hour),
+		End:        testNow.Add(6 * time.Hour),
+		Location:   outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		Status:     outage.StatusActive,
+	}
+	provider := &outage.FakeProvider{Outages: []outage.Outage{rustavi}}
+	now := testNow
+	s, store := newTestService(t, func() time.Time { return now }, provider)
+	s = s.WithOutbox()
+
+	// The end moves 18:00, 20:00, 18:00, 20:00: the second move to 20:00 is
+	// the same change as the first, from another revision.
+	for _, end := range []time.Duration{6, 8, 6, 8} {
+		provider.Outages[0].End = testNow.Add(end * time.Hour)
+		refresh(t, s)
+		now = now.Add(time.Minute)
+	}
+
+	claimed, err := store.ClaimNotifications(ctx, "a", now, now.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, claimed, 4)
+	ids := make(map[string]bool)
+	for _, n := range claimed {
+		ids[n.Id] = true
+	}
+	assert.Len(t, ids, 4)
+}
+
+func Test_Dispatcher(t *testing.T) {
+	ctx := context.Background()
+	now := testNow
+	clock := func() time.Time {
+		return now
+	}
+	rustavi := outage.Outage{
+		ProviderId: "water.gov.ge",
+		Kind:       outage.KindWater,
+		Start:      testNow.Add(-time.Hour),
+		End:        testNow.Add(6 * time.Hour),
+		Location:   outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		Status:     outage.StatusActive,
+	}
+	s, store := newTestService(t, clock, &outage.FakeProvider{Outages: []outage.Outage{rustavi}})
+	refresh(t, s.WithOutbox())
+	notifier := &fakeNotifier{failures: 1}
+	d := outage.NewDispatcher(store, notifier, "a", clock, slog.Default())
+
+	delivered, err := d.Dispatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, delivered)
+	delivered, err = d.Dispatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, delivered, "a failed notification waits for its backoff")
+
+	now = now.Add(time.Hour)
+	delivered, err = d.Dispatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, delivered)
+	if assert.Len(t, notifier.delivered, 1) {
+		assert.Equal(t, rustavi.Ref(), notifier.delivered[0].OutageRef)
+		assert.Equal(t, 1, notifier.delivered[0].Attempts)
+		assert.Equal(t, "receiver is down", notifier.delivered[0].LastError)
+	}
+
+	now = now.Add(time.Hour)
+	delivered, err = d.Dispatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, delivered, "delivered notifications are not sent again")
+}
@@ -2,6 +2,48 @@ package outage
 
 import "time"
 
+type Kind string
+
+const (
+	KindWater       Kind = "water"
+	KindElectricity Kind = "electricity"
+	KindGas         Kind = "gas"
+)
+
+type Status string
+
+const (
+	StatusActive     Status = "active"
+	StatusAnnounced  Status = "announced"
+	StatusClosed     Status = "closed"
+	StatusSuperseded Status = "superseded"
+)
+
+// Source tells scraped outages from the ones operators enter by hand. An
+// empty source reads as SourceOfficial.
+type Source string
+
+const (
+	SourceOfficial Source = "official"
+	SourceManual   Source = "manual"
+)
+
+// Providers that tell planned works from emergencies record it in
+// Outage.Extra under ExtraInterruption.
+const (
+	ExtraInterruption     = "interruption"
+	InterruptionPlanned   = "planned"
+	InterruptionEmergency = "emergency"
+)
+
+// A manual outage superseded by a scraped one records the provider that
+// took over under ExtraSupersededBy, and the scraped outage points back at
+// the report under ExtraManualReport.
+const (
+	ExtraSupersededBy = "supersededBy"
+	ExtraManualReport = "manualReport"
+)
+
 type Location struct {
 	Id       string
 	TitleGe  string
@@ -10,10 +52,38 @@ type Location struct {
 	Lng      string
 }
 
-type WaterGovGe struct {
+// Outage is a utility interruption reported by a provider. Fields that only
+// make sense for one provider go into Extra. Id and Reporter are only set on
+// manual outages. Key tells apart the outages a provider publishes for one
+// location with the same start, see AddressKey; it is empty for providers
+// that publish one outage per location at a time.
+type Outage struct {
+	Id                string
+	ProviderId        string
+	Key               string
+	Kind              Kind
 	Start             time.Time
 	End               time.Time
 	AffectedCustomers int
 	Location          Location
 	AddressesGe       []string
+	Status            Status
+	AnnouncementURI   string
+	Source            Source
+	Reporter          string
+	Extra             map[string]string
+}
+
+type Center struct {
+	ProviderId string
+	Location   Location
+	Problem    bool
+	FirstSeen  time.Time
+	LastSeen   time.Time
+}
+
+type CenterStatus struct {
+	LocationId string
+	Problem    bool
+	ObservedAt time.Time
 }
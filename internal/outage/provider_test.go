@@ -0,0 +1,84 @@
+package outage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// FakeProvider is the provider of the tests here and in outage_test. It
+// serves the outages, centers and error it is set to off one fetch, like a
+// map, and counts its fetches. Every fetch gets Pages with Client first.
+// The zero value is water.gov.ge without outages, fetching no pages.
+type FakeProvider struct {
+	ProviderId   string
+	ProviderKind Kind
+	Outages      []Outage
+	Centers      []Center
+	Err          error
+	Client       *http.Client
+	Pages        []string
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func (p *FakeProvider) Id() string {
+	if p.ProviderId == "" {
+		return "water.gov.ge"
+	}
+	return p.ProviderId
+}
+
+func (p *FakeProvider) Kind() Kind {
+	if p.ProviderKind == "" {
+		return KindWater
+	}
+	return p.ProviderKind
+}
+
+func (p *FakeProvider) GetOutages(ctx context.Context) ([]Outage, error) {
+	outages, _, err := p.GetOutagesAndCenters(ctx)
+	return outages, err
+}
+
+func (p *FakeProvider) GetOutagesAndCenters(ctx context.Context) ([]Outage, []Center, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetches++
+	for _, addr := range p.Pages {
+		if err := p.fetchPage(ctx, addr); err != nil {
+			return nil, nil, err
+		}
+	}
+	return slices.Clone(p.Outages), slices.Clone(p.Centers), p.Err
+}
+
+func (p *FakeProvider) fetchPage(ctx context.Context, addr string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	return err
+}
+
+// Set changes what the provider serves while it is being refreshed.
+func (p *FakeProvider) Set(outages []Outage, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Outages, p.Err = outages, err
+}
+
+func (p *FakeProvider) Fetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetches
+}
@@ -0,0 +1,85 @@
+package outage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Provider interface {
+	Id() string
+	Kind() Kind
+	GetOutages(ctx context.Context) ([]Outage, error)
+}
+
+// CenterProvider is implemented by providers that publish a catalog of
+// their service centers alongside outages, on the same page, so a refresh
+// reads both off one fetch. Centers may come with an error when the
+// outages failed after the catalog was read.
+type CenterProvider interface {
+	GetOutagesAndCenters(ctx context.Context) ([]Outage, []Center, error)
+}
+
+type Registration struct {
+	Provider Provider
+	Interval time.Duration
+	Schedule Schedule
+}
+
+type Registry struct {
+	registrations []Registration
+}
+
+func NewRegistry(registrations ...Registration) (Registry, error) {
+	handleErr := func(err error) (Registry, error) {
+		return Registry{}, fmt.Errorf("new registry: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, r := range registrations {
+		id := r.Provider.Id()
+		if seen[id] {
+			return handleErr(fmt.Errorf("%w: %s", errDuplicateProvider, id))
+		}
+		if r.Interval <= 0 {
+			return handleErr(fmt.Errorf("%w: %s", errBadInterval, id))
+		}
+		if err := r.Schedule.validate(); err != nil {
+			return handleErr(fmt.Errorf("%w: %s", err, id))
+		}
+		seen[id] = true
+	}
+	return Registry{registrations}, nil
+}
+
+func (r Registry) Registrations() []Registration {
+	return r.registrations
+}
+
+// Close releases the providers that hold on to something of their own,
+// such as the process of an external provider.
+func (r Registry) Close() {
+	for _, reg := range r.registrations {
+		if c, ok := reg.Provider.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+func (r Registry) has(providerId string) bool {
+	for _, reg := range r.registrations {
+		if reg.Provider.Id() == providerId {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Registry) ByKind(kind Kind) []Provider {
+	var providers []Provider
+	for _, reg := range r.registrations {
+		if reg.Provider.Kind() == kind {
+			providers = append(providers, reg.Provider)
+		}
+	}
+	return providers
+}
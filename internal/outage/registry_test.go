@@ -0,0 +1,24 @@
+package outage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewRegistry(t *testing.T) {
+	water := &FakeProvider{}
+	gas := &FakeProvider{ProviderId: "gas", ProviderKind: KindGas}
+	r, err := NewRegistry(Registration{water, time.Hour, Schedule{}}, Registration{gas, 6 * time.Hour, Schedule{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Provider{water}, r.ByKind(KindWater))
+	_, err = NewRegistry(Registration{water, time.Hour, Schedule{}}, Registration{water, time.Minute, Schedule{}})
+	assert.ErrorIs(t, err, errDuplicateProvider)
+	_, err = NewRegistry(Registration{gas, 0, Schedule{}})
+	assert.ErrorIs(t, err, errBadInterval)
+	_, err = NewRegistry(Registration{gas, time.Hour, Schedule{Jitter: -time.Minute}})
+	assert.ErrorIs(t, err, errBadSchedule)
+}
@@ -0,0 +1,233 @@
+package outage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Revision is one observed version of an outage. The first revision of an
+// outage changes nothing; every later one lists the fields that differ from
+// the revision before it.
+type Revision struct {
+	OutageRef  string
+	ObservedAt time.Time
+	Changed    []string
+	Outage     Outage
+}
+
+// ChangedFields names the fields of o that differ from old, the way the
+// HTTP API spells them.
+func ChangedFields(old, o Outage) []string {
+	var changed []string
+	if !old.Start.Equal(o.Start) {
+		changed = append(changed, "start")
+	}
+	if !old.End.Equal(o.End) {
+		changed = append(changed, "end")
+	}
+	if old.AffectedCustomers != o.AffectedCustomers {
+		changed = append(changed, "affectedCustomers")
+	}
+	if old.Location != o.Location {
+		changed = append(changed, "location")
+	}
+	if !slices.Equal(old.AddressesGe, o.AddressesGe) {
+		changed = append(changed, "addressesGe")
+	}
+	if old.Status != o.Status {
+		changed = append(changed, "status")
+	}
+	if old.AnnouncementURI != o.AnnouncementURI {
+		changed = append(changed, "announcementUri")
+	}
+	if old.Reporter != o.Reporter {
+		changed = append(changed, "reporter")
+	}
+	if !maps.Equal(old.Extra, o.Extra) {
+		changed = append(changed, "extra")
+	}
+	return changed
+}
+
+// EndExtensions counts the revisions that pushed the end of an outage later.
+func EndExtensions(revisions []Revision) int {
+	var n int
+	for i := 1; i < len(revisions); i++ {
+		prev, cur := revisions[i-1].Outage.End, revisions[i].Outage.End
+		if !prev.IsZero() && cur.After(prev) {
+			n++
+		}
+	}
+	return n
+}
+
+// transition is a new revision of an outage and the latest one before it,
+// which is zero for a new outage.
+type transition struct {
+	previous Revision
+	next     Revision
+}
+
+// recordRevisions stores a revision of every outage that is new or differs
+// from its latest revision. With a change feed the feed records them
+// instead, see HandleChange.
+func (s Service) recordRevisions(ctx context.Context, outages ...Outage) error {
+	if s.changeFeed {
+		return nil
+	}
+	transitions, err := s.newRevisions(ctx, outages...)
+	return errors.Join(err, s.saveRevisions(ctx, transitions))
+}
+
+// newRevisions compares every outage with its latest revision and returns
+// the revisions of the new and changed ones.
+func (s Service) newRevisions(ctx context.Context, outages ...Outage) ([]transition, error) {
+	observedAt := s.now()
+	var (
+		result []transition
+		errs   []error
+	)
+	for _, o := range outages {
+		ref := o.Ref()
+		revisions, err := s.repo.GetRevisions(ctx, ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t := transition{next: Revision{OutageRef: ref, ObservedAt: observedAt, Outage: o}}
+		if len(revisions) > 0 {
+			t.previous = revisions[len(revisions)-1]
+			if t.next.Changed = ChangedFields(t.previous.Outage, o); len(t.next.Changed) == 0 {
+				continue
+			}
+		}
+		result = append(result, t)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return result, fmt.Errorf("new revisions: %w", err)
+	}
+	return result, nil
+}
+
+func (s Service) saveRevisions(ctx context.Context, transitions []transition) error {
+	var errs []error
+	for _, t := range transitions {
+		if err := s.repo.SaveRevision(ctx, t.next); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("record revisions: %w", err)
+	}
+	return nil
+}
+
+// GetOutageHistory returns every revision of an outage, oldest first.
+func (s Service) GetOutageHistory(ctx context.Context, ref string) ([]Revision, error) {
+	handleErr := func(err error) ([]Revision, error) {
+		return nil, fmt.Errorf("get outage history %s: %w", ref, err)
+	}
+	revisions, err := s.repo.GetRevisions(ctx, ref)
+	if err != nil {
+		return handleErr(err)
+	}
+	if len(revisions) == 0 {
+		return handleErr(ErrNotFound)
+	}
+	return revisions, nil
+}
+
+// GetOutagesAsOf rebuilds the outages at a location as they were observed
+// at asOf: the latest revision of every outage seen by then, kept if it had
+// not ended yet. Manual outages that were closed or superseded by then are
+// left out, as they were from the live list.
+func (s Service) GetOutagesAsOf(ctx context.Context, kind Kind, titleLat string, asOf time.Time) ([]Outage, error) {
+	handleErr := func(err error) ([]Outage, error) {
+		return nil, fmt.Errorf("get outages as of %s: %w", asOf.Format(time.RFC3339), err)
+	}
+	providerIds := []string{ManualProviderId}
+	for _, provider := range s.registry.ByKind(kind) {
+		providerIds = append(providerIds, provider.Id())
+	}
+	var outages []Outage
+	for _, providerId := range providerIds {
+		revisions, err := s.repo.GetRevisionsAsOf(ctx, providerId, titleLat, asOf)
+		if err != nil {
+			return handleErr(err)
+		}
+		for _, r := range revisions {
+			o := r.Outage
+			if o.Kind != kind || !o.open() || !o.End.IsZero() && !o.End.After(asOf) {
+				continue
+			}
+			outages = append(outages, o)
+		}
+	}
+	slices.SortFunc(outages, func(a, b Outage) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Ref(), b.Ref())
+	})
+	return outages, nil
+}
+
+// OutageChange is an outage present at both instants of a diff whose
+// fields differ.
+type OutageChange struct {
+	Before  Outage
+	After   Outage
+	Changed []string
+}
+
+type OutageDiff struct {
+	Added   []Outage
+	Removed []Outage
+	Changed []OutageChange
+}
+
+// DiffOutages matches outages by ref and tells which ones appeared,
+// disappeared or changed between before and after.
+func DiffOutages(before, after []Outage) OutageDiff {
+	var diff OutageDiff
+	old := make(map[string]Outage, len(before))
+	for _, o := range before {
+		old[o.Ref()] = o
+	}
+	for _, o := range after {
+		b, found := old[o.Ref()]
+		if !found {
+			diff.Added = append(diff.Added, o)
+			continue
+		}
+		delete(old, o.Ref())
+		if changed := ChangedFields(b, o); len(changed) > 0 {
+			diff.Changed = append(diff.Changed, OutageChange{b, o, changed})
+		}
+	}
+	for _, o := range before {
+		if _, gone := old[o.Ref()]; gone {
+			diff.Removed = append(diff.Removed, o)
+		}
+	}
+	return diff
+}
+
+// DiffOutagesAsOf compares the outages at a location as observed at from
+// and at to.
+func (s Service) DiffOutagesAsOf(ctx context.Context, kind Kind, titleLat string, from, to time.Time) (OutageDiff, error) {
+	before, err := s.GetOutagesAsOf(ctx, kind, titleLat, from)
+	if err != nil {
+		return OutageDiff{}, fmt.Errorf("diff outages: %w", err)
+	}
+	after, err := s.GetOutagesAsOf(ctx, kind, titleLat, to)
+	if err != nil {
+		return OutageDiff{}, fmt.Errorf("diff outages: %w", err)
+	}
+	return DiffOutages(before, after), nil
+}
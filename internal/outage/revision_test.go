@@ -0,0 +1,48 @@
+package outage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ChangedFields(t *testing.T) {
+	start := time.Date(2023, 10, 18, 10, 0, 0, 0, time.UTC)
+	o := Outage{
+		Start:       start,
+		End:         start.Add(8 * time.Hour),
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      StatusActive,
+	}
+	assert.Nil(t, ChangedFields(o, o))
+	extended := o
+	extended.End = o.End.Add(2 * time.Hour)
+	extended.AddressesGe = []string{"მესხიშვილის ქ.", "შარტავას ქ."}
+	extended.Extra = map[string]string{ExtraInterruption: InterruptionEmergency}
+	assert.Equal(t, []string{"end", "addressesGe", "extra"}, ChangedFields(o, extended))
+}
+
+func Test_EndExtensions(t *testing.T) {
+	end := time.Date(2023, 10, 18, 18, 0, 0, 0, time.UTC)
+	var revisions []Revision
+	for _, e := range []time.Time{{}, end, end.Add(time.Hour), end.Add(time.Hour), end.Add(3 * time.Hour), end} {
+		revisions = append(revisions, Revision{Outage: Outage{End: e}})
+	}
+	assert.Equal(t, 2, EndExtensions(revisions))
+}
+
+func Test_DiffOutages(t *testing.T) {
+	start := time.Date(2023, 10, 18, 10, 0, 0, 0, time.UTC)
+	kept := Outage{ProviderId: "water.gov.ge", Start: start, End: start.Add(time.Hour), Location: Location{TitleLat: "rustavi"}}
+	extended := kept
+	extended.End = start.Add(3 * time.Hour)
+	gone := kept
+	gone.Start = start.Add(-time.Hour)
+	added := Outage{Id: "3f2a", ProviderId: ManualProviderId, Start: start}
+	assert.Equal(t, OutageDiff{
+		Added:   []Outage{added},
+		Removed: []Outage{gone},
+		Changed: []OutageChange{{kept, extended, []string{"end"}}},
+	}, DiffOutages([]Outage{gone, kept}, []Outage{extended, added}))
+}
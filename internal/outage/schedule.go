@@ -0,0 +1,246 @@
+package outage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/cron"
+)
+
+// Clock is the time source of the scheduler, so tests can move time along
+// instead of sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct {
+	now func() time.Time
+}
+
+func (c systemClock) Now() time.Time {
+	return c.now()
+}
+
+func (c systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Schedule tunes when a provider is refreshed on top of its Interval. The
+// zero value refreshes every Interval.
+type Schedule struct {
+	// Cron replaces Interval as the regular schedule when it is set.
+	Cron cron.Schedule
+	// ActiveInterval is used instead when it comes sooner, while one of
+	// the provider's outages is under way or within NearEnd of its
+	// announced end.
+	ActiveInterval time.Duration
+	NearEnd        time.Duration
+	// Jitter adds up to this much to every delay, so replicas and
+	// providers sharing a schedule do not refresh in lockstep.
+	Jitter time.Duration
+	// MaxBackoff caps the delay after failed refreshes: each failure in a
+	// row doubles the interval in effect. Zero turns backoff off.
+	MaxBackoff time.Duration
+}
+
+func (s Schedule) validate() error {
+	if s.ActiveInterval < 0 || s.NearEnd < 0 || s.Jitter < 0 || s.MaxBackoff < 0 {
+		return errBadSchedule
+	}
+	return nil
+}
+
+// WithClock makes the service read the time from clock and wait on it
+// between refreshes.
+func (s Service) WithClock(clock Clock) Service {
+	s.clock, s.now = clock, clock.Now
+	return s
+}
+
+// defaultTriggerPoll is how often the replica refreshing a provider looks
+// for refreshes requested on the others.
+const defaultTriggerPoll = 10 * time.Second
+
+// WithTriggerPoll makes the service look for refresh requests every poll
+// between refreshes. Zero leaves requests made on other replicas to the
+// next scheduled refresh.
+func (s Service) WithTriggerPoll(poll time.Duration) Service {
+	s.triggerPoll = poll
+	return s
+}
+
+// refreshTriggers holds a channel per provider while it is being
+// refreshed on this replica, so that requests made here are taken without
+// waiting for the poll.
+type refreshTriggers struct {
+	mu    sync.Mutex
+	chans map[string]chan struct{}
+}
+
+func newRefreshTriggers() *refreshTriggers {
+	return &refreshTriggers{chans: make(map[string]chan struct{})}
+}
+
+func (t *refreshTriggers) register(providerId string) chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	trigger := make(chan struct{}, 1)
+	t.chans[providerId] = trigger
+	return trigger
+}
+
+func (t *refreshTriggers) unregister(providerId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.chans, providerId)
+}
+
+func (t *refreshTriggers) nudge(providerId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// A nudge that is pending already covers this one.
+	select {
+	case t.chans[providerId] <- struct{}{}:
+	default:
+	}
+}
+
+// TriggerRefresh makes the provider refresh right away instead of waiting
+// for its schedule. The request is kept in the repo, so it can be made on
+// any replica: the one refreshing the provider takes it at its next poll,
+// or at once when that is this one.
+func (s Service) TriggerRefresh(ctx context.Context, providerId string) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("trigger refresh %s: %w", providerId, err)
+	}
+	if !s.registry.has(providerId) {
+		return handleErr(ErrNoProvider)
+	}
+	if err := s.repo.RequestRefresh(ctx, providerId, s.now()); err != nil {
+		return handleErr(err)
+	}
+	s.triggers.nudge(providerId)
+	return nil
+}
+
+func (s Service) refreshPeriodically(ctx context.Context, reg Registration) {
+	id := reg.Provider.Id()
+	sl := s.sl.With(slog.String("provider", id))
+	trigger := s.triggers.register(id)
+	defer s.triggers.unregister(id)
+	var (
+		outages  []Outage
+		failures int
+		reason   = ReasonStartup
+	)
+	for {
+		refreshed, err := s.refreshRun(ctx, reg.Provider, reason)
+		// A failed refresh keeps the outages seen last.
+		if err != nil {
+			sl.Error("refresh provider", slog.Any("err", err))
+			failures++
+		} else {
+			outages, failures = refreshed, 0
+		}
+		now := s.clock.Now()
+		next := nextRefresh(reg, outages, failures, now)
+		sl.Debug("next refresh", slog.Duration("in", next.Sub(now)), slog.Int("failures", failures))
+		if reason = s.awaitRefresh(ctx, id, trigger, next); reason == "" {
+			sl.Info("stopping periodic refresh", slog.Any("ctx error", ctx.Err()))
+			return
+		}
+	}
+}
+
+// awaitRefresh waits until next or a refresh request, looking for requests
+// every triggerPoll, and returns why the provider is to be refreshed. It
+// returns no reason once ctx is done.
+func (s Service) awaitRefresh(ctx context.Context, providerId string, trigger <-chan struct{}, next time.Time) RunReason {
+	for {
+		wait := next.Sub(s.clock.Now())
+		if s.triggerPoll > 0 && s.triggerPoll < wait {
+			wait = s.triggerPoll
+		}
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-trigger:
+		case <-s.clock.After(wait):
+		}
+		requested, err := s.repo.TakeRefreshRequest(ctx, providerId)
+		if err != nil && ctx.Err() == nil {
+			s.sl.Error("take refresh request", slog.String("provider", providerId), slog.Any("err", err))
+		}
+		switch {
+		case requested:
+			s.sl.Info("refresh triggered", slog.String("provider", providerId))
+			return ReasonTrigger
+		case !s.clock.Now().Before(next):
+			return ReasonSchedule
+		}
+	}
+}
+
+// nextRefresh picks the earlier of the regular schedule and, with outages
+// under way or ending soon, the active interval. Failures push it out and
+// jitter is added last.
+func nextRefresh(reg Registration, outages []Outage, failures int, now time.Time) time.Time {
+	sched := reg.Schedule
+	interval := reg.Interval
+	next := now.Add(interval)
+	if !sched.Cron.IsZero() {
+		// The interval in effect is the gap between the next two times
+		// of the cron schedule.
+		if cronNext := sched.Cron.Next(now); !cronNext.IsZero() {
+			next = cronNext
+			if after := sched.Cron.Next(cronNext); !after.IsZero() {
+				interval = after.Sub(cronNext)
+			}
+		}
+	}
+	if sched.ActiveInterval > 0 && active(outages, now, sched.NearEnd) {
+		interval = min(interval, sched.ActiveInterval)
+		if activeNext := now.Add(sched.ActiveInterval); activeNext.Before(next) {
+			next = activeNext
+		}
+	}
+	if failures > 0 && sched.MaxBackoff > 0 {
+		backoff := interval
+		for i := 0; i < failures && backoff < sched.MaxBackoff; i++ {
+			backoff *= 2
+		}
+		backoff = min(backoff, sched.MaxBackoff)
+		if backedOff := now.Add(backoff); backedOff.After(next) {
+			next = backedOff
+		}
+	}
+	if sched.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(sched.Jitter))))
+	}
+	return next
+}
+
+// active reports whether an outage is under way, with or without an
+// announced end, or ends within nearEnd. Closed outages are over.
+func active(outages []Outage, now time.Time, nearEnd time.Duration) bool {
+	for _, o := range outages {
+		if o.Status == StatusClosed {
+			continue
+		}
+		if o.End.IsZero() {
+			if !o.Start.After(now) {
+				return true
+			}
+			continue
+		}
+		if o.End.After(now) && (!o.Start.After(now) || !o.End.After(now.Add(nearEnd))) {
+			return true
+		}
+	}
+	return false
+}
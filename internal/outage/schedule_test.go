@@ -0,0 +1,213 @@
+package outage_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/cron"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock hands every wait to the test, which fires it after moving the
+// time along. Waits are buffered, since the scheduler starts one before it
+// knows whether it is stopping.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan fakeTimer
+}
+
+type fakeTimer struct {
+	d time.Duration
+	c chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, timers: make(chan fakeTimer, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	timer := fakeTimer{d, make(chan time.Time, 1)}
+	c.timers <- timer
+	return timer.c
+}
+
+func (c *fakeClock) wait(t *testing.T) fakeTimer {
+	t.Helper()
+	select {
+	case timer := <-c.timers:
+		return timer
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scheduler never waited")
+		return fakeTimer{}
+	}
+}
+
+func (c *fakeClock) fire(timer fakeTimer) {
+	c.mu.Lock()
+	c.now = c.now.Add(timer.d)
+	now := c.now
+	c.mu.Unlock()
+	timer.c <- now
+}
+
+// startScheduledService refreshes reg on clock until the returned stop is
+// called, looking for refresh requests every poll.
+func startScheduledService(t *testing.T, clock *fakeClock, poll time.Duration, reg outage.Registration) (outage.Service, repo.Memory, func()) {
+	t.Helper()
+	registry, err := outage.NewRegistry(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := repo.NewMemory("", clock.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := outage.NewService(registry, store, outage.NewReportLimiter(2, time.Hour), clock.Now, slog.Default()).
+		WithClock(clock).
+		WithTriggerPoll(poll)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartRefreshingData(ctx)
+	}()
+	return s, store, func() {
+		cancel()
+		<-done
+	}
+}
+
+func Test_SchedulerAdaptive(t *testing.T) {
+	clock := newFakeClock(testNow)
+	provider := &outage.FakeProvider{}
+	s, _, stop := startScheduledService(t, clock, 0, outage.Registration{
+		Provider: provider,
+		Interval: time.Hour,
+		Schedule: outage.Schedule{ActiveInterval: 5 * time.Minute, NearEnd: 30 * time.Minute, MaxBackoff: 4 * time.Hour},
+	})
+	defer stop()
+
+	timer := clock.wait(t)
+	assert.Equal(t, time.Hour, timer.d, "nothing going on")
+
+	provider.Set([]outage.Outage{{
+		Start:    testNow,
+		End:      testNow.Add(4 * time.Hour),
+		Location: outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+	}}, nil)
+	clock.fire(timer)
+	timer = clock.wait(t)
+	assert.Equal(t, 5*time.Minute, timer.d, "an outage is under way")
+
+	provider.Set(nil, errors.New("upstream is down"))
+	for _, backoff := range []time.Duration{10 * time.Minute, 20 * time.Minute, 40 * time.Minute} {
+		clock.fire(timer)
+		timer = clock.wait(t)
+		assert.Equal(t, backoff, timer.d, "failures double the active interval")
+	}
+
+	provider.Set(nil, nil)
+	clock.fire(timer)
+	timer = clock.wait(t)
+	assert.Equal(t, time.Hour, timer.d, "the outage is gone")
+
+	provider.Set([]outage.Outage{{
+		Start:    clock.Now().Add(-4 * time.Hour),
+		End:      clock.Now().Add(20 * time.Minute),
+		Location: outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+	}}, nil)
+	calls := provider.Fetches()
+	if err := s.TriggerRefresh(context.Background(), "water.gov.ge"); err != nil {
+		t.Fatal(err)
+	}
+	timer = clock.wait(t)
+	assert.Equal(t, calls+1, provider.Fetches(), "the trigger refreshes without the timer")
+	assert.Equal(t, 5*time.Minute, timer.d, "an outage is near its end")
+
+	assert.ErrorIs(t, s.TriggerRefresh(context.Background(), "missing"), outage.ErrNoProvider)
+}
+
+func Test_SchedulerPollsRequests(t *testing.T) {
+	clock := newFakeClock(testNow)
+	provider := &outage.FakeProvider{}
+	reg := outage.Registration{Provider: provider, Interval: time.Hour}
+	_, store, stop := startScheduledService(t, clock, time.Minute, reg)
+	defer stop()
+	registry, err := outage.NewRegistry(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The follower shares the leader's repo but does not refresh.
+	follower := outage.NewService(registry, store, outage.NewReportLimiter(2, time.Hour), clock.Now, slog.Default())
+
+	timer := clock.wait(t)
+	assert.Equal(t, time.Minute, timer.d, "polls until the schedule is due")
+	clock.fire(timer)
+	timer = clock.wait(t)
+	assert.Equal(t, 1, provider.Fetches(), "nothing was requested")
+
+	if err := follower.TriggerRefresh(context.Background(), "water.gov.ge"); err != nil {
+		t.Fatal(err)
+	}
+	clock.fire(timer)
+	timer = clock.wait(t)
+	assert.Equal(t, 2, provider.Fetches(), "the leader took the follower's request")
+	assert.Equal(t, time.Minute, timer.d)
+}
+
+func Test_SchedulerCron(t *testing.T) {
+	clock := newFakeClock(testNow)
+	mornings, err := cron.Parse("0 6 * * *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, stop := startScheduledService(t, clock, 0, outage.Registration{
+		Provider: &outage.FakeProvider{},
+		Interval: time.Hour,
+		Schedule: outage.Schedule{Cron: mornings, Jitter: time.Minute},
+	})
+	defer stop()
+
+	// testNow is noon, so the first wait runs to 06:00 the next day and
+	// the second one a day further, give or take the jitter.
+	for _, want := range []time.Duration{18 * time.Hour, 24 * time.Hour} {
+		timer := clock.wait(t)
+		assert.Greater(t, timer.d, want-time.Minute)
+		assert.Less(t, timer.d, want+time.Minute)
+		clock.fire(timer)
+	}
+}
+
+func Test_SchedulerCronBackoff(t *testing.T) {
+	clock := newFakeClock(testNow)
+	mornings, err := cron.Parse("0 6 * * *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, stop := startScheduledService(t, clock, 0, outage.Registration{
+		Provider: &outage.FakeProvider{Err: errors.New("upstream is down")},
+		Interval: time.Hour,
+		Schedule: outage.Schedule{Cron: mornings, MaxBackoff: 72 * time.Hour},
+	})
+	defer stop()
+
+	// Failures double the day between mornings, not the hour of Interval.
+	for _, want := range []time.Duration{48 * time.Hour, 72 * time.Hour} {
+		timer := clock.wait(t)
+		assert.Equal(t, want, timer.d)
+		clock.fire(timer)
+	}
+}
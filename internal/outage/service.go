@@ -2,64 +2,284 @@ package outage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
+	"sync"
 	"time"
 )
 
-type WaterGovGePlugin interface {
-	GetWaterOutages(ctx context.Context) ([]WaterGovGe, error)
-}
-
-type WaterGovGeRepo interface {
-	SaveOutages(ctx context.Context, outages ...WaterGovGe) error
+type Repo interface {
+	SaveOutages(ctx context.Context, outages ...Outage) error
+	GetOutages(ctx context.Context, providerId, titleLat string) ([]Outage, error)
+	// GetOutage returns the provider's outage at a location with the start
+	// and key given, ended or not, or ErrNotFound.
+	GetOutage(ctx context.Context, providerId, titleLat string, start time.Time, key string) (Outage, error)
+	// GetCurrentOutages returns the outages of kind a provider has not
+	// ended yet, at every location.
+	GetCurrentOutages(ctx context.Context, providerId string, kind Kind) ([]Outage, error)
+	SaveCenters(ctx context.Context, centers ...Center) error
+	GetCenters(ctx context.Context, providerId string) ([]Center, error)
+	GetCenterHistory(ctx context.Context, providerId, locationId string) ([]CenterStatus, error)
+	SaveManualOutage(ctx context.Context, o Outage) error
+	GetManualOutage(ctx context.Context, id string) (Outage, error)
+	GetManualOutages(ctx context.Context) ([]Outage, error)
+	SaveCrowdReport(ctx context.Context, r CrowdReport) error
+	GetCrowdReports(ctx context.Context, outageRef string) ([]CrowdReport, error)
+	SaveRevision(ctx context.Context, r Revision) error
+	GetRevisions(ctx context.Context, outageRef string) ([]Revision, error)
+	GetRevisionsAsOf(ctx context.Context, providerId, titleLat string, asOf time.Time) ([]Revision, error)
+	SaveRun(ctx context.Context, r Run) error
+	// GetRuns returns the latest runs of a provider, newest first.
+	GetRuns(ctx context.Context, providerId string, limit int) ([]Run, error)
+	// RequestRefresh leaves a request for the provider to be refreshed,
+	// for whichever replica refreshes it to take.
+	RequestRefresh(ctx context.Context, providerId string, at time.Time) error
+	// TakeRefreshRequest removes the provider's pending request and
+	// reports whether there was one.
+	TakeRefreshRequest(ctx context.Context, providerId string) (bool, error)
+	// SaveOutagesNotifying saves outages like SaveOutages and queues the
+	// notifications in the same write as the outages they are about.
+	// Notifications already queued are left as they are.
+	SaveOutagesNotifying(ctx context.Context, outages []Outage, notifications []Notification) error
+	SaveNotifications(ctx context.Context, notifications ...Notification) error
+	// ClaimNotifications claims up to limit notifications that are due at
+	// now and not claimed by another owner until after now.
+	ClaimNotifications(ctx context.Context, owner string, now, until time.Time, limit int) ([]Notification, error)
+	CompleteNotification(ctx context.Context, id string, deliveredAt time.Time) error
+	RetryNotification(ctx context.Context, id string, nextAttemptAt time.Time, lastErr string) error
 }
 
 type Service struct {
-	plugin WaterGovGePlugin
-	repo   WaterGovGeRepo
-	ticker *time.Ticker
-	sl     *slog.Logger
+	registry      Registry
+	repo          Repo
+	reportLimiter *ReportLimiter
+	now           func() time.Time
+	sl            *slog.Logger
+	changeFeed    bool
+	outbox        bool
+	clock         Clock
+	triggers      *refreshTriggers
+	triggerPoll   time.Duration
 }
 
-func NewService(ctx context.Context, parser WaterGovGePlugin, repo WaterGovGeRepo, interval time.Duration, sl *slog.Logger) Service {
-	ticker := time.NewTicker(interval)
-	go func() {
-		<-ctx.Done()
-		ticker.Stop()
-	}()
-	return Service{parser, repo, ticker, sl}
+func NewService(registry Registry, repo Repo, reportLimiter *ReportLimiter, now func() time.Time, sl *slog.Logger) Service {
+	return Service{registry, repo, reportLimiter, now, sl, false, false, systemClock{now}, newRefreshTriggers(), defaultTriggerPoll}
 }
 
+// StartRefreshingData refreshes every registered provider on its own
+// schedule and blocks until ctx is done.
 func (s Service) StartRefreshingData(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			s.sl.Info("stopping periodic refresh", slog.Any("ctx error", ctx.Err()))
-			return
-		default:
-			if err := s.refreshWaterOutages(ctx); err != nil {
-				s.sl.Error("refresh water outages", slog.Any("err", err))
-			}
-			<-s.ticker.C
-		}
+	var wg sync.WaitGroup
+	for _, reg := range s.registry.Registrations() {
+		wg.Add(1)
+		go func(reg Registration) {
+			defer wg.Done()
+			s.refreshPeriodically(ctx, reg)
+		}(reg)
 	}
+	wg.Wait()
 }
 
-func (s Service) refreshWaterOutages(ctx context.Context) error {
-	handleErr := func(err error) error {
-		return fmt.Errorf("refresh water outages: %w", err)
+// refreshProvider fetches and saves the provider's outages, counting them
+// in run.
+func (s Service) refreshProvider(ctx context.Context, provider Provider, run *Run) ([]Outage, error) {
+	handleErr := func(err error) ([]Outage, error) {
+		return nil, fmt.Errorf("refresh provider %s: %w", provider.Id(), err)
+	}
+	var (
+		outages    []Outage
+		centersErr error
+		err        error
+	)
+	if cp, ok := provider.(CenterProvider); ok {
+		var centers []Center
+		outages, centers, err = cp.GetOutagesAndCenters(ctx)
+		if len(centers) > 0 {
+			centersErr = s.refreshCenters(ctx, provider, centers)
+		}
+	} else {
+		outages, err = provider.GetOutages(ctx)
 	}
-	waterOutages, err := s.plugin.GetWaterOutages(ctx)
 	if err != nil {
-		return handleErr(err)
+		return handleErr(errors.Join(centersErr, err))
+	}
+	run.Parsed = len(outages)
+	for i := range outages {
+		outages[i].ProviderId = provider.Id()
+		outages[i].Kind = provider.Kind()
+		if outages[i].Source == "" {
+			outages[i].Source = SourceOfficial
+		}
+	}
+	outages, err = s.supersedeAnnouncements(ctx, provider.Id(), outages)
+	if err != nil {
+		s.sl.Warn("announcements were not superseded", slog.String("provider", provider.Id()), slog.Any("err", err))
+	}
+	outages, err = s.supersedeManual(ctx, outages)
+	if err != nil {
+		s.sl.Warn("manual outages were not superseded", slog.String("provider", provider.Id()), slog.Any("err", err))
+	}
+	outages, err = s.closeVanished(ctx, provider, outages)
+	if err != nil {
+		s.sl.Warn("vanished outages were not closed", slog.String("provider", provider.Id()), slog.Any("err", err))
+	}
+	if !s.outbox || s.changeFeed {
+		if err := s.repo.SaveOutages(ctx, outages...); err != nil {
+			return handleErr(errors.Join(centersErr, err))
+		}
+		run.Saved = len(outages)
+		if err := errors.Join(centersErr, s.recordRevisions(ctx, outages...)); err != nil {
+			return handleErr(err)
+		}
+		return outages, nil
+	}
+	// Revisions are saved after the outages and their notifications. A
+	// crash in between finds the same changes on the next refresh and
+	// queues the same notifications, which the outbox ignores. An outage
+	// whose revisions could not be read is saved without a notification
+	// and notified on a later refresh.
+	transitions, revisionsErr := s.newRevisions(ctx, outages...)
+	notifications, err := s.notifications(transitions)
+	if err != nil {
+		return handleErr(errors.Join(centersErr, revisionsErr, err))
 	}
-	if err := s.repo.SaveOutages(ctx, waterOutages...); err != nil {
+	if err := s.repo.SaveOutagesNotifying(ctx, outages, notifications); err != nil {
+		return handleErr(errors.Join(centersErr, revisionsErr, err))
+	}
+	run.Saved = len(outages)
+	if err := errors.Join(centersErr, revisionsErr, s.saveRevisions(ctx, transitions)); err != nil {
 		return handleErr(err)
 	}
-	return nil
+	return outages, nil
+}
+
+// closeVanished returns the refreshed outages along with the stored ones
+// the provider no longer publishes, closed, so that saving them records
+// when they vanished. Announcements from the news stay as they are, since
+// their articles may be gone before the outage goes live.
+func (s Service) closeVanished(ctx context.Context, provider Provider, outages []Outage) ([]Outage, error) {
+	stored, err := s.repo.GetCurrentOutages(ctx, provider.Id(), provider.Kind())
+	if err != nil {
+		return outages, fmt.Errorf("close vanished outages: %w", err)
+	}
+	refreshed := make(map[string]bool, len(outages))
+	for _, o := range outages {
+		refreshed[o.Ref()] = true
+	}
+	for _, o := range stored {
+		switch {
+		case refreshed[o.Ref()], o.Status == StatusClosed, o.Status == StatusSuperseded:
+			continue
+		case o.Status == StatusAnnounced && o.AnnouncementURI != "":
+			continue
+		}
+		o.Status = StatusClosed
+		outages = append(outages, o)
+	}
+	return outages, nil
 }
 
-func (s Service) GetWaterOutages(ctx context.Context) error {
+func (s Service) refreshCenters(ctx context.Context, provider Provider, centers []Center) error {
+	for i := range centers {
+		centers[i].ProviderId = provider.Id()
+	}
+	if err := s.repo.SaveCenters(ctx, centers...); err != nil {
+		return fmt.Errorf("refresh centers: %w", err)
+	}
 	return nil
 }
+
+// GetOutages returns the outages at a location that have not ended yet,
+// from every provider of kind and from operators.
+func (s Service) GetOutages(ctx context.Context, kind Kind, titleLat string) ([]Outage, error) {
+	handleErr := func(err error) ([]Outage, error) {
+		return nil, fmt.Errorf("get outages: %w", err)
+	}
+	var outages []Outage
+	for _, provider := range s.registry.ByKind(kind) {
+		providerOutages, err := s.repo.GetOutages(ctx, provider.Id(), titleLat)
+		if err != nil {
+			return handleErr(err)
+		}
+		// Announcements that went live are kept superseded in storage, and
+		// outages the provider stopped publishing are kept closed.
+		for _, o := range providerOutages {
+			if o.Status != StatusSuperseded && o.Status != StatusClosed {
+				outages = append(outages, o)
+			}
+		}
+	}
+	manual, err := s.repo.GetManualOutages(ctx)
+	if err != nil {
+		return handleErr(err)
+	}
+	for _, m := range manual {
+		if m.Kind == kind && m.Location.TitleLat == titleLat && m.open() {
+			outages = append(outages, m)
+		}
+	}
+	return outages, nil
+}
+
+// AddressIndex is implemented by repos that index outages by the words of
+// their addresses.
+type AddressIndex interface {
+	GetOutagesByAddress(ctx context.Context, providerId, addr string) ([]Outage, error)
+}
+
+// GetOutagesByAddress returns the outages of kind, ended or not, with an
+// address holding every word of addr, oldest first. It needs a repo with an
+// AddressIndex.
+func (s Service) GetOutagesByAddress(ctx context.Context, kind Kind, addr string) ([]Outage, error) {
+	handleErr := func(err error) ([]Outage, error) {
+		return nil, fmt.Errorf("get outages by address: %w", err)
+	}
+	index, ok := s.repo.(AddressIndex)
+	if !ok {
+		return handleErr(ErrNoAddressIndex)
+	}
+	var outages []Outage
+	for _, provider := range s.registry.ByKind(kind) {
+		providerOutages, err := index.GetOutagesByAddress(ctx, provider.Id(), addr)
+		if err != nil {
+			return handleErr(err)
+		}
+		for _, o := range providerOutages {
+			if o.Status != StatusSuperseded {
+				outages = append(outages, o)
+			}
+		}
+	}
+	sort.SliceStable(outages, func(i, j int) bool {
+		return outages[i].Start.Before(outages[j].Start)
+	})
+	return outages, nil
+}
+
+func (s Service) GetCenters(ctx context.Context, kind Kind) ([]Center, error) {
+	handleErr := func(err error) ([]Center, error) {
+		return nil, fmt.Errorf("get centers: %w", err)
+	}
+	var centers []Center
+	for _, provider := range s.registry.ByKind(kind) {
+		if _, ok := provider.(CenterProvider); !ok {
+			continue
+		}
+		providerCenters, err := s.repo.GetCenters(ctx, provider.Id())
+		if err != nil {
+			return handleErr(err)
+		}
+		centers = append(centers, providerCenters...)
+	}
+	return centers, nil
+}
+
+func (s Service) GetCenterHistory(ctx context.Context, providerId, locationId string) ([]CenterStatus, error) {
+	history, err := s.repo.GetCenterHistory(ctx, providerId, locationId)
+	if err != nil {
+		return nil, fmt.Errorf("get center history: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,440 @@
+package outage_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2023, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func fixedNow() time.Time {
+	return testNow
+}
+
+func newTestService(t *testing.T, now func() time.Time, providers ...outage.Provider) (outage.Service, repo.Memory) {
+	t.Helper()
+	var registrations []outage.Registration
+	for _, p := range providers {
+		registrations = append(registrations, outage.Registration{Provider: p, Interval: time.Hour})
+	}
+	registry, err := outage.NewRegistry(registrations...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := repo.NewMemory("", now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outage.NewService(registry, store, outage.NewReportLimiter(2, time.Hour), now, slog.Default()), store
+}
+
+func Test_ServiceRefreshSupersedesManual(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"}
+	official := outage.Outage{
+		Start:       testNow.Add(time.Hour),
+		End:         testNow.Add(6 * time.Hour),
+		Location:    rustavi,
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      outage.StatusAnnounced,
+	}
+	s, store := newTestService(t, fixedNow, &outage.FakeProvider{Outages: []outage.Outage{official}})
+	manual, err := s.ReportOutage(ctx, outage.Outage{
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-time.Hour),
+		Location:    outage.Location{TitleGe: "რუსთავი"},
+		AddressesGe: []string{"მესხიშვილის  ქ."},
+		Reporter:    "nino",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outages, err := s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Outage{manual}, outages)
+
+	// A cancelled context refreshes every provider once and returns.
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StartRefreshingData(refreshCtx)
+
+	outages, err = s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	official.ProviderId = "water.gov.ge"
+	official.Kind = outage.KindWater
+	official.Source = outage.SourceOfficial
+	official.Extra = map[string]string{outage.ExtraManualReport: manual.Id}
+	assert.Equal(t, []outage.Outage{official}, outages)
+	superseded, err := store.GetManualOutage(ctx, manual.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, outage.StatusSuperseded, superseded.Status)
+}
+
+func Test_ServiceGetOutagesByAddress(t *testing.T) {
+	ctx := context.Background()
+	ended := outage.Outage{
+		Start:       testNow.Add(-48 * time.Hour),
+		End:         testNow.Add(-40 * time.Hour),
+		Location:    outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		AddressesGe: []string{"მესხიშვილის ქ. N5"},
+		Status:      outage.StatusActive,
+	}
+	active := ended
+	active.Start, active.End = testNow.Add(-time.Hour), testNow.Add(6*time.Hour)
+	active.AddressesGe = []string{"მესხიშვილის ქ. №5", "კოსტავას გამზ. 12"}
+	elsewhere := active
+	elsewhere.Start = testNow
+	elsewhere.AddressesGe = []string{"მესხიშვილის ქ. 7"}
+	s, store := newTestService(t, fixedNow, &outage.FakeProvider{Outages: []outage.Outage{active, elsewhere}})
+	ended.ProviderId, ended.Kind, ended.Source = "water.gov.ge", outage.KindWater, outage.SourceOfficial
+	if err := store.SaveOutages(ctx, ended); err != nil {
+		t.Fatal(err)
+	}
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StartRefreshingData(refreshCtx)
+
+	outages, err := s.GetOutagesByAddress(ctx, outage.KindWater, "მესხიშვილის 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active.ProviderId, active.Kind, active.Source = "water.gov.ge", outage.KindWater, outage.SourceOfficial
+	assert.Equal(t, []outage.Outage{ended, active}, outages)
+}
+
+func Test_ServiceReportCrowd(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, fixedNow)
+	manual, err := s.ReportOutage(ctx, outage.Outage{
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-time.Hour),
+		Location:    outage.Location{TitleGe: "რუსთავი"},
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Reporter:    "nino",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ReportCrowd(ctx, outage.CrowdReport{OutageRef: "manual/missing", Reporter: "bot:1", Status: outage.ReportRestored})
+	assert.ErrorIs(t, err, outage.ErrNotFound)
+	report := outage.CrowdReport{OutageRef: manual.Ref(), Reporter: "bot:1", Status: outage.ReportRestored}
+	crowd, err := s.ReportCrowd(ctx, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, outage.Crowd{Restored: 1, Confidence: 1.0 / 3.0, RestoredAt: testNow, LastReportAt: testNow}, crowd)
+	crowd, err = s.ReportCrowd(ctx, outage.CrowdReport{OutageRef: manual.Ref(), Reporter: "bot:2", Status: outage.ReportStillOff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, outage.Crowd{Restored: 1, StillOff: 1, Confidence: 0.5, LastReportAt: testNow}, crowd)
+	if _, err := s.ReportCrowd(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ReportCrowd(ctx, report)
+	assert.ErrorIs(t, err, outage.ErrRateLimited)
+}
+
+func Test_ServiceReportCrowdScraped(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t, fixedNow)
+	// Saved without a revision, as when revisions come from the stream, and
+	// already ended.
+	ended := outage.Outage{
+		ProviderId: "water.gov.ge",
+		Kind:       outage.KindWater,
+		Start:      testNow.Add(-5 * time.Hour),
+		End:        testNow.Add(-time.Hour),
+		Location:   outage.Location{Id: "3", TitleGe: "ბათუმის", TitleLat: "batumis"},
+		Status:     outage.StatusActive,
+		Source:     outage.SourceOfficial,
+	}
+	if err := store.SaveOutages(ctx, ended); err != nil {
+		t.Fatal(err)
+	}
+	crowd, err := s.ReportCrowd(ctx, outage.CrowdReport{OutageRef: ended.Ref(), Reporter: "bot:1", Status: outage.ReportStillOff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, crowd.StillOff)
+	_, err = s.ReportCrowd(ctx, outage.CrowdReport{OutageRef: "water.gov.ge/batumis/" + testNow.UTC().Format(time.RFC3339), Reporter: "bot:1", Status: outage.ReportStillOff})
+	assert.ErrorIs(t, err, outage.ErrNotFound)
+	_, err = s.ReportCrowd(ctx, outage.CrowdReport{OutageRef: "water.gov.ge/batumis/yesterday", Reporter: "bot:1", Status: outage.ReportStillOff})
+	assert.ErrorIs(t, err, outage.ErrInvalidOutage)
+}
+
+func Test_ServiceRevisions(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Outage{
+		Start:       testNow.Add(-time.Hour),
+		End:         testNow.Add(6 * time.Hour),
+		Location:    outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      outage.StatusActive,
+	}
+	provider := &outage.FakeProvider{Outages: []outage.Outage{rustavi}}
+	s, _ := newTestService(t, fixedNow, provider)
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, end := range []time.Time{rustavi.End, rustavi.End, rustavi.End.Add(2 * time.Hour)} {
+		provider.Outages[0].End = end
+		s.StartRefreshingData(refreshCtx)
+	}
+	revisions, err := s.GetOutageHistory(ctx, "water.gov.ge/rustavi/2023-10-18T11:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, revisions, 2)
+	assert.Nil(t, revisions[0].Changed)
+	assert.Equal(t, []string{"end"}, revisions[1].Changed)
+	assert.Equal(t, testNow.Add(8*time.Hour), revisions[1].Outage.End)
+	_, err = s.GetOutageHistory(ctx, "water.gov.ge/rustavi/2023-10-18T12:00:00Z")
+	assert.ErrorIs(t, err, outage.ErrNotFound)
+}
+
+func Test_ServiceOutagesAsOf(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Outage{
+		Start:       testNow.Add(time.Hour),
+		End:         testNow.Add(6 * time.Hour),
+		Location:    outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      outage.StatusAnnounced,
+	}
+	emergency := rustavi
+	emergency.Start = testNow.Add(2 * time.Hour)
+	emergency.End = testNow.Add(3 * time.Hour)
+	provider := &outage.FakeProvider{Outages: []outage.Outage{rustavi}}
+	now := testNow
+	s, _ := newTestService(t, func() time.Time { return now }, provider)
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StartRefreshingData(refreshCtx)
+	now = testNow.Add(30 * time.Minute)
+	provider.Outages = []outage.Outage{rustavi, emergency}
+	provider.Outages[0].End = testNow.Add(9 * time.Hour)
+	s.StartRefreshingData(refreshCtx)
+
+	before, err := s.GetOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, before, 1)
+	assert.Equal(t, testNow.Add(6*time.Hour), before[0].End)
+	after, err := s.GetOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, after, 2)
+	ended, err := s.GetOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(4*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, ended, 1)
+	none, err := s.GetOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, none)
+
+	diff, err := s.DiffOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(time.Minute), testNow.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, diff.Added, 1)
+	assert.Equal(t, testNow.Add(2*time.Hour), diff.Added[0].Start)
+	assert.Empty(t, diff.Removed)
+	assert.Len(t, diff.Changed, 1)
+	assert.Equal(t, []string{"end"}, diff.Changed[0].Changed)
+}
+
+func Test_ServiceRefreshClosesVanished(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Outage{
+		Start:    testNow,
+		End:      testNow.Add(6 * time.Hour),
+		Location: outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		Status:   outage.StatusActive,
+	}
+	provider := &outage.FakeProvider{Outages: []outage.Outage{rustavi}}
+	now := testNow
+	s, _ := newTestService(t, func() time.Time { return now }, provider)
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StartRefreshingData(refreshCtx)
+	now = testNow.Add(time.Hour)
+	provider.Outages = nil
+	s.StartRefreshingData(refreshCtx)
+
+	live, err := s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, live)
+	revisions, err := s.GetOutageHistory(ctx, "water.gov.ge/rustavi/2023-10-18T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, []string{"status"}, revisions[1].Changed)
+	assert.Equal(t, now, revisions[1].ObservedAt)
+	before, err := s.GetOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, before, 1)
+	after, err := s.GetOutagesAsOf(ctx, outage.KindWater, "rustavi", testNow.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, after)
+
+	s.StartRefreshingData(refreshCtx)
+	revisions, err = s.GetOutageHistory(ctx, "water.gov.ge/rustavi/2023-10-18T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, revisions, 2, "a closed outage is closed once")
+}
+
+func Test_ServiceHandleChange(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Outage{
+		ProviderId:  "water.gov.ge",
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-time.Hour),
+		End:         testNow.Add(6 * time.Hour),
+		Location:    outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+		AddressesGe: []string{"მესხიშვილის ქ."},
+		Status:      outage.StatusActive,
+	}
+	provider := &outage.FakeProvider{Outages: []outage.Outage{rustavi}}
+	s, _ := newTestService(t, fixedNow, provider)
+	s = s.WithChangeFeed()
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StartRefreshingData(refreshCtx)
+	_, err := s.GetOutageHistory(ctx, rustavi.Ref())
+	assert.ErrorIs(t, err, outage.ErrNotFound, "the refresh leaves revisions to the feed")
+
+	extended := rustavi
+	extended.End = rustavi.End.Add(2 * time.Hour)
+	for _, c := range []outage.Change{
+		{New: rustavi, ObservedAt: testNow},
+		{Old: rustavi, New: rustavi, ObservedAt: testNow.Add(time.Minute)},
+		{Old: rustavi, New: extended, ObservedAt: testNow.Add(2 * time.Minute)},
+		{Old: extended, ObservedAt: testNow.Add(3 * time.Minute)},
+	} {
+		if err := s.HandleChange(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revisions, err := s.GetOutageHistory(ctx, rustavi.Ref())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, []string{"end"}, revisions[1].Changed)
+	assert.Equal(t, testNow.Add(2*time.Minute), revisions[1].ObservedAt)
+}
+
+func Test_ServiceRefreshSupersedesStoredAnnouncement(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"}
+	announced := outage.Outage{
+		Start:           testNow.Add(time.Hour),
+		End:             testNow.Add(6 * time.Hour),
+		Location:        rustavi,
+		Status:          outage.StatusAnnounced,
+		AnnouncementURI: "http://water.gov.ge/page/full/2741",
+	}
+	live := outage.Outage{
+		Start:    testNow.Add(90 * time.Minute),
+		End:      testNow.Add(8 * time.Hour),
+		Location: rustavi,
+		Status:   outage.StatusActive,
+	}
+	provider := &outage.FakeProvider{Outages: []outage.Outage{announced}}
+	s, store := newTestService(t, fixedNow, provider)
+	refresh := func() {
+		t.Helper()
+		refreshCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		s.StartRefreshingData(refreshCtx)
+	}
+	refresh()
+	outages, err := s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, outages, 1)
+	assert.Equal(t, outage.StatusAnnounced, outages[0].Status)
+
+	// The article is gone from the news by the time the outage goes live.
+	provider.Set([]outage.Outage{live}, nil)
+	refresh()
+	outages, err = s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, outages, 1)
+	assert.Equal(t, live.Start, outages[0].Start)
+	assert.Equal(t, announced.AnnouncementURI, outages[0].AnnouncementURI)
+	stored, err := store.GetOutages(ctx, "water.gov.ge", "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, stored, 2)
+
+	// An article fetched again does not bring the announcement back.
+	provider.Set([]outage.Outage{live, announced}, nil)
+	refresh()
+	outages, err = s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, outages, 1)
+	assert.Equal(t, live.Start, outages[0].Start)
+}
+
+func Test_ServiceRefreshFetchesMapOnce(t *testing.T) {
+	ctx := context.Background()
+	rustavi := outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"}
+	provider := &outage.FakeProvider{
+		Outages: []outage.Outage{{
+			Start:    testNow,
+			End:      testNow.Add(time.Hour),
+			Location: rustavi,
+			Status:   outage.StatusActive,
+		}},
+		Centers: []outage.Center{{Location: rustavi, Problem: true}},
+	}
+	s, _ := newTestService(t, fixedNow, provider)
+	refreshCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	s.StartRefreshingData(refreshCtx)
+
+	assert.Equal(t, 1, provider.Fetches())
+	centers, err := s.GetCenters(ctx, outage.KindWater)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, centers, 1)
+	outages, err := s.GetOutages(ctx, outage.KindWater, "rustavi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, outages, 1)
+}
@@ -0,0 +1,119 @@
+package declarative
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"gopkg.in/yaml.v3"
+)
+
+// Definition describes how to scrape one provider without writing a parser.
+// Items are either the pages behind Link on the listing, or the elements
+// matched by Container on the listing (or on each linked page).
+type Definition struct {
+	Id       string          `yaml:"id"`
+	Kind     outage.Kind     `yaml:"kind"`
+	Interval time.Duration   `yaml:"interval"`
+	Listing  string          `yaml:"listing"`
+	Layout   string          `yaml:"layout"`
+	TimeZone string          `yaml:"time_zone"`
+	Items    Items           `yaml:"items"`
+	Fields   Fields          `yaml:"fields"`
+	Extra    map[string]Rule `yaml:"extra"`
+}
+
+type Items struct {
+	Link      string `yaml:"link"`
+	Container string `yaml:"container"`
+	Filter    string `yaml:"filter"`
+}
+
+type Fields struct {
+	Start     Rule `yaml:"start"`
+	End       Rule `yaml:"end"`
+	Customers Rule `yaml:"customers"`
+	Location  Rule `yaml:"location"`
+	Addresses Rule `yaml:"addresses"`
+}
+
+// Rule locates a value with a CSS selector, a regex over the selected text,
+// or both. A regex with several groups joins them with a space. Layout
+// overrides the definition layout; a layout without a date takes the date
+// of the start. Split breaks one element into several addresses and Map
+// translates the extracted value.
+type Rule struct {
+	Selector   string            `yaml:"selector"`
+	Regex      string            `yaml:"regex"`
+	Layout     string            `yaml:"layout"`
+	Split      string            `yaml:"split"`
+	TrimSuffix string            `yaml:"trim_suffix"`
+	Map        map[string]string `yaml:"map"`
+}
+
+func (r Rule) empty() bool {
+	return r.Selector == "" && r.Regex == ""
+}
+
+func ParseDefinition(raw []byte) (Definition, error) {
+	handleErr := func(err error) (Definition, error) {
+		return Definition{}, fmt.Errorf("parse definition: %w", err)
+	}
+	var def Definition
+	if err := yaml.Unmarshal(raw, &def); err != nil {
+		return handleErr(err)
+	}
+	if err := def.validate(); err != nil {
+		return handleErr(err)
+	}
+	return def, nil
+}
+
+func LoadDefinitions(dir string) ([]Definition, error) {
+	handleErr := func(err error) ([]Definition, error) {
+		return nil, fmt.Errorf("load definitions from %s: %w", dir, err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return handleErr(err)
+	}
+	defs := make([]Definition, 0, len(paths))
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return handleErr(err)
+		}
+		def, err := ParseDefinition(raw)
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: %w", filepath.Base(path), err))
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+func (d Definition) validate() error {
+	switch {
+	case d.Id == "":
+		return errNoId
+	case d.Kind != outage.KindWater && d.Kind != outage.KindElectricity && d.Kind != outage.KindGas:
+		return fmt.Errorf("%w: %q", errBadKind, d.Kind)
+	case d.Listing == "":
+		return errNoListing
+	case d.Layout == "":
+		return errNoLayout
+	case d.Interval <= 0:
+		return errNoInterval
+	case d.Items.Link == "" && d.Items.Container == "":
+		return errNoItems
+	case d.Fields.Start.empty():
+		return fmt.Errorf("%w: start", errNoRule)
+	case d.Fields.End.empty():
+		return fmt.Errorf("%w: end", errNoRule)
+	case d.Fields.Addresses.empty():
+		return fmt.Errorf("%w: addresses", errNoRule)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package declarative
+
+type errorParser string
+
+func (e errorParser) Error() string {
+	return string(e)
+}
+func (e errorParser) Parser() {}
+
+const (
+	errNoId         errorParser = "definition has no id"
+	errBadKind      errorParser = "definition has unknown kind"
+	errNoListing    errorParser = "definition has no listing url"
+	errNoLayout     errorParser = "definition has no date layout"
+	errNoItems      errorParser = "definition has neither item link nor container"
+	errNoRule       errorParser = "definition misses a required field rule"
+	errNoInterval   errorParser = "definition has no refresh interval"
+	errNoContainer  errorParser = "item container not found"
+	errNoField      errorParser = "field not found"
+	errBadStart     errorParser = "malformed start"
+	errBadEnd       errorParser = "malformed end"
+	errBadCustomers errorParser = "malformed customers"
+	errNoAddresses  errorParser = "no addresses"
+	errUnmapped     errorParser = "value has no mapping"
+)
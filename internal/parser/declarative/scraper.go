@@ -0,0 +1,386 @@
+package declarative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+)
+
+// Scraper executes a Definition. Items that do not parse are logged with a
+// diagnostic and skipped, so one odd announcement does not hide the rest.
+type Scraper struct {
+	c         *http.Client
+	def       Definition
+	link      *dom.Selector
+	container *dom.Selector
+	filterRx  *regexp.Regexp
+	fields    map[string]compiledRule
+	location  *time.Location
+	sl        *slog.Logger
+}
+
+type compiledRule struct {
+	Rule
+	selector *dom.Selector
+	rx       *regexp.Regexp
+}
+
+type item struct {
+	uri string
+	doc []byte
+	n   *dom.Node
+}
+
+const (
+	fieldStart     = "start"
+	fieldEnd       = "end"
+	fieldCustomers = "customers"
+	fieldLocation  = "location"
+	fieldAddresses = "addresses"
+)
+
+func NewScraper(def Definition, sl *slog.Logger) (Scraper, error) {
+	handleErr := func(err error) (Scraper, error) {
+		return Scraper{}, fmt.Errorf("new scraper %s: %w", def.Id, err)
+	}
+	if err := def.validate(); err != nil {
+		return handleErr(err)
+	}
+	timeZone := def.TimeZone
+	if timeZone == "" {
+		timeZone = "Asia/Tbilisi"
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return handleErr(err)
+	}
+	link, err := compileSelector(def.Items.Link)
+	if err != nil {
+		return handleErr(err)
+	}
+	container, err := compileSelector(def.Items.Container)
+	if err != nil {
+		return handleErr(err)
+	}
+	var filterRx *regexp.Regexp
+	if def.Items.Filter != "" {
+		if filterRx, err = regexp.Compile(def.Items.Filter); err != nil {
+			return handleErr(err)
+		}
+	}
+	rules := map[string]Rule{
+		fieldStart:     def.Fields.Start,
+		fieldEnd:       def.Fields.End,
+		fieldCustomers: def.Fields.Customers,
+		fieldLocation:  def.Fields.Location,
+		fieldAddresses: def.Fields.Addresses,
+	}
+	for name, rule := range def.Extra {
+		rules["extra."+name] = rule
+	}
+	fields := make(map[string]compiledRule, len(rules))
+	for name, rule := range rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: %w", name, err))
+		}
+		fields[name] = compiled
+	}
+	c := http.Client{
+		Timeout: time.Second * 10,
+	}
+	return Scraper{
+		&c,
+		def,
+		link,
+		container,
+		filterRx,
+		fields,
+		location,
+		sl,
+	}, nil
+}
+
+func compileSelector(sel string) (*dom.Selector, error) {
+	if sel == "" {
+		return nil, nil
+	}
+	s, err := dom.Compile(sel)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func compileRule(rule Rule) (compiledRule, error) {
+	selector, err := compileSelector(rule.Selector)
+	if err != nil {
+		return compiledRule{}, err
+	}
+	var rx *regexp.Regexp
+	if rule.Regex != "" {
+		if rx, err = regexp.Compile(rule.Regex); err != nil {
+			return compiledRule{}, err
+		}
+	}
+	return compiledRule{rule, selector, rx}, nil
+}
+
+func (s Scraper) Definition() Definition {
+	return s.def
+}
+
+// WithTransport makes the scraper fetch the listing and the pages it
+// links to through rt.
+func (s Scraper) WithTransport(rt http.RoundTripper) Scraper {
+	c := *s.c
+	c.Transport = rt
+	s.c = &c
+	return s
+}
+
+func (s Scraper) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get %s outages: %w", s.def.Id, err)
+	}
+	items, err := s.fetchItems(ctx)
+	if err != nil {
+		return handleErr(err)
+	}
+	var outages []outage.Outage
+	for _, it := range items {
+		o, err := s.parseItem(it)
+		if err != nil {
+			var diag parser.Diagnostic
+			if errors.As(err, &diag) {
+				s.sl.Warn("item did not parse", slog.String("provider", s.def.Id), slog.String("uri", it.uri), slog.Any("diagnostic", diag))
+				continue
+			}
+			return handleErr(err)
+		}
+		outages = append(outages, o)
+	}
+	return outages, nil
+}
+
+func (s Scraper) fetchItems(ctx context.Context) ([]item, error) {
+	handleErr := func(err error) ([]item, error) {
+		return nil, fmt.Errorf("fetch items: %w", err)
+	}
+	rawListing, err := parser.FetchRawHTMLFile(ctx, s.c, s.def.Listing)
+	if err != nil {
+		return handleErr(err)
+	}
+	listing, err := dom.Parse(rawListing)
+	if err != nil {
+		return handleErr(err)
+	}
+	if s.link == nil {
+		return s.containers(item{s.def.Listing, rawListing, listing}), nil
+	}
+	base, err := url.Parse(s.def.Listing)
+	if err != nil {
+		return handleErr(err)
+	}
+	var items []item
+	for _, a := range listing.Select(*s.link) {
+		if s.filterRx != nil && !s.filterRx.MatchString(a.TextContent()) {
+			continue
+		}
+		ref, err := url.Parse(a.Attr("href"))
+		if err != nil {
+			s.sl.Warn("skipping malformed item link", slog.String("provider", s.def.Id), slog.Any("diagnostic", parser.NewDiagnostic(errNoField, rawListing, a.Offset, err)))
+			continue
+		}
+		uri := base.ResolveReference(ref).String()
+		rawPage, err := parser.FetchRawHTMLFile(ctx, s.c, uri)
+		if err != nil {
+			return handleErr(err)
+		}
+		page, err := dom.Parse(rawPage)
+		if err != nil {
+			return handleErr(err)
+		}
+		pageItems := s.containers(item{uri, rawPage, page})
+		if len(pageItems) == 0 {
+			s.sl.Warn("item page has no container", slog.String("provider", s.def.Id), slog.Any("diagnostic", parser.NewDiagnostic(errNoContainer, rawPage, 0, nil)))
+		}
+		items = append(items, pageItems...)
+	}
+	return items, nil
+}
+
+func (s Scraper) containers(page item) []item {
+	if s.container == nil {
+		return []item{page}
+	}
+	var items []item
+	for _, n := range page.n.Select(*s.container) {
+		if s.link == nil && s.filterRx != nil && !s.filterRx.MatchString(n.TextContent()) {
+			continue
+		}
+		items = append(items, item{page.uri, page.doc, n})
+	}
+	return items
+}
+
+func (s Scraper) parseItem(it item) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("parse item %s: %w", it.uri, err)
+	}
+	diagnose := func(rule errorParser, offset int, cause error) (outage.Outage, error) {
+		return handleErr(parser.NewDiagnostic(rule, it.doc, offset, cause))
+	}
+	rawStart, offset, found := s.extract(s.fields[fieldStart], it.n)
+	if !found {
+		return diagnose(errNoField, offset, errors.New(fieldStart))
+	}
+	start, err := s.parseTime(s.fields[fieldStart], rawStart, time.Time{})
+	if err != nil {
+		return diagnose(errBadStart, offset, err)
+	}
+	rawEnd, offset, found := s.extract(s.fields[fieldEnd], it.n)
+	if !found {
+		return diagnose(errNoField, offset, errors.New(fieldEnd))
+	}
+	end, err := s.parseTime(s.fields[fieldEnd], rawEnd, start)
+	if err != nil {
+		return diagnose(errBadEnd, offset, err)
+	}
+	affectedCustomers := 0
+	if rule := s.fields[fieldCustomers]; !rule.empty() {
+		if rawCustomers, offset, found := s.extract(rule, it.n); found {
+			if affectedCustomers, err = strconv.Atoi(rawCustomers); err != nil {
+				return diagnose(errBadCustomers, offset, err)
+			}
+		}
+	}
+	titleGe := s.def.Id
+	if rule := s.fields[fieldLocation]; !rule.empty() {
+		if rawLocation, _, found := s.extract(rule, it.n); found {
+			titleGe = rawLocation
+		}
+	}
+	addresses := s.extractAll(s.fields[fieldAddresses], it.n)
+	if len(addresses) == 0 {
+		return diagnose(errNoAddresses, it.n.Offset, nil)
+	}
+	extra := make(map[string]string)
+	for name := range s.def.Extra {
+		value, offset, found := s.extract(s.fields["extra."+name], it.n)
+		if !found {
+			continue
+		}
+		if value == "" {
+			return diagnose(errUnmapped, offset, errors.New(name))
+		}
+		extra[name] = value
+	}
+	var announcementURI string
+	if it.uri != s.def.Listing {
+		announcementURI = it.uri
+	}
+	titleLat := address.Translit(titleGe)
+	return outage.Outage{
+		Start:             start,
+		End:               end,
+		AffectedCustomers: affectedCustomers,
+		Location: outage.Location{
+			Id:       titleLat,
+			TitleGe:  titleGe,
+			TitleLat: titleLat,
+		},
+		AddressesGe:     addresses,
+		AnnouncementURI: announcementURI,
+		Extra:           extra,
+	}, nil
+}
+
+// extract returns the first value matched by rule below n, with its offset
+// in the document.
+func (s Scraper) extract(rule compiledRule, n *dom.Node) (string, int, bool) {
+	nodes := []*dom.Node{n}
+	if rule.selector != nil {
+		nodes = n.Select(*rule.selector)
+	}
+	for _, node := range nodes {
+		if value, found := rule.apply(node.TextContent()); found {
+			return value, node.TextOffset(value), true
+		}
+	}
+	return "", n.Offset, false
+}
+
+func (s Scraper) extractAll(rule compiledRule, n *dom.Node) []string {
+	nodes := []*dom.Node{n}
+	if rule.selector != nil {
+		nodes = n.Select(*rule.selector)
+	}
+	var values []string
+	for _, node := range nodes {
+		value, found := rule.apply(node.TextContent())
+		if !found {
+			continue
+		}
+		if rule.Split != "" {
+			values = append(values, address.Split(value, rule.Split)...)
+		} else if value = address.Normalize(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (r compiledRule) apply(text string) (string, bool) {
+	value := text
+	if r.rx != nil {
+		m := r.rx.FindStringSubmatch(text)
+		switch {
+		case m == nil:
+			return "", false
+		case len(m) == 1:
+			value = m[0]
+		default:
+			value = strings.Join(m[1:], " ")
+		}
+	}
+	value = strings.TrimSpace(value)
+	if r.TrimSuffix != "" {
+		value = strings.TrimSpace(strings.TrimSuffix(value, r.TrimSuffix))
+	}
+	if r.Map != nil {
+		value = r.Map[value]
+	}
+	return value, value != "" || r.Map != nil
+}
+
+func (s Scraper) parseTime(rule compiledRule, value string, day time.Time) (time.Time, error) {
+	layout := s.def.Layout
+	if rule.Layout != "" {
+		layout = rule.Layout
+	}
+	t, err := time.ParseInLocation(layout, value, s.location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Year() != 0 || day.IsZero() {
+		return t, nil
+	}
+	t = time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, s.location)
+	if !t.After(day) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
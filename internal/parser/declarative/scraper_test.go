@@ -0,0 +1,127 @@
+package declarative
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser/electricity"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFixtureServer(t *testing.T, routes map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, found := routes[r.URL.Path]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "./fixtures/"+fixture)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func loadFixtureDefinition(t *testing.T, name string) Definition {
+	t.Helper()
+	raw, err := os.ReadFile("./fixtures/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := ParseDefinition(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return def
+}
+
+func Test_ScrapeLinkedItems(t *testing.T) {
+	srv := newFixtureServer(t, map[string]string{
+		"/ka/news":     "rustavi_water_news.html",
+		"/ka/news/101": "rustavi_water_101.html",
+		"/ka/news/103": "rustavi_water_103.html",
+		"/ka/news/104": "rustavi_water_104.html",
+	})
+	def := loadFixtureDefinition(t, "rustavi_water.yaml")
+	def.Listing = srv.URL + "/ka/news"
+	s, err := NewScraper(def, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outages, err := s.GetOutages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := outage.Location{
+		Id:       "rustavi",
+		TitleGe:  "რუსთავი",
+		TitleLat: "rustavi",
+	}
+	wantOutages := []outage.Outage{
+		{
+			Start:    time.Date(2023, 10, 18, 10, 0, 0, 0, s.location),
+			End:      time.Date(2023, 10, 18, 18, 0, 0, 0, s.location),
+			Location: location,
+			AddressesGe: []string{
+				"მესხიშვილის ქ.",
+				"კოსტავას გამზ. N 12",
+				"შარტავას ქ.",
+			},
+			AnnouncementURI: srv.URL + "/ka/news/101",
+			Extra:           map[string]string{},
+		},
+		{
+			Start:           time.Date(2023, 10, 19, 23, 0, 0, 0, s.location),
+			End:             time.Date(2023, 10, 20, 5, 0, 0, 0, s.location),
+			Location:        location,
+			AddressesGe:     []string{"ფალიაშვილის ქ."},
+			AnnouncementURI: srv.URL + "/ka/news/103",
+			Extra:           map[string]string{},
+		},
+	}
+	assert.Equal(t, wantOutages, outages)
+}
+
+func Test_ScrapeMatchesEnergoPro(t *testing.T) {
+	srv := newFixtureServer(t, map[string]string{
+		"/ka/outages": "../../electricity/fixtures/energo_pro.html",
+	})
+	def := loadFixtureDefinition(t, "energo_pro.yaml")
+	def.Listing = srv.URL + "/ka/outages"
+	s, err := NewScraper(def, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := electricity.NewEnergoPro(srv.URL, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	wantOutages, err := e.GetOutages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outages, err := s.GetOutages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, wantOutages, outages)
+}
+
+func Test_ParseDefinitionInvalid(t *testing.T) {
+	def := loadFixtureDefinition(t, "energo_pro.yaml")
+	def.Fields.Addresses = Rule{}
+	_, err := NewScraper(def, slog.Default())
+	assert.True(t, errors.Is(err, errNoRule))
+	def = loadFixtureDefinition(t, "energo_pro.yaml")
+	def.Fields.Start.Selector = ".outage-time >"
+	_, err = NewScraper(def, slog.Default())
+	assert.Error(t, err)
+}
@@ -0,0 +1,20 @@
+package electricity
+
+import (
+	"strings"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+const dateTimeLayout = "02.01.2006 15:04"
+
+func interruption(label string) (string, error) {
+	switch strings.TrimSpace(label) {
+	case "გეგმიური":
+		return outage.InterruptionPlanned, nil
+	case "ავარიული":
+		return outage.InterruptionEmergency, nil
+	default:
+		return "", errUnknownInterruption
+	}
+}
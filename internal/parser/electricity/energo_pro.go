@@ -0,0 +1,152 @@
+package electricity
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+)
+
+// EnergoPro scrapes the outage announcements of Energo-Pro Georgia, which
+// serves the regions outside Tbilisi, grouped by service center.
+type EnergoPro struct {
+	c           *http.Client
+	timeRangeRx *regexp.Regexp
+	customersRx *regexp.Regexp
+	location    *time.Location
+	outagesURI  string
+	sl          *slog.Logger
+}
+
+func NewEnergoPro(baseURI string, sl *slog.Logger) (EnergoPro, error) {
+	const outagesPath = "/ka/outages"
+	tbilisi, err := time.LoadLocation("Asia/Tbilisi")
+	if err != nil {
+		return EnergoPro{}, fmt.Errorf("load location: %w", err)
+	}
+	var (
+		timeRangeRx = regexp.MustCompile(`(\d{2}\.\d{2}\.\d{4}\s+\d{1,2}:\d{2})\s*-\s*(\d{2}\.\d{2}\.\d{4}\s+\d{1,2}:\d{2})`)
+		customersRx = regexp.MustCompile(`(\d+)`)
+	)
+	c := http.Client{
+		Timeout: time.Second * 10,
+	}
+	return EnergoPro{
+		&c,
+		timeRangeRx,
+		customersRx,
+		tbilisi,
+		baseURI + outagesPath,
+		sl,
+	}, nil
+}
+
+// WithTransport makes EnergoPro fetch its outages page through rt.
+func (e EnergoPro) WithTransport(rt http.RoundTripper) EnergoPro {
+	c := *e.c
+	c.Transport = rt
+	e.c = &c
+	return e
+}
+
+func (e EnergoPro) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get energo-pro outages: %w", err)
+	}
+	rawHTML, err := parser.FetchRawHTMLFile(ctx, e.c, e.outagesURI)
+	if err != nil {
+		return handleErr(err)
+	}
+	outages, err := e.parseOutages(ctx, rawHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, nil
+}
+
+func (e EnergoPro) parseOutages(ctx context.Context, rawHTML []byte) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("parse energo-pro outages: %w", err)
+	}
+	diagnose := func(rule errorParser, offset int, cause error) ([]outage.Outage, error) {
+		return handleErr(parser.NewDiagnostic(rule, rawHTML, offset, cause))
+	}
+	root, err := dom.Parse(rawHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	list := root.Find(dom.ByClass("outages-list"))
+	if list == nil {
+		return diagnose(errNoOutages, 0, nil)
+	}
+	var outages []outage.Outage
+	for _, item := range list.FindAll(dom.ByClass("outage")) {
+		region := item.Find(dom.ByClass("outage-region"))
+		if region == nil {
+			return diagnose(errNoRegion, item.Offset, nil)
+		}
+		titleGe := address.TrimServiceCenter(region.TextContent())
+		timeNode := item.Find(dom.ByClass("outage-time"))
+		if timeNode == nil {
+			return diagnose(errBadOutageTime, item.Offset, nil)
+		}
+		timeRange := e.timeRangeRx.FindStringSubmatch(timeNode.TextContent())
+		if len(timeRange) < 3 {
+			return diagnose(errBadOutageTime, timeNode.Offset, nil)
+		}
+		start, err := time.ParseInLocation(dateTimeLayout, timeRange[1], e.location)
+		if err != nil {
+			return diagnose(errBadOutageStart, timeNode.Offset, err)
+		}
+		end, err := time.ParseInLocation(dateTimeLayout, timeRange[2], e.location)
+		if err != nil {
+			return diagnose(errBadOutageEnd, timeNode.Offset, err)
+		}
+		affectedCustomers := 0
+		if customers := item.Find(dom.ByClass("outage-customers")); customers != nil {
+			m := e.customersRx.FindString(customers.TextContent())
+			if affectedCustomers, err = strconv.Atoi(m); err != nil {
+				return diagnose(errBadOutageAffected, customers.Offset, err)
+			}
+		}
+		extra := make(map[string]string)
+		if typeNode := item.Find(dom.ByClass("outage-type")); typeNode != nil {
+			kind, err := interruption(typeNode.TextContent())
+			if err != nil {
+				return diagnose(errUnknownInterruption, typeNode.Offset, nil)
+			}
+			extra[outage.ExtraInterruption] = kind
+		}
+		var addresses []string
+		for _, li := range item.FindAll(dom.ByTag("li")) {
+			if addr := address.Normalize(li.TextContent()); addr != "" {
+				addresses = append(addresses, addr)
+			}
+		}
+		if len(addresses) == 0 {
+			return diagnose(errNoAddresses, item.Offset, nil)
+		}
+		titleLat := address.Translit(titleGe)
+		outages = append(outages, outage.Outage{
+			Start:             start,
+			End:               end,
+			AffectedCustomers: affectedCustomers,
+			Location: outage.Location{
+				Id:       titleLat,
+				TitleGe:  titleGe,
+				TitleLat: titleLat,
+			},
+			AddressesGe: addresses,
+			Extra:       extra,
+		})
+	}
+	return outages, nil
+}
@@ -0,0 +1,61 @@
+package electricity
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseEnergoPro(t *testing.T) {
+	rawHTML, err := os.ReadFile("./fixtures/energo_pro.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEnergoPro("http://localhost", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	outages, err := e.parseOutages(ctx, rawHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOutages := []outage.Outage{
+		{
+			Start:             time.Date(2023, 9, 19, 11, 0, 0, 0, e.location),
+			End:               time.Date(2023, 9, 19, 16, 0, 0, 0, e.location),
+			AffectedCustomers: 1204,
+			Location: outage.Location{
+				Id:       "batumis",
+				TitleGe:  "ბათუმის",
+				TitleLat: "batumis",
+			},
+			AddressesGe: []string{
+				"ბათუმი, ჭავჭავაძის ქ.",
+				"ბათუმი, გორგილაძის ქ. N 45",
+			},
+			Extra: map[string]string{
+				outage.ExtraInterruption: outage.InterruptionPlanned,
+			},
+		},
+		{
+			Start: time.Date(2023, 9, 18, 9, 15, 0, 0, e.location),
+			End:   time.Date(2023, 9, 18, 13, 0, 0, 0, e.location),
+			Location: outage.Location{
+				Id:       "kutaisis",
+				TitleGe:  "ქუთაისის",
+				TitleLat: "kutaisis",
+			},
+			AddressesGe: []string{"ქუთაისი, რუსთაველის გამზ."},
+			Extra: map[string]string{
+				outage.ExtraInterruption: outage.InterruptionEmergency,
+			},
+		},
+	}
+	assert.Equal(t, wantOutages, outages)
+}
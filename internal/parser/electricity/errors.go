@@ -0,0 +1,19 @@
+package electricity
+
+type errorParser string
+
+func (e errorParser) Error() string {
+	return string(e)
+}
+func (e errorParser) Parser() {}
+
+const (
+	errNoOutages           errorParser = "outage listing not found"
+	errNoRegion            errorParser = "outage region not found"
+	errBadOutageStart      errorParser = "malformed outage start"
+	errBadOutageEnd        errorParser = "malformed outage end"
+	errBadOutageTime       errorParser = "malformed outage time range"
+	errBadOutageAffected   errorParser = "malformed affected customers"
+	errUnknownInterruption errorParser = "unknown interruption type"
+	errNoAddresses         errorParser = "no addresses"
+)
@@ -0,0 +1,146 @@
+package electricity
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+)
+
+// Telasi scrapes planned and emergency outages of the Tbilisi distribution
+// company from its outage table.
+type Telasi struct {
+	c          *http.Client
+	location   *time.Location
+	outagesURI string
+	sl         *slog.Logger
+}
+
+func NewTelasi(baseURI string, sl *slog.Logger) (Telasi, error) {
+	const outagesPath = "/ka/power/outages"
+	tbilisi, err := time.LoadLocation("Asia/Tbilisi")
+	if err != nil {
+		return Telasi{}, fmt.Errorf("load location: %w", err)
+	}
+	c := http.Client{
+		Timeout: time.Second * 10,
+	}
+	return Telasi{
+		&c,
+		tbilisi,
+		baseURI + outagesPath,
+		sl,
+	}, nil
+}
+
+// WithTransport makes Telasi fetch its outages page through rt.
+func (t Telasi) WithTransport(rt http.RoundTripper) Telasi {
+	c := *t.c
+	c.Transport = rt
+	t.c = &c
+	return t
+}
+
+func (t Telasi) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get telasi outages: %w", err)
+	}
+	rawHTML, err := parser.FetchRawHTMLFile(ctx, t.c, t.outagesURI)
+	if err != nil {
+		return handleErr(err)
+	}
+	outages, err := t.parseOutages(ctx, rawHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, nil
+}
+
+func (t Telasi) parseOutages(ctx context.Context, rawHTML []byte) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("parse telasi outages: %w", err)
+	}
+	diagnose := func(rule errorParser, offset int, cause error) ([]outage.Outage, error) {
+		return handleErr(parser.NewDiagnostic(rule, rawHTML, offset, cause))
+	}
+	root, err := dom.Parse(rawHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	table := root.Find(dom.ByClass("outages"))
+	if table == nil {
+		return diagnose(errNoOutages, 0, nil)
+	}
+	var outages []outage.Outage
+	for _, row := range table.FindAll(dom.ByClass("outage-row")) {
+		cell := func(class string) *dom.Node {
+			return row.Find(dom.ByClass(class))
+		}
+		regionNode := cell("region")
+		if regionNode == nil || regionNode.TextContent() == "" {
+			return diagnose(errNoRegion, row.Offset, nil)
+		}
+		region := regionNode.TextContent()
+		startNode := cell("start")
+		if startNode == nil {
+			return diagnose(errBadOutageStart, row.Offset, nil)
+		}
+		start, err := time.ParseInLocation(dateTimeLayout, startNode.TextContent(), t.location)
+		if err != nil {
+			return diagnose(errBadOutageStart, startNode.Offset, err)
+		}
+		endNode := cell("end")
+		if endNode == nil {
+			return diagnose(errBadOutageEnd, row.Offset, nil)
+		}
+		end, err := time.ParseInLocation(dateTimeLayout, endNode.TextContent(), t.location)
+		if err != nil {
+			return diagnose(errBadOutageEnd, endNode.Offset, err)
+		}
+		affectedCustomers := 0
+		if customers := cell("customers"); customers != nil && customers.TextContent() != "" {
+			if affectedCustomers, err = strconv.Atoi(customers.TextContent()); err != nil {
+				return diagnose(errBadOutageAffected, customers.Offset, err)
+			}
+		}
+		typeNode := cell("type")
+		if typeNode == nil {
+			return diagnose(errUnknownInterruption, row.Offset, nil)
+		}
+		kind, err := interruption(typeNode.TextContent())
+		if err != nil {
+			return diagnose(errUnknownInterruption, typeNode.Offset, nil)
+		}
+		streets := cell("streets")
+		if streets == nil {
+			return diagnose(errNoAddresses, row.Offset, nil)
+		}
+		addresses := address.Split(streets.TextContent(), ";")
+		if len(addresses) == 0 {
+			return diagnose(errNoAddresses, streets.Offset, nil)
+		}
+		titleLat := address.Translit(region)
+		outages = append(outages, outage.Outage{
+			Start:             start,
+			End:               end,
+			AffectedCustomers: affectedCustomers,
+			Location: outage.Location{
+				Id:       titleLat,
+				TitleGe:  region,
+				TitleLat: titleLat,
+			},
+			AddressesGe: addresses,
+			Extra: map[string]string{
+				outage.ExtraInterruption: kind,
+			},
+		})
+	}
+	return outages, nil
+}
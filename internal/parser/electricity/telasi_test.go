@@ -0,0 +1,110 @@
+package electricity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTelasi(t *testing.T) {
+	rawHTML, err := os.ReadFile("./fixtures/telasi.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	te, err := NewTelasi("http://localhost", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	outages, err := te.parseOutages(ctx, rawHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOutages := []outage.Outage{
+		{
+			Start:             time.Date(2023, 9, 18, 10, 0, 0, 0, te.location),
+			End:               time.Date(2023, 9, 18, 17, 0, 0, 0, te.location),
+			AffectedCustomers: 312,
+			Location: outage.Location{
+				Id:       "saburtalo",
+				TitleGe:  "საბურთალო",
+				TitleLat: "saburtalo",
+			},
+			AddressesGe: []string{
+				"ვაჟა-ფშაველას გამზ. N 12",
+				"ნუცუბიძის ქ. N 3 & 4",
+				"პეკინის გამზ. N 41",
+			},
+			Extra: map[string]string{
+				outage.ExtraInterruption: outage.InterruptionPlanned,
+			},
+		},
+		{
+			Start: time.Date(2023, 9, 17, 22, 40, 0, 0, te.location),
+			End:   time.Date(2023, 9, 18, 2, 0, 0, 0, te.location),
+			Location: outage.Location{
+				Id:       "vak'e",
+				TitleGe:  "ვაკე",
+				TitleLat: "vak'e",
+			},
+			AddressesGe: []string{"ჭავჭავაძის გამზ. N 37"},
+			Extra: map[string]string{
+				outage.ExtraInterruption: outage.InterruptionEmergency,
+			},
+		},
+	}
+	assert.Equal(t, wantOutages, outages)
+}
+
+func Test_ParseTelasiDiagnostic(t *testing.T) {
+	rawHTML, err := os.ReadFile("./fixtures/telasi.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	te, err := NewTelasi("http://localhost", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	broken := bytes.Replace(rawHTML, []byte("18.09.2023 17:00"), []byte("18.09.2023 17h00"), 1)
+	_, err = te.parseOutages(ctx, broken)
+	var diag parser.Diagnostic
+	if !errors.As(err, &diag) {
+		t.Fatalf("want diagnostic, got %v", err)
+	}
+	assert.ErrorIs(t, err, errBadOutageEnd)
+	assert.Contains(t, diag.Snippet, "17h00")
+}
+
+func Test_ParseTelasiMissingCells(t *testing.T) {
+	rawHTML, err := os.ReadFile("./fixtures/telasi.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	te, err := NewTelasi("http://localhost", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	withoutCustomers := bytes.Replace(rawHTML, []byte(`<td class="customers">312</td>`), nil, 1)
+	outages, err := te.parseOutages(ctx, withoutCustomers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, outages[0].AffectedCustomers)
+	withoutRegion := bytes.Replace(rawHTML, []byte(`<td class="region">ვაკე</td>`), nil, 1)
+	_, err = te.parseOutages(ctx, withoutRegion)
+	var diag parser.Diagnostic
+	if !errors.As(err, &diag) {
+		t.Fatalf("want diagnostic, got %v", err)
+	}
+	assert.ErrorIs(t, err, errNoRegion)
+}
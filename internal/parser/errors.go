@@ -1,5 +1,12 @@
 package parser
 
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+)
+
 type errorParser string
 
 func (e errorParser) Error() string {
@@ -8,10 +15,87 @@ func (e errorParser) Error() string {
 func (e errorParser) Parser() {}
 
 const (
-	errMapNotFound      errorParser = "map not found"
-	errNoRespBody       errorParser = "response body not found"
-	errNoOutageStart    errorParser = "outage start not found"
-	errNoOutageEnd      errorParser = "outage end not found"
-	errNoOutageAffected errorParser = "outage no affected customers"
-	errNoAddresses      errorParser = "no addresses"
+	errMapNotFound        errorParser = "map not found"
+	errBadMapMarkers      errorParser = "malformed map markers"
+	errNoRespBody         errorParser = "response body not found"
+	errNoOutageStart      errorParser = "outage start not found"
+	errBadOutageStart     errorParser = "malformed outage start"
+	errNoOutageEnd        errorParser = "outage end not found"
+	errBadOutageEnd       errorParser = "malformed outage end"
+	errNoOutageAffected   errorParser = "outage no affected customers"
+	errBadOutageAffected  errorParser = "malformed affected customers"
+	errNoAddresses        errorParser = "no addresses"
+	errNoAnnouncementLink errorParser = "malformed announcement link"
+	errNoAnnouncementBody errorParser = "announcement body not found"
+	errNoServiceCenter    errorParser = "announcement service center not found"
+	errNoAnnouncementDate errorParser = "announcement date not found"
+	errNoAnnouncementYear errorParser = "announcement year not found"
+	errNoAnnouncementTime errorParser = "announcement time range not found"
 )
+
+const diagnosticSnippetBytes = 120
+
+// Diagnostic pinpoints where in a fetched document a parsing rule failed.
+// It replaces dumping the whole document into the error and can be
+// extracted from any wrapped parser error with errors.As.
+type Diagnostic struct {
+	Rule    string `json:"rule"`
+	Offset  int    `json:"offset"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Snippet string `json:"snippet"`
+	rule    error
+	cause   error
+}
+
+func NewDiagnostic(rule error, doc []byte, offset int, cause error) Diagnostic {
+	offset = max(0, min(offset, len(doc)))
+	line := bytes.Count(doc[:offset], []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(doc[:offset], '\n') + 1
+	column := utf8.RuneCount(doc[lineStart:offset]) + 1
+	return Diagnostic{
+		Rule:    rule.Error(),
+		Offset:  offset,
+		Line:    line,
+		Column:  column,
+		Snippet: snippet(doc, offset, diagnosticSnippetBytes),
+		rule:    rule,
+		cause:   cause,
+	}
+}
+
+func (d Diagnostic) Error() string {
+	msg := fmt.Sprintf("%s at %d:%d (offset %d) near %q", d.Rule, d.Line, d.Column, d.Offset, d.Snippet)
+	if d.cause != nil {
+		msg += ": " + d.cause.Error()
+	}
+	return msg
+}
+
+func (d Diagnostic) Unwrap() []error {
+	if d.cause == nil {
+		return []error{d.rule}
+	}
+	return []error{d.rule, d.cause}
+}
+
+func (d Diagnostic) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("rule", d.Rule),
+		slog.Int("offset", d.Offset),
+		slog.Int("line", d.Line),
+		slog.Int("column", d.Column),
+		slog.String("snippet", d.Snippet),
+	)
+}
+
+func snippet(doc []byte, offset, size int) string {
+	from, to := max(0, offset-size/2), min(len(doc), offset+size/2)
+	for from > 0 && !utf8.RuneStart(doc[from]) {
+		from--
+	}
+	for to < len(doc) && !utf8.RuneStart(doc[to]) {
+		to++
+	}
+	return string(bytes.Join(bytes.Fields(doc[from:to]), []byte(" ")))
+}
@@ -0,0 +1,17 @@
+package gas
+
+type errorParser string
+
+func (e errorParser) Error() string {
+	return string(e)
+}
+func (e errorParser) Parser() {}
+
+const (
+	errNoNotices           errorParser = "notice listing not found"
+	errNoNoticeBody        errorParser = "notice body not found"
+	errNoNoticeTime        errorParser = "notice time range not found"
+	errNoDistrict          errorParser = "notice district not found"
+	errUnknownInterruption errorParser = "unknown interruption type"
+	errNoAddresses         errorParser = "no addresses"
+)
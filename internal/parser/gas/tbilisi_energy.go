@@ -0,0 +1,172 @@
+package gas
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser"
+)
+
+// TbilisiEnergy scrapes the gas supply interruption notices published by
+// the Tbilisi gas distributor.
+type TbilisiEnergy struct {
+	c              *http.Client
+	dateTimeLayout string
+	gasSupplyRx    *regexp.Regexp
+	timeRangeRx    *regexp.Regexp
+	districtRx     *regexp.Regexp
+	location       *time.Location
+	noticesURI     string
+	sl             *slog.Logger
+}
+
+func NewTbilisiEnergy(baseURI string, sl *slog.Logger) (TbilisiEnergy, error) {
+	const (
+		noticesPath    = "/ka/notices"
+		dateTimeLayout = "02.01.2006 15:04"
+	)
+	tbilisi, err := time.LoadLocation("Asia/Tbilisi")
+	if err != nil {
+		return TbilisiEnergy{}, fmt.Errorf("load location: %w", err)
+	}
+	var (
+		gasSupplyRx = regexp.MustCompile(`ბუნებრივი\s+აირის\s+მიწოდებ`)
+		timeRangeRx = regexp.MustCompile(`(\d{2}\.\d{2}\.\d{4})\s+(\d{1,2}:\d{2})\s+საათიდან\s+(\d{1,2}:\d{2})\s+საათამდე`)
+		districtRx  = regexp.MustCompile(`(\p{Georgian}+)\s+რაიონ`)
+	)
+	c := http.Client{
+		Timeout: time.Second * 10,
+	}
+	return TbilisiEnergy{
+		&c,
+		dateTimeLayout,
+		gasSupplyRx,
+		timeRangeRx,
+		districtRx,
+		tbilisi,
+		baseURI + noticesPath,
+		sl,
+	}, nil
+}
+
+// WithTransport makes TbilisiEnergy fetch its notices through rt.
+func (t TbilisiEnergy) WithTransport(rt http.RoundTripper) TbilisiEnergy {
+	c := *t.c
+	c.Transport = rt
+	t.c = &c
+	return t
+}
+
+func (t TbilisiEnergy) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get tbilisi energy outages: %w", err)
+	}
+	rawHTML, err := parser.FetchRawHTMLFile(ctx, t.c, t.noticesURI)
+	if err != nil {
+		return handleErr(err)
+	}
+	outages, err := t.parseNotices(ctx, rawHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, nil
+}
+
+func (t TbilisiEnergy) parseNotices(ctx context.Context, rawHTML []byte) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("parse tbilisi energy notices: %w", err)
+	}
+	diagnose := func(rule errorParser, offset int, cause error) ([]outage.Outage, error) {
+		return handleErr(parser.NewDiagnostic(rule, rawHTML, offset, cause))
+	}
+	root, err := dom.Parse(rawHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	notices := root.Find(dom.ByClass("notices"))
+	if notices == nil {
+		return diagnose(errNoNotices, 0, nil)
+	}
+	var outages []outage.Outage
+	for _, notice := range notices.FindAll(dom.ByClass("notice")) {
+		title := ""
+		if titleNode := notice.Find(dom.ByClass("notice-title")); titleNode != nil {
+			title = titleNode.TextContent()
+		}
+		if !t.gasSupplyRx.MatchString(title) {
+			continue
+		}
+		body := notice.Find(dom.ByClass("notice-body"))
+		if body == nil {
+			return diagnose(errNoNoticeBody, notice.Offset, nil)
+		}
+		text := body.TextContent()
+		kind, err := classify(title + " " + text)
+		if err != nil {
+			return diagnose(errUnknownInterruption, notice.Offset, nil)
+		}
+		timeRange := t.timeRangeRx.FindStringSubmatch(text)
+		if len(timeRange) < 4 {
+			return diagnose(errNoNoticeTime, body.Offset, nil)
+		}
+		start, err := time.ParseInLocation(t.dateTimeLayout, timeRange[1]+" "+timeRange[2], t.location)
+		if err != nil {
+			return diagnose(errNoNoticeTime, body.TextOffset(timeRange[1]), err)
+		}
+		end, err := time.ParseInLocation(t.dateTimeLayout, timeRange[1]+" "+timeRange[3], t.location)
+		if err != nil {
+			return diagnose(errNoNoticeTime, body.TextOffset(timeRange[3]), err)
+		}
+		if !end.After(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		district := t.districtRx.FindStringSubmatch(text)
+		if len(district) < 2 {
+			return diagnose(errNoDistrict, body.Offset, nil)
+		}
+		var addresses []string
+		for _, li := range body.FindAll(dom.ByTag("li")) {
+			if addr := address.Normalize(li.TextContent()); addr != "" {
+				addresses = append(addresses, addr)
+			}
+		}
+		if len(addresses) == 0 {
+			return diagnose(errNoAddresses, body.Offset, nil)
+		}
+		titleLat := address.Translit(district[1])
+		outages = append(outages, outage.Outage{
+			Start: start,
+			End:   end,
+			Location: outage.Location{
+				Id:       titleLat,
+				TitleGe:  district[1],
+				TitleLat: titleLat,
+			},
+			AddressesGe: addresses,
+			Extra: map[string]string{
+				outage.ExtraInterruption: kind,
+			},
+		})
+	}
+	return outages, nil
+}
+
+// classify tells planned works from emergencies by the wording of a notice.
+func classify(text string) (string, error) {
+	switch {
+	case strings.Contains(text, "ავარი") || strings.Contains(text, "დაზიანებ"):
+		return outage.InterruptionEmergency, nil
+	case strings.Contains(text, "გეგმიურ"):
+		return outage.InterruptionPlanned, nil
+	default:
+		return "", errUnknownInterruption
+	}
+}
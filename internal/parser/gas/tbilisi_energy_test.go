@@ -0,0 +1,63 @@
+package gas
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTbilisiEnergy(t *testing.T) {
+	rawHTML, err := os.ReadFile("./fixtures/tbilisi_energy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	te, err := NewTbilisiEnergy("http://localhost", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	outages, err := te.parseNotices(ctx, rawHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOutages := []outage.Outage{
+		{
+			Start: time.Date(2023, 9, 20, 10, 0, 0, 0, te.location),
+			End:   time.Date(2023, 9, 20, 18, 0, 0, 0, te.location),
+			Location: outage.Location{
+				Id:       "didubis",
+				TitleGe:  "დიდუბის",
+				TitleLat: "didubis",
+			},
+			AddressesGe: []string{
+				"წერეთლის გამზ. N 116",
+				"აღმაშენებლის ხეივანი N 5",
+			},
+			Extra: map[string]string{
+				outage.ExtraInterruption: outage.InterruptionPlanned,
+			},
+		},
+		{
+			Start: time.Date(2023, 9, 12, 21, 30, 0, 0, te.location),
+			End:   time.Date(2023, 9, 13, 2, 0, 0, 0, te.location),
+			Location: outage.Location{
+				Id:       "gldanis",
+				TitleGe:  "გლდანის",
+				TitleLat: "gldanis",
+			},
+			AddressesGe: []string{
+				"ხიზანიშვილის ქ. N 1",
+				"გლდანის მე-3 მ/რ, კორპ. N 12",
+			},
+			Extra: map[string]string{
+				outage.ExtraInterruption: outage.InterruptionEmergency,
+			},
+		},
+	}
+	assert.Equal(t, wantOutages, outages)
+}
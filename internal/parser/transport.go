@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// refreshCacheSize bounds how many pages a RefreshTransport keeps.
+const refreshCacheSize = 256
+
+// RefreshTransport is the transport of the providers' HTTP clients. It
+// keeps the last page fetched from every address along with its ETag or
+// Last-Modified, and asks the site whether the page changed instead of
+// fetching it again; a page that did not is served from the cache. Pages
+// fetched and pages served from the cache are counted in the journal of
+// the refresh running in the request's context.
+type RefreshTransport struct {
+	base  http.RoundTripper
+	mu    *sync.Mutex
+	pages map[string]cachedPage
+}
+
+type cachedPage struct {
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+func NewRefreshTransport(base http.RoundTripper) RefreshTransport {
+	return RefreshTransport{base, &sync.Mutex{}, make(map[string]cachedPage)}
+}
+
+func (t RefreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if req.Method != http.MethodGet {
+		outage.CountPage(ctx)
+		return t.base.RoundTrip(req)
+	}
+	addr := req.URL.String()
+	t.mu.Lock()
+	cached, found := t.pages[addr]
+	t.mu.Unlock()
+	if found {
+		// A RoundTripper must leave the request it is given as it is.
+		req = req.Clone(req.Context())
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if found && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		outage.CountCacheHit(ctx)
+		return cached.response(req), nil
+	}
+	outage.CountPage(ctx)
+	page := cachedPage{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode != http.StatusOK || (page.etag == "" && page.lastModified == "") {
+		return resp, nil
+	}
+	page.body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	page.header = resp.Header.Clone()
+	t.store(addr, page)
+	resp.Body = io.NopCloser(bytes.NewReader(page.body))
+	return resp, nil
+}
+
+// store drops an arbitrary page to make room once the cache is full.
+func (t RefreshTransport) store(addr string, page cachedPage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, found := t.pages[addr]; !found && len(t.pages) >= refreshCacheSize {
+		for dropped := range t.pages {
+			delete(t.pages, dropped)
+			break
+		}
+	}
+	t.pages[addr] = page
+}
+
+func (p cachedPage) response(req *http.Request) *http.Response {
+	header := p.header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(p.body)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(p.body)),
+		ContentLength: int64(len(p.body)),
+		Request:       req,
+	}
+}
@@ -3,8 +3,8 @@ package parser
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
 	"io"
 	"log/slog"
 	"net/http"
@@ -13,21 +13,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
 	"github.com/doesnotcommit/outage_monitor/internal/outage"
 )
 
 type WaterGovGe struct {
-	c                         *http.Client
-	outageDateTimeLayout      string
-	mapMarkersRx              *regexp.Regexp
-	outageStartLabelRx        *regexp.Regexp
-	outageEndLabelRx          *regexp.Regexp
-	outageAffectedCustomersRx *regexp.Regexp
-	outageAddressesRx         *regexp.Regexp
-	location                  *time.Location
-	mapURI                    string
-	problemURITpl             string
-	sl                        *slog.Logger
+	c                    *http.Client
+	outageDateTimeLayout string
+	mapMarkersRx         *regexp.Regexp
+	location             *time.Location
+	mapURI               string
+	problemURITpl        string
+	sl                   *slog.Logger
 }
 
 type waterGovGePoint struct {
@@ -48,13 +46,7 @@ func NewWaterGovGe(sl *slog.Logger) (WaterGovGe, error) {
 	if err != nil {
 		return WaterGovGe{}, fmt.Errorf("load location: %w", err)
 	}
-	var (
-		mapMarkersRx              = regexp.MustCompile(`var markers = (\[.+\]);`)
-		outageStartLabelRx        = regexp.MustCompile(`<div>\s+წყალმომარაგების\s+შეწყვეტის\s+დრო:\s+([\d/\s:]+)\s+</div>`)
-		outageEndLabelRx          = regexp.MustCompile(`<div>\s+წყალმომარაგების\s+აღდგენის\s+დრო:\s+([\d/\s:]+)\s+</div>`)
-		outageAffectedCustomersRx = regexp.MustCompile(`<div>\sგამორთული\sაბონენტების\sრაოდენობა:\s(\d+)\s</div>`)
-		outageAddressesRx         = regexp.MustCompile(`<div>\s*([^<>]+)\s*</div>`)
-	)
+	mapMarkersRx := regexp.MustCompile(`var markers = (\[.+\]);`)
 	c := http.Client{
 		Timeout: time.Second * 10,
 	}
@@ -62,10 +54,6 @@ func NewWaterGovGe(sl *slog.Logger) (WaterGovGe, error) {
 		&c,
 		outageDateTimeLayout,
 		mapMarkersRx,
-		outageStartLabelRx,
-		outageEndLabelRx,
-		outageAffectedCustomersRx,
-		outageAddressesRx,
 		tbilisi,
 		mapURI,
 		problemURITpl,
@@ -73,9 +61,26 @@ func NewWaterGovGe(sl *slog.Logger) (WaterGovGe, error) {
 	}, nil
 }
 
-func (w WaterGovGe) GetOutages(ctx context.Context) ([]outage.WaterGovGe, error) {
-	handleErr := func(err error) ([]outage.WaterGovGe, error) {
-		return nil, fmt.Errorf("get outages: %w", err)
+// WithTransport makes the parser fetch the map and problem pages through
+// rt.
+func (w WaterGovGe) WithTransport(rt http.RoundTripper) WaterGovGe {
+	c := *w.c
+	c.Transport = rt
+	w.c = &c
+	return w
+}
+
+func (w WaterGovGe) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	outages, _, err := w.GetOutagesAndCenters(ctx)
+	return outages, err
+}
+
+// GetOutagesAndCenters reads the catalog and the outages off one fetch of
+// the map page. The centers are returned even when a problem page fails,
+// since the map itself was read.
+func (w WaterGovGe) GetOutagesAndCenters(ctx context.Context) ([]outage.Outage, []outage.Center, error) {
+	handleErr := func(err error) ([]outage.Outage, []outage.Center, error) {
+		return nil, nil, fmt.Errorf("get outages and centers: %w", err)
 	}
 	rawMapHTML, err := w.fetchRawHTMLFile(ctx, w.mapURI)
 	if err != nil {
@@ -85,18 +90,39 @@ func (w WaterGovGe) GetOutages(ctx context.Context) ([]outage.WaterGovGe, error)
 	if err != nil {
 		return handleErr(err)
 	}
+	centers := make([]outage.Center, len(points))
+	for i, point := range points {
+		centers[i] = outage.Center{
+			Location: w.pointLocation(point),
+			Problem:  point.Problem,
+		}
+	}
 	problems, err := w.parseProblems(ctx, points)
 	if err != nil {
-		return handleErr(err)
+		return nil, centers, fmt.Errorf("get outages and centers: %w", err)
+	}
+	return problems, centers, nil
+}
+
+func (w WaterGovGe) pointLocation(point waterGovGePoint) outage.Location {
+	shortTitleGe := address.TrimServiceCenter(point.Title)
+	if shortTitleGe == strings.TrimSpace(point.Title) {
+		w.sl.Warn("no suffix found", slog.String("title", point.Title))
+	}
+	return outage.Location{
+		Id:       strings.TrimSpace(point.Id),
+		TitleGe:  shortTitleGe,
+		TitleLat: address.Translit(shortTitleGe),
+		Lat:      strings.TrimSpace(point.Lat),
+		Lng:      strings.TrimSpace(point.Lng),
 	}
-	return problems, nil
 }
 
-func (w WaterGovGe) parseProblems(ctx context.Context, points []waterGovGePoint) ([]outage.WaterGovGe, error) {
-	handleErr := func(err error) ([]outage.WaterGovGe, error) {
+func (w WaterGovGe) parseProblems(ctx context.Context, points []waterGovGePoint) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
 		return nil, fmt.Errorf("parse problems: %w", err)
 	}
-	var problems []outage.WaterGovGe
+	var problems []outage.Outage
 	for _, point := range points {
 		if !point.Problem {
 			continue
@@ -105,95 +131,114 @@ func (w WaterGovGe) parseProblems(ctx context.Context, points []waterGovGePoint)
 		if err != nil {
 			return handleErr(err)
 		}
-		shortTitleGe, foundSfx := strings.CutSuffix(strings.TrimSpace(point.Title), " სერვის ცენტრი")
-		if !foundSfx {
-			w.sl.Warn("no suffix found")
-		}
-		location := outage.Location{
-			Id:       strings.TrimSpace(point.Id),
-			TitleGe:  shortTitleGe,
-			TitleLat: translit(shortTitleGe),
-			Lat:      strings.TrimSpace(point.Lat),
-			Lng:      strings.TrimSpace(point.Lng),
-		}
+		location := w.pointLocation(point)
 		problem, err := w.parseProblem(ctx, location, rawProblemHTML)
 		if err != nil {
+			var diag Diagnostic
+			if errors.As(err, &diag) {
+				w.sl.Warn("problem page did not parse", slog.String("location", location.Id), slog.Any("diagnostic", diag))
+			}
 			return handleErr(err)
 		}
+		problem.Status = outage.StatusActive
 		problems = append(problems, problem)
 	}
 	return problems, nil
 }
 
-func (w WaterGovGe) parseProblem(ctx context.Context, location outage.Location, rawProblemHTML []byte) (outage.WaterGovGe, error) {
-	handleErr := func(err error) (outage.WaterGovGe, error) {
-		return outage.WaterGovGe{}, fmt.Errorf("parse problem [%s]: %w", string(rawProblemHTML), err)
+// ParseProblemHTML parses a problem page on its own, taking the location
+// from the modal title.
+func (w WaterGovGe) ParseProblemHTML(ctx context.Context, rawProblemHTML []byte) (outage.Outage, error) {
+	root, err := dom.Parse(rawProblemHTML)
+	if err != nil {
+		return outage.Outage{}, fmt.Errorf("parse problem: %w", err)
 	}
-	rawOutageStartBytes := w.outageStartLabelRx.FindSubmatch(rawProblemHTML)
-	if len(rawOutageStartBytes) < 2 {
-		return handleErr(errNoOutageStart)
+	modal := extractProblem(root)
+	titleGe := address.TrimServiceCenter(modal.title)
+	location := outage.Location{TitleGe: titleGe, TitleLat: address.Translit(titleGe)}
+	return w.problemOutage(location, modal, rawProblemHTML)
+}
+
+func (w WaterGovGe) parseProblem(ctx context.Context, location outage.Location, rawProblemHTML []byte) (outage.Outage, error) {
+	root, err := dom.Parse(rawProblemHTML)
+	if err != nil {
+		return outage.Outage{}, fmt.Errorf("parse problem %s: %w", location.Id, err)
 	}
-	rawOutageStart := strings.TrimSpace(string(rawOutageStartBytes[1]))
-	rawOutageEndBytes := w.outageEndLabelRx.FindSubmatch(rawProblemHTML)
-	if len(rawOutageStartBytes) < 2 {
-		return handleErr(errNoOutageEnd)
+	return w.problemOutage(location, extractProblem(root), rawProblemHTML)
+}
+
+// problemOutage reads the outage off the first incident of the modal;
+// rawProblemHTML is kept for the diagnostics.
+func (w WaterGovGe) problemOutage(location outage.Location, modal problemModal, rawProblemHTML []byte) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("parse problem %s: %w", location.Id, err)
 	}
-	rawOutageEnd := strings.TrimSpace(string(rawOutageEndBytes[1]))
-	outageStart, err := time.ParseInLocation(w.outageDateTimeLayout, rawOutageStart, w.location)
-	if err != nil {
-		return handleErr(err)
+	diagnose := func(rule errorParser, offset int, cause error) (outage.Outage, error) {
+		return handleErr(NewDiagnostic(rule, rawProblemHTML, offset, cause))
+	}
+	if len(modal.incidents) == 0 {
+		return diagnose(errNoOutageStart, modal.offset, nil)
+	}
+	incident := modal.incidents[0]
+	if !incident.start.found {
+		return diagnose(errNoOutageStart, incident.offset, nil)
 	}
-	outageEnd, err := time.ParseInLocation(w.outageDateTimeLayout, rawOutageEnd, w.location)
+	outageStart, err := time.ParseInLocation(w.outageDateTimeLayout, incident.start.value, w.location)
 	if err != nil {
-		return handleErr(err)
+		return diagnose(errBadOutageStart, incident.start.offset, err)
 	}
-	rawOutageAffectedCustomersBytes := w.outageAffectedCustomersRx.FindSubmatch(rawProblemHTML)
-	if len(rawOutageStartBytes) < 2 {
-		return handleErr(errNoOutageStart)
+	if !incident.end.found {
+		return diagnose(errNoOutageEnd, incident.start.offset, nil)
 	}
-	outageAffectedCustomersStr := strings.TrimSpace(string(rawOutageAffectedCustomersBytes[1]))
-	outageAffectedCustomers, err := strconv.Atoi(outageAffectedCustomersStr)
+	outageEnd, err := time.ParseInLocation(w.outageDateTimeLayout, incident.end.value, w.location)
 	if err != nil {
-		return handleErr(err)
+		return diagnose(errBadOutageEnd, incident.end.offset, err)
 	}
-	rawAddressesBytes := w.outageAddressesRx.FindAllSubmatch(rawProblemHTML, -1)
-	if len(rawAddressesBytes) < 4 {
-		return handleErr(errNoAddresses)
+	if !incident.affectedCustomers.found {
+		return diagnose(errNoOutageAffected, incident.end.offset, nil)
 	}
-	rawAddressesBytes = rawAddressesBytes[3:]
-	var addresses []string
-	for _, rawAddr := range rawAddressesBytes {
-		if len(rawAddr) < 2 {
-			continue
-		}
-		addr := strings.TrimSpace(html.UnescapeString(string(rawAddr[1])))
-		addresses = append(addresses, addr)
+	outageAffectedCustomers, err := strconv.Atoi(incident.affectedCustomers.value)
+	if err != nil {
+		return diagnose(errBadOutageAffected, incident.affectedCustomers.offset, err)
 	}
-	return outage.WaterGovGe{
+	if !incident.addressesFound || len(incident.addresses) == 0 {
+		return diagnose(errNoAddresses, incident.affectedCustomers.offset, nil)
+	}
+	return outage.Outage{
 		Start:             outageStart,
 		End:               outageEnd,
 		AffectedCustomers: outageAffectedCustomers,
-		AddressesGe:       addresses,
+		AddressesGe:       incident.addresses,
 		Location:          location,
 	}, nil
 }
 
 func (w WaterGovGe) parseMapMarkers(ctx context.Context, htmlFile []byte) ([]waterGovGePoint, error) {
 	handleErr := func(err error) ([]waterGovGePoint, error) {
-		return nil, fmt.Errorf("parse map markers [%s]: %w", string(htmlFile), err)
+		return nil, fmt.Errorf("parse map markers: %w", err)
 	}
-	submatch := w.mapMarkersRx.FindSubmatch(htmlFile)
-	if len(submatch) < 2 {
-		return handleErr(errMapNotFound)
+	submatchIdx := w.mapMarkersRx.FindSubmatchIndex(htmlFile)
+	if len(submatchIdx) < 4 {
+		return handleErr(NewDiagnostic(errMapNotFound, htmlFile, 0, nil))
 	}
+	rawMarkers := htmlFile[submatchIdx[2]:submatchIdx[3]]
 	var points []waterGovGePoint
-	if err := json.Unmarshal(submatch[1], &points); err != nil {
-		return handleErr(err)
+	if err := json.Unmarshal(rawMarkers, &points); err != nil {
+		offset := submatchIdx[2]
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			offset += int(syntaxErr.Offset)
+		}
+		return handleErr(NewDiagnostic(errBadMapMarkers, htmlFile, offset, err))
 	}
 	return points, nil
 }
 
 func (w WaterGovGe) fetchRawHTMLFile(ctx context.Context, addr string) ([]byte, error) {
+	return FetchRawHTMLFile(ctx, w.c, addr)
+}
+
+func FetchRawHTMLFile(ctx context.Context, c *http.Client, addr string) ([]byte, error) {
 	handleErr := func(err error) ([]byte, error) {
 		return nil, fmt.Errorf("fetch html file at %s: %w", addr, err)
 	}
@@ -201,7 +246,7 @@ func (w WaterGovGe) fetchRawHTMLFile(ctx context.Context, addr string) ([]byte,
 	if err != nil {
 		return handleErr(err)
 	}
-	resp, err := w.c.Do(req)
+	resp, err := c.Do(req)
 	if err != nil {
 		return handleErr(err)
 	}
@@ -215,28 +260,3 @@ func (w WaterGovGe) fetchRawHTMLFile(ctx context.Context, addr string) ([]byte,
 	}
 	return rawBody, nil
 }
-
-func translit(ge string) string {
-	table := map[rune]string{
-		'ა': "a", 'ბ': "b", 'გ': "g",
-		'დ': "d", 'ე': "e", 'ვ': "v",
-		'ზ': "z", 'თ': "t", 'ი': "i",
-		'კ': "k'", 'ლ': "l", 'მ': "m",
-		'ნ': "n", 'ო': "o", 'პ': "p'",
-		'ჟ': "zh", 'რ': "r", 'ს': "s",
-		'ტ': "t'", 'უ': "u", 'ფ': "p",
-		'ქ': "k", 'ღ': "gh", 'ყ': "q",
-		'შ': "sh", 'ჩ': "ch", 'ც': "ts",
-		'ძ': "dz", 'წ': "ts'", 'ჭ': "ch'",
-		'ხ': "kh", 'ჯ': "j", 'ჰ': "h",
-	}
-	result := make([]rune, 0, len(ge))
-	for _, r := range ge {
-		tr, ok := table[r]
-		if !ok {
-			tr = " "
-		}
-		result = append(result, []rune(tr)...)
-	}
-	return string(result)
-}
@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+type WaterGovGeNews struct {
+	c               *http.Client
+	newsDateLayout  string
+	announcementRx  *regexp.Regexp
+	serviceCenterRx *regexp.Regexp
+	dayMonthRx      *regexp.Regexp
+	numericDateRx   *regexp.Regexp
+	yearRx          *regexp.Regexp
+	timeRangeRx     *regexp.Regexp
+	months          map[string]time.Month
+	location        *time.Location
+	newsURI         string
+	sl              *slog.Logger
+}
+
+type waterGovGeNewsItem struct {
+	uri       string
+	title     string
+	published time.Time
+}
+
+func NewWaterGovGeNews(sl *slog.Logger) (WaterGovGeNews, error) {
+	const (
+		newsURI        = "http://water.gov.ge/page/news"
+		newsDateLayout = "02/01/2006"
+	)
+	tbilisi, err := time.LoadLocation("Asia/Tbilisi")
+	if err != nil {
+		return WaterGovGeNews{}, fmt.Errorf("load location: %w", err)
+	}
+	var (
+		announcementRx  = regexp.MustCompile(`წყალმომარაგების\s+(?:დროებითი\s+)?შეწყვეტა`)
+		serviceCenterRx = regexp.MustCompile(`(\p{Georgian}+)\s+სერვის\s+ცენტრ`)
+		dayMonthRx      = regexp.MustCompile(`(\d{1,2})\s+(იანვარ|თებერვალ|მარტ|აპრილ|მაის|ივნის|ივლის|აგვისტო|სექტემბერ|ოქტომბერ|ნოემბერ|დეკემბერ)`)
+		numericDateRx   = regexp.MustCompile(`(\d{1,2})[./](\d{1,2})[./](\d{4})`)
+		yearRx          = regexp.MustCompile(`(\d{4})\s+წლის`)
+		timeRangeRx     = regexp.MustCompile(`(\d{1,2}):(\d{2})\s+საათიდან\s+(\d{1,2}):(\d{2})\s+საათამდე`)
+	)
+	months := map[string]time.Month{
+		"იანვარ": time.January, "თებერვალ": time.February, "მარტ": time.March,
+		"აპრილ": time.April, "მაის": time.May, "ივნის": time.June,
+		"ივლის": time.July, "აგვისტო": time.August, "სექტემბერ": time.September,
+		"ოქტომბერ": time.October, "ნოემბერ": time.November, "დეკემბერ": time.December,
+	}
+	c := http.Client{
+		Timeout: time.Second * 10,
+	}
+	return WaterGovGeNews{
+		&c,
+		newsDateLayout,
+		announcementRx,
+		serviceCenterRx,
+		dayMonthRx,
+		numericDateRx,
+		yearRx,
+		timeRangeRx,
+		months,
+		tbilisi,
+		newsURI,
+		sl,
+	}, nil
+}
+
+// WithTransport makes the parser fetch the news and its articles through
+// rt.
+func (w WaterGovGeNews) WithTransport(rt http.RoundTripper) WaterGovGeNews {
+	c := *w.c
+	c.Transport = rt
+	w.c = &c
+	return w
+}
+
+func (w WaterGovGeNews) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get announced outages: %w", err)
+	}
+	rawNewsHTML, err := FetchRawHTMLFile(ctx, w.c, w.newsURI)
+	if err != nil {
+		return handleErr(err)
+	}
+	items, err := w.parseNewsListing(ctx, rawNewsHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	var announced []outage.Outage
+	for _, item := range items {
+		rawArticleHTML, err := FetchRawHTMLFile(ctx, w.c, item.uri)
+		if err != nil {
+			return handleErr(err)
+		}
+		o, err := w.parseAnnouncement(ctx, item, rawArticleHTML)
+		if err != nil {
+			var diag Diagnostic
+			if errors.As(err, &diag) {
+				w.sl.Warn("announcement did not parse", slog.String("uri", item.uri), slog.Any("diagnostic", diag))
+				continue
+			}
+			return handleErr(err)
+		}
+		announced = append(announced, o)
+	}
+	return announced, nil
+}
+
+func (w WaterGovGeNews) parseNewsListing(ctx context.Context, rawNewsHTML []byte) ([]waterGovGeNewsItem, error) {
+	handleErr := func(err error) ([]waterGovGeNewsItem, error) {
+		return nil, fmt.Errorf("parse news listing: %w", err)
+	}
+	base, err := url.Parse(w.newsURI)
+	if err != nil {
+		return handleErr(err)
+	}
+	root, err := dom.Parse(rawNewsHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	var items []waterGovGeNewsItem
+	for _, n := range root.FindAll(dom.ByClass("news-item")) {
+		title := n.Find(dom.ByClass("news-title"))
+		if title == nil {
+			continue
+		}
+		link := title.Find(dom.ByTag("a"))
+		if link == nil || !w.announcementRx.MatchString(title.TextContent()) {
+			continue
+		}
+		ref, err := url.Parse(link.Attr("href"))
+		if err != nil {
+			return handleErr(NewDiagnostic(errNoAnnouncementLink, rawNewsHTML, link.Offset, err))
+		}
+		item := waterGovGeNewsItem{
+			uri:   base.ResolveReference(ref).String(),
+			title: title.TextContent(),
+		}
+		if date := n.Find(dom.ByClass("news-date")); date != nil {
+			if published, err := time.ParseInLocation(w.newsDateLayout, date.TextContent(), w.location); err == nil {
+				item.published = published
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (w WaterGovGeNews) parseAnnouncement(ctx context.Context, item waterGovGeNewsItem, rawArticleHTML []byte) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("parse announcement %s: %w", item.uri, err)
+	}
+	root, err := dom.Parse(rawArticleHTML)
+	if err != nil {
+		return handleErr(err)
+	}
+	content := root.Find(dom.ByClass("post-content"))
+	if content == nil {
+		return handleErr(NewDiagnostic(errNoAnnouncementBody, rawArticleHTML, 0, nil))
+	}
+	diagnose := func(rule errorParser, offset int, cause error) (outage.Outage, error) {
+		return handleErr(NewDiagnostic(rule, rawArticleHTML, offset, cause))
+	}
+	if item.published.IsZero() {
+		if date := root.Find(dom.ByClass("post-date")); date != nil {
+			if published, err := time.ParseInLocation(w.newsDateLayout, date.TextContent(), w.location); err == nil {
+				item.published = published
+			}
+		}
+	}
+	text := content.TextContent()
+	serviceCenter := w.serviceCenterRx.FindStringSubmatch(text)
+	if len(serviceCenter) < 2 {
+		return diagnose(errNoServiceCenter, content.Offset, nil)
+	}
+	day, err := w.parseAnnouncementDay(text, item.published)
+	if err != nil {
+		return diagnose(errNoAnnouncementDate, content.Offset, err)
+	}
+	timeRange := w.timeRangeRx.FindStringSubmatch(text)
+	if len(timeRange) < 5 {
+		return diagnose(errNoAnnouncementTime, content.Offset, nil)
+	}
+	clock := lo.Map(timeRange[1:], func(s string, _ int) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+	start := day.Add(time.Duration(clock[0])*time.Hour + time.Duration(clock[1])*time.Minute)
+	end := day.Add(time.Duration(clock[2])*time.Hour + time.Duration(clock[3])*time.Minute)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	var addresses []string
+	for _, li := range content.FindAll(dom.ByTag("li")) {
+		if addr := address.Normalize(li.TextContent()); addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+	if len(addresses) == 0 {
+		return diagnose(errNoAddresses, content.Offset, nil)
+	}
+	titleGe := serviceCenter[1]
+	return outage.Outage{
+		Start:       start,
+		End:         end,
+		AddressesGe: lo.Uniq(addresses),
+		Location: outage.Location{
+			TitleGe:  titleGe,
+			TitleLat: address.Translit(titleGe),
+		},
+		Status:          outage.StatusAnnounced,
+		AnnouncementURI: item.uri,
+	}, nil
+}
+
+func (w WaterGovGeNews) parseAnnouncementDay(text string, published time.Time) (time.Time, error) {
+	if m := w.numericDateRx.FindStringSubmatch(text); len(m) == 4 {
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		year, _ := strconv.Atoi(m[3])
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, w.location), nil
+	}
+	m := w.dayMonthRx.FindStringSubmatch(text)
+	if len(m) < 3 {
+		return time.Time{}, errNoAnnouncementDate
+	}
+	day, _ := strconv.Atoi(m[1])
+	month := w.months[m[2]]
+	if y := w.yearRx.FindStringSubmatch(text); len(y) == 2 {
+		year, _ := strconv.Atoi(y[1])
+		return time.Date(year, month, day, 0, 0, 0, 0, w.location), nil
+	}
+	if published.IsZero() {
+		return time.Time{}, errNoAnnouncementYear
+	}
+	date := time.Date(published.Year(), month, day, 0, 0, 0, 0, w.location)
+	if date.Before(published) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, nil
+}
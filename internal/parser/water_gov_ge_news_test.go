@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseNewsListing(t *testing.T) {
+	rawNews, err := os.ReadFile("./fixtures/news.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWaterGovGeNews(slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	items, err := w.parseNewsListing(ctx, rawNews)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantItems := []waterGovGeNewsItem{
+		{
+			uri:       "http://water.gov.ge/page/full/2741",
+			title:     "წყალმომარაგების შეწყვეტა ოზურგეთში",
+			published: time.Date(2023, 9, 13, 0, 0, 0, 0, w.location),
+		},
+		{
+			uri:       "http://water.gov.ge/page/full/2736",
+			title:     "გეგმიური სამუშაოები - წყალმომარაგების დროებითი შეწყვეტა ქუთაისში",
+			published: time.Date(2023, 9, 11, 0, 0, 0, 0, w.location),
+		},
+	}
+	assert.Equal(t, wantItems, items)
+}
+
+func Test_ParseAnnouncement(t *testing.T) {
+	rawArticle, err := os.ReadFile("./fixtures/announcement.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWaterGovGeNews(slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	item := waterGovGeNewsItem{uri: "http://water.gov.ge/page/full/2741"}
+	o, err := w.parseAnnouncement(ctx, item, rawArticle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantO := outage.Outage{
+		Start: time.Date(2023, 9, 15, 10, 0, 0, 0, w.location),
+		End:   time.Date(2023, 9, 15, 18, 0, 0, 0, w.location),
+		Location: outage.Location{
+			TitleGe:  "ოზურგეთის",
+			TitleLat: "ozurgetis",
+		},
+		AddressesGe: []string{
+			"ოზურგეთი ე.თაყაიშვილის ქ.",
+			"ოზურგეთი დიმიტრი ერისთავის ქ.",
+			"ოზურგეთი გურიის ქ. N 12",
+		},
+		Status:          outage.StatusAnnounced,
+		AnnouncementURI: "http://water.gov.ge/page/full/2741",
+	}
+	assert.Equal(t, wantO, o)
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/dom"
+)
+
+const (
+	outageStartLabel             = "წყალმომარაგების შეწყვეტის დრო:"
+	outageEndLabel               = "წყალმომარაგების აღდგენის დრო:"
+	outageAffectedCustomersLabel = "გამორთული აბონენტების რაოდენობა:"
+	problemsAddressPrefix        = "problems_address"
+)
+
+type problemModal struct {
+	title     string
+	offset    int
+	incidents []problemIncident
+}
+
+type problemIncident struct {
+	header            string
+	offset            int
+	start             labeledRow
+	end               labeledRow
+	affectedCustomers labeledRow
+	addresses         []string
+	addressesFound    bool
+}
+
+type labeledRow struct {
+	value  string
+	offset int
+	found  bool
+}
+
+// extractProblem walks the problem modal: the modal title, then one
+// incident per h5 header with its labeled rows and address container.
+// Rows that precede the first header open an implicit incident.
+func extractProblem(root *dom.Node) problemModal {
+	modal := problemModal{}
+	if title := root.Find(dom.ByClass("modal-title")); title != nil {
+		modal.title = title.TextContent()
+	}
+	body := root.Find(dom.ByClass("modal-body"))
+	if body == nil {
+		body = root
+	}
+	modal.offset = body.Offset
+	current := func() *problemIncident {
+		if len(modal.incidents) == 0 {
+			modal.incidents = append(modal.incidents, problemIncident{offset: body.Offset})
+		}
+		return &modal.incidents[len(modal.incidents)-1]
+	}
+	body.Walk(func(n *dom.Node) bool {
+		switch {
+		case n.Tag == "h5":
+			modal.incidents = append(modal.incidents, problemIncident{
+				header: n.TextContent(),
+				offset: n.Offset,
+			})
+			return false
+		case isAddressContainer(n):
+			incident := current()
+			incident.addressesFound = true
+			for _, addr := range n.Elements() {
+				if text := address.Normalize(addr.TextContent()); text != "" {
+					incident.addresses = append(incident.addresses, text)
+				}
+			}
+			return false
+		case n.Tag == "div" && len(n.FindAll(dom.ByTag("div"))) == 1:
+			text := n.TextContent()
+			for _, label := range []string{outageStartLabel, outageEndLabel, outageAffectedCustomersLabel} {
+				value, found := strings.CutPrefix(text, label)
+				if !found {
+					continue
+				}
+				incident := current()
+				row := map[string]*labeledRow{
+					outageStartLabel:             &incident.start,
+					outageEndLabel:               &incident.end,
+					outageAffectedCustomersLabel: &incident.affectedCustomers,
+				}[label]
+				if !row.found {
+					value = strings.TrimSpace(value)
+					*row = labeledRow{value, n.TextOffset(value), true}
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return modal
+}
+
+func isAddressContainer(n *dom.Node) bool {
+	return n.HasClass(problemsAddressPrefix) || strings.HasPrefix(n.Attr("id"), problemsAddressPrefix)
+}
@@ -1,11 +1,14 @@
 package parser
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/doesnotcommit/outage_monitor/internal/outage"
 	"github.com/stretchr/testify/assert"
@@ -50,12 +53,13 @@ func Test_ParseProblem(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	wantP := outage.WaterGovGe{
+	wantP := outage.Outage{
 		Location:          location,
 		Start:             time.Date(2023, 9, 8, 19, 20, 0, 0, w.location),
 		End:               time.Date(2023, 9, 11, 19, 20, 0, 0, w.location),
 		AffectedCustomers: 186,
 		AddressesGe: []string{
+			"ოზურგეთი ე.თაყაიშვილის ქ.",
 			"ოზურგეთი ე.თაყაიშვილის I შეს.",
 			"ოზურგეთი ე.თაყაიშვილის II შეს.",
 			"ოზურგეთი ე.თაყაიშვილის III შეს.",
@@ -164,3 +168,53 @@ func Test_ParseProblem(t *testing.T) {
 	}
 	assert.Equal(t, wantP, p)
 }
+
+func Test_ParseProblemDiagnostic(t *testing.T) {
+	rawProblem, err := os.ReadFile("./fixtures/problem.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWaterGovGe(slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	brokenProblem := bytes.Replace(rawProblem, []byte("11/09/2023 19:20:00"), []byte("41/09/2023 19:20:00"), 1)
+	_, err = w.ParseProblemHTML(ctx, brokenProblem)
+	var diag Diagnostic
+	if !errors.As(err, &diag) {
+		t.Fatalf("want diagnostic, got %v", err)
+	}
+	assert.ErrorIs(t, err, errBadOutageEnd)
+	assert.Equal(t, string(errBadOutageEnd), diag.Rule)
+	assert.Equal(t, 14, diag.Line)
+	assert.Equal(t, bytes.Index(brokenProblem, []byte("41/09/2023")), diag.Offset)
+	assert.Contains(t, diag.Snippet, "41/09/2023 19:20:00")
+	assert.LessOrEqual(t, len(diag.Snippet), diagnosticSnippetBytes+utf8.UTFMax)
+	assert.Less(t, len(err.Error()), len(brokenProblem)/4)
+}
+
+func Test_ParseProblemTolerant(t *testing.T) {
+	rawProblem, err := os.ReadFile("./fixtures/problem.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWaterGovGe(slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	want, err := w.ParseProblemHTML(ctx, rawProblem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reformatted := bytes.ReplaceAll(rawProblem, []byte("<div> "), []byte("<div class=\"row-item\" data-x='1'>\n\t\t"))
+	reformatted = bytes.ReplaceAll(reformatted, []byte("წყალმომარაგების "), []byte("წყალმომარაგების\n    "))
+	reformatted = bytes.ReplaceAll(reformatted, []byte("  </div>"), []byte("</div >"))
+	got, err := w.ParseProblemHTML(ctx, reformatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, "ოზურგეთის", got.Location.TitleGe)
+}
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/internal/parser/declarative"
+)
+
+type DeclarativeScraper interface {
+	Definition() declarative.Definition
+	GetOutages(ctx context.Context) ([]outage.Outage, error)
+}
+
+// Declarative is a provider described by a definition file instead of code.
+type Declarative struct {
+	scraper DeclarativeScraper
+	now     func() time.Time
+}
+
+func NewDeclarative(scraper DeclarativeScraper, now func() time.Time) Declarative {
+	return Declarative{scraper, now}
+}
+
+func (d Declarative) Id() string {
+	return d.scraper.Definition().Id
+}
+
+func (d Declarative) Kind() outage.Kind {
+	return d.scraper.Definition().Kind
+}
+
+func (d Declarative) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	outages, err := d.scraper.GetOutages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get %s outages: %w", d.Id(), err)
+	}
+	now := d.now()
+	for i := range outages {
+		outages[i].Status = statusAt(outages[i], now)
+		outages[i].Key = outage.AddressKey(outages[i].AddressesGe)
+	}
+	return outages, nil
+}
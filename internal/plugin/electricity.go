@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+const (
+	TelasiId    = "telasi.ge"
+	EnergoProId = "energo-pro.ge"
+)
+
+type ElectricityParser interface {
+	GetOutages(ctx context.Context) ([]outage.Outage, error)
+}
+
+// Electricity is a provider backed by one distribution company's listing.
+// Listings mix upcoming and ongoing outages, so status is decided here, and
+// list several rows for a district with the same start, told apart by
+// their addresses.
+type Electricity struct {
+	id                string
+	electricityParser ElectricityParser
+	now               func() time.Time
+}
+
+func NewElectricity(id string, parser ElectricityParser, now func() time.Time) Electricity {
+	return Electricity{id, parser, now}
+}
+
+func (e Electricity) Id() string {
+	return e.id
+}
+
+func (e Electricity) Kind() outage.Kind {
+	return outage.KindElectricity
+}
+
+func (e Electricity) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	outages, err := e.electricityParser.GetOutages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get %s outages: %w", e.id, err)
+	}
+	now := e.now()
+	for i := range outages {
+		outages[i].Status = statusAt(outages[i], now)
+		outages[i].Key = outage.AddressKey(outages[i].AddressesGe)
+	}
+	return outages, nil
+}
+
+func statusAt(o outage.Outage, now time.Time) outage.Status {
+	if o.Start.After(now) {
+		return outage.StatusAnnounced
+	}
+	return outage.StatusActive
+}
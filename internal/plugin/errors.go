@@ -0,0 +1,16 @@
+package plugin
+
+type errorPlugin string
+
+func (e errorPlugin) Error() string {
+	return string(e)
+}
+
+const (
+	errNoTarget        errorPlugin = "external provider has no target"
+	errProtocolVersion errorPlugin = "external provider speaks another protocol version"
+	errNoProviderId    errorPlugin = "external provider has no id"
+	errBadKind         errorPlugin = "external provider has unknown kind"
+	errUnhealthy       errorPlugin = "external provider is unhealthy"
+	errProviderChanged errorPlugin = "external provider came back as another provider"
+)
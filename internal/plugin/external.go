@@ -0,0 +1,286 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/pluginrpc"
+)
+
+const externalTCPScheme = "tcp://"
+
+// External is a provider running out of process and speaking pluginrpc.
+// Target is either a command line, launched with the protocol on its stdio,
+// or tcp://host:port of a provider that is already running. A provider that
+// crashes, hangs past the timeout or fails its health check is restarted
+// (or redialed) on the next call; every new session repeats the handshake
+// and is refused if the provider came back under another id or kind. A
+// launched command is killed when the context given to NewExternal ends.
+type External struct {
+	target  string
+	timeout time.Duration
+	caps    pluginrpc.Capabilities
+	session *externalSession
+	now     func() time.Time
+	sl      *slog.Logger
+}
+
+type externalSession struct {
+	// ctx bounds the lifetime of launched commands rather than of a call.
+	ctx    context.Context
+	mu     sync.Mutex
+	client *rpc.Client
+	cmd    *exec.Cmd
+}
+
+func NewExternal(ctx context.Context, target string, timeout time.Duration, now func() time.Time, sl *slog.Logger) (External, error) {
+	handleErr := func(err error) (External, error) {
+		return External{}, fmt.Errorf("new external provider %s: %w", target, err)
+	}
+	if strings.TrimSpace(target) == "" {
+		return handleErr(errNoTarget)
+	}
+	e := External{
+		target:  target,
+		timeout: timeout,
+		session: &externalSession{ctx: ctx},
+		now:     now,
+		sl:      sl,
+	}
+	if _, err := e.session.connect(ctx, target, func(client *rpc.Client) (err error) {
+		e.caps, err = e.handshake(ctx, client)
+		return err
+	}, sl); err != nil {
+		e.Close()
+		return handleErr(err)
+	}
+	switch {
+	case e.caps.ProtocolVersion != pluginrpc.ProtocolVersion:
+		e.Close()
+		return handleErr(fmt.Errorf("%w: %d", errProtocolVersion, e.caps.ProtocolVersion))
+	case e.caps.Id == "":
+		e.Close()
+		return handleErr(errNoProviderId)
+	}
+	switch outage.Kind(e.caps.Kind) {
+	case outage.KindWater, outage.KindElectricity, outage.KindGas:
+	default:
+		e.Close()
+		return handleErr(fmt.Errorf("%w: %q", errBadKind, e.caps.Kind))
+	}
+	return e, nil
+}
+
+func (e External) Id() string {
+	return e.caps.Id
+}
+
+func (e External) Kind() outage.Kind {
+	return outage.Kind(e.caps.Kind)
+}
+
+// Interval is the refresh interval the provider asked for, or zero.
+func (e External) Interval() time.Duration {
+	interval, err := time.ParseDuration(e.caps.RefreshInterval)
+	if err != nil {
+		return 0
+	}
+	return interval
+}
+
+func (e External) Health(ctx context.Context) error {
+	var reply pluginrpc.HealthReply
+	if err := e.call(ctx, pluginrpc.MethodHealth, pluginrpc.HealthArgs{}, &reply); err != nil {
+		return fmt.Errorf("health of %s: %w", e.caps.Id, err)
+	}
+	if !reply.Healthy {
+		return fmt.Errorf("health of %s: %w: %s", e.caps.Id, errUnhealthy, reply.Message)
+	}
+	return nil
+}
+
+func (e External) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get %s outages: %w", e.caps.Id, err)
+	}
+	if err := e.Health(ctx); err != nil {
+		e.sl.Warn("external provider is unhealthy, restarting", slog.String("provider", e.caps.Id), slog.Any("err", err))
+		e.session.reset(e.sl)
+	}
+	var reply pluginrpc.GetOutagesReply
+	if err := e.call(ctx, pluginrpc.MethodGetOutages, pluginrpc.GetOutagesArgs{}, &reply); err != nil {
+		return handleErr(err)
+	}
+	now := e.now()
+	outages := make([]outage.Outage, len(reply.Outages))
+	for i, o := range reply.Outages {
+		outages[i] = outage.Outage{
+			Key:               o.Key,
+			Start:             o.Start,
+			End:               o.End,
+			AffectedCustomers: o.AffectedCustomers,
+			Location: outage.Location{
+				Id:       o.Location.Id,
+				TitleGe:  o.Location.TitleGe,
+				TitleLat: o.Location.TitleLat,
+				Lat:      o.Location.Lat,
+				Lng:      o.Location.Lng,
+			},
+			AddressesGe:     o.AddressesGe,
+			Status:          outage.Status(o.Status),
+			AnnouncementURI: o.AnnouncementURI,
+			Extra:           o.Extra,
+		}
+		if outages[i].Status == "" {
+			outages[i].Status = statusAt(outages[i], now)
+		}
+		if outages[i].Key == "" {
+			outages[i].Key = outage.AddressKey(outages[i].AddressesGe)
+		}
+	}
+	return outages, nil
+}
+
+// Close stops the provider process or hangs up on it.
+func (e External) Close() {
+	e.session.reset(e.sl)
+}
+
+// call runs one request within the timeout. A crash or a timeout drops the
+// session so that the next call starts a fresh one; a crash is retried once
+// right away.
+func (e External) call(ctx context.Context, method string, args, reply any) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("call %s: %w", method, err)
+	}
+	for attempt := 0; ; attempt++ {
+		client, err := e.session.connect(ctx, e.target, func(client *rpc.Client) error {
+			return e.rehandshake(ctx, client)
+		}, e.sl)
+		if err != nil {
+			return handleErr(err)
+		}
+		err = e.callOnce(ctx, client, method, args, reply)
+		if err == nil {
+			return nil
+		}
+		var serverErr rpc.ServerError
+		if errors.As(err, &serverErr) {
+			return handleErr(err)
+		}
+		e.sl.Warn("external provider failed, restarting", slog.String("target", e.target), slog.String("method", method), slog.Any("err", err))
+		e.session.reset(e.sl)
+		if attempt > 0 || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return handleErr(err)
+		}
+	}
+}
+
+func (e External) handshake(ctx context.Context, client *rpc.Client) (pluginrpc.Capabilities, error) {
+	var caps pluginrpc.Capabilities
+	if err := e.callOnce(ctx, client, pluginrpc.MethodHandshake, pluginrpc.HandshakeArgs{ProtocolVersion: pluginrpc.ProtocolVersion}, &caps); err != nil {
+		return pluginrpc.Capabilities{}, fmt.Errorf("handshake: %w", err)
+	}
+	return caps, nil
+}
+
+// rehandshake greets a restarted provider, which must still be the one the
+// registry knows.
+func (e External) rehandshake(ctx context.Context, client *rpc.Client) error {
+	caps, err := e.handshake(ctx, client)
+	if err != nil {
+		return err
+	}
+	if caps.Id != e.caps.Id || caps.Kind != e.caps.Kind {
+		return fmt.Errorf("%w: %s %s is now %s %s", errProviderChanged, e.caps.Id, e.caps.Kind, caps.Id, caps.Kind)
+	}
+	return nil
+}
+
+func (e External) callOnce(ctx context.Context, client *rpc.Client, method string, args, reply any) error {
+	ctx, cancelCtx := context.WithTimeout(ctx, e.timeout)
+	defer cancelCtx()
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.Done:
+		return call.Error
+	}
+}
+
+// connect returns the session's client, starting a new session when there
+// is none and greeting it before anyone else can use it.
+func (s *externalSession) connect(ctx context.Context, target string, greet func(client *rpc.Client) error, sl *slog.Logger) (*rpc.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	if addr, found := strings.CutPrefix(target, externalTCPScheme); found {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %w", addr, err)
+		}
+		s.client = jsonrpc.NewClient(conn)
+	} else {
+		args := strings.Fields(target)
+		cmd := exec.CommandContext(s.ctx, args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("launch %s: %w", target, err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("launch %s: %w", target, err)
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("launch %s: %w", target, err)
+		}
+		s.cmd = cmd
+		s.client = jsonrpc.NewClient(pluginrpc.NewStdioConn(stdout, stdin))
+	}
+	if err := greet(s.client); err != nil {
+		s.close(sl)
+		return nil, err
+	}
+	return s.client, nil
+}
+
+func (s *externalSession) reset(sl *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.close(sl)
+}
+
+// close drops the session; the caller holds mu.
+func (s *externalSession) close(sl *slog.Logger) {
+	if s.client != nil {
+		if err := s.client.Close(); err != nil && !errors.Is(err, rpc.ErrShutdown) && !errors.Is(err, io.ErrClosedPipe) {
+			sl.Debug("close external provider client", slog.Any("err", err))
+		}
+		s.client = nil
+	}
+	if s.cmd != nil {
+		cmd := s.cmd
+		s.cmd = nil
+		if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			sl.Debug("kill external provider", slog.Any("err", err))
+		}
+		go cmd.Wait()
+	}
+}
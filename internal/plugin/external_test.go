@@ -0,0 +1,160 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/doesnotcommit/outage_monitor/pluginrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// The test binary doubles as an external provider: with the helper variable
+// set it serves pluginrpc on stdio instead of running the tests.
+const (
+	helperModeEnv   = "OUTAGE_MONITOR_PLUGIN_HELPER"
+	helperMarkerEnv = "OUTAGE_MONITOR_PLUGIN_HELPER_MARKER"
+)
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(helperModeEnv); mode != "" {
+		if err := pluginrpc.ServeStdio(context.Background(), helperProvider{mode}); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type helperProvider struct {
+	mode string
+}
+
+var helperStart = time.Date(2023, 9, 20, 10, 0, 0, 0, time.UTC)
+
+func (h helperProvider) Capabilities() pluginrpc.Capabilities {
+	kind := string(outage.KindWater)
+	if h.mode == "bad-kind" {
+		kind = "steam"
+	}
+	id := "helper.ge"
+	if _, err := os.Stat(os.Getenv(helperMarkerEnv)); h.mode == "change-id" && err == nil {
+		id = "other.ge"
+	}
+	return pluginrpc.Capabilities{
+		Id:              id,
+		Kind:            kind,
+		RefreshInterval: "15m",
+	}
+}
+
+func (h helperProvider) Health(ctx context.Context) error {
+	if h.mode == "unhealthy" {
+		return errors.New("upstream unreachable")
+	}
+	return nil
+}
+
+func (h helperProvider) GetOutages(ctx context.Context) ([]pluginrpc.Outage, error) {
+	switch h.mode {
+	case "hang":
+		time.Sleep(time.Minute)
+	case "crash-once", "change-id":
+		marker := os.Getenv(helperMarkerEnv)
+		if _, err := os.Stat(marker); errors.Is(err, os.ErrNotExist) {
+			if err := os.WriteFile(marker, nil, 0o600); err != nil {
+				return nil, err
+			}
+			os.Exit(1)
+		}
+	}
+	return []pluginrpc.Outage{
+		{
+			Start: helperStart,
+			End:   helperStart.Add(8 * time.Hour),
+			Location: pluginrpc.Location{
+				Id:       "rustavi",
+				TitleGe:  "რუსთავი",
+				TitleLat: "rustavi",
+			},
+			AddressesGe: []string{"მესხიშვილის ქ."},
+		},
+	}, nil
+}
+
+func newHelperExternal(t *testing.T, mode string, timeout time.Duration) (External, error) {
+	t.Helper()
+	t.Setenv(helperModeEnv, mode)
+	t.Setenv(helperMarkerEnv, filepath.Join(t.TempDir(), "crashed"))
+	now := func() time.Time {
+		return helperStart.Add(time.Hour)
+	}
+	e, err := NewExternal(context.Background(), os.Args[0], timeout, now, slog.Default())
+	if err == nil {
+		t.Cleanup(e.Close)
+	}
+	return e, err
+}
+
+func Test_ExternalGetOutages(t *testing.T) {
+	for _, mode := range []string{"ok", "crash-once", "unhealthy"} {
+		t.Run(mode, func(t *testing.T) {
+			e, err := newHelperExternal(t, mode, time.Second*5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "helper.ge", e.Id())
+			assert.Equal(t, outage.KindWater, e.Kind())
+			assert.Equal(t, 15*time.Minute, e.Interval())
+			outages, err := e.GetOutages(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantOutages := []outage.Outage{
+				{
+					Start: helperStart,
+					End:   helperStart.Add(8 * time.Hour),
+					Location: outage.Location{
+						Id:       "rustavi",
+						TitleGe:  "რუსთავი",
+						TitleLat: "rustavi",
+					},
+					AddressesGe: []string{"მესხიშვილის ქ."},
+					Status:      outage.StatusActive,
+					Key:         outage.AddressKey([]string{"მესხიშვილის ქ."}),
+				},
+			}
+			assert.Equal(t, wantOutages, outages)
+		})
+	}
+}
+
+func Test_ExternalTimeout(t *testing.T) {
+	e, err := newHelperExternal(t, "hang", time.Millisecond*300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.GetOutages(context.Background())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.NoError(t, e.Health(context.Background()))
+}
+
+func Test_ExternalBadCapabilities(t *testing.T) {
+	_, err := newHelperExternal(t, "bad-kind", time.Second*5)
+	assert.True(t, errors.Is(err, errBadKind))
+}
+
+func Test_ExternalChangedProvider(t *testing.T) {
+	e, err := newHelperExternal(t, "change-id", time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.GetOutages(context.Background())
+	assert.ErrorIs(t, err, errProviderChanged)
+	assert.Equal(t, "helper.ge", e.Id())
+}
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+const TbilisiEnergyId = "tbilisienergy.ge"
+
+type GasParser interface {
+	GetOutages(ctx context.Context) ([]outage.Outage, error)
+}
+
+type Gas struct {
+	id        string
+	gasParser GasParser
+	now       func() time.Time
+}
+
+func NewGas(id string, parser GasParser, now func() time.Time) Gas {
+	return Gas{id, parser, now}
+}
+
+func (g Gas) Id() string {
+	return g.id
+}
+
+func (g Gas) Kind() outage.Kind {
+	return outage.KindGas
+}
+
+func (g Gas) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	outages, err := g.gasParser.GetOutages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get %s outages: %w", g.id, err)
+	}
+	now := g.now()
+	for i := range outages {
+		outages[i].Status = statusAt(outages[i], now)
+		outages[i].Key = outage.AddressKey(outages[i].AddressesGe)
+	}
+	return outages, nil
+}
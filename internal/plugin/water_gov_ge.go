@@ -2,23 +2,57 @@ package plugin
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 
 	"github.com/doesnotcommit/outage_monitor/internal/outage"
 )
 
+const WaterGovGeId = "water.gov.ge"
+
 type WaterGovGeParser interface {
-	GetOutages(ctx context.Context) ([]outage.WaterGovGe, error)
+	GetOutages(ctx context.Context) ([]outage.Outage, error)
+}
+
+type WaterGovGeMapParser interface {
+	WaterGovGeParser
+	GetOutagesAndCenters(ctx context.Context) ([]outage.Outage, []outage.Center, error)
 }
 
+// WaterGovGe is the water.gov.ge provider. It combines outages live on the
+// map with planned works announced in the news; the service links the two
+// and supersedes the announcements that went live.
 type WaterGovGe struct {
-	waterGovGeParser WaterGovGeParser
+	waterGovGeParser     WaterGovGeMapParser
+	waterGovGeNewsParser WaterGovGeParser
+	sl                   *slog.Logger
+}
+
+func NewWaterGovGe(parser WaterGovGeMapParser, newsParser WaterGovGeParser, sl *slog.Logger) WaterGovGe {
+	return WaterGovGe{parser, newsParser, sl}
+}
+
+func (w WaterGovGe) Id() string {
+	return WaterGovGeId
+}
+
+func (w WaterGovGe) Kind() outage.Kind {
+	return outage.KindWater
 }
 
-func NewWaterGovGe(parser WaterGovGeParser) WaterGovGe {
-	return WaterGovGe{parser}
+func (w WaterGovGe) GetOutages(ctx context.Context) ([]outage.Outage, error) {
+	outages, _, err := w.GetOutagesAndCenters(ctx)
+	return outages, err
 }
 
-func (w WaterGovGe) GetWaterOutages(ctx context.Context) ([]outage.WaterGovGe, error) {
-	// TODO
-	return w.waterGovGeParser.GetOutages(ctx)
+func (w WaterGovGe) GetOutagesAndCenters(ctx context.Context) ([]outage.Outage, []outage.Center, error) {
+	live, centers, err := w.waterGovGeParser.GetOutagesAndCenters(ctx)
+	if err != nil {
+		return nil, centers, fmt.Errorf("get %s outages: %w", WaterGovGeId, err)
+	}
+	announced, err := w.waterGovGeNewsParser.GetOutages(ctx)
+	if err != nil {
+		w.sl.Warn("announcements unavailable, keeping live outages only", slog.Any("err", err))
+	}
+	return append(live, announced...), centers, nil
 }
@@ -0,0 +1,512 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+// Dynamo keeps one set of tables per provider, named after the provider id,
+// so the original water.gov.ge table is read and written unchanged. Its sort
+// key is called outageEnd but has always held the start, followed by the
+// outage key when there is one, so the real end is kept in a separate end
+// attribute. Manual outages live in their own table
+// keyed by id. Outage tables carry an index of active outages by end, and
+// each has an address-token table next to it.
+type Dynamo struct {
+	outagesPartitionKey   string
+	outagesSortKey        string
+	centersTableSuffix    string
+	historyTableSuffix    string
+	addressesTableSuffix  string
+	addressesPartitionKey string
+	addressesSortKey      string
+	activeIndexName       string
+	centersPartitionKey   string
+	centersHistorySortKey string
+	manualTableName       string
+	manualPartitionKey    string
+	crowdTableName        string
+	crowdPartitionKey     string
+	crowdSortKey          string
+	revisionsTableName    string
+	revisionsPartitionKey string
+	revisionsSortKey      string
+	revisionsIndexName    string
+	leasesTableName       string
+	leasesPartitionKey    string
+	outboxTableName       string
+	outboxPartitionKey    string
+	outboxIndexName       string
+	runsTableName         string
+	runsPartitionKey      string
+	runsSortKey           string
+	tablePrefix           string
+	ttlAttribute          string
+	retention             time.Duration
+	streams               bool
+	batchBackoff          batchBackoff
+	client                *dynamodb.Client
+	now                   func() time.Time
+	sl                    *slog.Logger
+}
+
+type dynamoOutage struct {
+	LocationId        string
+	LocationTitle     string
+	OutageEnd         string
+	OutageKey         string
+	AddressesGe       []string
+	AffectedCustomers int
+	LocationLat       string
+	LocationLng       string
+	OutageStart       time.Time
+	TitleGe           string
+	Status            string
+	AnnouncementUri   string
+	ProviderId        string
+	Kind              string
+	Extra             map[string]string
+	End               time.Time
+	Id                string
+	Source            string
+	Reporter          string
+}
+
+// NewDynamo uses the static access key when one is given and the default
+// credential chain (environment, shared profile, IRSA) otherwise. A non-empty
+// endpoint replaces the AWS one, e.g. http://localhost:8000 for DynamoDB
+// Local, and tablePrefix is put in front of every table name.
+func NewDynamo(ctx context.Context, accessKey, secretAccessKey, region, endpoint, tablePrefix string, now func() time.Time, sl *slog.Logger) (Dynamo, error) {
+	handleErr := func(err error) (Dynamo, error) {
+		return Dynamo{}, fmt.Errorf("new dynamo: %w", err)
+	}
+	conf, err := loadAWSConfig(ctx, accessKey, secretAccessKey, region)
+	if err != nil {
+		return handleErr(err)
+	}
+	client := dynamodb.NewFromConfig(conf, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return newDynamo(client, tablePrefix, now, sl), nil
+}
+
+// loadAWSConfig is shared by the DynamoDB and DynamoDB Streams clients.
+func loadAWSConfig(ctx context.Context, accessKey, secretAccessKey, region string) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if accessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{
+				AccessKeyID:     accessKey,
+				SecretAccessKey: secretAccessKey,
+			}, nil
+		})))
+	}
+	conf, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	conf.RetryMaxAttempts = 32
+	retryMode, err := aws.ParseRetryMode("adaptive")
+	if err != nil {
+		return aws.Config{}, err
+	}
+	conf.RetryMode = retryMode
+	return conf, nil
+}
+
+func newDynamo(client *dynamodb.Client, tablePrefix string, now func() time.Time, sl *slog.Logger) Dynamo {
+	const (
+		outagesPartitionKey   = "locationTitle"
+		outagesSortKey        = "outageEnd"
+		centersTableSuffix    = ".centers"
+		historyTableSuffix    = ".centers.history"
+		addressesTableSuffix  = ".addresses"
+		addressesPartitionKey = "token"
+		addressesSortKey      = "outageKey"
+		activeIndexName       = "kind-end"
+		centersPartitionKey   = "locationId"
+		centersHistorySortKey = "observedAt"
+		manualTableName       = "manual.outages"
+		manualPartitionKey    = "id"
+		crowdTableName        = "crowd.reports"
+		crowdPartitionKey     = "outageRef"
+		crowdSortKey          = "reportKey"
+		revisionsTableName    = "outage.revisions"
+		revisionsPartitionKey = "outageRef"
+		revisionsSortKey      = "observedAt"
+		revisionsIndexName    = "locationKey-observedAt"
+		leasesTableName       = "stream.leases"
+		leasesPartitionKey    = "leaseKey"
+		outboxTableName       = "notification.outbox"
+		outboxPartitionKey    = "id"
+		outboxIndexName       = "pending-nextAttemptAt"
+		runsTableName         = "refresh.runs"
+		runsPartitionKey      = "providerId"
+		runsSortKey           = "startedAt"
+		ttlAttribute          = "expiresAt"
+	)
+	return Dynamo{
+		outagesPartitionKey,
+		outagesSortKey,
+		centersTableSuffix,
+		historyTableSuffix,
+		addressesTableSuffix,
+		addressesPartitionKey,
+		addressesSortKey,
+		activeIndexName,
+		centersPartitionKey,
+		centersHistorySortKey,
+		tablePrefix + manualTableName,
+		manualPartitionKey,
+		tablePrefix + crowdTableName,
+		crowdPartitionKey,
+		crowdSortKey,
+		tablePrefix + revisionsTableName,
+		revisionsPartitionKey,
+		revisionsSortKey,
+		revisionsIndexName,
+		tablePrefix + leasesTableName,
+		leasesPartitionKey,
+		tablePrefix + outboxTableName,
+		outboxPartitionKey,
+		outboxIndexName,
+		tablePrefix + runsTableName,
+		runsPartitionKey,
+		runsSortKey,
+		tablePrefix,
+		ttlAttribute,
+		0,
+		false,
+		defaultBatchBackoff,
+		client,
+		now,
+		sl,
+	}
+}
+
+// WithRetention makes outages, their address tokens and revisions expire
+// retention after they end, refresh runs and notifications retention after
+// they start, and leases retention after they were last renewed, through the
+// table TTL. Zero keeps them forever.
+func (w Dynamo) WithRetention(retention time.Duration) Dynamo {
+	w.retention = retention
+	return w
+}
+
+// expiresAt is the TTL of an outage in unix seconds, or "" when outages are
+// kept forever.
+func (w Dynamo) expiresAt(o outage.Outage) string {
+	if w.retention <= 0 {
+		return ""
+	}
+	end := o.End
+	if end.IsZero() {
+		end = o.Start
+	}
+	return strconv.FormatInt(end.Add(w.retention).Unix(), 10)
+}
+
+// WithStreams makes EnsureTables turn on NEW_AND_OLD_IMAGES streams for the
+// outage and manual tables. DynamoChangeFeed keeps its checkpoints in the
+// lease table, next to the leader lease.
+func (w Dynamo) WithStreams() Dynamo {
+	w.streams = true
+	return w
+}
+
+func (w Dynamo) outagesTableName(providerId string) string {
+	return w.tablePrefix + providerId
+}
+
+func (w Dynamo) centersTableName(providerId string) string {
+	return w.tablePrefix + providerId + w.centersTableSuffix
+}
+
+func (w Dynamo) historyTableName(providerId string) string {
+	return w.tablePrefix + providerId + w.historyTableSuffix
+}
+
+func (w Dynamo) addressesTableName(providerId string) string {
+	return w.tablePrefix + providerId + w.addressesTableSuffix
+}
+
+// SaveOutages writes the outages and their address tokens in batches, see
+// writeBatches. Outages that share a key are written once, the last one
+// winning.
+func (w Dynamo) SaveOutages(ctx context.Context, outages ...outage.Outage) error {
+	var puts []batchPut
+	for _, o := range outages {
+		puts = append(puts, newBatchPut(w.outagesTableName(o.ProviderId), w.outageItem(o), w.outagesPartitionKey, w.outagesSortKey))
+		puts = append(puts, w.addressPuts(o)...)
+	}
+	if err := writeBatches(ctx, w.client, puts, w.batchBackoff, w.sl); err != nil {
+		return fmt.Errorf("save outages: %w", err)
+	}
+	return nil
+}
+
+func (w Dynamo) GetOutage(ctx context.Context, providerId, titleLat string, start time.Time, key string) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("get outage %s/%s: %w", providerId, titleLat, err)
+	}
+	gio, err := w.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(w.outagesTableName(providerId)),
+		Key: map[string]types.AttributeValue{
+			w.outagesPartitionKey: &types.AttributeValueMemberS{Value: titleLat},
+			w.outagesSortKey:      &types.AttributeValueMemberS{Value: outageSortKey(outage.Outage{Start: start, Key: key})},
+		},
+	})
+	if err != nil {
+		return handleErr(err)
+	}
+	if gio.Item == nil {
+		return handleErr(outage.ErrNotFound)
+	}
+	var o dynamoOutage
+	if err := attributevalue.UnmarshalMap(gio.Item, &o); err != nil {
+		return handleErr(err)
+	}
+	return o.toOutage(providerId), nil
+}
+
+// openEnd is the end written for ongoing outages without one, so that the
+// active index holds them too.
+const openEnd = "9999-12-31T23:59:59Z"
+
+// outageSortKey is the outage's start in UTC, followed by its key when the
+// provider lists several outages at one location with the same start.
+func outageSortKey(o outage.Outage) string {
+	start := o.Start.UTC().Format(time.RFC3339)
+	if o.Key == "" {
+		return start
+	}
+	return start + "#" + o.Key
+}
+
+func (w Dynamo) outageItem(o outage.Outage) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		w.outagesPartitionKey: &types.AttributeValueMemberS{
+			Value: o.Location.TitleLat,
+		},
+		w.outagesSortKey: &types.AttributeValueMemberS{
+			Value: outageSortKey(o),
+		},
+		"titleGe": &types.AttributeValueMemberS{
+			Value: o.Location.TitleGe,
+		},
+		"outageStart": &types.AttributeValueMemberS{
+			Value: o.Start.UTC().Format(time.RFC3339),
+		},
+		"affectedCustomers": &types.AttributeValueMemberN{
+			Value: strconv.Itoa(o.AffectedCustomers),
+		},
+		"locationLat": &types.AttributeValueMemberS{
+			Value: o.Location.Lat,
+		},
+		"locationLng": &types.AttributeValueMemberS{
+			Value: o.Location.Lng,
+		},
+		"locationId": &types.AttributeValueMemberS{
+			Value: o.Location.Id,
+		},
+		"status": &types.AttributeValueMemberS{
+			Value: string(o.Status),
+		},
+		"announcementUri": &types.AttributeValueMemberS{
+			Value: o.AnnouncementURI,
+		},
+		"providerId": &types.AttributeValueMemberS{
+			Value: o.ProviderId,
+		},
+		"kind": &types.AttributeValueMemberS{
+			Value: string(o.Kind),
+		},
+		"source": &types.AttributeValueMemberS{
+			Value: string(o.Source),
+		},
+	}
+	// DynamoDB rejects empty sets, so an outage without addresses has no
+	// addressesGe at all.
+	if addressesGe := lo.Uniq(o.AddressesGe); len(addressesGe) > 0 {
+		item["addressesGe"] = &types.AttributeValueMemberSS{
+			Value: addressesGe,
+		}
+	}
+	if expiresAt := w.expiresAt(o); expiresAt != "" {
+		item[w.ttlAttribute] = &types.AttributeValueMemberN{
+			Value: expiresAt,
+		}
+	}
+	end := openEnd
+	if !o.End.IsZero() {
+		end = o.End.UTC().Format(time.RFC3339)
+	}
+	item["end"] = &types.AttributeValueMemberS{
+		Value: end,
+	}
+	if o.Id != "" {
+		item["id"] = &types.AttributeValueMemberS{
+			Value: o.Id,
+		}
+	}
+	if o.Key != "" {
+		item["outageKey"] = &types.AttributeValueMemberS{
+			Value: o.Key,
+		}
+	}
+	if o.Reporter != "" {
+		item["reporter"] = &types.AttributeValueMemberS{
+			Value: o.Reporter,
+		}
+	}
+	if len(o.Extra) > 0 {
+		extra := make(map[string]types.AttributeValue, len(o.Extra))
+		for k, v := range o.Extra {
+			extra[k] = &types.AttributeValueMemberS{Value: v}
+		}
+		item["extra"] = &types.AttributeValueMemberM{Value: extra}
+	}
+	return item
+}
+
+func (w Dynamo) GetOutages(ctx context.Context, providerId, titleLat string) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get outages: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(w.outagesPartitionKey).Equal(expression.Value(titleLat))).
+		WithFilter(w.notEnded()).
+		WithProjection(expression.NamesList(
+			expression.Name(w.outagesPartitionKey),
+			expression.Name(w.outagesSortKey),
+			expression.Name("addressesGe"),
+			expression.Name("affectedCustomers"),
+			expression.Name("locationLat"),
+			expression.Name("locationLng"),
+			expression.Name("outageStart"),
+			expression.Name("titleGe"),
+			expression.Name("locationId"),
+			expression.Name("status"),
+			expression.Name("announcementUri"),
+			expression.Name("providerId"),
+			expression.Name("kind"),
+			expression.Name("extra"),
+			expression.Name("end"),
+			expression.Name("id"),
+			expression.Name("source"),
+			expression.Name("reporter"),
+			expression.Name("outageKey"),
+		)).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	outages, err := w.queryOutages(ctx, providerId, &dynamodb.QueryInput{
+		KeyConditionExpression:    exp.KeyCondition(),
+		FilterExpression:          exp.Filter(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ProjectionExpression:      exp.Projection(),
+		TableName:                 aws.String(w.outagesTableName(providerId)),
+	})
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, nil
+}
+
+// notEnded matches the outage items that have not ended yet, openEnd
+// included. An item without an end is ongoing, unless it was written before
+// kind existed: those took their end from the sort key. Times are written in UTC, so that
+// they compare as strings.
+func (w Dynamo) notEnded() expression.ConditionBuilder {
+	now := w.now().UTC().Format(time.RFC3339)
+	noEnd := expression.AttributeNotExists(expression.Name("end"))
+	return expression.Name("end").GreaterThan(expression.Value(now)).Or(
+		noEnd.And(expression.AttributeExists(expression.Name("kind"))),
+		noEnd.And(expression.Name(w.outagesSortKey).GreaterThan(expression.Value(now))),
+	)
+}
+
+// queryOutages follows LastEvaluatedKey through every page of a query.
+func (w Dynamo) queryOutages(ctx context.Context, providerId string, qi *dynamodb.QueryInput) ([]outage.Outage, error) {
+	var outages []dynamoOutage
+	p := dynamodb.NewQueryPaginator(w.client, qi)
+	for p.HasMorePages() {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var page []dynamoOutage
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return nil, err
+		}
+		outages = append(outages, page...)
+	}
+	result := make([]outage.Outage, len(outages))
+	for i, o := range outages {
+		result[i] = o.toOutage(providerId)
+	}
+	return result, nil
+}
+
+func (o dynamoOutage) toOutage(providerId string) outage.Outage {
+	kind := outage.Kind(o.Kind)
+	if o.ProviderId == "" {
+		o.ProviderId = providerId
+	}
+	if kind == "" {
+		kind = outage.KindWater
+	}
+	end := o.End
+	if end.UTC().Format(time.RFC3339) == openEnd {
+		end = time.Time{}
+	}
+	if end.IsZero() && o.Kind == "" {
+		// Items written before kind and end existed took the end from the
+		// sort key.
+		legacyEnd, _, _ := strings.Cut(o.OutageEnd, "#")
+		end, _ = time.Parse(time.RFC3339, legacyEnd)
+	}
+	source := outage.Source(o.Source)
+	if source == "" {
+		source = outage.SourceOfficial
+	}
+	return outage.Outage{
+		Id:                o.Id,
+		ProviderId:        o.ProviderId,
+		Key:               o.OutageKey,
+		Kind:              kind,
+		Start:             o.OutageStart,
+		End:               end,
+		AffectedCustomers: o.AffectedCustomers,
+		Location: outage.Location{
+			Id:       o.LocationId,
+			TitleGe:  o.TitleGe,
+			TitleLat: o.LocationTitle,
+			Lat:      o.LocationLat,
+			Lng:      o.LocationLng,
+		},
+		AddressesGe:     o.AddressesGe,
+		Status:          outage.Status(o.Status),
+		AnnouncementURI: o.AnnouncementUri,
+		Source:          source,
+		Reporter:        o.Reporter,
+		Extra:           o.Extra,
+	}
+}
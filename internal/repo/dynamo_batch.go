@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxBatchWriteItems is the most puts BatchWriteItem accepts at once.
+const maxBatchWriteItems = 25
+
+type batchWriteClient interface {
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// batchPut is one item to put, with its key rendered as text so duplicates
+// can be spotted and failures reported.
+type batchPut struct {
+	tableName string
+	keyNames  []string
+	key       string
+	item      map[string]types.AttributeValue
+}
+
+// batchBackoff bounds the retries of unprocessed items: the delay doubles
+// from base up to max, with full jitter, for at most attempts rounds.
+type batchBackoff struct {
+	base     time.Duration
+	max      time.Duration
+	attempts int
+}
+
+var defaultBatchBackoff = batchBackoff{50 * time.Millisecond, 5 * time.Second, 8}
+
+func (b batchBackoff) delay(attempt int) time.Duration {
+	d := b.base << attempt
+	if d <= 0 || d > b.max {
+		d = b.max
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func newBatchPut(tableName string, item map[string]types.AttributeValue, keyNames ...string) batchPut {
+	return batchPut{tableName, keyNames, itemKey(item, keyNames), item}
+}
+
+func itemKey(item map[string]types.AttributeValue, keyNames []string) string {
+	key := make([]string, len(keyNames))
+	for i, name := range keyNames {
+		if s, ok := item[name].(*types.AttributeValueMemberS); ok {
+			key[i] = s.Value
+		}
+	}
+	return strings.Join(key, "/")
+}
+
+// dedupePuts keeps the last put of every key, since a batch with the same
+// key twice is rejected as a whole.
+func dedupePuts(puts []batchPut) []batchPut {
+	last := make(map[[2]string]int, len(puts))
+	for i, p := range puts {
+		last[[2]string{p.tableName, p.key}] = i
+	}
+	deduped := make([]batchPut, 0, len(last))
+	for i, p := range puts {
+		if last[[2]string{p.tableName, p.key}] == i {
+			deduped = append(deduped, p)
+		}
+	}
+	return deduped
+}
+
+// writeBatches puts the items in batches of at most 25 and retries what
+// DynamoDB leaves unprocessed. A failed batch does not stop the others; the
+// returned error joins one error per item that was not written.
+func writeBatches(ctx context.Context, client batchWriteClient, puts []batchPut, backoff batchBackoff, sl *slog.Logger) error {
+	puts = dedupePuts(puts)
+	var errs []error
+	for len(puts) > 0 {
+		n := min(len(puts), maxBatchWriteItems)
+		errs = append(errs, writeBatch(ctx, client, puts[:n], backoff, sl)...)
+		puts = puts[n:]
+	}
+	return errors.Join(errs...)
+}
+
+func writeBatch(ctx context.Context, client batchWriteClient, puts []batchPut, backoff batchBackoff, sl *slog.Logger) []error {
+	requests := make(map[string][]types.WriteRequest)
+	for _, p := range puts {
+		requests[p.tableName] = append(requests[p.tableName], types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: p.item},
+		})
+	}
+	failAll := func(err error) []error {
+		errs := make([]error, 0, len(puts))
+		for _, p := range puts {
+			errs = append(errs, fmt.Errorf("put %s %s: %w", p.tableName, p.key, err))
+		}
+		return errs
+	}
+	for attempt := 0; ; attempt++ {
+		bwo, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems:           requests,
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		})
+		if err != nil {
+			return failAll(err)
+		}
+		sl.Debug("wrote batch", slog.Int("attempt", attempt), slog.Any("consumed capacity", bwo.ConsumedCapacity))
+		if len(bwo.UnprocessedItems) == 0 {
+			return nil
+		}
+		requests = bwo.UnprocessedItems
+		puts = unprocessedPuts(puts, requests)
+		if attempt+1 >= backoff.attempts {
+			return failAll(errUnprocessedItem)
+		}
+		select {
+		case <-ctx.Done():
+			return failAll(ctx.Err())
+		case <-time.After(backoff.delay(attempt)):
+		}
+	}
+}
+
+// unprocessedPuts narrows puts down to the items DynamoDB sent back.
+func unprocessedPuts(puts []batchPut, unprocessed map[string][]types.WriteRequest) []batchPut {
+	var left []batchPut
+	for _, p := range puts {
+		for _, wr := range unprocessed[p.tableName] {
+			if wr.PutRequest != nil && itemKey(wr.PutRequest.Item, p.keyNames) == p.key {
+				left = append(left, p)
+				break
+			}
+		}
+	}
+	return left
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBatchClient leaves the first item of every batch unprocessed a few
+// times and rejects batches holding a poisoned key.
+type fakeBatchClient struct {
+	unprocessedRounds int
+	poisoned          string
+	batchSizes        []int
+	written           map[string]int
+}
+
+func (c *fakeBatchClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	var size int
+	for _, requests := range params.RequestItems {
+		size += len(requests)
+		for _, wr := range requests {
+			if itemKey(wr.PutRequest.Item, []string{"pk"}) == c.poisoned {
+				return nil, errors.New("ValidationException")
+			}
+		}
+	}
+	c.batchSizes = append(c.batchSizes, size)
+	bwo := dynamodb.BatchWriteItemOutput{UnprocessedItems: make(map[string][]types.WriteRequest)}
+	for table, requests := range params.RequestItems {
+		for i, wr := range requests {
+			if i == 0 && c.unprocessedRounds > 0 {
+				bwo.UnprocessedItems[table] = append(bwo.UnprocessedItems[table], wr)
+				continue
+			}
+			c.written[table+"/"+itemKey(wr.PutRequest.Item, []string{"pk"})]++
+		}
+	}
+	if len(bwo.UnprocessedItems) > 0 {
+		c.unprocessedRounds--
+	}
+	return &bwo, nil
+}
+
+func testPuts(n int) []batchPut {
+	puts := make([]batchPut, n)
+	for i := range puts {
+		puts[i] = newBatchPut("water.gov.ge", map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: strconv.Itoa(i)},
+		}, "pk")
+	}
+	return puts
+}
+
+func Test_WriteBatches(t *testing.T) {
+	ctx := context.Background()
+	backoff := batchBackoff{time.Millisecond, time.Millisecond, 3}
+	client := fakeBatchClient{unprocessedRounds: 2, written: make(map[string]int)}
+	puts := append(testPuts(60), testPuts(5)...)
+	if err := writeBatches(ctx, &client, puts, backoff, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{25, 1, 1, 25, 10}, client.batchSizes)
+	assert.Len(t, client.written, 60)
+	for key, n := range client.written {
+		assert.Equal(t, 1, n, key)
+	}
+
+	client = fakeBatchClient{unprocessedRounds: 5, written: make(map[string]int)}
+	err := writeBatches(ctx, &client, testPuts(3), backoff, slog.Default())
+	assert.ErrorIs(t, err, errUnprocessedItem)
+	assert.EqualError(t, err, "put water.gov.ge 0: "+string(errUnprocessedItem))
+
+	client = fakeBatchClient{poisoned: "30", written: make(map[string]int)}
+	err = writeBatches(ctx, &client, testPuts(40), backoff, slog.Default())
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 15)
+	assert.Len(t, client.written, 25)
+}
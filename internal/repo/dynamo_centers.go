@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+type dynamoCenter struct {
+	LocationId string
+	TitleGe    string
+	TitleLat   string
+	Lat        string
+	Lng        string
+	Problem    bool
+	FirstSeen  time.Time
+	LastSeen   time.Time
+}
+
+type dynamoCenterStatus struct {
+	LocationId string
+	Problem    bool
+	ObservedAt time.Time
+}
+
+// SaveCenters upserts the catalog entry of every center and appends to the
+// history table whenever a center's problem flag differs from the stored one.
+// Times are written in UTC, so that the history sorts by them whatever the
+// zone of the server that wrote them.
+func (w Dynamo) SaveCenters(ctx context.Context, centers ...outage.Center) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save centers: %w", err)
+	}
+	now := w.now().UTC().Format(time.RFC3339)
+	for _, center := range centers {
+		update := expression.
+			Set(expression.Name("titleGe"), expression.Value(center.Location.TitleGe)).
+			Set(expression.Name("titleLat"), expression.Value(center.Location.TitleLat)).
+			Set(expression.Name("lat"), expression.Value(center.Location.Lat)).
+			Set(expression.Name("lng"), expression.Value(center.Location.Lng)).
+			Set(expression.Name("problem"), expression.Value(center.Problem)).
+			Set(expression.Name("lastSeen"), expression.Value(now)).
+			Set(expression.Name("firstSeen"), expression.IfNotExists(expression.Name("firstSeen"), expression.Value(now)))
+		exp, err := expression.NewBuilder().WithUpdate(update).Build()
+		if err != nil {
+			return handleErr(err)
+		}
+		uo, err := w.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(w.centersTableName(center.ProviderId)),
+			Key: map[string]types.AttributeValue{
+				w.centersPartitionKey: &types.AttributeValueMemberS{Value: center.Location.Id},
+			},
+			UpdateExpression:          exp.Update(),
+			ExpressionAttributeNames:  exp.Names(),
+			ExpressionAttributeValues: exp.Values(),
+			ReturnValues:              types.ReturnValueUpdatedOld,
+		})
+		if err != nil {
+			return handleErr(err)
+		}
+		oldProblem, known := uo.Attributes["problem"].(*types.AttributeValueMemberBOOL)
+		if known && oldProblem.Value == center.Problem {
+			continue
+		}
+		if _, err := w.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(w.historyTableName(center.ProviderId)),
+			Item: map[string]types.AttributeValue{
+				w.centersPartitionKey:   &types.AttributeValueMemberS{Value: center.Location.Id},
+				w.centersHistorySortKey: &types.AttributeValueMemberS{Value: now},
+				"problem":               &types.AttributeValueMemberBOOL{Value: center.Problem},
+			},
+		}); err != nil {
+			return handleErr(err)
+		}
+	}
+	return nil
+}
+
+func (w Dynamo) GetCenters(ctx context.Context, providerId string) ([]outage.Center, error) {
+	handleErr := func(err error) ([]outage.Center, error) {
+		return nil, fmt.Errorf("get centers: %w", err)
+	}
+	var centers []dynamoCenter
+	p := dynamodb.NewScanPaginator(w.client, &dynamodb.ScanInput{
+		TableName: aws.String(w.centersTableName(providerId)),
+	})
+	for p.HasMorePages() {
+		so, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoCenter
+		if err := attributevalue.UnmarshalListOfMaps(so.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		centers = append(centers, page...)
+	}
+	result := make([]outage.Center, len(centers))
+	for i, c := range centers {
+		result[i] = outage.Center{
+			ProviderId: providerId,
+			Location: outage.Location{
+				Id:       c.LocationId,
+				TitleGe:  c.TitleGe,
+				TitleLat: c.TitleLat,
+				Lat:      c.Lat,
+				Lng:      c.Lng,
+			},
+			Problem:   c.Problem,
+			FirstSeen: c.FirstSeen,
+			LastSeen:  c.LastSeen,
+		}
+	}
+	return result, nil
+}
+
+func (w Dynamo) GetCenterHistory(ctx context.Context, providerId, locationId string) ([]outage.CenterStatus, error) {
+	handleErr := func(err error) ([]outage.CenterStatus, error) {
+		return nil, fmt.Errorf("get center history: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(w.centersPartitionKey).Equal(expression.Value(locationId))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	var history []dynamoCenterStatus
+	p := dynamodb.NewQueryPaginator(w.client, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.historyTableName(providerId)),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ScanIndexForward:          aws.Bool(true),
+	})
+	for p.HasMorePages() {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoCenterStatus
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		history = append(history, page...)
+	}
+	result := make([]outage.CenterStatus, len(history))
+	for i, h := range history {
+		result[i] = outage.CenterStatus(h)
+	}
+	return result, nil
+}
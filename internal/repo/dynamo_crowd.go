@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+type dynamoCrowdReport struct {
+	OutageRef  string
+	Reporter   string
+	Address    string
+	Status     string
+	ReportedAt time.Time
+}
+
+// SaveCrowdReport appends a report. The sort key starts with the report time
+// so the reports of an outage read in order.
+func (w Dynamo) SaveCrowdReport(ctx context.Context, r outage.CrowdReport) error {
+	reportedAt := r.ReportedAt.UTC().Format(time.RFC3339Nano)
+	if _, err := w.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(w.crowdTableName),
+		Item: map[string]types.AttributeValue{
+			w.crowdPartitionKey: &types.AttributeValueMemberS{Value: r.OutageRef},
+			w.crowdSortKey:      &types.AttributeValueMemberS{Value: reportedAt + "#" + r.Reporter},
+			"reporter":          &types.AttributeValueMemberS{Value: r.Reporter},
+			"address":           &types.AttributeValueMemberS{Value: r.Address},
+			"status":            &types.AttributeValueMemberS{Value: string(r.Status)},
+			"reportedAt":        &types.AttributeValueMemberS{Value: reportedAt},
+		},
+	}); err != nil {
+		return fmt.Errorf("save crowd report: %w", err)
+	}
+	return nil
+}
+
+func (w Dynamo) GetCrowdReports(ctx context.Context, outageRef string) ([]outage.CrowdReport, error) {
+	handleErr := func(err error) ([]outage.CrowdReport, error) {
+		return nil, fmt.Errorf("get crowd reports: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(w.crowdPartitionKey).Equal(expression.Value(outageRef))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	var reports []dynamoCrowdReport
+	p := dynamodb.NewQueryPaginator(w.client, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.crowdTableName),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ScanIndexForward:          aws.Bool(true),
+	})
+	for p.HasMorePages() {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoCrowdReport
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		reports = append(reports, page...)
+	}
+	result := make([]outage.CrowdReport, len(reports))
+	for i, r := range reports {
+		result[i] = outage.CrowdReport{
+			OutageRef:  r.OutageRef,
+			Reporter:   r.Reporter,
+			Address:    r.Address,
+			Status:     outage.ReportStatus(r.Status),
+			ReportedAt: r.ReportedAt,
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,401 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+// maxBatchGetKeys is the most keys BatchGetItem accepts at once.
+const maxBatchGetKeys = 100
+
+type dynamoAddressToken struct {
+	Token         string
+	OutageKey     string
+	LocationTitle string
+	OutageEnd     string
+}
+
+// addressPuts indexes every token of the outage's addresses. Tokens of
+// addresses that were later dropped stay behind; lookups filter them out.
+func (w Dynamo) addressPuts(o outage.Outage) []batchPut {
+	sortKey := outageSortKey(o)
+	var tokens []string
+	for _, addr := range o.AddressesGe {
+		tokens = append(tokens, address.Tokens(addr)...)
+	}
+	expiresAt := w.expiresAt(o)
+	var puts []batchPut
+	for _, token := range lo.Uniq(tokens) {
+		item := map[string]types.AttributeValue{
+			w.addressesPartitionKey: &types.AttributeValueMemberS{Value: token},
+			w.addressesSortKey:      &types.AttributeValueMemberS{Value: o.Location.TitleLat + "#" + sortKey},
+			w.outagesPartitionKey:   &types.AttributeValueMemberS{Value: o.Location.TitleLat},
+			w.outagesSortKey:        &types.AttributeValueMemberS{Value: sortKey},
+		}
+		if expiresAt != "" {
+			item[w.ttlAttribute] = &types.AttributeValueMemberN{Value: expiresAt}
+		}
+		puts = append(puts, newBatchPut(w.addressesTableName(o.ProviderId), item, w.addressesPartitionKey, w.addressesSortKey))
+	}
+	return puts
+}
+
+// deleteOutageItem removes the item of o stored under sortKey and the
+// address entries pointing at it.
+func (w Dynamo) deleteOutageItem(ctx context.Context, o outage.Outage, sortKey string) error {
+	_, err := w.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(w.outagesTableName(o.ProviderId)),
+		Key: map[string]types.AttributeValue{
+			w.outagesPartitionKey: &types.AttributeValueMemberS{Value: o.Location.TitleLat},
+			w.outagesSortKey:      &types.AttributeValueMemberS{Value: sortKey},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	for _, addr := range o.AddressesGe {
+		tokens = append(tokens, address.Tokens(addr)...)
+	}
+	for _, token := range lo.Uniq(tokens) {
+		_, err := w.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(w.addressesTableName(o.ProviderId)),
+			Key: map[string]types.AttributeValue{
+				w.addressesPartitionKey: &types.AttributeValueMemberS{Value: token},
+				w.addressesSortKey:      &types.AttributeValueMemberS{Value: o.Location.TitleLat + "#" + sortKey},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCurrentOutages returns the provider's outages of kind that have not
+// ended yet at any location, off the active index. Ongoing outages without
+// an end are indexed under openEnd, which sorts after every real end.
+func (w Dynamo) GetCurrentOutages(ctx context.Context, providerId string, kind outage.Kind) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get current outages: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("kind").Equal(expression.Value(string(kind))).
+			And(expression.Key("end").GreaterThan(expression.Value(w.now().UTC().Format(time.RFC3339))))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	outages, err := w.queryOutages(ctx, providerId, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.outagesTableName(providerId)),
+		IndexName:                 aws.String(w.activeIndexName),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, nil
+}
+
+// rewriteLegacyOutages rewrites the provider's outage items written before
+// the current layout: those without an end, which the active index leaves
+// out, and those keyed or started in their own zone rather than UTC, which a
+// refresh would save again next to the old item. An item whose sort key
+// changes is removed with its address entries once the new one is written.
+// Later starts find nothing left to rewrite.
+func (w Dynamo) rewriteLegacyOutages(ctx context.Context, providerId string) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("rewrite legacy outages of %s: %w", providerId, err)
+	}
+	exp, err := expression.NewBuilder().
+		WithFilter(expression.AttributeNotExists(expression.Name("end")).
+			Or(expression.Not(expression.Contains(expression.Name("outageStart"), "Z"))).
+			Or(expression.Not(expression.Contains(expression.Name(w.outagesSortKey), "Z")))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	p := dynamodb.NewScanPaginator(w.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(w.outagesTableName(providerId)),
+		FilterExpression:          exp.Filter(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var outages []outage.Outage
+	rekeyed := make(map[string]outage.Outage)
+	for p.HasMorePages() {
+		so, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoOutage
+		if err := attributevalue.UnmarshalListOfMaps(so.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		for _, item := range page {
+			o := item.toOutage(providerId)
+			outages = append(outages, o)
+			if item.OutageEnd != outageSortKey(o) {
+				rekeyed[item.OutageEnd] = o
+			}
+		}
+	}
+	if len(outages) == 0 {
+		return nil
+	}
+	if err := w.SaveOutages(ctx, outages...); err != nil {
+		return handleErr(err)
+	}
+	for sortKey, o := range rekeyed {
+		if err := w.deleteOutageItem(ctx, o, sortKey); err != nil {
+			return handleErr(err)
+		}
+	}
+	w.sl.Info("rewrote legacy outages", slog.String("provider", providerId), slog.Int("outages", len(outages)))
+	return nil
+}
+
+// GetOutagesPage returns up to limit of the provider's outages after cursor,
+// ended or not, in table order, and the cursor of the next page, which is
+// empty after the last one. The cursor is the last key the scan evaluated.
+func (w Dynamo) GetOutagesPage(ctx context.Context, providerId, cursor string, limit int) ([]outage.Outage, string, error) {
+	handleErr := func(err error) ([]outage.Outage, string, error) {
+		return nil, "", fmt.Errorf("get outages page: %w", err)
+	}
+	si := &dynamodb.ScanInput{
+		TableName: aws.String(w.outagesTableName(providerId)),
+		Limit:     aws.Int32(int32(limit)),
+	}
+	if cursor != "" {
+		var after map[string]string
+		if err := json.Unmarshal([]byte(cursor), &after); err != nil {
+			return handleErr(err)
+		}
+		startKey, err := attributevalue.MarshalMap(after)
+		if err != nil {
+			return handleErr(err)
+		}
+		si.ExclusiveStartKey = startKey
+	}
+	so, err := w.client.Scan(ctx, si)
+	if err != nil {
+		return handleErr(err)
+	}
+	var page []dynamoOutage
+	if err := attributevalue.UnmarshalListOfMaps(so.Items, &page); err != nil {
+		return handleErr(err)
+	}
+	outages := make([]outage.Outage, len(page))
+	for i, o := range page {
+		outages[i] = o.toOutage(providerId)
+	}
+	if len(so.LastEvaluatedKey) == 0 {
+		return outages, "", nil
+	}
+	var last map[string]string
+	if err := attributevalue.UnmarshalMap(so.LastEvaluatedKey, &last); err != nil {
+		return handleErr(err)
+	}
+	raw, err := json.Marshal(last)
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, string(raw), nil
+}
+
+// GetOutagesByAddress returns the outages with an address holding every
+// token of addr, ended or not, oldest first.
+func (w Dynamo) GetOutagesByAddress(ctx context.Context, providerId, addr string) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get outages by address: %w", err)
+	}
+	tokens := address.Tokens(addr)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	var keys map[string]dynamoAddressToken
+	for _, token := range tokens {
+		found, err := w.addressTokens(ctx, providerId, token)
+		if err != nil {
+			return handleErr(err)
+		}
+		if keys == nil {
+			keys = found
+			continue
+		}
+		for key := range keys {
+			if _, ok := found[key]; !ok {
+				delete(keys, key)
+			}
+		}
+	}
+	outages, err := w.batchGetOutages(ctx, providerId, lo.Values(keys))
+	if err != nil {
+		return handleErr(err)
+	}
+	outages = lo.Filter(outages, func(o outage.Outage, _ int) bool {
+		return hasTokens(o, tokens)
+	})
+	sort.Slice(outages, func(i, j int) bool {
+		return outages[i].Start.Before(outages[j].Start)
+	})
+	return outages, nil
+}
+
+// hasTokens tells whether one of the outage's addresses holds every token.
+func hasTokens(o outage.Outage, tokens []string) bool {
+	return lo.SomeBy(o.AddressesGe, func(a string) bool {
+		return len(lo.Intersect(address.Tokens(a), tokens)) == len(tokens)
+	})
+}
+
+func (w Dynamo) addressTokens(ctx context.Context, providerId, token string) (map[string]dynamoAddressToken, error) {
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(w.addressesPartitionKey).Equal(expression.Value(token))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]dynamoAddressToken)
+	p := dynamodb.NewQueryPaginator(w.client, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.addressesTableName(providerId)),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	for p.HasMorePages() {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var page []dynamoAddressToken
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return nil, err
+		}
+		for _, t := range page {
+			found[t.OutageKey] = t
+		}
+	}
+	return found, nil
+}
+
+// batchGetOutages reads outages by key, 100 at a time, retrying the keys
+// DynamoDB leaves unprocessed with the batch write backoff.
+func (w Dynamo) batchGetOutages(ctx context.Context, providerId string, tokens []dynamoAddressToken) ([]outage.Outage, error) {
+	tableName := w.outagesTableName(providerId)
+	var items []map[string]types.AttributeValue
+	for _, chunk := range lo.Chunk(tokens, maxBatchGetKeys) {
+		keys := make([]map[string]types.AttributeValue, len(chunk))
+		for i, t := range chunk {
+			keys[i] = map[string]types.AttributeValue{
+				w.outagesPartitionKey: &types.AttributeValueMemberS{Value: t.LocationTitle},
+				w.outagesSortKey:      &types.AttributeValueMemberS{Value: t.OutageEnd},
+			}
+		}
+		requests := map[string]types.KeysAndAttributes{tableName: {Keys: keys}}
+		for attempt := 0; len(requests) > 0; attempt++ {
+			if attempt >= w.batchBackoff.attempts {
+				return nil, fmt.Errorf("%s: %d keys: %w", tableName, len(requests[tableName].Keys), errUnprocessedItem)
+			}
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(w.batchBackoff.delay(attempt - 1)):
+				}
+			}
+			bgo, err := w.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: requests})
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, bgo.Responses[tableName]...)
+			requests = bgo.UnprocessedKeys
+		}
+	}
+	var outages []dynamoOutage
+	if err := attributevalue.UnmarshalListOfMaps(items, &outages); err != nil {
+		return nil, err
+	}
+	result := make([]outage.Outage, len(outages))
+	for i, o := range outages {
+		result[i] = o.toOutage(providerId)
+	}
+	return result, nil
+}
+
+// GetOutagesStartedBetween scans the provider's outages for the ones that
+// started in [from, to). It reads the whole table and is meant for the
+// archive export, not for requests. Items written before starts were kept
+// in UTC hold them in their own zone, so the filter is widened by the
+// largest offset and the bounds are applied again on the parsed starts.
+func (w Dynamo) GetOutagesStartedBetween(ctx context.Context, providerId string, from, to time.Time) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get outages started between: %w", err)
+	}
+	started := expression.Name("outageStart")
+	exp, err := expression.NewBuilder().
+		WithFilter(started.GreaterThanEqual(expression.Value(from.UTC().Add(-maxZoneOffset).Format(time.RFC3339))).
+			And(started.LessThan(expression.Value(to.UTC().Add(maxZoneOffset).Format(time.RFC3339))))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	outages, err := w.scanOutages(ctx, providerId, exp)
+	if err != nil {
+		return handleErr(err)
+	}
+	result := lo.Filter(outages, func(o outage.Outage, _ int) bool {
+		return !o.Start.Before(from) && o.Start.Before(to)
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result, nil
+}
+
+// maxZoneOffset bounds how far a start written in its own zone sorts from
+// the same start in UTC.
+const maxZoneOffset = 14 * time.Hour
+
+// scanOutages reads every outage item of a provider that matches the
+// filter of exp.
+func (w Dynamo) scanOutages(ctx context.Context, providerId string, exp expression.Expression) ([]outage.Outage, error) {
+	var outages []dynamoOutage
+	p := dynamodb.NewScanPaginator(w.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(w.outagesTableName(providerId)),
+		FilterExpression:          exp.Filter(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	for p.HasMorePages() {
+		so, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var page []dynamoOutage
+		if err := attributevalue.UnmarshalListOfMaps(so.Items, &page); err != nil {
+			return nil, err
+		}
+		outages = append(outages, page...)
+	}
+	result := make([]outage.Outage, len(outages))
+	for i, o := range outages {
+		result[i] = o.toOutage(providerId)
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AcquireLease takes or renews a lease in the lease table with a
+// conditional update, the same way DynamoChangeFeed leases shards.
+func (w Dynamo) AcquireLease(ctx context.Context, name, owner string, now, until time.Time) (bool, error) {
+	ownerName, expiry := expression.Name("owner"), expression.Name("leaseExpiry")
+	exp, err := expression.NewBuilder().
+		WithUpdate(w.leaseTTL(expression.Set(ownerName, expression.Value(owner)).
+			Set(expiry, expression.Value(until.UnixMilli())), now)).
+		WithCondition(expression.AttributeNotExists(expression.Name(w.leasesPartitionKey)).
+			Or(ownerName.Equal(expression.Value(owner)), expiry.LessThanEqual(expression.Value(now.UnixMilli())))).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("acquire lease %s: %w", name, err)
+	}
+	_, err = w.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(w.leasesTableName),
+		Key:                       w.leaseKey(name),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var held *types.ConditionalCheckFailedException
+	if errors.As(err, &held) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("acquire lease %s: %w", name, err)
+	}
+	return true, nil
+}
+
+func (w Dynamo) ReleaseLease(ctx context.Context, name, owner string) error {
+	exp, err := expression.NewBuilder().
+		WithCondition(expression.Name("owner").Equal(expression.Value(owner))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("release lease %s: %w", name, err)
+	}
+	_, err = w.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(w.leasesTableName),
+		Key:                       w.leaseKey(name),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var taken *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &taken) {
+		return fmt.Errorf("release lease %s: %w", name, err)
+	}
+	return nil
+}
+
+func (w Dynamo) leaseKey(name string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		w.leasesPartitionKey: &types.AttributeValueMemberS{Value: name},
+	}
+}
+
+// streamRetention is how long a stream keeps its records and shards.
+const streamRetention = 24 * time.Hour
+
+// leaseTTL pushes the TTL of a lease back on every renewal, so the leases of
+// stopped replicas and the checkpoints of trimmed shards expire. A
+// checkpoint lives at least as long as its shard.
+func (w Dynamo) leaseTTL(update expression.UpdateBuilder, now time.Time) expression.UpdateBuilder {
+	if w.retention <= 0 {
+		return update
+	}
+	return update.Set(expression.Name(w.ttlAttribute), expression.Value(now.Add(max(w.retention, streamRetention)).Unix()))
+}
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+func (w Dynamo) SaveManualOutage(ctx context.Context, o outage.Outage) error {
+	if _, err := w.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(w.manualTableName),
+		Item:      w.outageItem(o),
+	}); err != nil {
+		return fmt.Errorf("save manual outage %s: %w", o.Id, err)
+	}
+	return nil
+}
+
+func (w Dynamo) GetManualOutage(ctx context.Context, id string) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("get manual outage %s: %w", id, err)
+	}
+	gio, err := w.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(w.manualTableName),
+		Key: map[string]types.AttributeValue{
+			w.manualPartitionKey: &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return handleErr(err)
+	}
+	if gio.Item == nil {
+		return handleErr(outage.ErrNotFound)
+	}
+	var o dynamoOutage
+	if err := attributevalue.UnmarshalMap(gio.Item, &o); err != nil {
+		return handleErr(err)
+	}
+	return o.toOutage(outage.ManualProviderId), nil
+}
+
+func (w Dynamo) GetManualOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get manual outages: %w", err)
+	}
+	var outages []dynamoOutage
+	p := dynamodb.NewScanPaginator(w.client, &dynamodb.ScanInput{
+		TableName: aws.String(w.manualTableName),
+	})
+	for p.HasMorePages() {
+		so, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoOutage
+		if err := attributevalue.UnmarshalListOfMaps(so.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		outages = append(outages, page...)
+	}
+	result := make([]outage.Outage, len(outages))
+	for i, o := range outages {
+		result[i] = o.toOutage(outage.ManualProviderId)
+	}
+	return result, nil
+}
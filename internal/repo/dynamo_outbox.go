@@ -0,0 +1,307 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// The outbox index is sparse: only notifications waiting for delivery carry
+// the pending attribute, so the index holds exactly the pending ones sorted
+// by their next attempt.
+const outboxPending = "1"
+
+type dynamoNotification struct {
+	Id            string
+	OutageRef     string
+	Changed       []string
+	Outage        string
+	CreatedAt     string
+	Attempts      int
+	NextAttemptAt string
+	LastError     string
+	ClaimedUntil  int64
+}
+
+// SaveOutagesNotifying writes every outage that has a notification together
+// with it in a transaction, conditional on the notification not being
+// queued yet. When it is, the transaction is cancelled and the outage is
+// written like the rest, in batches with the address tokens.
+func (w Dynamo) SaveOutagesNotifying(ctx context.Context, outages []outage.Outage, notifications []outage.Notification) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save outages notifying: %w", err)
+	}
+	notified := make(map[string]bool, len(notifications))
+	var puts []batchPut
+	for _, n := range notifications {
+		queued, err := w.saveOutageNotifying(ctx, n)
+		if err != nil {
+			return handleErr(err)
+		}
+		if !queued {
+			puts = append(puts, newBatchPut(w.outagesTableName(n.Outage.ProviderId), w.outageItem(n.Outage), w.outagesPartitionKey, w.outagesSortKey))
+		}
+		notified[n.OutageRef] = true
+	}
+	for _, o := range outages {
+		if !notified[o.Ref()] {
+			puts = append(puts, newBatchPut(w.outagesTableName(o.ProviderId), w.outageItem(o), w.outagesPartitionKey, w.outagesSortKey))
+		}
+		puts = append(puts, w.addressPuts(o)...)
+	}
+	if err := writeBatches(ctx, w.client, puts, w.batchBackoff, w.sl); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+// saveOutageNotifying reports false when the notification was queued
+// before and nothing was written.
+func (w Dynamo) saveOutageNotifying(ctx context.Context, n outage.Notification) (bool, error) {
+	item, err := w.notificationItem(n)
+	if err != nil {
+		return false, err
+	}
+	_, err = w.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName: aws.String(w.outagesTableName(n.Outage.ProviderId)),
+				Item:      w.outageItem(n.Outage),
+			}},
+			{Put: &types.Put{
+				TableName:                aws.String(w.outboxTableName),
+				Item:                     item,
+				ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+				ExpressionAttributeNames: map[string]string{"#id": w.outboxPartitionKey},
+			}},
+		},
+	})
+	var cancelled *types.TransactionCanceledException
+	if errors.As(err, &cancelled) && len(cancelled.CancellationReasons) == 2 &&
+		aws.ToString(cancelled.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("notification %s: %w", n.Id, err)
+	}
+	return true, nil
+}
+
+func (w Dynamo) SaveNotifications(ctx context.Context, notifications ...outage.Notification) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save notifications: %w", err)
+	}
+	for _, n := range notifications {
+		item, err := w.notificationItem(n)
+		if err != nil {
+			return handleErr(err)
+		}
+		_, err = w.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                aws.String(w.outboxTableName),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+			ExpressionAttributeNames: map[string]string{"#id": w.outboxPartitionKey},
+		})
+		var queued *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &queued) {
+			return handleErr(fmt.Errorf("notification %s: %w", n.Id, err))
+		}
+	}
+	return nil
+}
+
+func (w Dynamo) notificationItem(n outage.Notification) (map[string]types.AttributeValue, error) {
+	raw, err := json.Marshal(n.Outage)
+	if err != nil {
+		return nil, err
+	}
+	changed := make([]types.AttributeValue, len(n.Changed))
+	for i, field := range n.Changed {
+		changed[i] = &types.AttributeValueMemberS{Value: field}
+	}
+	item := map[string]types.AttributeValue{
+		w.outboxPartitionKey: &types.AttributeValueMemberS{Value: n.Id},
+		"outageRef":          &types.AttributeValueMemberS{Value: n.OutageRef},
+		"changed":            &types.AttributeValueMemberL{Value: changed},
+		"outage":             &types.AttributeValueMemberS{Value: string(raw)},
+		"createdAt":          &types.AttributeValueMemberS{Value: n.CreatedAt.UTC().Format(revisionTimeLayout)},
+		"attempts":           &types.AttributeValueMemberN{Value: strconv.Itoa(n.Attempts)},
+		"nextAttemptAt":      &types.AttributeValueMemberS{Value: n.NextAttemptAt.UTC().Format(revisionTimeLayout)},
+		"lastError":          &types.AttributeValueMemberS{Value: n.LastError},
+		"pending":            &types.AttributeValueMemberS{Value: outboxPending},
+	}
+	if w.retention > 0 {
+		item[w.ttlAttribute] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(n.CreatedAt.Add(w.retention).Unix(), 10),
+		}
+	}
+	return item, nil
+}
+
+// ClaimNotifications reads the due notifications off the outbox index and
+// claims them one by one with a conditional update, skipping any another
+// owner claimed in between.
+func (w Dynamo) ClaimNotifications(ctx context.Context, owner string, now, until time.Time, limit int) ([]outage.Notification, error) {
+	handleErr := func(err error) ([]outage.Notification, error) {
+		return nil, fmt.Errorf("claim notifications: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("pending").Equal(expression.Value(outboxPending)).
+			And(expression.Key("nextAttemptAt").LessThanEqual(expression.Value(now.UTC().Format(revisionTimeLayout))))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	p := dynamodb.NewQueryPaginator(w.client, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.outboxTableName),
+		IndexName:                 aws.String(w.outboxIndexName),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ScanIndexForward:          aws.Bool(true),
+	})
+	var claimed []outage.Notification
+	for p.HasMorePages() && len(claimed) < limit {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoNotification
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		for _, dn := range page {
+			if len(claimed) == limit {
+				break
+			}
+			if dn.ClaimedUntil > now.UnixMilli() {
+				continue
+			}
+			ok, err := w.claimNotification(ctx, dn.Id, owner, now, until)
+			if err != nil {
+				return handleErr(err)
+			}
+			if !ok {
+				continue
+			}
+			n, err := dn.toNotification()
+			if err != nil {
+				return handleErr(err)
+			}
+			claimed = append(claimed, n)
+		}
+	}
+	return claimed, nil
+}
+
+func (w Dynamo) claimNotification(ctx context.Context, id, owner string, now, until time.Time) (bool, error) {
+	claimedUntil := expression.Name("claimedUntil")
+	exp, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("claimedBy"), expression.Value(owner)).
+			Set(claimedUntil, expression.Value(until.UnixMilli()))).
+		WithCondition(expression.AttributeExists(expression.Name("pending")).
+			And(expression.AttributeNotExists(claimedUntil).Or(claimedUntil.LessThanEqual(expression.Value(now.UnixMilli()))))).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	_, err = w.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(w.outboxTableName),
+		Key:                       w.notificationKey(id),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var taken *types.ConditionalCheckFailedException
+	if errors.As(err, &taken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("notification %s: %w", id, err)
+	}
+	return true, nil
+}
+
+func (w Dynamo) CompleteNotification(ctx context.Context, id string, deliveredAt time.Time) error {
+	update := expression.Set(expression.Name("deliveredAt"), expression.Value(deliveredAt.UTC().Format(revisionTimeLayout))).
+		Remove(expression.Name("pending")).
+		Remove(expression.Name("claimedBy")).
+		Remove(expression.Name("claimedUntil"))
+	if err := w.updateNotification(ctx, id, update); err != nil {
+		return fmt.Errorf("complete notification %s: %w", id, err)
+	}
+	return nil
+}
+
+func (w Dynamo) RetryNotification(ctx context.Context, id string, nextAttemptAt time.Time, lastErr string) error {
+	update := expression.Set(expression.Name("nextAttemptAt"), expression.Value(nextAttemptAt.UTC().Format(revisionTimeLayout))).
+		Set(expression.Name("lastError"), expression.Value(lastErr)).
+		Add(expression.Name("attempts"), expression.Value(1)).
+		Remove(expression.Name("claimedBy")).
+		Remove(expression.Name("claimedUntil"))
+	if err := w.updateNotification(ctx, id, update); err != nil {
+		return fmt.Errorf("retry notification %s: %w", id, err)
+	}
+	return nil
+}
+
+func (w Dynamo) updateNotification(ctx context.Context, id string, update expression.UpdateBuilder) error {
+	exp, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(expression.AttributeExists(expression.Name(w.outboxPartitionKey))).
+		Build()
+	if err != nil {
+		return err
+	}
+	_, err = w.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(w.outboxTableName),
+		Key:                       w.notificationKey(id),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var missing *types.ConditionalCheckFailedException
+	if errors.As(err, &missing) {
+		return outage.ErrNoNotification
+	}
+	return err
+}
+
+func (w Dynamo) notificationKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		w.outboxPartitionKey: &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+func (dn dynamoNotification) toNotification() (outage.Notification, error) {
+	n := outage.Notification{
+		Id:        dn.Id,
+		OutageRef: dn.OutageRef,
+		Changed:   dn.Changed,
+		Attempts:  dn.Attempts,
+		LastError: dn.LastError,
+	}
+	if err := json.Unmarshal([]byte(dn.Outage), &n.Outage); err != nil {
+		return outage.Notification{}, err
+	}
+	var err error
+	if n.CreatedAt, err = time.Parse(revisionTimeLayout, dn.CreatedAt); err != nil {
+		return outage.Notification{}, err
+	}
+	if n.NextAttemptAt, err = time.Parse(revisionTimeLayout, dn.NextAttemptAt); err != nil {
+		return outage.Notification{}, err
+	}
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+// revisionTimeLayout keeps nanoseconds at a fixed width, so observation
+// times sort as strings; RFC3339Nano trims trailing zeros.
+const revisionTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+type dynamoRevision struct {
+	OutageRef  string
+	ObservedAt time.Time
+	Changed    []string
+	Outage     string
+}
+
+// SaveRevision appends a revision. The outage is stored as JSON, the sort
+// key is the observation time so revisions read in order. locationKey feeds
+// the index as-of queries read.
+func (w Dynamo) SaveRevision(ctx context.Context, r outage.Revision) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save revision: %w", err)
+	}
+	raw, err := json.Marshal(r.Outage)
+	if err != nil {
+		return handleErr(err)
+	}
+	changed := make([]types.AttributeValue, len(r.Changed))
+	for i, field := range r.Changed {
+		changed[i] = &types.AttributeValueMemberS{Value: field}
+	}
+	item := map[string]types.AttributeValue{
+		w.revisionsPartitionKey: &types.AttributeValueMemberS{Value: r.OutageRef},
+		w.revisionsSortKey:      &types.AttributeValueMemberS{Value: r.ObservedAt.UTC().Format(revisionTimeLayout)},
+		"changed":               &types.AttributeValueMemberL{Value: changed},
+		"outage":                &types.AttributeValueMemberS{Value: string(raw)},
+		"locationKey":           &types.AttributeValueMemberS{Value: revisionLocationKey(r.Outage.ProviderId, r.Outage.Location.TitleLat)},
+	}
+	// A revision goes with its outage.
+	if expiresAt := w.expiresAt(r.Outage); expiresAt != "" {
+		item[w.ttlAttribute] = &types.AttributeValueMemberN{Value: expiresAt}
+	}
+	if _, err := w.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(w.revisionsTableName),
+		Item:      item,
+	}); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+func revisionLocationKey(providerId, titleLat string) string {
+	return providerId + "/" + titleLat
+}
+
+func (w Dynamo) GetRevisions(ctx context.Context, outageRef string) ([]outage.Revision, error) {
+	handleErr := func(err error) ([]outage.Revision, error) {
+		return nil, fmt.Errorf("get revisions: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(w.revisionsPartitionKey).Equal(expression.Value(outageRef))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	revisions, err := w.queryRevisions(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.revisionsTableName),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ScanIndexForward:          aws.Bool(true),
+	})
+	if err != nil {
+		return handleErr(err)
+	}
+	return revisions, nil
+}
+
+// GetRevisionsAsOf returns the latest revision observed at or before asOf
+// of every outage at a location.
+func (w Dynamo) GetRevisionsAsOf(ctx context.Context, providerId, titleLat string, asOf time.Time) ([]outage.Revision, error) {
+	handleErr := func(err error) ([]outage.Revision, error) {
+		return nil, fmt.Errorf("get revisions as of: %w", err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("locationKey").Equal(expression.Value(revisionLocationKey(providerId, titleLat))).
+			And(expression.Key(w.revisionsSortKey).LessThanEqual(expression.Value(asOf.UTC().Format(revisionTimeLayout))))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	revisions, err := w.queryRevisions(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.revisionsTableName),
+		IndexName:                 aws.String(w.revisionsIndexName),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ScanIndexForward:          aws.Bool(true),
+	})
+	if err != nil {
+		return handleErr(err)
+	}
+	latest := make(map[string]outage.Revision)
+	for _, r := range revisions {
+		latest[r.OutageRef] = r
+	}
+	result := lo.Values(latest)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].OutageRef < result[j].OutageRef
+	})
+	return result, nil
+}
+
+func (w Dynamo) queryRevisions(ctx context.Context, qi *dynamodb.QueryInput) ([]outage.Revision, error) {
+	var revisions []dynamoRevision
+	p := dynamodb.NewQueryPaginator(w.client, qi)
+	for p.HasMorePages() {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var page []dynamoRevision
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, page...)
+	}
+	result := make([]outage.Revision, len(revisions))
+	for i, r := range revisions {
+		result[i] = outage.Revision{
+			OutageRef:  r.OutageRef,
+			ObservedAt: r.ObservedAt,
+			Changed:    r.Changed,
+		}
+		if len(result[i].Changed) == 0 {
+			result[i].Changed = nil
+		}
+		if err := json.Unmarshal([]byte(r.Outage), &result[i].Outage); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+type dynamoRun struct {
+	ProviderId string
+	StartedAt  string
+	EndedAt    string
+	Reason     string
+	Pages      int
+	CacheHits  int
+	Parsed     int
+	Saved      int
+	Errors     string
+}
+
+// SaveRun puts a run under its provider, sorted by its start in
+// revisionTimeLayout. The errors are stored as JSON.
+func (w Dynamo) SaveRun(ctx context.Context, r outage.Run) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save run %s: %w", r.ProviderId, err)
+	}
+	errs, err := json.Marshal(r.Errors)
+	if err != nil {
+		return handleErr(err)
+	}
+	item := map[string]types.AttributeValue{
+		w.runsPartitionKey: &types.AttributeValueMemberS{Value: r.ProviderId},
+		w.runsSortKey:      &types.AttributeValueMemberS{Value: r.StartedAt.UTC().Format(revisionTimeLayout)},
+		"endedAt":          &types.AttributeValueMemberS{Value: r.EndedAt.UTC().Format(revisionTimeLayout)},
+		"reason":           &types.AttributeValueMemberS{Value: string(r.Reason)},
+		"pages":            &types.AttributeValueMemberN{Value: strconv.Itoa(r.Pages)},
+		"cacheHits":        &types.AttributeValueMemberN{Value: strconv.Itoa(r.CacheHits)},
+		"parsed":           &types.AttributeValueMemberN{Value: strconv.Itoa(r.Parsed)},
+		"saved":            &types.AttributeValueMemberN{Value: strconv.Itoa(r.Saved)},
+		"errors":           &types.AttributeValueMemberS{Value: string(errs)},
+	}
+	if w.retention > 0 {
+		item[w.ttlAttribute] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(r.StartedAt.Add(w.retention).Unix(), 10),
+		}
+	}
+	if _, err := w.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(w.runsTableName),
+		Item:      item,
+	}); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+// GetRuns reads the provider's partition backwards, newest run first.
+func (w Dynamo) GetRuns(ctx context.Context, providerId string, limit int) ([]outage.Run, error) {
+	handleErr := func(err error) ([]outage.Run, error) {
+		return nil, fmt.Errorf("get runs %s: %w", providerId, err)
+	}
+	exp, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(w.runsPartitionKey).Equal(expression.Value(providerId))).
+		Build()
+	if err != nil {
+		return handleErr(err)
+	}
+	p := dynamodb.NewQueryPaginator(w.client, &dynamodb.QueryInput{
+		TableName:                 aws.String(w.runsTableName),
+		KeyConditionExpression:    exp.KeyCondition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(int32(limit)),
+	})
+	var runs []outage.Run
+	for p.HasMorePages() && len(runs) < limit {
+		qo, err := p.NextPage(ctx)
+		if err != nil {
+			return handleErr(err)
+		}
+		var page []dynamoRun
+		if err := attributevalue.UnmarshalListOfMaps(qo.Items, &page); err != nil {
+			return handleErr(err)
+		}
+		for _, dr := range page {
+			if len(runs) == limit {
+				break
+			}
+			r, err := dr.toRun()
+			if err != nil {
+				return handleErr(err)
+			}
+			runs = append(runs, r)
+		}
+	}
+	return runs, nil
+}
+
+func (dr dynamoRun) toRun() (outage.Run, error) {
+	r := outage.Run{
+		ProviderId: dr.ProviderId,
+		Reason:     outage.RunReason(dr.Reason),
+		Pages:      dr.Pages,
+		CacheHits:  dr.CacheHits,
+		Parsed:     dr.Parsed,
+		Saved:      dr.Saved,
+	}
+	if err := json.Unmarshal([]byte(dr.Errors), &r.Errors); err != nil {
+		return outage.Run{}, err
+	}
+	var err error
+	if r.StartedAt, err = time.Parse(revisionTimeLayout, dr.StartedAt); err != nil {
+		return outage.Run{}, err
+	}
+	if r.EndedAt, err = time.Parse(revisionTimeLayout, dr.EndedAt); err != nil {
+		return outage.Run{}, err
+	}
+	return r, nil
+}
+
+// refreshRequestKey names the item of a provider's pending refresh request
+// in the lease table, next to the leases of the replicas that poll it.
+func refreshRequestKey(providerId string) string {
+	return "refresh/" + providerId
+}
+
+func (w Dynamo) RequestRefresh(ctx context.Context, providerId string, at time.Time) error {
+	item := w.leaseKey(refreshRequestKey(providerId))
+	item["requestedAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(at.UnixMilli(), 10)}
+	if w.retention > 0 {
+		item[w.ttlAttribute] = &types.AttributeValueMemberN{Value: strconv.FormatInt(at.Add(w.retention).Unix(), 10)}
+	}
+	if _, err := w.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(w.leasesTableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("request refresh %s: %w", providerId, err)
+	}
+	return nil
+}
+
+// TakeRefreshRequest deletes the request and reads it back in the same
+// call, so that only one of the replicas polling at once takes it.
+func (w Dynamo) TakeRefreshRequest(ctx context.Context, providerId string) (bool, error) {
+	do, err := w.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String(w.leasesTableName),
+		Key:          w.leaseKey(refreshRequestKey(providerId)),
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return false, fmt.Errorf("take refresh request %s: %w", providerId, err)
+	}
+	return len(do.Attributes) > 0, nil
+}
@@ -0,0 +1,326 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+const (
+	changeFeedLeaseDuration = 30 * time.Second
+	changeFeedPollInterval  = time.Second
+	// shardEnd is the checkpoint of a shard read to its end.
+	shardEnd = "SHARD_END"
+)
+
+// streamsClient is the part of the DynamoDB Streams API the change feed
+// reads with.
+type streamsClient interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// tablesClient is the part of the DynamoDB API the change feed finds the
+// streams and keeps the shard leases with.
+type tablesClient interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// DynamoChangeFeed turns the streams of the outage and manual tables into
+// outage changes. Every shard is read by the one replica holding its lease
+// in the lease table, which also keeps the sequence number of the last
+// record handled. The checkpoint moves past a record only after it was
+// handled and only while the lease is held, so each shard position is
+// handled once, or again after a crash between handling and checkpointing.
+// Children wait until their parent shard is read to the end, keeping the
+// changes of an item in order.
+type DynamoChangeFeed struct {
+	dynamo        Dynamo
+	streams       streamsClient
+	tables        tablesClient
+	providerIds   []string
+	owner         string
+	leaseDuration time.Duration
+	pollInterval  time.Duration
+}
+
+// NewDynamoChangeFeed connects to DynamoDB Streams the way NewDynamo
+// connects to DynamoDB. dynamo has to have streams on, and owner names this
+// replica in the leases.
+func NewDynamoChangeFeed(ctx context.Context, accessKey, secretAccessKey, region, endpoint string, dynamo Dynamo, providerIds []string, owner string) (DynamoChangeFeed, error) {
+	conf, err := loadAWSConfig(ctx, accessKey, secretAccessKey, region)
+	if err != nil {
+		return DynamoChangeFeed{}, fmt.Errorf("new dynamo change feed: %w", err)
+	}
+	client := dynamodbstreams.NewFromConfig(conf, func(o *dynamodbstreams.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return newDynamoChangeFeed(client, dynamo.client, dynamo, providerIds, owner), nil
+}
+
+func newDynamoChangeFeed(streams streamsClient, tables tablesClient, dynamo Dynamo, providerIds []string, owner string) DynamoChangeFeed {
+	return DynamoChangeFeed{dynamo, streams, tables, providerIds, owner, changeFeedLeaseDuration, changeFeedPollInterval}
+}
+
+// Run hands every change to handle until ctx is done. A change handle fails
+// on is retried from the same position on the next poll.
+func (f DynamoChangeFeed) Run(ctx context.Context, handle func(context.Context, outage.Change) error) {
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := f.Poll(ctx, handle); err != nil {
+			f.dynamo.sl.Error("poll change feed", slog.Any("err", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads every shard it can lease up to its latest record.
+func (f DynamoChangeFeed) Poll(ctx context.Context, handle func(context.Context, outage.Change) error) error {
+	tables := map[string]string{f.dynamo.manualTableName: outage.ManualProviderId}
+	for _, providerId := range f.providerIds {
+		tables[f.dynamo.outagesTableName(providerId)] = providerId
+	}
+	var errs []error
+	for tableName, providerId := range tables {
+		if err := f.pollTable(ctx, tableName, providerId, handle); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tableName, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("poll change feed: %w", err)
+	}
+	return nil
+}
+
+func (f DynamoChangeFeed) pollTable(ctx context.Context, tableName, providerId string, handle func(context.Context, outage.Change) error) error {
+	dto, err := f.tables.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return err
+	}
+	streamArn := aws.ToString(dto.Table.LatestStreamArn)
+	if streamArn == "" {
+		return errNoStream
+	}
+	shards, err := f.shards(ctx, streamArn)
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[aws.ToString(shard.ShardId)] = true
+	}
+	finished := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		if parent := aws.ToString(shard.ParentShardId); listed[parent] && !finished[parent] {
+			continue
+		}
+		done, err := f.readShard(ctx, streamArn, aws.ToString(shard.ShardId), providerId, handle)
+		if err != nil {
+			return err
+		}
+		finished[aws.ToString(shard.ShardId)] = done
+	}
+	return nil
+}
+
+// shards lists the shards of a stream, parents before their children.
+func (f DynamoChangeFeed) shards(ctx context.Context, streamArn string) ([]streamtypes.Shard, error) {
+	var (
+		shards  []streamtypes.Shard
+		startId *string
+	)
+	for {
+		dso, err := f.streams.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(streamArn),
+			ExclusiveStartShardId: startId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, dso.StreamDescription.Shards...)
+		if startId = dso.StreamDescription.LastEvaluatedShardId; startId == nil {
+			return shards, nil
+		}
+	}
+}
+
+// readShard handles the records of a shard past its checkpoint and tells
+// whether the shard is read to its end. A shard leased to another replica
+// is left alone.
+func (f DynamoChangeFeed) readShard(ctx context.Context, streamArn, shardId, providerId string, handle func(context.Context, outage.Change) error) (bool, error) {
+	leaseKey := streamArn + "/" + shardId
+	checkpoint, leased, err := f.acquireLease(ctx, leaseKey)
+	if err != nil || !leased {
+		return false, err
+	}
+	if checkpoint == shardEnd {
+		return true, nil
+	}
+	gsii := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(streamArn),
+		ShardId:           aws.String(shardId),
+		ShardIteratorType: streamtypes.ShardIteratorTypeTrimHorizon,
+	}
+	if checkpoint != "" {
+		gsii.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+		gsii.SequenceNumber = aws.String(checkpoint)
+	}
+	gsio, err := f.streams.GetShardIterator(ctx, gsii)
+	if err != nil {
+		return false, err
+	}
+	iterator := gsio.ShardIterator
+	for iterator != nil {
+		gro, err := f.streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: iterator})
+		if err != nil {
+			return false, err
+		}
+		for _, record := range gro.Records {
+			change, err := f.dynamo.changeOf(record, providerId)
+			if err != nil {
+				return false, err
+			}
+			if err := handle(ctx, change); err != nil {
+				return false, err
+			}
+			if err := f.checkpoint(ctx, leaseKey, aws.ToString(record.Dynamodb.SequenceNumber)); err != nil {
+				return false, err
+			}
+		}
+		if len(gro.Records) == 0 && gro.NextShardIterator != nil {
+			// Caught up with an open shard.
+			return false, nil
+		}
+		iterator = gro.NextShardIterator
+	}
+	if err := f.checkpoint(ctx, leaseKey, shardEnd); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// changeOf decodes the old and new images of a stream record.
+func (w Dynamo) changeOf(record streamtypes.Record, providerId string) (outage.Change, error) {
+	change := outage.Change{ObservedAt: w.now()}
+	if record.Dynamodb == nil {
+		return change, nil
+	}
+	if at := record.Dynamodb.ApproximateCreationDateTime; at != nil {
+		change.ObservedAt = *at
+	}
+	for _, image := range []struct {
+		from map[string]streamtypes.AttributeValue
+		to   *outage.Outage
+	}{
+		{record.Dynamodb.OldImage, &change.Old},
+		{record.Dynamodb.NewImage, &change.New},
+	} {
+		if len(image.from) == 0 {
+			continue
+		}
+		item, err := attributevalue.FromDynamoDBStreamsMap(image.from)
+		if err != nil {
+			return outage.Change{}, err
+		}
+		var o dynamoOutage
+		if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+			return outage.Change{}, err
+		}
+		*image.to = o.toOutage(providerId)
+	}
+	return change, nil
+}
+
+type dynamoLease struct {
+	LeaseKey    string
+	Owner       string
+	LeaseExpiry int64
+	Checkpoint  string
+}
+
+// acquireLease takes or renews the lease of a shard unless another owner
+// holds it unexpired, and returns the shard's checkpoint.
+func (f DynamoChangeFeed) acquireLease(ctx context.Context, leaseKey string) (string, bool, error) {
+	now := f.dynamo.now()
+	owner, expiry := expression.Name("owner"), expression.Name("leaseExpiry")
+	exp, err := expression.NewBuilder().
+		WithUpdate(f.dynamo.leaseTTL(expression.Set(owner, expression.Value(f.owner)).
+			Set(expiry, expression.Value(now.Add(f.leaseDuration).UnixMilli())), now)).
+		WithCondition(expression.AttributeNotExists(expression.Name(f.dynamo.leasesPartitionKey)).
+			Or(owner.Equal(expression.Value(f.owner)), expiry.LessThan(expression.Value(now.UnixMilli())))).
+		Build()
+	if err != nil {
+		return "", false, err
+	}
+	uio, err := f.tables.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(f.dynamo.leasesTableName),
+		Key:                       f.dynamo.leaseKey(leaseKey),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	var held *types.ConditionalCheckFailedException
+	if errors.As(err, &held) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("acquire lease %s: %w", leaseKey, err)
+	}
+	var lease dynamoLease
+	if err := attributevalue.UnmarshalMap(uio.Attributes, &lease); err != nil {
+		return "", false, fmt.Errorf("acquire lease %s: %w", leaseKey, err)
+	}
+	return lease.Checkpoint, true, nil
+}
+
+// checkpoint records the position of a shard and renews its lease, failing
+// with errLeaseLost once another owner took the lease over.
+func (f DynamoChangeFeed) checkpoint(ctx context.Context, leaseKey, sequenceNumber string) error {
+	now := f.dynamo.now()
+	exp, err := expression.NewBuilder().
+		WithUpdate(f.dynamo.leaseTTL(expression.Set(expression.Name("checkpoint"), expression.Value(sequenceNumber)).
+			Set(expression.Name("leaseExpiry"), expression.Value(now.Add(f.leaseDuration).UnixMilli())), now)).
+		WithCondition(expression.Name("owner").Equal(expression.Value(f.owner))).
+		Build()
+	if err != nil {
+		return err
+	}
+	_, err = f.tables.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(f.dynamo.leasesTableName),
+		Key:                       f.dynamo.leaseKey(leaseKey),
+		UpdateExpression:          exp.Update(),
+		ConditionExpression:       exp.Condition(),
+		ExpressionAttributeNames:  exp.Names(),
+		ExpressionAttributeValues: exp.Values(),
+	})
+	var lost *types.ConditionalCheckFailedException
+	if errors.As(err, &lost) {
+		return fmt.Errorf("checkpoint %s: %w", leaseKey, errLeaseLost)
+	}
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", leaseKey, err)
+	}
+	return nil
+}
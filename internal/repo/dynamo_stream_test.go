@@ -0,0 +1,353 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DynamoChangeOf(t *testing.T) {
+	d := newDynamo(nil, "", func() time.Time { return testNow }, slog.Default())
+	observedAt := testNow.Add(-time.Minute)
+	change, err := d.changeOf(streamtypes.Record{
+		EventName: streamtypes.OperationTypeModify,
+		Dynamodb: &streamtypes.StreamRecord{
+			ApproximateCreationDateTime: &observedAt,
+			OldImage: map[string]streamtypes.AttributeValue{
+				"locationTitle": &streamtypes.AttributeValueMemberS{Value: "ozurgetis"},
+				"outageEnd":     &streamtypes.AttributeValueMemberS{Value: "2023-10-18T10:00:00Z"},
+				"outageStart":   &streamtypes.AttributeValueMemberS{Value: "2023-10-18T10:00:00Z"},
+				"end":           &streamtypes.AttributeValueMemberS{Value: "2023-10-18T14:00:00Z"},
+				"status":        &streamtypes.AttributeValueMemberS{Value: "active"},
+			},
+			NewImage: map[string]streamtypes.AttributeValue{
+				"locationTitle": &streamtypes.AttributeValueMemberS{Value: "ozurgetis"},
+				"outageEnd":     &streamtypes.AttributeValueMemberS{Value: "2023-10-18T10:00:00Z"},
+				"outageStart":   &streamtypes.AttributeValueMemberS{Value: "2023-10-18T10:00:00Z"},
+				"end":           &streamtypes.AttributeValueMemberS{Value: "2023-10-18T16:00:00Z"},
+				"status":        &streamtypes.AttributeValueMemberS{Value: "active"},
+				"addressesGe":   &streamtypes.AttributeValueMemberSS{Value: []string{"ე.თაყაიშვილის ქ."}},
+			},
+		},
+	}, "water.gov.ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, observedAt, change.ObservedAt)
+	assert.Equal(t, "water.gov.ge/ozurgetis/2023-10-18T10:00:00Z", change.New.Ref())
+	assert.Equal(t, []string{"end", "addressesGe"}, outage.ChangedFields(change.Old, change.New))
+
+	deleted, err := d.changeOf(streamtypes.Record{
+		EventName: streamtypes.OperationTypeRemove,
+		Dynamodb: &streamtypes.StreamRecord{OldImage: map[string]streamtypes.AttributeValue{
+			"locationTitle": &streamtypes.AttributeValueMemberS{Value: "ozurgetis"},
+			"outageStart":   &streamtypes.AttributeValueMemberS{Value: "2023-10-18T10:00:00Z"},
+		}},
+	}, "water.gov.ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, deleted.New.Start.IsZero())
+	assert.Equal(t, testNow, deleted.ObservedAt)
+}
+
+func Test_DynamoChangeFeed(t *testing.T) {
+	ctx := context.Background()
+	d, providerId := newTestDynamo(t)
+	d = d.WithStreams()
+	if err := d.EnsureTables(ctx, providerId); err != nil {
+		t.Fatal(err)
+	}
+	client := dynamodbstreams.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("local", "local", ""),
+	}, func(o *dynamodbstreams.Options) {
+		o.BaseEndpoint = aws.String(os.Getenv(testDynamoURLEnv))
+	})
+	o := outage.Outage{
+		ProviderId:  providerId,
+		Kind:        outage.KindWater,
+		Start:       testNow,
+		End:         testNow.Add(4 * time.Hour),
+		Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+		AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ."},
+		Status:      outage.StatusActive,
+	}
+	extended := o
+	extended.End = o.End.Add(2 * time.Hour)
+	for _, save := range []outage.Outage{o, extended} {
+		if err := d.SaveOutages(ctx, save); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var changes []outage.Change
+	collect := func(ctx context.Context, c outage.Change) error {
+		changes = append(changes, c)
+		return nil
+	}
+	feed := newDynamoChangeFeed(client, d.client, d, []string{providerId}, "replica-a")
+	if err := feed.Poll(ctx, collect); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, changes, 2) {
+		assert.True(t, changes[0].Old.Start.IsZero())
+		assert.Equal(t, []string{"end"}, outage.ChangedFields(changes[1].Old, changes[1].New))
+	}
+
+	// The checkpoint keeps the first replica from handling them again and
+	// the lease keeps a second one off the shard.
+	if err := feed.Poll(ctx, collect); err != nil {
+		t.Fatal(err)
+	}
+	if err := newDynamoChangeFeed(client, d.client, d, []string{providerId}, "replica-b").Poll(ctx, collect); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, changes, 2)
+}
+
+// fakeShard is a shard of fakeStreams. A closed shard ends after its
+// records; an open one may get more.
+type fakeShard struct {
+	id      string
+	parent  string
+	records []string
+	closed  bool
+}
+
+// fakeStreams serves shards by stream ARN. Shard iterators are the shard id
+// and the position of the next record; sequence numbers are the record
+// names.
+type fakeStreams struct {
+	shards map[string][]fakeShard
+}
+
+func (s fakeStreams) shard(id string) fakeShard {
+	for _, shards := range s.shards {
+		for _, shard := range shards {
+			if shard.id == id {
+				return shard
+			}
+		}
+	}
+	return fakeShard{}
+}
+
+func (s fakeStreams) DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	var shards []streamtypes.Shard
+	for _, shard := range s.shards[aws.ToString(params.StreamArn)] {
+		described := streamtypes.Shard{ShardId: aws.String(shard.id)}
+		if shard.parent != "" {
+			described.ParentShardId = aws.String(shard.parent)
+		}
+		shards = append(shards, described)
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &streamtypes.StreamDescription{Shards: shards}}, nil
+}
+
+func (s fakeStreams) GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	shard := s.shard(aws.ToString(params.ShardId))
+	position := 0
+	if params.ShardIteratorType == streamtypes.ShardIteratorTypeAfterSequenceNumber {
+		position = slices.Index(shard.records, aws.ToString(params.SequenceNumber)) + 1
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(shard.id + "/" + strconv.Itoa(position))}, nil
+}
+
+func (s fakeStreams) GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	id, position, _ := strings.Cut(aws.ToString(params.ShardIterator), "/")
+	from, err := strconv.Atoi(position)
+	if err != nil {
+		return nil, err
+	}
+	shard := s.shard(id)
+	gro := &dynamodbstreams.GetRecordsOutput{}
+	for _, name := range shard.records[from:] {
+		gro.Records = append(gro.Records, streamtypes.Record{
+			EventName: streamtypes.OperationTypeInsert,
+			Dynamodb: &streamtypes.StreamRecord{
+				SequenceNumber: aws.String(name),
+				NewImage: map[string]streamtypes.AttributeValue{
+					"locationTitle": &streamtypes.AttributeValueMemberS{Value: name},
+					"outageStart":   &streamtypes.AttributeValueMemberS{Value: "2023-10-18T10:00:00Z"},
+				},
+			},
+		})
+	}
+	if !shard.closed {
+		gro.NextShardIterator = aws.String(id + "/" + strconv.Itoa(len(shard.records)))
+	}
+	return gro, nil
+}
+
+// fakeLeases keeps the lease table in memory. It understands the SET
+// updates and the conditions the change feed writes: comparisons and
+// attribute_not_exists, all joined by OR or all by AND.
+type fakeLeases struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+var (
+	fakeSet       = regexp.MustCompile(`(#\d+) = (:\d+)`)
+	fakeCondition = regexp.MustCompile(`attribute_not_exists \((#\d+)\)|(#\d+) (<=|<|=) (:\d+)`)
+)
+
+func (l fakeLeases) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: &types.TableDescription{
+		LatestStreamArn: aws.String("arn:" + aws.ToString(params.TableName)),
+	}}, nil
+}
+
+func (l fakeLeases) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	key := params.Key["leaseKey"].(*types.AttributeValueMemberS).Value
+	item, found := l.items[key]
+	if condition := aws.ToString(params.ConditionExpression); condition != "" {
+		or := strings.Contains(condition, " OR ")
+		holds := !or
+		for _, clause := range fakeCondition.FindAllStringSubmatch(condition, -1) {
+			var ok bool
+			if clause[1] != "" {
+				ok = !found
+			} else {
+				ok = found && fakeCompare(item[params.ExpressionAttributeNames[clause[2]]], clause[3], params.ExpressionAttributeValues[clause[4]])
+			}
+			if or {
+				holds = holds || ok
+			} else {
+				holds = holds && ok
+			}
+		}
+		if !holds {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	if !found {
+		item = map[string]types.AttributeValue{"leaseKey": params.Key["leaseKey"]}
+		l.items[key] = item
+	}
+	for _, set := range fakeSet.FindAllStringSubmatch(aws.ToString(params.UpdateExpression), -1) {
+		item[params.ExpressionAttributeNames[set[1]]] = params.ExpressionAttributeValues[set[2]]
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: maps.Clone(item)}, nil
+}
+
+func fakeCompare(a types.AttributeValue, op string, b types.AttributeValue) bool {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		return op == "=" && a.Value == b.(*types.AttributeValueMemberS).Value
+	case *types.AttributeValueMemberN:
+		x, _ := strconv.ParseInt(a.Value, 10, 64)
+		y, _ := strconv.ParseInt(b.(*types.AttributeValueMemberN).Value, 10, 64)
+		switch op {
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		}
+		return x == y
+	}
+	return false
+}
+
+func (l fakeLeases) lease(key, owner string, expiry time.Time, checkpoint string) {
+	l.items[key] = map[string]types.AttributeValue{
+		"leaseKey":    &types.AttributeValueMemberS{Value: key},
+		"owner":       &types.AttributeValueMemberS{Value: owner},
+		"leaseExpiry": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiry.UnixMilli(), 10)},
+		"checkpoint":  &types.AttributeValueMemberS{Value: checkpoint},
+	}
+}
+
+func (l fakeLeases) checkpointOf(key string) string {
+	if checkpoint, ok := l.items[key]["checkpoint"].(*types.AttributeValueMemberS); ok {
+		return checkpoint.Value
+	}
+	return ""
+}
+
+func newFakeChangeFeed(shards ...fakeShard) (DynamoChangeFeed, fakeLeases, string) {
+	d := newDynamo(nil, "", func() time.Time { return testNow }, slog.Default())
+	streamArn := "arn:" + d.outagesTableName("water.gov.ge")
+	leases := fakeLeases{map[string]map[string]types.AttributeValue{}}
+	streams := fakeStreams{map[string][]fakeShard{streamArn: shards}}
+	return newDynamoChangeFeed(streams, leases, d, []string{"water.gov.ge"}, "replica-a"), leases, streamArn
+}
+
+func Test_DynamoChangeFeedShards(t *testing.T) {
+	ctx := context.Background()
+	var handled []string
+	collect := func(ctx context.Context, c outage.Change) error {
+		handled = append(handled, c.New.Location.TitleLat)
+		return nil
+	}
+
+	t.Run("resumes from the checkpoint", func(t *testing.T) {
+		handled = nil
+		feed, leases, streamArn := newFakeChangeFeed(fakeShard{id: "a", records: []string{"a1", "a2", "a3"}, closed: true})
+		leases.lease(streamArn+"/a", "replica-b", testNow.Add(-time.Second), "a2")
+		if err := feed.Poll(ctx, collect); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"a3"}, handled)
+		assert.Equal(t, shardEnd, leases.checkpointOf(streamArn+"/a"))
+	})
+
+	t.Run("skips a shard another owner leases", func(t *testing.T) {
+		handled = nil
+		feed, leases, streamArn := newFakeChangeFeed(fakeShard{id: "a", records: []string{"a1"}})
+		leases.lease(streamArn+"/a", "replica-b", testNow.Add(time.Minute), "")
+		if err := feed.Poll(ctx, collect); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, handled)
+		assert.Equal(t, "", leases.checkpointOf(streamArn+"/a"))
+	})
+
+	t.Run("a child waits for its parent", func(t *testing.T) {
+		handled = nil
+		feed, leases, streamArn := newFakeChangeFeed(
+			fakeShard{id: "parent", records: []string{"p1"}, closed: true},
+			fakeShard{id: "child", parent: "parent", records: []string{"c1"}},
+		)
+		leases.lease(streamArn+"/parent", "replica-b", testNow.Add(time.Minute), "")
+		if err := feed.Poll(ctx, collect); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, handled)
+		leases.lease(streamArn+"/parent", "replica-b", testNow.Add(-time.Second), "")
+		if err := feed.Poll(ctx, collect); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"p1", "c1"}, handled)
+		assert.Equal(t, "c1", leases.checkpointOf(streamArn+"/child"))
+	})
+
+	t.Run("stops when the lease is lost mid-shard", func(t *testing.T) {
+		handled = nil
+		feed, leases, streamArn := newFakeChangeFeed(fakeShard{id: "a", records: []string{"a1", "a2"}, closed: true})
+		steal := func(ctx context.Context, c outage.Change) error {
+			handled = append(handled, c.New.Location.TitleLat)
+			leases.lease(streamArn+"/a", "replica-b", testNow.Add(time.Minute), "")
+			return nil
+		}
+		err := feed.Poll(ctx, steal)
+		assert.ErrorIs(t, err, errLeaseLost)
+		assert.Equal(t, []string{"a1"}, handled)
+		assert.Equal(t, "", leases.checkpointOf(streamArn+"/a"))
+	})
+}
@@ -0,0 +1,349 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoTable describes a table with string keys. Tables with ttl expire
+// items by the TTL attribute once a retention is set, and tables with
+// stream get a stream once streams are on.
+type dynamoTable struct {
+	name         string
+	partitionKey string
+	sortKey      string
+	indexes      []dynamoIndex
+	ttl          bool
+	stream       bool
+}
+
+// dynamoIndex is a global secondary index projecting every attribute.
+type dynamoIndex struct {
+	name         string
+	partitionKey string
+	sortKey      string
+}
+
+const tableActivePollInterval = 2 * time.Second
+
+func (w Dynamo) tables(providerIds ...string) []dynamoTable {
+	tables := []dynamoTable{
+		{w.manualTableName, w.manualPartitionKey, "", nil, false, true},
+		{w.crowdTableName, w.crowdPartitionKey, w.crowdSortKey, nil, false, false},
+		{w.revisionsTableName, w.revisionsPartitionKey, w.revisionsSortKey, []dynamoIndex{
+			{w.revisionsIndexName, "locationKey", w.revisionsSortKey},
+		}, true, false},
+		{w.outboxTableName, w.outboxPartitionKey, "", []dynamoIndex{
+			{w.outboxIndexName, "pending", "nextAttemptAt"},
+		}, true, false},
+		{w.leasesTableName, w.leasesPartitionKey, "", nil, true, false},
+		{w.runsTableName, w.runsPartitionKey, w.runsSortKey, nil, true, false},
+	}
+	for _, providerId := range providerIds {
+		tables = append(tables,
+			dynamoTable{w.outagesTableName(providerId), w.outagesPartitionKey, w.outagesSortKey, []dynamoIndex{
+				{w.activeIndexName, "kind", "end"},
+			}, true, true},
+			dynamoTable{w.addressesTableName(providerId), w.addressesPartitionKey, w.addressesSortKey, nil, true, false},
+			dynamoTable{w.centersTableName(providerId), w.centersPartitionKey, "", nil, false, false},
+			dynamoTable{w.historyTableName(providerId), w.centersPartitionKey, w.centersHistorySortKey, nil, false, false},
+		)
+	}
+	return tables
+}
+
+func (w Dynamo) CreateTables(ctx context.Context, providerIds ...string) error {
+	for _, table := range w.tables(providerIds...) {
+		if err := w.createTable(ctx, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureTables creates the tables that are missing, adds the indexes that
+// are missing from existing tables, drops the ones no longer described and
+// waits until all of them are ACTIVE.
+// With a retention it also turns TTL on for every table that keeps history
+// or may pile up leases, and
+// with streams it turns their streams on. It is safe to run on every start,
+// from replicas starting together too: a table another replica is creating
+// or updating is waited for rather than failed on. Outage items written
+// before the active index covered them are rewritten last.
+func (w Dynamo) EnsureTables(ctx context.Context, providerIds ...string) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("ensure tables: %w", err)
+	}
+	for _, table := range w.tables(providerIds...) {
+		dto, err := w.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table.name)})
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			if err := w.createTable(ctx, table); err != nil {
+				return handleErr(err)
+			}
+		} else if err != nil {
+			return handleErr(fmt.Errorf("describe table %s: %w", table.name, err))
+		}
+		if err := w.waitActive(ctx, table.name); err != nil {
+			return handleErr(err)
+		}
+		if table.ttl && w.retention > 0 {
+			if err := w.enableTTL(ctx, table.name); err != nil {
+				return handleErr(err)
+			}
+		}
+		if dto == nil {
+			continue
+		}
+		if table.stream && w.streams && !streamEnabled(dto.Table) {
+			if err := w.enableStream(ctx, table.name); err != nil {
+				return handleErr(err)
+			}
+			if err := w.waitActive(ctx, table.name); err != nil {
+				return handleErr(err)
+			}
+		}
+		existing := make(map[string]bool)
+		for _, gsi := range dto.Table.GlobalSecondaryIndexes {
+			existing[aws.ToString(gsi.IndexName)] = true
+		}
+		described := make(map[string]bool)
+		// DynamoDB builds one new index per UpdateTable.
+		for _, index := range table.indexes {
+			described[index.name] = true
+			if existing[index.name] {
+				continue
+			}
+			if err := w.addIndex(ctx, table.name, index); err != nil {
+				return handleErr(err)
+			}
+			if err := w.waitActive(ctx, table.name); err != nil {
+				return handleErr(err)
+			}
+		}
+		// An index nothing reads still costs a write per item.
+		for name := range existing {
+			if described[name] {
+				continue
+			}
+			if err := w.dropIndex(ctx, table.name, name); err != nil {
+				return handleErr(err)
+			}
+			if err := w.waitActive(ctx, table.name); err != nil {
+				return handleErr(err)
+			}
+		}
+	}
+	for _, providerId := range providerIds {
+		if err := w.rewriteLegacyOutages(ctx, providerId); err != nil {
+			return handleErr(err)
+		}
+	}
+	return nil
+}
+
+// waitActive polls until the table and every one of its indexes are ACTIVE.
+func (w Dynamo) waitActive(ctx context.Context, tableName string) error {
+	for {
+		dto, err := w.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+		if err != nil {
+			return fmt.Errorf("wait for table %s: %w", tableName, err)
+		}
+		active := dto.Table.TableStatus == types.TableStatusActive
+		for _, gsi := range dto.Table.GlobalSecondaryIndexes {
+			active = active && gsi.IndexStatus == types.IndexStatusActive
+		}
+		if active {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for table %s: %w", tableName, ctx.Err())
+		case <-time.After(tableActivePollInterval):
+		}
+	}
+}
+
+func stringAttributes(names ...string) []types.AttributeDefinition {
+	var defs []types.AttributeDefinition
+	defined := make(map[string]bool)
+	for _, name := range names {
+		if name == "" || defined[name] {
+			continue
+		}
+		defined[name] = true
+		defs = append(defs, types.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+	}
+	return defs
+}
+
+func keySchema(partitionKey, sortKey string) []types.KeySchemaElement {
+	schema := []types.KeySchemaElement{
+		{
+			AttributeName: aws.String(partitionKey),
+			KeyType:       types.KeyTypeHash,
+		},
+	}
+	if sortKey != "" {
+		schema = append(schema, types.KeySchemaElement{
+			AttributeName: aws.String(sortKey),
+			KeyType:       types.KeyTypeRange,
+		})
+	}
+	return schema
+}
+
+func (index dynamoIndex) gsi() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(index.name),
+		KeySchema: keySchema(index.partitionKey, index.sortKey),
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+	}
+}
+
+func (w Dynamo) createTable(ctx context.Context, table dynamoTable) error {
+	keys := []string{table.partitionKey, table.sortKey}
+	for _, index := range table.indexes {
+		keys = append(keys, index.partitionKey, index.sortKey)
+	}
+	cti := dynamodb.CreateTableInput{
+		AttributeDefinitions:      stringAttributes(keys...),
+		KeySchema:                 keySchema(table.partitionKey, table.sortKey),
+		TableName:                 aws.String(table.name),
+		BillingMode:               types.BillingModePayPerRequest,
+		DeletionProtectionEnabled: aws.Bool(false),
+	}
+	for _, index := range table.indexes {
+		cti.GlobalSecondaryIndexes = append(cti.GlobalSecondaryIndexes, index.gsi())
+	}
+	if table.stream && w.streams {
+		cti.StreamSpecification = streamSpecification()
+	}
+	_, err := w.client.CreateTable(ctx, &cti)
+	switch {
+	case inUse(err):
+		w.sl.Info("table is being created elsewhere", slog.String("table", table.name))
+	case err != nil:
+		return fmt.Errorf("create table %s: %w", table.name, err)
+	default:
+		w.sl.Info("created table", slog.String("table", table.name))
+	}
+	return nil
+}
+
+// inUse tells whether another replica got to the table first: it is being
+// created or updated, and the caller only has to wait for it to be ACTIVE.
+func inUse(err error) bool {
+	var inUse *types.ResourceInUseException
+	return errors.As(err, &inUse)
+}
+
+func (w Dynamo) addIndex(ctx context.Context, tableName string, index dynamoIndex) error {
+	gsi := index.gsi()
+	_, err := w.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:            aws.String(tableName),
+		AttributeDefinitions: stringAttributes(index.partitionKey, index.sortKey),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  gsi.IndexName,
+					KeySchema:  gsi.KeySchema,
+					Projection: gsi.Projection,
+				},
+			},
+		},
+	})
+	switch {
+	case inUse(err):
+		w.sl.Info("table is being updated elsewhere", slog.String("table", tableName), slog.String("index", index.name))
+	case err != nil:
+		return fmt.Errorf("add index %s to %s: %w", index.name, tableName, err)
+	default:
+		w.sl.Info("added index", slog.String("table", tableName), slog.String("index", index.name))
+	}
+	return nil
+}
+
+func (w Dynamo) dropIndex(ctx context.Context, tableName, indexName string) error {
+	_, err := w.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(tableName),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Delete: &types.DeleteGlobalSecondaryIndexAction{IndexName: aws.String(indexName)},
+			},
+		},
+	})
+	switch {
+	case inUse(err):
+		w.sl.Info("table is being updated elsewhere", slog.String("table", tableName), slog.String("index", indexName))
+	case err != nil:
+		return fmt.Errorf("drop index %s from %s: %w", indexName, tableName, err)
+	default:
+		w.sl.Info("dropped index", slog.String("table", tableName), slog.String("index", indexName))
+	}
+	return nil
+}
+
+func (w Dynamo) enableTTL(ctx context.Context, tableName string) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("enable ttl on %s: %w", tableName, err)
+	}
+	dtto, err := w.client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return handleErr(err)
+	}
+	if d := dtto.TimeToLiveDescription; d != nil && (d.TimeToLiveStatus == types.TimeToLiveStatusEnabled || d.TimeToLiveStatus == types.TimeToLiveStatusEnabling) {
+		return nil
+	}
+	if _, err := w.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(w.ttlAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	}); err != nil {
+		return handleErr(err)
+	}
+	w.sl.Info("enabled ttl", slog.String("table", tableName))
+	return nil
+}
+
+func streamSpecification() *types.StreamSpecification {
+	return &types.StreamSpecification{
+		StreamEnabled:  aws.Bool(true),
+		StreamViewType: types.StreamViewTypeNewAndOldImages,
+	}
+}
+
+func streamEnabled(table *types.TableDescription) bool {
+	spec := table.StreamSpecification
+	return spec != nil && aws.ToBool(spec.StreamEnabled) && spec.StreamViewType == types.StreamViewTypeNewAndOldImages
+}
+
+func (w Dynamo) enableStream(ctx context.Context, tableName string) error {
+	_, err := w.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:           aws.String(tableName),
+		StreamSpecification: streamSpecification(),
+	})
+	switch {
+	case inUse(err):
+		w.sl.Info("table is being updated elsewhere", slog.String("table", tableName))
+	case err != nil:
+		return fmt.Errorf("enable stream on %s: %w", tableName, err)
+	default:
+		w.sl.Info("enabled stream", slog.String("table", tableName))
+	}
+	return nil
+}
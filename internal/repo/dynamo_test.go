@@ -0,0 +1,278 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Dynamo runs when OUTAGE_MONITOR_TEST_DYNAMO_URL points at DynamoDB Local,
+// e.g. docker run -p 8000:8000 amazon/dynamodb-local and
+// http://localhost:8000.
+const testDynamoURLEnv = "OUTAGE_MONITOR_TEST_DYNAMO_URL"
+
+func newTestDynamo(t *testing.T) (Dynamo, string) {
+	t.Helper()
+	endpoint := os.Getenv(testDynamoURLEnv)
+	if endpoint == "" {
+		t.Skip(testDynamoURLEnv + " is not set")
+	}
+	client := dynamodb.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("local", "local", ""),
+	}, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+	now := func() time.Time {
+		return testNow
+	}
+	d := newDynamo(client, fmt.Sprintf("test%d.", time.Now().UnixNano()), now, slog.Default())
+	providerId := "water.gov.ge"
+	// The second run finds every table and must leave them alone.
+	for i := 0; i < 2; i++ {
+		if err := d.EnsureTables(context.Background(), providerId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d, providerId
+}
+
+func Test_DynamoEnsureTablesConcurrently(t *testing.T) {
+	d, _ := newTestDynamo(t)
+	d = newDynamo(d.client, fmt.Sprintf("test%d.", time.Now().UnixNano()), d.now, d.sl)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- d.EnsureTables(context.Background(), "water.gov.ge")
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func Test_DynamoSaveOutages(t *testing.T) {
+	ctx := context.Background()
+	d, providerId := newTestDynamo(t)
+	var outages []outage.Outage
+	for i := 0; i < 60; i++ {
+		outages = append(outages, outage.Outage{
+			ProviderId: providerId,
+			Kind:       outage.KindWater,
+			Start:      testNow.Add(time.Duration(i) * time.Minute),
+			End:        testNow.Add(4 * time.Hour),
+			Location:   outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+			Status:     outage.StatusActive,
+			Source:     outage.SourceOfficial,
+		})
+		if i%2 == 0 {
+			outages[i].AddressesGe = []string{"ოზურგეთი ქ. " + strconv.Itoa(i), "ოზურგეთი ქ. " + strconv.Itoa(i)}
+		}
+	}
+	duplicate := outages[0]
+	duplicate.AffectedCustomers = 1200
+	if err := d.SaveOutages(ctx, append(outages, duplicate)...); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetOutages(ctx, providerId, "ozurgetis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, got, 60)
+	assert.Equal(t, 1200, got[0].AffectedCustomers)
+	assert.Equal(t, []string{"ოზურგეთი ქ. 0"}, got[0].AddressesGe)
+	assert.Nil(t, got[1].AddressesGe)
+}
+
+func Test_DynamoIndexes(t *testing.T) {
+	ctx := context.Background()
+	d, providerId := newTestDynamo(t)
+	ozurgeti := outage.Outage{
+		ProviderId:  providerId,
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-8 * time.Hour),
+		End:         testNow.Add(-time.Hour),
+		Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+		AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ. N5"},
+		Status:      outage.StatusActive,
+		Source:      outage.SourceOfficial,
+	}
+	active := ozurgeti
+	active.Start = testNow.Add(-time.Hour)
+	active.End = testNow.Add(4 * time.Hour)
+	active.AddressesGe = []string{"ოზურგეთი გურიის ქ."}
+	rustavi := active
+	rustavi.Location = outage.Location{Id: "12", TitleGe: "რუსთავის", TitleLat: "rustavis"}
+	rustavi.AddressesGe = []string{"რუსთავი თაყაიშვილის ქ. N5"}
+	if err := d.SaveOutages(ctx, ozurgeti, active, rustavi); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetCurrentOutages(ctx, providerId, outage.KindWater)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []outage.Outage{active, rustavi}, got)
+	got, err = d.GetCurrentOutages(ctx, providerId, outage.KindGas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, got)
+	got, err = d.GetOutagesByAddress(ctx, providerId, "თაყაიშვილის ქუჩა 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Outage{ozurgeti, rustavi}, got)
+}
+
+func Test_DynamoOutbox(t *testing.T) {
+	ctx := context.Background()
+	d, providerId := newTestDynamo(t)
+	o := outage.Outage{
+		ProviderId: providerId,
+		Kind:       outage.KindWater,
+		Start:      testNow.Add(2 * time.Hour),
+		End:        testNow.Add(6 * time.Hour),
+		Location:   outage.Location{Id: "9", TitleGe: "ბათუმის", TitleLat: "batumis"},
+		Status:     outage.StatusActive,
+		Source:     outage.SourceOfficial,
+	}
+	n, err := outage.NewNotification(outage.Revision{}, outage.Revision{OutageRef: o.Ref(), ObservedAt: testNow, Outage: o}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second save finds the notification queued and writes the outage
+	// alone.
+	for i := 0; i < 2; i++ {
+		if err := d.SaveOutagesNotifying(ctx, []outage.Outage{o}, []outage.Notification{n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outages, err := d.GetOutages(ctx, providerId, "batumis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, outages, 1)
+	claimed, err := d.ClaimNotifications(ctx, "a", testNow, testNow.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Notification{n}, claimed)
+	claimed, err = d.ClaimNotifications(ctx, "b", testNow, testNow.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, claimed)
+	if err := d.RetryNotification(ctx, n.Id, testNow.Add(time.Minute), "receiver is down"); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = d.ClaimNotifications(ctx, "b", testNow.Add(time.Minute), testNow.Add(2*time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Attempts, n.NextAttemptAt, n.LastError = 1, testNow.Add(time.Minute), "receiver is down"
+	assert.Equal(t, []outage.Notification{n}, claimed)
+	if err := d.CompleteNotification(ctx, n.Id, testNow.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = d.ClaimNotifications(ctx, "b", testNow.Add(time.Hour), testNow.Add(2*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, claimed)
+	assert.ErrorIs(t, d.CompleteNotification(ctx, "missing", testNow), outage.ErrNoNotification)
+}
+
+func Test_DynamoSameStart(t *testing.T) {
+	d, providerId := newTestDynamo(t)
+	testSameStart(t, d, providerId)
+}
+
+func Test_DynamoNoEnd(t *testing.T) {
+	d, providerId := newTestDynamo(t)
+	testNoEnd(t, d, providerId)
+}
+
+func Test_DynamoOtherZones(t *testing.T) {
+	d, providerId := newTestDynamo(t)
+	testOtherZones(t, func(now func() time.Time) outageStore {
+		d.now = now
+		return d
+	}, providerId)
+}
+
+func Test_DynamoOutagesPage(t *testing.T) {
+	d, providerId := newTestDynamo(t)
+	testOutagesPage(t, d, providerId)
+}
+
+func Test_DynamoLeases(t *testing.T) {
+	d, _ := newTestDynamo(t)
+	testLeases(t, d)
+}
+
+func Test_DynamoRuns(t *testing.T) {
+	d, _ := newTestDynamo(t)
+	testRuns(t, d)
+}
+
+func Test_DynamoLegacyOutages(t *testing.T) {
+	ctx := context.Background()
+	d, providerId := newTestDynamo(t)
+	tbilisi := time.FixedZone("GET", 4*60*60)
+	o := outage.Outage{
+		ProviderId:  providerId,
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-time.Hour).In(tbilisi),
+		End:         testNow.Add(3 * time.Hour).UTC(),
+		Location:    outage.Location{Id: "3", TitleGe: "ბათუმის", TitleLat: "batumis"},
+		AddressesGe: []string{"ბათუმი გორგასლის ქ."},
+		Status:      outage.StatusActive,
+		Source:      outage.SourceOfficial,
+	}
+	// Written as before: keyed and started in the provider's zone.
+	item := d.outageItem(o)
+	item[d.outagesSortKey] = &types.AttributeValueMemberS{Value: o.Start.Format(time.RFC3339)}
+	item["outageStart"] = &types.AttributeValueMemberS{Value: o.Start.Format(time.RFC3339)}
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.outagesTableName(providerId)),
+		Item:      item,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnsureTables(ctx, providerId); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveOutages(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetOutages(ctx, providerId, "batumis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, o.Ref(), got[0].Ref())
+	}
+}
+
+func Test_DynamoCenters(t *testing.T) {
+	d, _ := newTestDynamo(t)
+	if err := d.EnsureTables(context.Background(), "gwp.ge"); err != nil {
+		t.Fatal(err)
+	}
+	testCenters(t, func(now func() time.Time) centerStore {
+		d.now = now
+		return d
+	})
+}
@@ -0,0 +1,16 @@
+package repo
+
+type errorRepo string
+
+func (e errorRepo) Error() string {
+	return string(e)
+}
+
+const errUnknownDriver errorRepo = "unknown sql driver"
+
+const errUnprocessedItem errorRepo = "item left unprocessed after retries"
+
+const (
+	errNoStream  errorRepo = "table has no stream"
+	errLeaseLost errorRepo = "shard lease taken over by another owner"
+)
@@ -0,0 +1,607 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/address"
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+)
+
+// Memory keeps everything in maps behind one RWMutex, so readers never see
+// a refresh half applied. With a snapshot path it is written to a JSON file
+// periodically and reloaded from it on start.
+type Memory struct {
+	state        *memoryState
+	snapshotPath string
+	now          func() time.Time
+	sl           *slog.Logger
+}
+
+type memoryState struct {
+	mu        sync.RWMutex
+	outages   map[memoryOutageKey]outage.Outage
+	centers   map[memoryCenterKey]outage.Center
+	history   map[memoryCenterKey][]outage.CenterStatus
+	manual    map[string]outage.Outage
+	crowd     map[string][]outage.CrowdReport
+	revisions map[string][]outage.Revision
+	outbox    map[string]memoryNotification
+	leases    map[string]memoryLease
+	runs      map[string][]outage.Run
+	requests  map[string]time.Time
+}
+
+// memoryNotification is a notification in the outbox with its claim and
+// delivery, exported for the snapshot.
+type memoryNotification struct {
+	Notification outage.Notification
+	ClaimedBy    string
+	ClaimedUntil time.Time
+	DeliveredAt  time.Time
+}
+
+// memoryLease is kept out of the snapshot; a lease only outlives the
+// process that holds it by its expiry.
+type memoryLease struct {
+	owner string
+	until time.Time
+}
+
+type memoryOutageKey struct {
+	providerId string
+	titleLat   string
+	start      int64
+	key        string
+}
+
+type memoryCenterKey struct {
+	providerId string
+	locationId string
+}
+
+type memorySnapshot struct {
+	Outages   []outage.Outage
+	Centers   []outage.Center
+	History   []memoryHistory
+	Manual    []outage.Outage
+	Crowd     []outage.CrowdReport
+	Revisions []outage.Revision
+	Outbox    []memoryNotification
+	Runs      []outage.Run
+}
+
+type memoryHistory struct {
+	ProviderId string
+	Statuses   []outage.CenterStatus
+}
+
+func NewMemory(snapshotPath string, now func() time.Time, sl *slog.Logger) (Memory, error) {
+	m := Memory{
+		&memoryState{
+			outages:   make(map[memoryOutageKey]outage.Outage),
+			centers:   make(map[memoryCenterKey]outage.Center),
+			history:   make(map[memoryCenterKey][]outage.CenterStatus),
+			manual:    make(map[string]outage.Outage),
+			crowd:     make(map[string][]outage.CrowdReport),
+			revisions: make(map[string][]outage.Revision),
+			outbox:    make(map[string]memoryNotification),
+			leases:    make(map[string]memoryLease),
+			runs:      make(map[string][]outage.Run),
+			requests:  make(map[string]time.Time),
+		},
+		snapshotPath,
+		now,
+		sl,
+	}
+	if snapshotPath == "" {
+		return m, nil
+	}
+	if err := m.load(); err != nil {
+		return Memory{}, fmt.Errorf("new memory: %w", err)
+	}
+	return m, nil
+}
+
+func (m Memory) load() error {
+	raw, err := os.ReadFile(m.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load snapshot: %w", err)
+	}
+	var snap memorySnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return fmt.Errorf("load snapshot %s: %w", m.snapshotPath, err)
+	}
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range snap.Outages {
+		s.outages[outageKey(o)] = o
+	}
+	for _, c := range snap.Centers {
+		s.centers[memoryCenterKey{c.ProviderId, c.Location.Id}] = c
+	}
+	for _, h := range snap.History {
+		if len(h.Statuses) > 0 {
+			s.history[memoryCenterKey{h.ProviderId, h.Statuses[0].LocationId}] = h.Statuses
+		}
+	}
+	for _, o := range snap.Manual {
+		s.manual[o.Id] = o
+	}
+	for _, r := range snap.Crowd {
+		s.crowd[r.OutageRef] = append(s.crowd[r.OutageRef], r)
+	}
+	for _, r := range snap.Revisions {
+		s.revisions[r.OutageRef] = append(s.revisions[r.OutageRef], r)
+	}
+	for _, n := range snap.Outbox {
+		s.outbox[n.Notification.Id] = n
+	}
+	for _, r := range snap.Runs {
+		s.runs[r.ProviderId] = append(s.runs[r.ProviderId], r)
+	}
+	return nil
+}
+
+// Snapshot writes the state to the snapshot path through a temporary file,
+// so a crash mid-write leaves the previous snapshot intact.
+func (m Memory) Snapshot() error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if m.snapshotPath == "" {
+		return nil
+	}
+	s := m.state
+	s.mu.RLock()
+	snap := memorySnapshot{
+		Outages: lo.Values(s.outages),
+		Centers: lo.Values(s.centers),
+		Manual:  lo.Values(s.manual),
+		Outbox:  lo.Values(s.outbox),
+	}
+	for key, statuses := range s.history {
+		snap.History = append(snap.History, memoryHistory{key.providerId, statuses})
+	}
+	for _, reports := range s.crowd {
+		snap.Crowd = append(snap.Crowd, reports...)
+	}
+	for _, revisions := range s.revisions {
+		snap.Revisions = append(snap.Revisions, revisions...)
+	}
+	for _, runs := range s.runs {
+		snap.Runs = append(snap.Runs, runs...)
+	}
+	raw, err := json.Marshal(snap)
+	s.mu.RUnlock()
+	if err != nil {
+		return handleErr(err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.snapshotPath), filepath.Base(m.snapshotPath)+".*")
+	if err != nil {
+		return handleErr(err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		return handleErr(errors.Join(err, tmp.Close(), os.Remove(tmp.Name())))
+	}
+	if err := tmp.Close(); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	if err := os.Rename(tmp.Name(), m.snapshotPath); err != nil {
+		return handleErr(errors.Join(err, os.Remove(tmp.Name())))
+	}
+	return nil
+}
+
+// StartSnapshotting snapshots every interval and once more when ctx is done.
+func (m Memory) StartSnapshotting(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := m.Snapshot(); err != nil {
+				m.sl.Error("final snapshot", slog.Any("err", err))
+			}
+			return
+		case <-ticker.C:
+			if err := m.Snapshot(); err != nil {
+				m.sl.Error("periodic snapshot", slog.Any("err", err))
+			}
+		}
+	}
+}
+
+func outageKey(o outage.Outage) memoryOutageKey {
+	return memoryOutageKey{o.ProviderId, o.Location.TitleLat, o.Start.Unix(), o.Key}
+}
+
+func (m Memory) SaveOutages(ctx context.Context, outages ...outage.Outage) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveOutages(outages)
+	return nil
+}
+
+func (s *memoryState) saveOutages(outages []outage.Outage) {
+	for _, o := range outages {
+		o.AddressesGe = lo.Uniq(o.AddressesGe)
+		s.outages[outageKey(o)] = o
+	}
+}
+
+// GetOutages returns the outages at a location that have not ended yet,
+// counting the ones without an end as ongoing.
+func (m Memory) GetOutages(ctx context.Context, providerId, titleLat string) ([]outage.Outage, error) {
+	now := m.now()
+	return m.findOutages(func(o outage.Outage) bool {
+		return o.ProviderId == providerId && o.Location.TitleLat == titleLat && (o.End.IsZero() || o.End.After(now))
+	}), nil
+}
+
+func (m Memory) GetOutage(ctx context.Context, providerId, titleLat string, start time.Time, key string) (outage.Outage, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, found := s.outages[memoryOutageKey{providerId, titleLat, start.Unix(), key}]
+	if !found {
+		return outage.Outage{}, fmt.Errorf("get outage %s/%s: %w", providerId, titleLat, outage.ErrNotFound)
+	}
+	return o, nil
+}
+
+// GetCurrentOutages returns the provider's outages of kind that have not
+// ended yet at any location.
+func (m Memory) GetCurrentOutages(ctx context.Context, providerId string, kind outage.Kind) ([]outage.Outage, error) {
+	now := m.now()
+	return m.findOutages(func(o outage.Outage) bool {
+		return o.ProviderId == providerId && o.Kind == kind && (o.End.IsZero() || o.End.After(now))
+	}), nil
+}
+
+// GetOutagesStartedBetween returns the provider's outages that started in
+// [from, to) at any location.
+func (m Memory) GetOutagesStartedBetween(ctx context.Context, providerId string, from, to time.Time) ([]outage.Outage, error) {
+	return m.findOutages(func(o outage.Outage) bool {
+		return o.ProviderId == providerId && !o.Start.Before(from) && o.Start.Before(to)
+	}), nil
+}
+
+// GetOutagesPage returns up to limit of the provider's outages after cursor,
+// ended or not, in ref order, and the cursor of the next page, which is
+// empty after the last one.
+func (m Memory) GetOutagesPage(ctx context.Context, providerId, cursor string, limit int) ([]outage.Outage, string, error) {
+	outages := m.findOutages(func(o outage.Outage) bool {
+		return o.ProviderId == providerId && o.Ref() > cursor
+	})
+	sort.Slice(outages, func(i, j int) bool {
+		return outages[i].Ref() < outages[j].Ref()
+	})
+	if len(outages) <= limit {
+		return outages, "", nil
+	}
+	return outages[:limit], outages[limit-1].Ref(), nil
+}
+
+// GetOutagesByAddress returns the outages with an address holding every
+// token of addr, ended or not, oldest first.
+func (m Memory) GetOutagesByAddress(ctx context.Context, providerId, addr string) ([]outage.Outage, error) {
+	tokens := address.Tokens(addr)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return m.findOutages(func(o outage.Outage) bool {
+		return o.ProviderId == providerId && hasTokens(o, tokens)
+	}), nil
+}
+
+func (m Memory) findOutages(match func(outage.Outage) bool) []outage.Outage {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var outages []outage.Outage
+	for _, o := range s.outages {
+		if match(o) {
+			outages = append(outages, o)
+		}
+	}
+	sort.Slice(outages, func(i, j int) bool {
+		return outages[i].Start.Before(outages[j].Start)
+	})
+	return outages
+}
+
+// SaveCenters upserts every center and appends to its history whenever its
+// problem flag differs from the stored one.
+func (m Memory) SaveCenters(ctx context.Context, centers ...outage.Center) error {
+	now := m.now()
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range centers {
+		key := memoryCenterKey{c.ProviderId, c.Location.Id}
+		old, known := s.centers[key]
+		c.FirstSeen, c.LastSeen = now, now
+		if known {
+			c.FirstSeen = old.FirstSeen
+		}
+		s.centers[key] = c
+		if known && old.Problem == c.Problem {
+			continue
+		}
+		s.history[key] = append(s.history[key], outage.CenterStatus{
+			LocationId: c.Location.Id,
+			Problem:    c.Problem,
+			ObservedAt: now,
+		})
+	}
+	return nil
+}
+
+func (m Memory) GetCenters(ctx context.Context, providerId string) ([]outage.Center, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var centers []outage.Center
+	for key, c := range s.centers {
+		if key.providerId == providerId {
+			centers = append(centers, c)
+		}
+	}
+	sort.Slice(centers, func(i, j int) bool {
+		return centers[i].Location.Id < centers[j].Location.Id
+	})
+	return centers, nil
+}
+
+func (m Memory) GetCenterHistory(ctx context.Context, providerId, locationId string) ([]outage.CenterStatus, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]outage.CenterStatus(nil), s.history[memoryCenterKey{providerId, locationId}]...), nil
+}
+
+func (m Memory) SaveManualOutage(ctx context.Context, o outage.Outage) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manual[o.Id] = o
+	return nil
+}
+
+func (m Memory) GetManualOutage(ctx context.Context, id string) (outage.Outage, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, found := s.manual[id]
+	if !found {
+		return outage.Outage{}, fmt.Errorf("get manual outage %s: %w", id, outage.ErrNotFound)
+	}
+	return o, nil
+}
+
+func (m Memory) GetManualOutages(ctx context.Context) ([]outage.Outage, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	outages := lo.Values(s.manual)
+	sort.Slice(outages, func(i, j int) bool {
+		if !outages[i].Start.Equal(outages[j].Start) {
+			return outages[i].Start.Before(outages[j].Start)
+		}
+		return outages[i].Id < outages[j].Id
+	})
+	return outages, nil
+}
+
+func (m Memory) SaveCrowdReport(ctx context.Context, r outage.CrowdReport) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crowd[r.OutageRef] = append(s.crowd[r.OutageRef], r)
+	return nil
+}
+
+func (m Memory) GetCrowdReports(ctx context.Context, outageRef string) ([]outage.CrowdReport, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]outage.CrowdReport(nil), s.crowd[outageRef]...), nil
+}
+
+func (m Memory) SaveRevision(ctx context.Context, r outage.Revision) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revisions[r.OutageRef] = append(s.revisions[r.OutageRef], r)
+	return nil
+}
+
+func (m Memory) GetRevisions(ctx context.Context, outageRef string) ([]outage.Revision, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]outage.Revision(nil), s.revisions[outageRef]...), nil
+}
+
+// GetRevisionsAsOf returns the latest revision observed at or before asOf
+// of every outage at a location.
+func (m Memory) GetRevisionsAsOf(ctx context.Context, providerId, titleLat string, asOf time.Time) ([]outage.Revision, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []outage.Revision
+	for _, revisions := range s.revisions {
+		var latest *outage.Revision
+		for i, r := range revisions {
+			if r.Outage.ProviderId == providerId && r.Outage.Location.TitleLat == titleLat && !r.ObservedAt.After(asOf) {
+				latest = &revisions[i]
+			}
+		}
+		if latest != nil {
+			result = append(result, *latest)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].OutageRef < result[j].OutageRef
+	})
+	return result, nil
+}
+
+func (m Memory) SaveOutagesNotifying(ctx context.Context, outages []outage.Outage, notifications []outage.Notification) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveOutages(outages)
+	s.saveNotifications(notifications)
+	return nil
+}
+
+func (m Memory) SaveNotifications(ctx context.Context, notifications ...outage.Notification) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveNotifications(notifications)
+	return nil
+}
+
+func (s *memoryState) saveNotifications(notifications []outage.Notification) {
+	for _, n := range notifications {
+		if _, queued := s.outbox[n.Id]; !queued {
+			s.outbox[n.Id] = memoryNotification{Notification: n}
+		}
+	}
+}
+
+func (m Memory) ClaimNotifications(ctx context.Context, owner string, now, until time.Time, limit int) ([]outage.Notification, error) {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []memoryNotification
+	for _, n := range s.outbox {
+		if n.DeliveredAt.IsZero() && !n.Notification.NextAttemptAt.After(now) && !n.ClaimedUntil.After(now) {
+			due = append(due, n)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].Notification.NextAttemptAt.Before(due[j].Notification.NextAttemptAt)
+	})
+	var claimed []outage.Notification
+	for _, n := range lo.Slice(due, 0, limit) {
+		n.ClaimedBy, n.ClaimedUntil = owner, until
+		s.outbox[n.Notification.Id] = n
+		claimed = append(claimed, n.Notification)
+	}
+	return claimed, nil
+}
+
+func (m Memory) CompleteNotification(ctx context.Context, id string, deliveredAt time.Time) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, found := s.outbox[id]
+	if !found {
+		return fmt.Errorf("complete notification %s: %w", id, outage.ErrNoNotification)
+	}
+	n.DeliveredAt, n.ClaimedBy, n.ClaimedUntil = deliveredAt, "", time.Time{}
+	s.outbox[id] = n
+	return nil
+}
+
+func (m Memory) RetryNotification(ctx context.Context, id string, nextAttemptAt time.Time, lastErr string) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, found := s.outbox[id]
+	if !found {
+		return fmt.Errorf("retry notification %s: %w", id, outage.ErrNoNotification)
+	}
+	n.Notification.Attempts++
+	n.Notification.NextAttemptAt, n.Notification.LastError = nextAttemptAt, lastErr
+	n.ClaimedBy, n.ClaimedUntil = "", time.Time{}
+	s.outbox[id] = n
+	return nil
+}
+
+func (m Memory) AcquireLease(ctx context.Context, name, owner string, now, until time.Time) (bool, error) {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease, found := s.leases[name]; found && lease.owner != owner && lease.until.After(now) {
+		return false, nil
+	}
+	s.leases[name] = memoryLease{owner, until}
+	return true, nil
+}
+
+func (m Memory) ReleaseLease(ctx context.Context, name, owner string) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leases[name].owner == owner {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// runsKept is how many of a provider's runs the journal keeps in memory
+// and in SQL, oldest dropped first. Dynamo expires runs by their TTL.
+const runsKept = 500
+
+func (m Memory) SaveRun(ctx context.Context, r outage.Run) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := append(s.runs[r.ProviderId], r)
+	if len(runs) > runsKept {
+		runs = slices.Clone(runs[len(runs)-runsKept:])
+	}
+	s.runs[r.ProviderId] = runs
+	return nil
+}
+
+// RequestRefresh keeps the request out of the snapshot, like the leases:
+// memory serves a single replica, and a restart refreshes anyway.
+func (m Memory) RequestRefresh(ctx context.Context, providerId string, at time.Time) error {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[providerId] = at
+	return nil
+}
+
+func (m Memory) TakeRefreshRequest(ctx context.Context, providerId string) (bool, error) {
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.requests[providerId]
+	delete(s.requests, providerId)
+	return found, nil
+}
+
+func (m Memory) GetRuns(ctx context.Context, providerId string, limit int) ([]outage.Run, error) {
+	s := m.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored := s.runs[providerId]
+	runs := make([]outage.Run, 0, min(limit, len(stored)))
+	for i := len(stored) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, stored[i])
+	}
+	return runs, nil
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MemorySnapshot(t *testing.T) {
+	ctx := context.Background()
+	now := func() time.Time {
+		return testNow
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	m, err := NewMemory(path, now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := outage.Outage{
+		ProviderId:  "water.gov.ge",
+		Kind:        outage.KindWater,
+		Start:       testNow.Add(-8 * time.Hour),
+		End:         testNow.Add(-time.Hour),
+		Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+		AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ."},
+		Status:      outage.StatusActive,
+	}
+	active := ended
+	active.Start = testNow.Add(-time.Hour)
+	active.End = testNow.Add(4 * time.Hour)
+	center := outage.Center{
+		ProviderId: "water.gov.ge",
+		Location:   outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+		Problem:    true,
+	}
+	manual := outage.Outage{Id: "3f2a", ProviderId: outage.ManualProviderId, Start: testNow, Reporter: "nino"}
+	report := outage.CrowdReport{OutageRef: "manual/3f2a", Reporter: "bot:1", Status: outage.ReportRestored, ReportedAt: testNow}
+	assert.NoError(t, m.SaveOutages(ctx, ended, active))
+	assert.NoError(t, m.SaveCenters(ctx, center))
+	assert.NoError(t, m.SaveManualOutage(ctx, manual))
+	assert.NoError(t, m.SaveCrowdReport(ctx, report))
+	revision := outage.Revision{OutageRef: active.Ref(), ObservedAt: testNow, Outage: active}
+	assert.NoError(t, m.SaveRevision(ctx, revision))
+	run := outage.Run{ProviderId: "water.gov.ge", Reason: outage.ReasonStartup, StartedAt: testNow, EndedAt: testNow, Parsed: 2, Saved: 2}
+	assert.NoError(t, m.SaveRun(ctx, run))
+	if err := m.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewMemory(path, now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outages, err := restored.GetOutages(ctx, "water.gov.ge", "ozurgetis")
+	assert.NoError(t, err)
+	assert.Equal(t, []outage.Outage{active}, outages)
+	started, err := restored.GetOutagesStartedBetween(ctx, "water.gov.ge", testNow.Add(-24*time.Hour), testNow)
+	assert.NoError(t, err)
+	assert.Equal(t, []outage.Outage{ended, active}, started)
+	centers, err := restored.GetCenters(ctx, "water.gov.ge")
+	assert.NoError(t, err)
+	center.FirstSeen, center.LastSeen = testNow, testNow
+	assert.Equal(t, []outage.Center{center}, centers)
+	history, err := restored.GetCenterHistory(ctx, "water.gov.ge", "7")
+	assert.NoError(t, err)
+	assert.Equal(t, []outage.CenterStatus{{LocationId: "7", Problem: true, ObservedAt: testNow}}, history)
+	got, err := restored.GetManualOutage(ctx, "3f2a")
+	assert.NoError(t, err)
+	assert.Equal(t, manual, got)
+	reports, err := restored.GetCrowdReports(ctx, "manual/3f2a")
+	assert.NoError(t, err)
+	assert.Equal(t, []outage.CrowdReport{report}, reports)
+	revisions, err := restored.GetRevisions(ctx, active.Ref())
+	assert.NoError(t, err)
+	assert.Equal(t, []outage.Revision{revision}, revisions)
+	runs, err := restored.GetRuns(ctx, "water.gov.ge", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []outage.Run{run}, runs)
+}
+
+func Test_MemoryLeases(t *testing.T) {
+	m, err := NewMemory("", time.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLeases(t, m)
+}
+
+func Test_MemorySameStart(t *testing.T) {
+	now := func() time.Time {
+		return testNow
+	}
+	m, err := NewMemory("", now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSameStart(t, m, "telasi.ge")
+}
+
+func Test_MemoryNoEnd(t *testing.T) {
+	now := func() time.Time {
+		return testNow
+	}
+	m, err := NewMemory("", now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNoEnd(t, m, "tbilisienergy.ge")
+}
+
+func Test_MemoryOtherZones(t *testing.T) {
+	m, err := NewMemory("", time.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOtherZones(t, func(now func() time.Time) outageStore {
+		m.now = now
+		return m
+	}, "batumiwater.ge")
+}
+
+func Test_MemoryOutagesPage(t *testing.T) {
+	now := func() time.Time {
+		return testNow
+	}
+	m, err := NewMemory("", now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOutagesPage(t, m, "gwp.ge")
+}
+
+func Test_MemoryRuns(t *testing.T) {
+	m, err := NewMemory("", time.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRuns(t, m)
+	testRunsKept(t, m)
+}
+
+func Test_MemoryCenters(t *testing.T) {
+	m, err := NewMemory("", time.Now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCenters(t, func(now func() time.Time) centerStore {
+		m.now = now
+		return m
+	})
+}
@@ -0,0 +1,81 @@
+-- Times are unix seconds (crowd reports: nanoseconds) so the same schema
+-- runs on PostgreSQL and SQLite and sorts as numbers on both.
+CREATE TABLE outages (
+    provider_id        TEXT    NOT NULL,
+    location_title_lat TEXT    NOT NULL,
+    start_at           BIGINT  NOT NULL,
+    end_at             BIGINT  NOT NULL,
+    kind               TEXT    NOT NULL,
+    location_id        TEXT    NOT NULL,
+    title_ge           TEXT    NOT NULL,
+    lat                TEXT    NOT NULL,
+    lng                TEXT    NOT NULL,
+    affected_customers INTEGER NOT NULL,
+    status             TEXT    NOT NULL,
+    announcement_uri   TEXT    NOT NULL,
+    source             TEXT    NOT NULL,
+    extra              TEXT    NOT NULL,
+    PRIMARY KEY (provider_id, location_title_lat, start_at)
+);
+
+CREATE INDEX outages_location_end ON outages (location_title_lat, end_at);
+
+CREATE INDEX outages_time_range ON outages (start_at, end_at);
+
+CREATE TABLE outage_addresses (
+    provider_id        TEXT   NOT NULL,
+    location_title_lat TEXT   NOT NULL,
+    start_at           BIGINT NOT NULL,
+    address            TEXT   NOT NULL,
+    position           INTEGER NOT NULL,
+    PRIMARY KEY (provider_id, location_title_lat, start_at, address)
+);
+
+CREATE INDEX outage_addresses_address ON outage_addresses (address);
+
+CREATE TABLE manual_outages (
+    id                 TEXT    NOT NULL PRIMARY KEY,
+    kind               TEXT    NOT NULL,
+    location_title_lat TEXT    NOT NULL,
+    start_at           BIGINT  NOT NULL,
+    end_at             BIGINT  NOT NULL,
+    location_id        TEXT    NOT NULL,
+    title_ge           TEXT    NOT NULL,
+    affected_customers INTEGER NOT NULL,
+    addresses          TEXT    NOT NULL,
+    status             TEXT    NOT NULL,
+    reporter           TEXT    NOT NULL,
+    extra              TEXT    NOT NULL
+);
+
+CREATE INDEX manual_outages_location ON manual_outages (kind, location_title_lat);
+
+CREATE TABLE centers (
+    provider_id TEXT    NOT NULL,
+    location_id TEXT    NOT NULL,
+    title_ge    TEXT    NOT NULL,
+    title_lat   TEXT    NOT NULL,
+    lat         TEXT    NOT NULL,
+    lng         TEXT    NOT NULL,
+    problem     BOOLEAN NOT NULL,
+    first_seen  BIGINT  NOT NULL,
+    last_seen   BIGINT  NOT NULL,
+    PRIMARY KEY (provider_id, location_id)
+);
+
+CREATE TABLE center_history (
+    provider_id TEXT    NOT NULL,
+    location_id TEXT    NOT NULL,
+    observed_at BIGINT  NOT NULL,
+    problem     BOOLEAN NOT NULL,
+    PRIMARY KEY (provider_id, location_id, observed_at)
+);
+
+CREATE TABLE crowd_reports (
+    outage_ref  TEXT   NOT NULL,
+    reported_at BIGINT NOT NULL,
+    reporter    TEXT   NOT NULL,
+    address     TEXT   NOT NULL,
+    status      TEXT   NOT NULL,
+    PRIMARY KEY (outage_ref, reported_at, reporter)
+);
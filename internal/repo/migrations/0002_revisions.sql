@@ -0,0 +1,10 @@
+-- Every observed version of an outage, observed_at in nanoseconds. The
+-- outage itself is kept as JSON since revisions are only ever read back
+-- whole.
+CREATE TABLE outage_revisions (
+    outage_ref  TEXT   NOT NULL,
+    observed_at BIGINT NOT NULL,
+    changed     TEXT   NOT NULL,
+    outage      TEXT   NOT NULL,
+    PRIMARY KEY (outage_ref, observed_at)
+);
@@ -0,0 +1,5 @@
+-- Lets revisions be looked up by location for as-of queries. Rows written
+-- before this migration keep empty columns.
+ALTER TABLE outage_revisions ADD COLUMN provider_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE outage_revisions ADD COLUMN location_title_lat TEXT NOT NULL DEFAULT '';
+CREATE INDEX outage_revisions_location ON outage_revisions (provider_id, location_title_lat, observed_at);
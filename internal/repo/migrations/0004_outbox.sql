@@ -0,0 +1,18 @@
+-- Notifications queued with the outage writes they are about, times in
+-- nanoseconds. A row is due while delivered_at is 0 and next_attempt_at has
+-- passed, and free to claim once claimed_until has passed.
+CREATE TABLE notification_outbox (
+    id              TEXT    NOT NULL PRIMARY KEY,
+    outage_ref      TEXT    NOT NULL,
+    changed         TEXT    NOT NULL,
+    outage          TEXT    NOT NULL,
+    created_at      BIGINT  NOT NULL,
+    attempts        INTEGER NOT NULL,
+    next_attempt_at BIGINT  NOT NULL,
+    last_error      TEXT    NOT NULL,
+    claimed_by      TEXT    NOT NULL,
+    claimed_until   BIGINT  NOT NULL,
+    delivered_at    BIGINT  NOT NULL
+);
+
+CREATE INDEX notification_outbox_due ON notification_outbox (delivered_at, next_attempt_at);
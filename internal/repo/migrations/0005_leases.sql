@@ -0,0 +1,6 @@
+-- Named leases held by one owner until expires_at, in nanoseconds.
+CREATE TABLE leases (
+    name       TEXT   NOT NULL PRIMARY KEY,
+    owner      TEXT   NOT NULL,
+    expires_at BIGINT NOT NULL
+);
@@ -0,0 +1,14 @@
+-- The journal of refresh runs, times in nanoseconds and errors as a JSON
+-- array.
+CREATE TABLE refresh_runs (
+    provider_id TEXT    NOT NULL,
+    started_at  BIGINT  NOT NULL,
+    ended_at    BIGINT  NOT NULL,
+    reason      TEXT    NOT NULL,
+    pages       INTEGER NOT NULL,
+    cache_hits  INTEGER NOT NULL,
+    parsed      INTEGER NOT NULL,
+    saved       INTEGER NOT NULL,
+    errors      TEXT    NOT NULL,
+    PRIMARY KEY (provider_id, started_at)
+);
@@ -0,0 +1,56 @@
+-- outage_key tells apart outages a provider lists at one location with the
+-- same start. A primary key cannot be altered in place on SQLite, so both
+-- tables are rebuilt.
+CREATE TABLE outages_keyed (
+    provider_id        TEXT    NOT NULL,
+    location_title_lat TEXT    NOT NULL,
+    start_at           BIGINT  NOT NULL,
+    outage_key         TEXT    NOT NULL DEFAULT '',
+    end_at             BIGINT  NOT NULL,
+    kind               TEXT    NOT NULL,
+    location_id        TEXT    NOT NULL,
+    title_ge           TEXT    NOT NULL,
+    lat                TEXT    NOT NULL,
+    lng                TEXT    NOT NULL,
+    affected_customers INTEGER NOT NULL,
+    status             TEXT    NOT NULL,
+    announcement_uri   TEXT    NOT NULL,
+    source             TEXT    NOT NULL,
+    extra              TEXT    NOT NULL,
+    PRIMARY KEY (provider_id, location_title_lat, start_at, outage_key)
+);
+
+INSERT INTO outages_keyed (
+    provider_id, location_title_lat, start_at, end_at, kind, location_id, title_ge, lat, lng,
+    affected_customers, status, announcement_uri, source, extra
+) SELECT
+    provider_id, location_title_lat, start_at, end_at, kind, location_id, title_ge, lat, lng,
+    affected_customers, status, announcement_uri, source, extra
+FROM outages;
+
+DROP TABLE outages;
+
+ALTER TABLE outages_keyed RENAME TO outages;
+
+CREATE INDEX outages_location_end ON outages (location_title_lat, end_at);
+
+CREATE INDEX outages_time_range ON outages (start_at, end_at);
+
+CREATE TABLE outage_addresses_keyed (
+    provider_id        TEXT    NOT NULL,
+    location_title_lat TEXT    NOT NULL,
+    start_at           BIGINT  NOT NULL,
+    outage_key         TEXT    NOT NULL DEFAULT '',
+    address            TEXT    NOT NULL,
+    position           INTEGER NOT NULL,
+    PRIMARY KEY (provider_id, location_title_lat, start_at, outage_key, address)
+);
+
+INSERT INTO outage_addresses_keyed (provider_id, location_title_lat, start_at, address, position)
+SELECT provider_id, location_title_lat, start_at, address, position FROM outage_addresses;
+
+DROP TABLE outage_addresses;
+
+ALTER TABLE outage_addresses_keyed RENAME TO outage_addresses;
+
+CREATE INDEX outage_addresses_address ON outage_addresses (address);
@@ -0,0 +1,6 @@
+-- Refreshes requested of whichever replica refreshes the provider, taken
+-- by it when it polls; requested_at in nanoseconds.
+CREATE TABLE refresh_requests (
+    provider_id  TEXT   NOT NULL PRIMARY KEY,
+    requested_at BIGINT NOT NULL
+);
@@ -0,0 +1,467 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/samber/lo"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQL stores everything Dynamo does in PostgreSQL or SQLite. Both run the
+// same schema; queries are written with ? placeholders and rebound for
+// PostgreSQL.
+type SQL struct {
+	db     *sql.DB
+	driver string
+	now    func() time.Time
+	sl     *slog.Logger
+}
+
+func NewSQL(ctx context.Context, driver, dsn string, now func() time.Time, sl *slog.Logger) (SQL, error) {
+	handleErr := func(err error) (SQL, error) {
+		return SQL{}, fmt.Errorf("new sql %s: %w", driver, err)
+	}
+	var driverName string
+	switch driver {
+	case DriverPostgres:
+		driverName = "pgx"
+	case DriverSQLite:
+		driverName = "sqlite"
+	default:
+		return handleErr(fmt.Errorf("%w: %q", errUnknownDriver, driver))
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return handleErr(err)
+	}
+	if driver == DriverSQLite {
+		// SQLite allows one writer; a single connection keeps writers
+		// from failing with SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return handleErr(err)
+	}
+	return SQL{db, driver, now, sl}, nil
+}
+
+func (s SQL) Close() error {
+	return s.db.Close()
+}
+
+// Migrate applies the embedded migrations that are not recorded in
+// schema_migrations yet, each in its own transaction.
+func (s SQL) Migrate(ctx context.Context) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER NOT NULL PRIMARY KEY,
+		applied_at BIGINT  NOT NULL
+	)`); err != nil {
+		return handleErr(err)
+	}
+	applied := make(map[int]bool)
+	rows, err := s.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return handleErr(err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return handleErr(err)
+		}
+		applied[version] = true
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return handleErr(err)
+	}
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return handleErr(err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		base := strings.TrimPrefix(name, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(base, "_", 2)[0])
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: %w", base, err))
+		}
+		if applied[version] {
+			continue
+		}
+		raw, err := migrations.ReadFile(name)
+		if err != nil {
+			return handleErr(err)
+		}
+		if err := s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range splitStatements(string(raw)) {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return fmt.Errorf("%s: %w", base, err)
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), version, s.now().Unix())
+			return err
+		}); err != nil {
+			return handleErr(err)
+		}
+		s.sl.Info("applied migration", slog.String("migration", base))
+	}
+	return nil
+}
+
+func splitStatements(raw string) []string {
+	var stmts []string
+	for _, stmt := range strings.Split(raw, ";\n") {
+		var lines []string
+		for _, line := range strings.Split(stmt, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				lines = append(lines, line)
+			}
+		}
+		if stmt = strings.TrimSpace(strings.Join(lines, "\n")); stmt != "" {
+			stmts = append(stmts, strings.TrimSuffix(stmt, ";"))
+		}
+	}
+	return stmts
+}
+
+// rebind turns ? placeholders into $n for PostgreSQL.
+func (s SQL) rebind(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+func (s SQL) inTx(ctx context.Context, do func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := do(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+func marshalExtra(extra map[string]string) (string, error) {
+	if len(extra) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(extra)
+	return string(raw), err
+}
+
+func unmarshalExtra(raw string) (map[string]string, error) {
+	var extra map[string]string
+	if err := json.Unmarshal([]byte(raw), &extra); err != nil {
+		return nil, err
+	}
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	return extra, nil
+}
+
+func (s SQL) SaveOutages(ctx context.Context, outages ...outage.Outage) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save outages: %w", err)
+	}
+	if len(outages) == 0 {
+		return nil
+	}
+	if err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.saveOutages(ctx, tx, outages)
+	}); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+func (s SQL) saveOutages(ctx context.Context, tx *sql.Tx, outages []outage.Outage) error {
+	upsert := s.rebind(`INSERT INTO outages (
+		provider_id, location_title_lat, start_at, outage_key, end_at, kind, location_id, title_ge, lat, lng,
+		affected_customers, status, announcement_uri, source, extra
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (provider_id, location_title_lat, start_at, outage_key) DO UPDATE SET
+		end_at = excluded.end_at,
+		kind = excluded.kind,
+		location_id = excluded.location_id,
+		title_ge = excluded.title_ge,
+		lat = excluded.lat,
+		lng = excluded.lng,
+		affected_customers = excluded.affected_customers,
+		status = excluded.status,
+		announcement_uri = excluded.announcement_uri,
+		source = excluded.source,
+		extra = excluded.extra`)
+	deleteAddresses := s.rebind(`DELETE FROM outage_addresses WHERE provider_id = ? AND location_title_lat = ? AND start_at = ? AND outage_key = ?`)
+	insertAddress := s.rebind(`INSERT INTO outage_addresses (provider_id, location_title_lat, start_at, outage_key, address, position) VALUES (?, ?, ?, ?, ?, ?)`)
+	for _, o := range outages {
+		extra, err := marshalExtra(o.Extra)
+		if err != nil {
+			return err
+		}
+		key := []any{o.ProviderId, o.Location.TitleLat, unix(o.Start), o.Key}
+		if _, err := tx.ExecContext(ctx, upsert, append(key,
+			unix(o.End), string(o.Kind), o.Location.Id, o.Location.TitleGe, o.Location.Lat, o.Location.Lng,
+			o.AffectedCustomers, string(o.Status), o.AnnouncementURI, string(o.Source), extra,
+		)...); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, deleteAddresses, key...); err != nil {
+			return err
+		}
+		for i, addr := range lo.Uniq(o.AddressesGe) {
+			if _, err := tx.ExecContext(ctx, insertAddress, append(key, addr, i)...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetOutages returns the outages at a location that have not ended yet,
+// counting the ones without an end (stored as 0) as ongoing.
+func (s SQL) GetOutages(ctx context.Context, providerId, titleLat string) ([]outage.Outage, error) {
+	outages, err := s.queryOutages(ctx, `WHERE location_title_lat = ? AND provider_id = ? AND (end_at > ? OR end_at = 0)`, titleLat, providerId, s.now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("get outages: %w", err)
+	}
+	return outages, nil
+}
+
+// GetCurrentOutages returns the provider's outages of kind that have not
+// ended yet at any location.
+func (s SQL) GetCurrentOutages(ctx context.Context, providerId string, kind outage.Kind) ([]outage.Outage, error) {
+	outages, err := s.queryOutages(ctx, `WHERE provider_id = ? AND kind = ? AND (end_at > ? OR end_at = 0)`, providerId, string(kind), s.now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("get current outages: %w", err)
+	}
+	return outages, nil
+}
+
+func (s SQL) GetOutage(ctx context.Context, providerId, titleLat string, start time.Time, key string) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("get outage %s/%s: %w", providerId, titleLat, err)
+	}
+	outages, err := s.queryOutages(ctx, `WHERE provider_id = ? AND location_title_lat = ? AND start_at = ? AND outage_key = ?`, providerId, titleLat, start.Unix(), key)
+	if err != nil {
+		return handleErr(err)
+	}
+	if len(outages) == 0 {
+		return handleErr(outage.ErrNotFound)
+	}
+	return outages[0], nil
+}
+
+// GetOutagesStartedBetween returns the provider's outages that started in
+// [from, to) at any location.
+func (s SQL) GetOutagesStartedBetween(ctx context.Context, providerId string, from, to time.Time) ([]outage.Outage, error) {
+	outages, err := s.queryOutages(ctx, `WHERE provider_id = ? AND start_at >= ? AND start_at < ?`, providerId, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("get outages started between: %w", err)
+	}
+	return outages, nil
+}
+
+// sqlCursor is the primary key of the last outage of a page.
+type sqlCursor struct {
+	Start    int64  `json:"start"`
+	TitleLat string `json:"titleLat"`
+	Key      string `json:"key"`
+}
+
+// GetOutagesPage returns up to limit of the provider's outages after cursor,
+// ended or not, and the cursor of the next page, which is empty after the
+// last one. It reads the keys of the page first, so the outages and their
+// addresses are read over a key range.
+func (s SQL) GetOutagesPage(ctx context.Context, providerId, cursor string, limit int) ([]outage.Outage, string, error) {
+	handleErr := func(err error) ([]outage.Outage, string, error) {
+		return nil, "", fmt.Errorf("get outages page: %w", err)
+	}
+	where, args := `WHERE provider_id = ?`, []any{providerId}
+	if cursor != "" {
+		var after sqlCursor
+		if err := json.Unmarshal([]byte(cursor), &after); err != nil {
+			return handleErr(err)
+		}
+		where += ` AND (start_at, location_title_lat, outage_key) > (?, ?, ?)`
+		args = append(args, after.Start, after.TitleLat, after.Key)
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT start_at, location_title_lat, outage_key FROM outages
+	`+where+`
+	ORDER BY start_at, location_title_lat, outage_key
+	LIMIT ?`), append(args, limit+1)...)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer rows.Close()
+	var keys []sqlCursor
+	for rows.Next() {
+		var key sqlCursor
+		if err := rows.Scan(&key.Start, &key.TitleLat, &key.Key); err != nil {
+			return handleErr(err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return handleErr(err)
+	}
+	rows.Close()
+	var next string
+	if len(keys) > limit {
+		last := keys[limit-1]
+		raw, err := json.Marshal(last)
+		if err != nil {
+			return handleErr(err)
+		}
+		next = string(raw)
+		where += ` AND (start_at, location_title_lat, outage_key) <= (?, ?, ?)`
+		args = append(args, last.Start, last.TitleLat, last.Key)
+	}
+	outages, err := s.queryOutages(ctx, where, args...)
+	if err != nil {
+		return handleErr(err)
+	}
+	return outages, next, nil
+}
+
+// queryOutages reads the outages matching where, oldest first, and their
+// addresses with a second query over the same filter.
+func (s SQL) queryOutages(ctx context.Context, where string, args ...any) ([]outage.Outage, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT
+		provider_id, location_title_lat, start_at, outage_key, end_at, kind, location_id, title_ge, lat, lng,
+		affected_customers, status, announcement_uri, source, extra
+	FROM outages
+	`+where+`
+	ORDER BY start_at`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var outages []outage.Outage
+	for rows.Next() {
+		var (
+			o               outage.Outage
+			start, end      int64
+			kind, status    string
+			source, extra   string
+			announcementURI string
+		)
+		if err := rows.Scan(
+			&o.ProviderId, &o.Location.TitleLat, &start, &o.Key, &end, &kind, &o.Location.Id, &o.Location.TitleGe,
+			&o.Location.Lat, &o.Location.Lng, &o.AffectedCustomers, &status, &announcementURI, &source, &extra,
+		); err != nil {
+			return nil, err
+		}
+		o.Start, o.End = fromUnix(start), fromUnix(end)
+		o.Kind, o.Status, o.Source = outage.Kind(kind), outage.Status(status), outage.Source(source)
+		o.AnnouncementURI = announcementURI
+		if o.Extra, err = unmarshalExtra(extra); err != nil {
+			return nil, err
+		}
+		outages = append(outages, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(outages) == 0 {
+		return nil, nil
+	}
+	addresses, err := s.outageAddresses(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range outages {
+		outages[i].AddressesGe = addresses[sqlOutageKey{o.ProviderId, o.Location.TitleLat, unix(o.Start), o.Key}]
+	}
+	return outages, nil
+}
+
+type sqlOutageKey struct {
+	providerId string
+	titleLat   string
+	start      int64
+	key        string
+}
+
+// outageAddresses reads the addresses of every outage matching where in
+// one query, in the order they were listed.
+func (s SQL) outageAddresses(ctx context.Context, where string, args ...any) (map[sqlOutageKey][]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT
+		provider_id, location_title_lat, start_at, outage_key, address
+	FROM outage_addresses
+	WHERE (provider_id, location_title_lat, start_at, outage_key) IN (
+		SELECT provider_id, location_title_lat, start_at, outage_key FROM outages
+		`+where+`
+	)
+	ORDER BY position`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	addresses := make(map[sqlOutageKey][]string)
+	for rows.Next() {
+		var (
+			key  sqlOutageKey
+			addr string
+		)
+		if err := rows.Scan(&key.providerId, &key.titleLat, &key.start, &key.key, &addr); err != nil {
+			return nil, err
+		}
+		addresses[key] = append(addresses[key], addr)
+	}
+	return addresses, rows.Err()
+}
@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// SaveCenters upserts the catalog entry of every center and appends to
+// center_history whenever a center's problem flag differs from the stored one.
+func (s SQL) SaveCenters(ctx context.Context, centers ...outage.Center) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save centers: %w", err)
+	}
+	now := s.now().Unix()
+	selectProblem := s.rebind(`SELECT problem FROM centers WHERE provider_id = ? AND location_id = ?`)
+	upsert := s.rebind(`INSERT INTO centers (
+		provider_id, location_id, title_ge, title_lat, lat, lng, problem, first_seen, last_seen
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (provider_id, location_id) DO UPDATE SET
+		title_ge = excluded.title_ge,
+		title_lat = excluded.title_lat,
+		lat = excluded.lat,
+		lng = excluded.lng,
+		problem = excluded.problem,
+		last_seen = excluded.last_seen`)
+	insertHistory := s.rebind(`INSERT INTO center_history (provider_id, location_id, observed_at, problem) VALUES (?, ?, ?, ?)
+	ON CONFLICT (provider_id, location_id, observed_at) DO UPDATE SET problem = excluded.problem`)
+	if err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, c := range centers {
+			var oldProblem bool
+			err := tx.QueryRowContext(ctx, selectProblem, c.ProviderId, c.Location.Id).Scan(&oldProblem)
+			known := err == nil
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, upsert,
+				c.ProviderId, c.Location.Id, c.Location.TitleGe, c.Location.TitleLat, c.Location.Lat, c.Location.Lng,
+				c.Problem, now, now,
+			); err != nil {
+				return err
+			}
+			if known && oldProblem == c.Problem {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, insertHistory, c.ProviderId, c.Location.Id, now, c.Problem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+func (s SQL) GetCenters(ctx context.Context, providerId string) ([]outage.Center, error) {
+	handleErr := func(err error) ([]outage.Center, error) {
+		return nil, fmt.Errorf("get centers: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT
+		location_id, title_ge, title_lat, lat, lng, problem, first_seen, last_seen
+	FROM centers WHERE provider_id = ? ORDER BY location_id`), providerId)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer rows.Close()
+	var centers []outage.Center
+	for rows.Next() {
+		var (
+			c                   = outage.Center{ProviderId: providerId}
+			firstSeen, lastSeen int64
+		)
+		if err := rows.Scan(
+			&c.Location.Id, &c.Location.TitleGe, &c.Location.TitleLat, &c.Location.Lat, &c.Location.Lng,
+			&c.Problem, &firstSeen, &lastSeen,
+		); err != nil {
+			return handleErr(err)
+		}
+		c.FirstSeen, c.LastSeen = fromUnix(firstSeen), fromUnix(lastSeen)
+		centers = append(centers, c)
+	}
+	if err := rows.Err(); err != nil {
+		return handleErr(err)
+	}
+	return centers, nil
+}
+
+func (s SQL) GetCenterHistory(ctx context.Context, providerId, locationId string) ([]outage.CenterStatus, error) {
+	handleErr := func(err error) ([]outage.CenterStatus, error) {
+		return nil, fmt.Errorf("get center history: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT problem, observed_at FROM center_history
+	WHERE provider_id = ? AND location_id = ? ORDER BY observed_at`), providerId, locationId)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer rows.Close()
+	var history []outage.CenterStatus
+	for rows.Next() {
+		var (
+			status     = outage.CenterStatus{LocationId: locationId}
+			observedAt int64
+		)
+		if err := rows.Scan(&status.Problem, &observedAt); err != nil {
+			return handleErr(err)
+		}
+		status.ObservedAt = fromUnix(observedAt)
+		history = append(history, status)
+	}
+	if err := rows.Err(); err != nil {
+		return handleErr(err)
+	}
+	return history, nil
+}
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+func (s SQL) SaveCrowdReport(ctx context.Context, r outage.CrowdReport) error {
+	if _, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO crowd_reports (outage_ref, reported_at, reporter, address, status)
+	VALUES (?, ?, ?, ?, ?)`),
+		r.OutageRef, r.ReportedAt.UnixNano(), r.Reporter, r.Address, string(r.Status),
+	); err != nil {
+		return fmt.Errorf("save crowd report: %w", err)
+	}
+	return nil
+}
+
+func (s SQL) GetCrowdReports(ctx context.Context, outageRef string) ([]outage.CrowdReport, error) {
+	handleErr := func(err error) ([]outage.CrowdReport, error) {
+		return nil, fmt.Errorf("get crowd reports: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT reported_at, reporter, address, status FROM crowd_reports
+	WHERE outage_ref = ? ORDER BY reported_at`), outageRef)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer rows.Close()
+	var reports []outage.CrowdReport
+	for rows.Next() {
+		var (
+			r          = outage.CrowdReport{OutageRef: outageRef}
+			reportedAt int64
+			status     string
+		)
+		if err := rows.Scan(&reportedAt, &r.Reporter, &r.Address, &status); err != nil {
+			return handleErr(err)
+		}
+		r.ReportedAt = time.Unix(0, reportedAt).UTC()
+		r.Status = outage.ReportStatus(status)
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return handleErr(err)
+	}
+	return reports, nil
+}
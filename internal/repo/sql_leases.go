@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AcquireLease inserts the lease or takes it over when owner holds it
+// already or it expired; the conditional upsert touches no row otherwise.
+func (s SQL) AcquireLease(ctx context.Context, name, owner string, now, until time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO leases (name, owner, expires_at) VALUES (?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+	WHERE leases.owner = excluded.owner OR leases.expires_at <= ?`), name, owner, until.UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("acquire lease %s: %w", name, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("acquire lease %s: %w", name, err)
+	}
+	return affected == 1, nil
+}
+
+func (s SQL) ReleaseLease(ctx context.Context, name, owner string) error {
+	if _, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM leases WHERE name = ? AND owner = ?`), name, owner); err != nil {
+		return fmt.Errorf("release lease %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+const manualColumns = `id, kind, location_title_lat, start_at, end_at, location_id, title_ge,
+	affected_customers, addresses, status, reporter, extra`
+
+func (s SQL) SaveManualOutage(ctx context.Context, o outage.Outage) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save manual outage %s: %w", o.Id, err)
+	}
+	addresses, err := json.Marshal(o.AddressesGe)
+	if err != nil {
+		return handleErr(err)
+	}
+	extra, err := marshalExtra(o.Extra)
+	if err != nil {
+		return handleErr(err)
+	}
+	if _, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO manual_outages (`+manualColumns+`)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET
+		kind = excluded.kind,
+		location_title_lat = excluded.location_title_lat,
+		start_at = excluded.start_at,
+		end_at = excluded.end_at,
+		location_id = excluded.location_id,
+		title_ge = excluded.title_ge,
+		affected_customers = excluded.affected_customers,
+		addresses = excluded.addresses,
+		status = excluded.status,
+		reporter = excluded.reporter,
+		extra = excluded.extra`),
+		o.Id, string(o.Kind), o.Location.TitleLat, unix(o.Start), unix(o.End), o.Location.Id, o.Location.TitleGe,
+		o.AffectedCustomers, string(addresses), string(o.Status), o.Reporter, extra,
+	); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+func (s SQL) GetManualOutage(ctx context.Context, id string) (outage.Outage, error) {
+	handleErr := func(err error) (outage.Outage, error) {
+		return outage.Outage{}, fmt.Errorf("get manual outage %s: %w", id, err)
+	}
+	o, err := scanManual(s.db.QueryRowContext(ctx, s.rebind(`SELECT `+manualColumns+` FROM manual_outages WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return handleErr(outage.ErrNotFound)
+	}
+	if err != nil {
+		return handleErr(err)
+	}
+	return o, nil
+}
+
+func (s SQL) GetManualOutages(ctx context.Context) ([]outage.Outage, error) {
+	handleErr := func(err error) ([]outage.Outage, error) {
+		return nil, fmt.Errorf("get manual outages: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+manualColumns+` FROM manual_outages ORDER BY start_at`)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer rows.Close()
+	var outages []outage.Outage
+	for rows.Next() {
+		o, err := scanManual(rows)
+		if err != nil {
+			return handleErr(err)
+		}
+		outages = append(outages, o)
+	}
+	if err := rows.Err(); err != nil {
+		return handleErr(err)
+	}
+	return outages, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanManual(row scanner) (outage.Outage, error) {
+	var (
+		o                      = outage.Outage{ProviderId: outage.ManualProviderId, Source: outage.SourceManual}
+		start, end             int64
+		kind, status           string
+		rawAddresses, rawExtra string
+	)
+	if err := row.Scan(
+		&o.Id, &kind, &o.Location.TitleLat, &start, &end, &o.Location.Id, &o.Location.TitleGe,
+		&o.AffectedCustomers, &rawAddresses, &status, &o.Reporter, &rawExtra,
+	); err != nil {
+		return outage.Outage{}, err
+	}
+	o.Kind, o.Status = outage.Kind(kind), outage.Status(status)
+	o.Start, o.End = fromUnix(start), fromUnix(end)
+	if err := json.Unmarshal([]byte(rawAddresses), &o.AddressesGe); err != nil {
+		return outage.Outage{}, err
+	}
+	extra, err := unmarshalExtra(rawExtra)
+	if err != nil {
+		return outage.Outage{}, err
+	}
+	o.Extra = extra
+	return o, nil
+}
@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// SaveOutagesNotifying saves the outages and queues the notifications in
+// one transaction.
+func (s SQL) SaveOutagesNotifying(ctx context.Context, outages []outage.Outage, notifications []outage.Notification) error {
+	if err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.saveOutages(ctx, tx, outages); err != nil {
+			return err
+		}
+		return s.saveNotifications(ctx, tx, notifications)
+	}); err != nil {
+		return fmt.Errorf("save outages notifying: %w", err)
+	}
+	return nil
+}
+
+func (s SQL) SaveNotifications(ctx context.Context, notifications ...outage.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.saveNotifications(ctx, tx, notifications)
+	}); err != nil {
+		return fmt.Errorf("save notifications: %w", err)
+	}
+	return nil
+}
+
+func (s SQL) saveNotifications(ctx context.Context, tx *sql.Tx, notifications []outage.Notification) error {
+	insert := s.rebind(`INSERT INTO notification_outbox (
+		id, outage_ref, changed, outage, created_at, attempts, next_attempt_at, last_error,
+		claimed_by, claimed_until, delivered_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, '', 0, 0)
+	ON CONFLICT (id) DO NOTHING`)
+	for _, n := range notifications {
+		stored, err := json.Marshal(n.Outage)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, insert,
+			n.Id, n.OutageRef, strings.Join(n.Changed, ","), string(stored), unixNano(n.CreatedAt),
+			n.Attempts, unixNano(n.NextAttemptAt), n.LastError,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimNotifications selects the due notifications and claims them one by
+// one, skipping any that another owner claimed in between.
+func (s SQL) ClaimNotifications(ctx context.Context, owner string, now, until time.Time, limit int) ([]outage.Notification, error) {
+	var claimed []outage.Notification
+	if err := s.inTx(ctx, func(tx *sql.Tx) error {
+		due, err := s.dueNotifications(ctx, tx, now, limit)
+		if err != nil {
+			return err
+		}
+		claim := s.rebind(`UPDATE notification_outbox SET claimed_by = ?, claimed_until = ?
+		WHERE id = ? AND delivered_at = 0 AND claimed_until <= ?`)
+		for _, n := range due {
+			res, err := tx.ExecContext(ctx, claim, owner, until.UnixNano(), n.Id, now.UnixNano())
+			if err != nil {
+				return err
+			}
+			if affected, err := res.RowsAffected(); err != nil {
+				return err
+			} else if affected == 1 {
+				claimed = append(claimed, n)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("claim notifications: %w", err)
+	}
+	return claimed, nil
+}
+
+func (s SQL) dueNotifications(ctx context.Context, tx *sql.Tx, now time.Time, limit int) ([]outage.Notification, error) {
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT
+		id, outage_ref, changed, outage, created_at, attempts, next_attempt_at, last_error
+	FROM notification_outbox
+	WHERE delivered_at = 0 AND next_attempt_at <= ? AND claimed_until <= ?
+	ORDER BY next_attempt_at, id
+	LIMIT ?`), now.UnixNano(), now.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notifications []outage.Notification
+	for rows.Next() {
+		var (
+			n                        outage.Notification
+			changed, stored          string
+			createdAt, nextAttemptAt int64
+		)
+		if err := rows.Scan(&n.Id, &n.OutageRef, &changed, &stored, &createdAt, &n.Attempts, &nextAttemptAt, &n.LastError); err != nil {
+			return nil, err
+		}
+		if changed != "" {
+			n.Changed = strings.Split(changed, ",")
+		}
+		if err := json.Unmarshal([]byte(stored), &n.Outage); err != nil {
+			return nil, err
+		}
+		n.CreatedAt, n.NextAttemptAt = fromUnixNano(createdAt), fromUnixNano(nextAttemptAt)
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s SQL) CompleteNotification(ctx context.Context, id string, deliveredAt time.Time) error {
+	if err := s.updateNotification(ctx, `UPDATE notification_outbox SET delivered_at = ?, claimed_by = '', claimed_until = 0
+	WHERE id = ?`, deliveredAt.UnixNano(), id); err != nil {
+		return fmt.Errorf("complete notification %s: %w", id, err)
+	}
+	return nil
+}
+
+func (s SQL) RetryNotification(ctx context.Context, id string, nextAttemptAt time.Time, lastErr string) error {
+	if err := s.updateNotification(ctx, `UPDATE notification_outbox
+	SET attempts = attempts + 1, next_attempt_at = ?, last_error = ?, claimed_by = '', claimed_until = 0
+	WHERE id = ?`, nextAttemptAt.UnixNano(), lastErr, id); err != nil {
+		return fmt.Errorf("retry notification %s: %w", id, err)
+	}
+	return nil
+}
+
+func (s SQL) updateNotification(ctx context.Context, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return outage.ErrNoNotification
+	}
+	return nil
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec).UTC()
+}
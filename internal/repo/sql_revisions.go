@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// SaveRevision replaces a revision observed at the same time, so one
+// delivered again by the stream is kept once.
+func (s SQL) SaveRevision(ctx context.Context, r outage.Revision) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save revision: %w", err)
+	}
+	raw, err := json.Marshal(r.Outage)
+	if err != nil {
+		return handleErr(err)
+	}
+	if _, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO outage_revisions (
+		outage_ref, observed_at, changed, outage, provider_id, location_title_lat
+	) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (outage_ref, observed_at) DO UPDATE SET
+		changed = excluded.changed, outage = excluded.outage,
+		provider_id = excluded.provider_id, location_title_lat = excluded.location_title_lat`),
+		r.OutageRef, r.ObservedAt.UnixNano(), strings.Join(r.Changed, ","), string(raw),
+		r.Outage.ProviderId, r.Outage.Location.TitleLat,
+	); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+func (s SQL) GetRevisions(ctx context.Context, outageRef string) ([]outage.Revision, error) {
+	revisions, err := s.queryRevisions(ctx, `SELECT outage_ref, observed_at, changed, outage FROM outage_revisions
+	WHERE outage_ref = ? ORDER BY observed_at`, outageRef)
+	if err != nil {
+		return nil, fmt.Errorf("get revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// GetRevisionsAsOf returns the latest revision observed at or before asOf
+// of every outage at a location.
+func (s SQL) GetRevisionsAsOf(ctx context.Context, providerId, titleLat string, asOf time.Time) ([]outage.Revision, error) {
+	revisions, err := s.queryRevisions(ctx, `SELECT r.outage_ref, r.observed_at, r.changed, r.outage
+	FROM outage_revisions r
+	JOIN (
+		SELECT outage_ref, MAX(observed_at) AS observed_at FROM outage_revisions
+		WHERE provider_id = ? AND location_title_lat = ? AND observed_at <= ?
+		GROUP BY outage_ref
+	) latest ON latest.outage_ref = r.outage_ref AND latest.observed_at = r.observed_at
+	ORDER BY r.outage_ref`, providerId, titleLat, asOf.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("get revisions as of: %w", err)
+	}
+	return revisions, nil
+}
+
+func (s SQL) queryRevisions(ctx context.Context, query string, args ...any) ([]outage.Revision, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []outage.Revision
+	for rows.Next() {
+		var (
+			r               outage.Revision
+			observedAt      int64
+			changed, stored string
+		)
+		if err := rows.Scan(&r.OutageRef, &observedAt, &changed, &stored); err != nil {
+			return nil, err
+		}
+		r.ObservedAt = time.Unix(0, observedAt).UTC()
+		if changed != "" {
+			r.Changed = strings.Split(changed, ",")
+		}
+		if err := json.Unmarshal([]byte(stored), &r.Outage); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
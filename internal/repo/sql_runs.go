@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+)
+
+// SaveRun prunes the provider's runs beyond the latest runsKept in the same
+// transaction. The cutoff is NULL while there are fewer, which deletes none.
+func (s SQL) SaveRun(ctx context.Context, r outage.Run) error {
+	handleErr := func(err error) error {
+		return fmt.Errorf("save run %s: %w", r.ProviderId, err)
+	}
+	errs, err := json.Marshal(r.Errors)
+	if err != nil {
+		return handleErr(err)
+	}
+	if err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO refresh_runs (
+			provider_id, started_at, ended_at, reason, pages, cache_hits, parsed, saved, errors
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			r.ProviderId, unixNano(r.StartedAt), unixNano(r.EndedAt), string(r.Reason),
+			r.Pages, r.CacheHits, r.Parsed, r.Saved, string(errs),
+		); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM refresh_runs
+		WHERE provider_id = ? AND started_at < (
+			SELECT started_at FROM refresh_runs
+			WHERE provider_id = ?
+			ORDER BY started_at DESC
+			LIMIT 1 OFFSET ?
+		)`), r.ProviderId, r.ProviderId, runsKept-1)
+		return err
+	}); err != nil {
+		return handleErr(err)
+	}
+	return nil
+}
+
+func (s SQL) GetRuns(ctx context.Context, providerId string, limit int) ([]outage.Run, error) {
+	handleErr := func(err error) ([]outage.Run, error) {
+		return nil, fmt.Errorf("get runs %s: %w", providerId, err)
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT
+		started_at, ended_at, reason, pages, cache_hits, parsed, saved, errors
+	FROM refresh_runs
+	WHERE provider_id = ?
+	ORDER BY started_at DESC
+	LIMIT ?`), providerId, limit)
+	if err != nil {
+		return handleErr(err)
+	}
+	defer rows.Close()
+	var runs []outage.Run
+	for rows.Next() {
+		var (
+			r                  = outage.Run{ProviderId: providerId}
+			startedAt, endedAt int64
+			reason, errs       string
+		)
+		if err := rows.Scan(&startedAt, &endedAt, &reason, &r.Pages, &r.CacheHits, &r.Parsed, &r.Saved, &errs); err != nil {
+			return handleErr(err)
+		}
+		if err := json.Unmarshal([]byte(errs), &r.Errors); err != nil {
+			return handleErr(err)
+		}
+		r.Reason = outage.RunReason(reason)
+		r.StartedAt, r.EndedAt = fromUnixNano(startedAt), fromUnixNano(endedAt)
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return handleErr(err)
+	}
+	return runs, nil
+}
+
+// RequestRefresh keeps one pending request per provider; a request that is
+// pending already takes the later time.
+func (s SQL) RequestRefresh(ctx context.Context, providerId string, at time.Time) error {
+	if _, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO refresh_requests (provider_id, requested_at) VALUES (?, ?)
+	ON CONFLICT (provider_id) DO UPDATE SET requested_at = excluded.requested_at`), providerId, unixNano(at)); err != nil {
+		return fmt.Errorf("request refresh %s: %w", providerId, err)
+	}
+	return nil
+}
+
+// TakeRefreshRequest deletes the pending request, so that only one of the
+// replicas polling at once takes it.
+func (s SQL) TakeRefreshRequest(ctx context.Context, providerId string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM refresh_requests WHERE provider_id = ?`), providerId)
+	if err != nil {
+		return false, fmt.Errorf("take refresh request %s: %w", providerId, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("take refresh request %s: %w", providerId, err)
+	}
+	return affected == 1, nil
+}
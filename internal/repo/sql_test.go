@@ -0,0 +1,672 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/outage_monitor/internal/outage"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+// Postgres runs when OUTAGE_MONITOR_TEST_POSTGRES_URL points at a server,
+// e.g. docker run -e POSTGRES_PASSWORD=pg -p 5432:5432 postgres:16 and
+// postgres://postgres:pg@localhost:5432/postgres.
+const testPostgresURLEnv = "OUTAGE_MONITOR_TEST_POSTGRES_URL"
+
+var testNow = time.Date(2023, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func newTestSQLite(t *testing.T) SQL {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "outages.db")
+	return newTestSQL(t, DriverSQLite, dsn)
+}
+
+func newTestPostgres(t *testing.T) SQL {
+	t.Helper()
+	rawURL := os.Getenv(testPostgresURLEnv)
+	if rawURL == "" {
+		t.Skip(testPostgresURLEnv + " is not set")
+	}
+	ctx := context.Background()
+	admin := newTestSQL(t, DriverPostgres, rawURL)
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.db.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.db.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return newTestSQL(t, DriverPostgres, u.String())
+}
+
+func newTestSQL(t *testing.T, driver, dsn string) SQL {
+	t.Helper()
+	now := func() time.Time {
+		return testNow
+	}
+	s, err := NewSQL(context.Background(), driver, dsn, now, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func Test_SQLite(t *testing.T) {
+	testSQL(t, newTestSQLite(t))
+}
+
+func Test_Postgres(t *testing.T) {
+	testSQL(t, newTestPostgres(t))
+}
+
+func testSQL(t *testing.T, s SQL) {
+	ctx := context.Background()
+	t.Run("migrate twice", func(t *testing.T) {
+		assert.NoError(t, s.Migrate(ctx))
+	})
+	t.Run("outages", func(t *testing.T) {
+		ended := outage.Outage{
+			ProviderId:  "water.gov.ge",
+			Kind:        outage.KindWater,
+			Start:       testNow.Add(-8 * time.Hour),
+			End:         testNow.Add(-time.Hour),
+			Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+			AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ."},
+			Status:      outage.StatusActive,
+			Source:      outage.SourceOfficial,
+		}
+		active := ended
+		active.Start = testNow.Add(-time.Hour)
+		active.End = testNow.Add(4 * time.Hour)
+		active.AffectedCustomers = 1200
+		active.AddressesGe = []string{"ოზურგეთი გურიის ქ.", "ოზურგეთი ე.თაყაიშვილის ქ.", "ოზურგეთი გურიის ქ."}
+		active.Extra = map[string]string{outage.ExtraInterruption: outage.InterruptionEmergency}
+		if err := s.SaveOutages(ctx, ended, active); err != nil {
+			t.Fatal(err)
+		}
+		active.AffectedCustomers = 1300
+		if err := s.SaveOutages(ctx, active); err != nil {
+			t.Fatal(err)
+		}
+		outages, err := s.GetOutages(ctx, "water.gov.ge", "ozurgetis")
+		if err != nil {
+			t.Fatal(err)
+		}
+		active.AddressesGe = active.AddressesGe[:2]
+		assert.Equal(t, []outage.Outage{active}, outages)
+	})
+	t.Run("same start", func(t *testing.T) {
+		testSameStart(t, s, "telasi.ge")
+	})
+	t.Run("no end", func(t *testing.T) {
+		testNoEnd(t, s, "tbilisienergy.ge")
+	})
+	t.Run("outages page", func(t *testing.T) {
+		testOutagesPage(t, s, "gwp.ge")
+	})
+	t.Run("other zones", func(t *testing.T) {
+		testOtherZones(t, func(now func() time.Time) outageStore {
+			s := s
+			s.now = now
+			return s
+		}, "batumiwater.ge")
+	})
+	t.Run("centers", func(t *testing.T) {
+		center := outage.Center{
+			ProviderId: "water.gov.ge",
+			Location:   outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis", Lat: "41.92", Lng: "42.0"},
+		}
+		for _, problem := range []bool{false, false, true} {
+			center.Problem = problem
+			if err := s.SaveCenters(ctx, center); err != nil {
+				t.Fatal(err)
+			}
+		}
+		centers, err := s.GetCenters(ctx, "water.gov.ge")
+		if err != nil {
+			t.Fatal(err)
+		}
+		center.FirstSeen, center.LastSeen = testNow, testNow
+		assert.Equal(t, []outage.Center{center}, centers)
+		history, err := s.GetCenterHistory(ctx, "water.gov.ge", "7")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []outage.CenterStatus{{LocationId: "7", Problem: true, ObservedAt: testNow}}, history)
+	})
+	t.Run("center catalog", func(t *testing.T) {
+		testCenters(t, func(now func() time.Time) centerStore {
+			s := s
+			s.now = now
+			return s
+		})
+	})
+	t.Run("manual outages", func(t *testing.T) {
+		_, err := s.GetManualOutage(ctx, "missing")
+		assert.ErrorIs(t, err, outage.ErrNotFound)
+		manual := outage.Outage{
+			Id:          "3f2a",
+			ProviderId:  outage.ManualProviderId,
+			Kind:        outage.KindWater,
+			Start:       testNow,
+			Location:    outage.Location{Id: "rustavi", TitleGe: "რუსთავი", TitleLat: "rustavi"},
+			AddressesGe: []string{"მესხიშვილის ქ."},
+			Status:      outage.StatusActive,
+			Source:      outage.SourceManual,
+			Reporter:    "nino",
+		}
+		if err := s.SaveManualOutage(ctx, manual); err != nil {
+			t.Fatal(err)
+		}
+		manual.Status = outage.StatusClosed
+		manual.End = testNow.Add(time.Hour)
+		if err := s.SaveManualOutage(ctx, manual); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.GetManualOutage(ctx, "3f2a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, manual, got)
+		all, err := s.GetManualOutages(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []outage.Outage{manual}, all)
+	})
+	t.Run("crowd reports", func(t *testing.T) {
+		reports := []outage.CrowdReport{
+			{OutageRef: "manual/3f2a", Reporter: "bot:1", Status: outage.ReportStillOff, ReportedAt: testNow},
+			{OutageRef: "manual/3f2a", Reporter: "bot:2", Address: "მესხიშვილის ქ.", Status: outage.ReportRestored, ReportedAt: testNow.Add(time.Millisecond)},
+		}
+		for _, r := range reports {
+			if err := s.SaveCrowdReport(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := s.GetCrowdReports(ctx, "manual/3f2a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, reports, got)
+	})
+	t.Run("revisions", func(t *testing.T) {
+		o := outage.Outage{
+			ProviderId:  "water.gov.ge",
+			Kind:        outage.KindWater,
+			Start:       testNow,
+			End:         testNow.Add(6 * time.Hour),
+			Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+			AddressesGe: []string{"ოზურგეთი გურიის ქ."},
+			Status:      outage.StatusActive,
+			Source:      outage.SourceOfficial,
+		}
+		first := outage.Revision{OutageRef: o.Ref(), ObservedAt: testNow, Outage: o}
+		o.End = o.End.Add(2 * time.Hour)
+		second := outage.Revision{OutageRef: o.Ref(), ObservedAt: testNow.Add(time.Hour), Changed: []string{"end"}, Outage: o}
+		// The second one is delivered again, as a stream may.
+		for _, r := range []outage.Revision{first, second, second} {
+			if err := s.SaveRevision(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := s.GetRevisions(ctx, o.Ref())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []outage.Revision{first, second}, got)
+		asOf, err := s.GetRevisionsAsOf(ctx, "water.gov.ge", "ozurgetis", testNow.Add(30*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []outage.Revision{first}, asOf)
+		asOf, err = s.GetRevisionsAsOf(ctx, "water.gov.ge", "ozurgetis", testNow.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []outage.Revision{second}, asOf)
+	})
+	t.Run("outbox", func(t *testing.T) {
+		o := outage.Outage{
+			ProviderId: "water.gov.ge",
+			Kind:       outage.KindWater,
+			Start:      testNow.Add(2 * time.Hour),
+			End:        testNow.Add(6 * time.Hour),
+			Location:   outage.Location{Id: "9", TitleGe: "ბათუმის", TitleLat: "batumis"},
+			Status:     outage.StatusActive,
+			Source:     outage.SourceOfficial,
+		}
+		n, err := outage.NewNotification(outage.Revision{}, outage.Revision{OutageRef: o.Ref(), ObservedAt: testNow, Outage: o}, testNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := s.SaveOutagesNotifying(ctx, []outage.Outage{o}, []outage.Notification{n}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		outages, err := s.GetOutages(ctx, "water.gov.ge", "batumis")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, outages, 1)
+		claimed, err := s.ClaimNotifications(ctx, "a", testNow, testNow.Add(time.Minute), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []outage.Notification{n}, claimed)
+		claimed, err = s.ClaimNotifications(ctx, "b", testNow, testNow.Add(time.Minute), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, claimed)
+		if err := s.RetryNotification(ctx, n.Id, testNow.Add(time.Minute), "receiver is down"); err != nil {
+			t.Fatal(err)
+		}
+		claimed, err = s.ClaimNotifications(ctx, "b", testNow.Add(time.Minute), testNow.Add(2*time.Minute), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Attempts, n.NextAttemptAt, n.LastError = 1, testNow.Add(time.Minute), "receiver is down"
+		assert.Equal(t, []outage.Notification{n}, claimed)
+		if err := s.CompleteNotification(ctx, n.Id, testNow.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		claimed, err = s.ClaimNotifications(ctx, "b", testNow.Add(time.Hour), testNow.Add(2*time.Hour), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, claimed)
+		assert.ErrorIs(t, s.CompleteNotification(ctx, "missing", testNow), outage.ErrNoNotification)
+	})
+	t.Run("leases", func(t *testing.T) {
+		testLeases(t, s)
+	})
+	t.Run("runs", func(t *testing.T) {
+		testRuns(t, s)
+		testRunsKept(t, s)
+	})
+}
+
+// testLeases runs against every backend: a lease is exclusive until it
+// expires or is released, and renewable by its owner.
+func testLeases(t *testing.T, leases outage.Leases) {
+	ctx := context.Background()
+	acquire := func(owner string, now time.Time) bool {
+		t.Helper()
+		acquired, err := leases.AcquireLease(ctx, "leader", owner, now, now.Add(15*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return acquired
+	}
+	assert.True(t, acquire("a", testNow))
+	assert.False(t, acquire("b", testNow.Add(5*time.Second)))
+	assert.True(t, acquire("a", testNow.Add(10*time.Second)), "the owner renews")
+	assert.False(t, acquire("b", testNow.Add(20*time.Second)), "the renewal moved the expiry")
+	assert.True(t, acquire("b", testNow.Add(25*time.Second)), "an expired lease is taken over")
+	if err := leases.ReleaseLease(ctx, "leader", "a"); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, acquire("a", testNow.Add(30*time.Second)), "only the owner releases")
+	if err := leases.ReleaseLease(ctx, "leader", "b"); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, acquire("a", testNow.Add(30*time.Second)))
+}
+
+type outageStore interface {
+	SaveOutages(ctx context.Context, outages ...outage.Outage) error
+	GetOutages(ctx context.Context, providerId, titleLat string) ([]outage.Outage, error)
+	GetOutage(ctx context.Context, providerId, titleLat string, start time.Time, key string) (outage.Outage, error)
+	GetCurrentOutages(ctx context.Context, providerId string, kind outage.Kind) ([]outage.Outage, error)
+	GetOutagesPage(ctx context.Context, providerId, cursor string, limit int) ([]outage.Outage, string, error)
+	GetOutagesStartedBetween(ctx context.Context, providerId string, from, to time.Time) ([]outage.Outage, error)
+}
+
+// testSameStart runs against every backend: two rows a provider lists for
+// one district with the same start are kept apart by their key.
+func testSameStart(t *testing.T, store outageStore, providerId string) {
+	ctx := context.Background()
+	first := outage.Outage{
+		ProviderId:  providerId,
+		Kind:        outage.KindElectricity,
+		Start:       testNow.Add(time.Hour),
+		End:         testNow.Add(5 * time.Hour),
+		Location:    outage.Location{Id: "gldanis", TitleGe: "გლდანის", TitleLat: "gldanis"},
+		AddressesGe: []string{"გლდანი ხიზანიშვილის ქ."},
+		Status:      outage.StatusAnnounced,
+		Source:      outage.SourceOfficial,
+	}
+	second := first
+	second.AddressesGe = []string{"გლდანი ვეკუას ქ.", "გლდანი ბოჭორიშვილის ქ."}
+	second.AffectedCustomers = 300
+	first.Key, second.Key = outage.AddressKey(first.AddressesGe), outage.AddressKey(second.AddressesGe)
+	if err := store.SaveOutages(ctx, first, second); err != nil {
+		t.Fatal(err)
+	}
+	second.AffectedCustomers = 350
+	if err := store.SaveOutages(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	outages, err := store.GetOutages(ctx, providerId, "gldanis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(outages, func(i, j int) bool {
+		return outages[i].Key < outages[j].Key
+	})
+	want := []outage.Outage{first, second}
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].Key < want[j].Key
+	})
+	assert.Equal(t, want, outages)
+	assert.NotEqual(t, first.Ref(), second.Ref())
+	got, err := store.GetOutage(ctx, providerId, "gldanis", second.Start, second.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, second, got)
+	_, err = store.GetOutage(ctx, providerId, "gldanis", second.Start, "missing")
+	assert.ErrorIs(t, err, outage.ErrNotFound)
+}
+
+// testNoEnd runs against every backend: an outage without an end is
+// ongoing until a refresh gives it one.
+func testNoEnd(t *testing.T, store outageStore, providerId string) {
+	ctx := context.Background()
+	o := outage.Outage{
+		ProviderId:  providerId,
+		Kind:        outage.KindGas,
+		Start:       testNow.Add(-2 * time.Hour),
+		Location:    outage.Location{Id: "isnis", TitleGe: "ისნის", TitleLat: "isnis"},
+		AddressesGe: []string{"ისანი ქეთევან დედოფლის გამზ."},
+		Status:      outage.StatusActive,
+		Source:      outage.SourceOfficial,
+	}
+	if err := store.SaveOutages(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	outages, err := store.GetOutages(ctx, providerId, "isnis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Outage{o}, outages)
+	outages, err = store.GetCurrentOutages(ctx, providerId, outage.KindGas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Outage{o}, outages)
+	o.End = testNow.Add(-time.Hour)
+	if err := store.SaveOutages(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	outages, err = store.GetOutages(ctx, providerId, "isnis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, outages)
+	outages, err = store.GetCurrentOutages(ctx, providerId, outage.KindGas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, outages)
+}
+
+// testOtherZones runs against every backend with a clock west of UTC and
+// outages in Tbilisi time: they end at the same instant, whatever the zones.
+func testOtherZones(t *testing.T, withNow func(now func() time.Time) outageStore, providerId string) {
+	ctx := context.Background()
+	now := testNow.In(time.FixedZone("EDT", -4*60*60))
+	store := withNow(func() time.Time {
+		return now
+	})
+	tbilisi := time.FixedZone("GET", 4*60*60)
+	ended := outage.Outage{
+		ProviderId: providerId,
+		Kind:       outage.KindWater,
+		Start:      now.Add(-5 * time.Hour).In(tbilisi),
+		End:        now.Add(-2 * time.Hour).In(tbilisi),
+		Location:   outage.Location{Id: "3", TitleGe: "ბათუმის", TitleLat: "batumis"},
+		Status:     outage.StatusActive,
+		Source:     outage.SourceOfficial,
+	}
+	ongoing := ended
+	ongoing.Start = now.Add(-time.Hour).In(tbilisi)
+	ongoing.End = now.Add(2 * time.Hour).In(tbilisi)
+	if err := store.SaveOutages(ctx, ended, ongoing); err != nil {
+		t.Fatal(err)
+	}
+	refs := func(outages []outage.Outage) []string {
+		return lo.Map(outages, func(o outage.Outage, _ int) string {
+			return o.Ref()
+		})
+	}
+	outages, err := store.GetOutages(ctx, providerId, "batumis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{ongoing.Ref()}, refs(outages))
+	outages, err = store.GetCurrentOutages(ctx, providerId, outage.KindWater)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{ongoing.Ref()}, refs(outages))
+	outages, err = store.GetOutagesStartedBetween(ctx, providerId, now.Add(-90*time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{ongoing.Ref()}, refs(outages))
+}
+
+// testOutagesPage runs against every backend: following the cursors reads
+// every outage of a provider once, ended or not.
+func testOutagesPage(t *testing.T, store outageStore, providerId string) {
+	ctx := context.Background()
+	var saved []string
+	for i := 0; i < 5; i++ {
+		o := outage.Outage{
+			ProviderId:  providerId,
+			Kind:        outage.KindWater,
+			Start:       testNow.Add(time.Duration(i-3) * 24 * time.Hour),
+			End:         testNow.Add(time.Duration(i-3)*24*time.Hour + 6*time.Hour),
+			Location:    outage.Location{Id: "7", TitleGe: "ოზურგეთის", TitleLat: "ozurgetis"},
+			AddressesGe: []string{"ოზურგეთი ე.თაყაიშვილის ქ."},
+			Status:      outage.StatusActive,
+			Source:      outage.SourceOfficial,
+		}
+		if err := store.SaveOutages(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, o.Ref())
+	}
+	var (
+		read   []string
+		cursor string
+	)
+	for pages := 1; ; pages++ {
+		outages, next, err := store.GetOutagesPage(ctx, providerId, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.LessOrEqual(t, len(outages), 2)
+		for _, o := range outages {
+			read = append(read, o.Ref())
+			assert.Equal(t, []string{"ოზურგეთი ე.თაყაიშვილის ქ."}, o.AddressesGe)
+		}
+		if next == "" {
+			break
+		}
+		if pages > len(saved) {
+			t.Fatal("pages do not end")
+		}
+		cursor = next
+	}
+	assert.ElementsMatch(t, saved, read)
+}
+
+type runJournal interface {
+	SaveRun(ctx context.Context, r outage.Run) error
+	GetRuns(ctx context.Context, providerId string, limit int) ([]outage.Run, error)
+	RequestRefresh(ctx context.Context, providerId string, at time.Time) error
+	TakeRefreshRequest(ctx context.Context, providerId string) (bool, error)
+}
+
+// testRuns runs against every backend: runs read back newest first, per
+// provider and up to the limit, and refresh requests are taken once however
+// many times they were made.
+func testRuns(t *testing.T, journal runJournal) {
+	ctx := context.Background()
+	ok := outage.Run{
+		ProviderId: "water.gov.ge",
+		Reason:     outage.ReasonStartup,
+		StartedAt:  testNow,
+		EndedAt:    testNow.Add(3 * time.Second),
+		Pages:      4,
+		Parsed:     12,
+		Saved:      12,
+	}
+	failed := outage.Run{
+		ProviderId: "water.gov.ge",
+		Reason:     outage.ReasonSchedule,
+		StartedAt:  testNow.Add(time.Hour),
+		EndedAt:    testNow.Add(time.Hour + time.Second),
+		Pages:      1,
+		Errors:     []string{"fetch html file: connection refused"},
+	}
+	other := outage.Run{ProviderId: "telasi.ge", Reason: outage.ReasonTrigger, StartedAt: testNow, EndedAt: testNow}
+	for _, r := range []outage.Run{ok, failed, other} {
+		if err := journal.SaveRun(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := journal.GetRuns(ctx, "water.gov.ge", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Run{failed, ok}, runs)
+	runs, err = journal.GetRuns(ctx, "water.gov.ge", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []outage.Run{failed}, runs)
+	runs, err = journal.GetRuns(ctx, "missing", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, runs)
+
+	for _, at := range []time.Time{testNow, testNow.Add(time.Second)} {
+		if err := journal.RequestRefresh(ctx, "water.gov.ge", at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []bool{true, false} {
+		taken, err := journal.TakeRefreshRequest(ctx, "water.gov.ge")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, taken)
+	}
+	taken, err := journal.TakeRefreshRequest(ctx, "telasi.ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, taken)
+}
+
+// testRunsKept runs against the backends that cap the journal: once a
+// provider has more than runsKept runs, the oldest are gone.
+func testRunsKept(t *testing.T, journal runJournal) {
+	ctx := context.Background()
+	for i := 0; i < runsKept+2; i++ {
+		started := testNow.Add(time.Duration(i) * time.Minute)
+		if err := journal.SaveRun(ctx, outage.Run{ProviderId: "kept", Reason: outage.ReasonSchedule, StartedAt: started, EndedAt: started}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := journal.GetRuns(ctx, "kept", runsKept+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, runs, runsKept)
+	assert.Equal(t, testNow.Add((runsKept+1)*time.Minute), runs[0].StartedAt)
+	assert.Equal(t, testNow.Add(2*time.Minute), runs[len(runs)-1].StartedAt)
+}
+
+type centerStore interface {
+	SaveCenters(ctx context.Context, centers ...outage.Center) error
+	GetCenters(ctx context.Context, providerId string) ([]outage.Center, error)
+	GetCenterHistory(ctx context.Context, providerId, locationId string) ([]outage.CenterStatus, error)
+}
+
+// testCenters runs against every backend with a clock that moves an hour
+// between saves: a center keeps the time it was first seen, moves the time
+// it was last seen, and gains history only when its problem flag flips. The
+// first save reads the clock in Tbilisi time, which must not change the
+// order of the history.
+func testCenters(t *testing.T, withNow func(now func() time.Time) centerStore) {
+	ctx := context.Background()
+	at := testNow
+	store := withNow(func() time.Time {
+		return at
+	})
+	center := outage.Center{
+		ProviderId: "gwp.ge",
+		Location:   outage.Location{Id: "12", TitleGe: "გლდანის", TitleLat: "gldanis"},
+	}
+	for i, problem := range []bool{false, false, true, true, false} {
+		at = testNow.Add(time.Duration(i) * time.Hour)
+		if i == 0 {
+			at = at.In(time.FixedZone("GET", 4*60*60))
+		}
+		center.Problem = problem
+		if err := store.SaveCenters(ctx, center); err != nil {
+			t.Fatal(err)
+		}
+	}
+	centers, err := store.GetCenters(ctx, "gwp.ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range centers {
+		centers[i].FirstSeen, centers[i].LastSeen = centers[i].FirstSeen.UTC(), centers[i].LastSeen.UTC()
+	}
+	center.FirstSeen, center.LastSeen = testNow, testNow.Add(4*time.Hour)
+	assert.Equal(t, []outage.Center{center}, centers)
+	history, err := store.GetCenterHistory(ctx, "gwp.ge", "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range history {
+		history[i].ObservedAt = history[i].ObservedAt.UTC()
+	}
+	assert.Equal(t, []outage.CenterStatus{
+		{LocationId: "12", Problem: false, ObservedAt: testNow},
+		{LocationId: "12", Problem: true, ObservedAt: testNow.Add(2 * time.Hour)},
+		{LocationId: "12", Problem: false, ObservedAt: testNow.Add(4 * time.Hour)},
+	}, history)
+}
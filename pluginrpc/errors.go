@@ -0,0 +1,9 @@
+package pluginrpc
+
+type errorProtocol string
+
+func (e errorProtocol) Error() string {
+	return string(e)
+}
+
+const errVersionMismatch errorProtocol = "protocol version mismatch"
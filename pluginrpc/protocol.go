@@ -0,0 +1,73 @@
+// Package pluginrpc is the protocol between the outage monitor and
+// out-of-process providers. The monitor launches the provider binary and
+// speaks JSON-RPC 1.0 (net/rpc/jsonrpc) over its stdin and stdout, or dials
+// it over TCP. Providers written in Go call Serve; other languages only need
+// to answer the Provider.* methods below with the same JSON shapes.
+//
+// A session starts with Provider.Handshake, which carries the protocol
+// version of the monitor and returns the Capabilities of the provider.
+// Provider.Health is called before every refresh and Provider.GetOutages
+// returns the current outages. Providers must log to stderr: stdout belongs
+// to the protocol.
+package pluginrpc
+
+import "time"
+
+const ProtocolVersion = 1
+
+const (
+	MethodHandshake  = "Provider.Handshake"
+	MethodHealth     = "Provider.Health"
+	MethodGetOutages = "Provider.GetOutages"
+)
+
+type HandshakeArgs struct {
+	ProtocolVersion int `json:"protocolVersion"`
+}
+
+// Capabilities describe the provider to the monitor. Kind is one of water,
+// electricity or gas. RefreshInterval is a Go duration such as "30m"; the
+// monitor falls back to its own default when it is empty.
+type Capabilities struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Id              string `json:"id"`
+	Kind            string `json:"kind"`
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+}
+
+type HealthArgs struct{}
+
+type HealthReply struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+type GetOutagesArgs struct{}
+
+type GetOutagesReply struct {
+	Outages []Outage `json:"outages"`
+}
+
+type Location struct {
+	Id       string `json:"id"`
+	TitleGe  string `json:"titleGe"`
+	TitleLat string `json:"titleLat"`
+	Lat      string `json:"lat,omitempty"`
+	Lng      string `json:"lng,omitempty"`
+}
+
+// Outage mirrors the monitor's outage model. Status is "active" or
+// "announced"; when empty the monitor derives it from Start. Key tells apart
+// outages at one location with the same start; when empty the monitor uses
+// a hash of the addresses.
+type Outage struct {
+	Key               string            `json:"key,omitempty"`
+	Start             time.Time         `json:"start"`
+	End               time.Time         `json:"end"`
+	AffectedCustomers int               `json:"affectedCustomers,omitempty"`
+	Location          Location          `json:"location"`
+	AddressesGe       []string          `json:"addressesGe"`
+	Status            string            `json:"status,omitempty"`
+	AnnouncementURI   string            `json:"announcementUri,omitempty"`
+	Extra             map[string]string `json:"extra,omitempty"`
+}
@@ -0,0 +1,83 @@
+package pluginrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+)
+
+// Provider is implemented by out-of-process providers written in Go.
+type Provider interface {
+	Capabilities() Capabilities
+	Health(ctx context.Context) error
+	GetOutages(ctx context.Context) ([]Outage, error)
+}
+
+type service struct {
+	ctx context.Context
+	p   Provider
+}
+
+func (s service) Handshake(args HandshakeArgs, reply *Capabilities) error {
+	caps := s.p.Capabilities()
+	caps.ProtocolVersion = ProtocolVersion
+	if args.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("%w: monitor speaks %d, provider speaks %d", errVersionMismatch, args.ProtocolVersion, ProtocolVersion)
+	}
+	*reply = caps
+	return nil
+}
+
+func (s service) Health(args HealthArgs, reply *HealthReply) error {
+	if err := s.p.Health(s.ctx); err != nil {
+		*reply = HealthReply{Message: err.Error()}
+		return nil
+	}
+	*reply = HealthReply{Healthy: true}
+	return nil
+}
+
+func (s service) GetOutages(args GetOutagesArgs, reply *GetOutagesReply) error {
+	outages, err := s.p.GetOutages(s.ctx)
+	if err != nil {
+		return err
+	}
+	*reply = GetOutagesReply{outages}
+	return nil
+}
+
+// Serve answers the monitor on conn until it hangs up.
+func Serve(ctx context.Context, p Provider, conn io.ReadWriteCloser) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Provider", service{ctx, p}); err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+	srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+// ServeStdio answers the monitor that launched this process.
+func ServeStdio(ctx context.Context, p Provider) error {
+	return Serve(ctx, p, NewStdioConn(os.Stdin, os.Stdout))
+}
+
+type stdioConn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+// NewStdioConn joins the two halves of a pipe into one connection.
+func NewStdioConn(r io.ReadCloser, w io.WriteCloser) io.ReadWriteCloser {
+	return stdioConn{r, w}
+}
+
+func (c stdioConn) Close() error {
+	rerr := c.ReadCloser.Close()
+	if err := c.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return rerr
+}